@@ -0,0 +1,679 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: dwh/v1/dwh.proto
+
+package dwhv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	DataWarehouse_CreateService_FullMethodName         = "/dwh.v1.DataWarehouse/CreateService"
+	DataWarehouse_GetService_FullMethodName            = "/dwh.v1.DataWarehouse/GetService"
+	DataWarehouse_ListServices_FullMethodName          = "/dwh.v1.DataWarehouse/ListServices"
+	DataWarehouse_UpdateService_FullMethodName         = "/dwh.v1.DataWarehouse/UpdateService"
+	DataWarehouse_DeleteService_FullMethodName         = "/dwh.v1.DataWarehouse/DeleteService"
+	DataWarehouse_CreateMetric_FullMethodName          = "/dwh.v1.DataWarehouse/CreateMetric"
+	DataWarehouse_GetMetric_FullMethodName             = "/dwh.v1.DataWarehouse/GetMetric"
+	DataWarehouse_ListMetrics_FullMethodName           = "/dwh.v1.DataWarehouse/ListMetrics"
+	DataWarehouse_UpdateMetric_FullMethodName          = "/dwh.v1.DataWarehouse/UpdateMetric"
+	DataWarehouse_DeleteMetric_FullMethodName          = "/dwh.v1.DataWarehouse/DeleteMetric"
+	DataWarehouse_CreateEvent_FullMethodName           = "/dwh.v1.DataWarehouse/CreateEvent"
+	DataWarehouse_StreamEvents_FullMethodName          = "/dwh.v1.DataWarehouse/StreamEvents"
+	DataWarehouse_GetMetricValues_FullMethodName       = "/dwh.v1.DataWarehouse/GetMetricValues"
+	DataWarehouse_AggregateMetricValues_FullMethodName = "/dwh.v1.DataWarehouse/AggregateMetricValues"
+)
+
+// DataWarehouseClient is the client API for DataWarehouse service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DataWarehouseClient interface {
+	CreateService(ctx context.Context, in *CreateServiceRequest, opts ...grpc.CallOption) (*Service, error)
+	GetService(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*Service, error)
+	ListServices(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListServicesResponse, error)
+	UpdateService(ctx context.Context, in *UpdateServiceRequest, opts ...grpc.CallOption) (*Service, error)
+	DeleteService(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteServiceResponse, error)
+	CreateMetric(ctx context.Context, in *CreateMetricRequest, opts ...grpc.CallOption) (*Metric, error)
+	GetMetric(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*Metric, error)
+	ListMetrics(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error)
+	UpdateMetric(ctx context.Context, in *UpdateMetricRequest, opts ...grpc.CallOption) (*Metric, error)
+	DeleteMetric(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteMetricResponse, error)
+	CreateEvent(ctx context.Context, in *CreateEventRequest, opts ...grpc.CallOption) (*Event, error)
+	StreamEvents(ctx context.Context, opts ...grpc.CallOption) (DataWarehouse_StreamEventsClient, error)
+	GetMetricValues(ctx context.Context, in *GetMetricValuesRequest, opts ...grpc.CallOption) (DataWarehouse_GetMetricValuesClient, error)
+	AggregateMetricValues(ctx context.Context, in *AggregateMetricValuesRequest, opts ...grpc.CallOption) (DataWarehouse_AggregateMetricValuesClient, error)
+}
+
+type dataWarehouseClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDataWarehouseClient(cc grpc.ClientConnInterface) DataWarehouseClient {
+	return &dataWarehouseClient{cc}
+}
+
+func (c *dataWarehouseClient) CreateService(ctx context.Context, in *CreateServiceRequest, opts ...grpc.CallOption) (*Service, error) {
+	out := new(Service)
+	err := c.cc.Invoke(ctx, DataWarehouse_CreateService_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataWarehouseClient) GetService(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*Service, error) {
+	out := new(Service)
+	err := c.cc.Invoke(ctx, DataWarehouse_GetService_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataWarehouseClient) ListServices(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListServicesResponse, error) {
+	out := new(ListServicesResponse)
+	err := c.cc.Invoke(ctx, DataWarehouse_ListServices_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataWarehouseClient) UpdateService(ctx context.Context, in *UpdateServiceRequest, opts ...grpc.CallOption) (*Service, error) {
+	out := new(Service)
+	err := c.cc.Invoke(ctx, DataWarehouse_UpdateService_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataWarehouseClient) DeleteService(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteServiceResponse, error) {
+	out := new(DeleteServiceResponse)
+	err := c.cc.Invoke(ctx, DataWarehouse_DeleteService_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataWarehouseClient) CreateMetric(ctx context.Context, in *CreateMetricRequest, opts ...grpc.CallOption) (*Metric, error) {
+	out := new(Metric)
+	err := c.cc.Invoke(ctx, DataWarehouse_CreateMetric_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataWarehouseClient) GetMetric(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*Metric, error) {
+	out := new(Metric)
+	err := c.cc.Invoke(ctx, DataWarehouse_GetMetric_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataWarehouseClient) ListMetrics(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error) {
+	out := new(ListMetricsResponse)
+	err := c.cc.Invoke(ctx, DataWarehouse_ListMetrics_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataWarehouseClient) UpdateMetric(ctx context.Context, in *UpdateMetricRequest, opts ...grpc.CallOption) (*Metric, error) {
+	out := new(Metric)
+	err := c.cc.Invoke(ctx, DataWarehouse_UpdateMetric_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataWarehouseClient) DeleteMetric(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteMetricResponse, error) {
+	out := new(DeleteMetricResponse)
+	err := c.cc.Invoke(ctx, DataWarehouse_DeleteMetric_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataWarehouseClient) CreateEvent(ctx context.Context, in *CreateEventRequest, opts ...grpc.CallOption) (*Event, error) {
+	out := new(Event)
+	err := c.cc.Invoke(ctx, DataWarehouse_CreateEvent_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataWarehouseClient) StreamEvents(ctx context.Context, opts ...grpc.CallOption) (DataWarehouse_StreamEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &DataWarehouse_ServiceDesc.Streams[0], DataWarehouse_StreamEvents_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &dataWarehouseStreamEventsClient{stream}
+	return x, nil
+}
+
+type DataWarehouse_StreamEventsClient interface {
+	Send(*CreateEventRequest) error
+	CloseAndRecv() (*StreamEventsResponse, error)
+	grpc.ClientStream
+}
+
+type dataWarehouseStreamEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *dataWarehouseStreamEventsClient) Send(m *CreateEventRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *dataWarehouseStreamEventsClient) CloseAndRecv() (*StreamEventsResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(StreamEventsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *dataWarehouseClient) GetMetricValues(ctx context.Context, in *GetMetricValuesRequest, opts ...grpc.CallOption) (DataWarehouse_GetMetricValuesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &DataWarehouse_ServiceDesc.Streams[1], DataWarehouse_GetMetricValues_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &dataWarehouseGetMetricValuesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type DataWarehouse_GetMetricValuesClient interface {
+	Recv() (*MetricValue, error)
+	grpc.ClientStream
+}
+
+type dataWarehouseGetMetricValuesClient struct {
+	grpc.ClientStream
+}
+
+func (x *dataWarehouseGetMetricValuesClient) Recv() (*MetricValue, error) {
+	m := new(MetricValue)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *dataWarehouseClient) AggregateMetricValues(ctx context.Context, in *AggregateMetricValuesRequest, opts ...grpc.CallOption) (DataWarehouse_AggregateMetricValuesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &DataWarehouse_ServiceDesc.Streams[2], DataWarehouse_AggregateMetricValues_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &dataWarehouseAggregateMetricValuesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type DataWarehouse_AggregateMetricValuesClient interface {
+	Recv() (*AggregatedMetric, error)
+	grpc.ClientStream
+}
+
+type dataWarehouseAggregateMetricValuesClient struct {
+	grpc.ClientStream
+}
+
+func (x *dataWarehouseAggregateMetricValuesClient) Recv() (*AggregatedMetric, error) {
+	m := new(AggregatedMetric)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DataWarehouseServer is the server API for DataWarehouse service.
+// All implementations must embed UnimplementedDataWarehouseServer
+// for forward compatibility
+type DataWarehouseServer interface {
+	CreateService(context.Context, *CreateServiceRequest) (*Service, error)
+	GetService(context.Context, *Ref) (*Service, error)
+	ListServices(context.Context, *ListRequest) (*ListServicesResponse, error)
+	UpdateService(context.Context, *UpdateServiceRequest) (*Service, error)
+	DeleteService(context.Context, *DeleteRequest) (*DeleteServiceResponse, error)
+	CreateMetric(context.Context, *CreateMetricRequest) (*Metric, error)
+	GetMetric(context.Context, *Ref) (*Metric, error)
+	ListMetrics(context.Context, *ListRequest) (*ListMetricsResponse, error)
+	UpdateMetric(context.Context, *UpdateMetricRequest) (*Metric, error)
+	DeleteMetric(context.Context, *DeleteRequest) (*DeleteMetricResponse, error)
+	CreateEvent(context.Context, *CreateEventRequest) (*Event, error)
+	StreamEvents(DataWarehouse_StreamEventsServer) error
+	GetMetricValues(*GetMetricValuesRequest, DataWarehouse_GetMetricValuesServer) error
+	AggregateMetricValues(*AggregateMetricValuesRequest, DataWarehouse_AggregateMetricValuesServer) error
+	mustEmbedUnimplementedDataWarehouseServer()
+}
+
+// UnimplementedDataWarehouseServer must be embedded to have forward compatible implementations.
+type UnimplementedDataWarehouseServer struct {
+}
+
+func (UnimplementedDataWarehouseServer) CreateService(context.Context, *CreateServiceRequest) (*Service, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateService not implemented")
+}
+func (UnimplementedDataWarehouseServer) GetService(context.Context, *Ref) (*Service, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetService not implemented")
+}
+func (UnimplementedDataWarehouseServer) ListServices(context.Context, *ListRequest) (*ListServicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListServices not implemented")
+}
+func (UnimplementedDataWarehouseServer) UpdateService(context.Context, *UpdateServiceRequest) (*Service, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateService not implemented")
+}
+func (UnimplementedDataWarehouseServer) DeleteService(context.Context, *DeleteRequest) (*DeleteServiceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteService not implemented")
+}
+func (UnimplementedDataWarehouseServer) CreateMetric(context.Context, *CreateMetricRequest) (*Metric, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateMetric not implemented")
+}
+func (UnimplementedDataWarehouseServer) GetMetric(context.Context, *Ref) (*Metric, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetric not implemented")
+}
+func (UnimplementedDataWarehouseServer) ListMetrics(context.Context, *ListRequest) (*ListMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMetrics not implemented")
+}
+func (UnimplementedDataWarehouseServer) UpdateMetric(context.Context, *UpdateMetricRequest) (*Metric, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateMetric not implemented")
+}
+func (UnimplementedDataWarehouseServer) DeleteMetric(context.Context, *DeleteRequest) (*DeleteMetricResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMetric not implemented")
+}
+func (UnimplementedDataWarehouseServer) CreateEvent(context.Context, *CreateEventRequest) (*Event, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateEvent not implemented")
+}
+func (UnimplementedDataWarehouseServer) StreamEvents(DataWarehouse_StreamEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedDataWarehouseServer) GetMetricValues(*GetMetricValuesRequest, DataWarehouse_GetMetricValuesServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetMetricValues not implemented")
+}
+func (UnimplementedDataWarehouseServer) AggregateMetricValues(*AggregateMetricValuesRequest, DataWarehouse_AggregateMetricValuesServer) error {
+	return status.Errorf(codes.Unimplemented, "method AggregateMetricValues not implemented")
+}
+func (UnimplementedDataWarehouseServer) mustEmbedUnimplementedDataWarehouseServer() {}
+
+// UnsafeDataWarehouseServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DataWarehouseServer will
+// result in compilation errors.
+type UnsafeDataWarehouseServer interface {
+	mustEmbedUnimplementedDataWarehouseServer()
+}
+
+func RegisterDataWarehouseServer(s grpc.ServiceRegistrar, srv DataWarehouseServer) {
+	s.RegisterService(&DataWarehouse_ServiceDesc, srv)
+}
+
+func _DataWarehouse_CreateService_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataWarehouseServer).CreateService(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataWarehouse_CreateService_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataWarehouseServer).CreateService(ctx, req.(*CreateServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataWarehouse_GetService_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataWarehouseServer).GetService(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataWarehouse_GetService_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataWarehouseServer).GetService(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataWarehouse_ListServices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataWarehouseServer).ListServices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataWarehouse_ListServices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataWarehouseServer).ListServices(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataWarehouse_UpdateService_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataWarehouseServer).UpdateService(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataWarehouse_UpdateService_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataWarehouseServer).UpdateService(ctx, req.(*UpdateServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataWarehouse_DeleteService_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataWarehouseServer).DeleteService(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataWarehouse_DeleteService_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataWarehouseServer).DeleteService(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataWarehouse_CreateMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateMetricRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataWarehouseServer).CreateMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataWarehouse_CreateMetric_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataWarehouseServer).CreateMetric(ctx, req.(*CreateMetricRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataWarehouse_GetMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataWarehouseServer).GetMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataWarehouse_GetMetric_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataWarehouseServer).GetMetric(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataWarehouse_ListMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataWarehouseServer).ListMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataWarehouse_ListMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataWarehouseServer).ListMetrics(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataWarehouse_UpdateMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateMetricRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataWarehouseServer).UpdateMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataWarehouse_UpdateMetric_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataWarehouseServer).UpdateMetric(ctx, req.(*UpdateMetricRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataWarehouse_DeleteMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataWarehouseServer).DeleteMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataWarehouse_DeleteMetric_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataWarehouseServer).DeleteMetric(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataWarehouse_CreateEvent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateEventRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataWarehouseServer).CreateEvent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataWarehouse_CreateEvent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataWarehouseServer).CreateEvent(ctx, req.(*CreateEventRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataWarehouse_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DataWarehouseServer).StreamEvents(&dataWarehouseStreamEventsServer{stream})
+}
+
+type DataWarehouse_StreamEventsServer interface {
+	SendAndClose(*StreamEventsResponse) error
+	Recv() (*CreateEventRequest, error)
+	grpc.ServerStream
+}
+
+type dataWarehouseStreamEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *dataWarehouseStreamEventsServer) SendAndClose(m *StreamEventsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *dataWarehouseStreamEventsServer) Recv() (*CreateEventRequest, error) {
+	m := new(CreateEventRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _DataWarehouse_GetMetricValues_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetMetricValuesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DataWarehouseServer).GetMetricValues(m, &dataWarehouseGetMetricValuesServer{stream})
+}
+
+type DataWarehouse_GetMetricValuesServer interface {
+	Send(*MetricValue) error
+	grpc.ServerStream
+}
+
+type dataWarehouseGetMetricValuesServer struct {
+	grpc.ServerStream
+}
+
+func (x *dataWarehouseGetMetricValuesServer) Send(m *MetricValue) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _DataWarehouse_AggregateMetricValues_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(AggregateMetricValuesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DataWarehouseServer).AggregateMetricValues(m, &dataWarehouseAggregateMetricValuesServer{stream})
+}
+
+type DataWarehouse_AggregateMetricValuesServer interface {
+	Send(*AggregatedMetric) error
+	grpc.ServerStream
+}
+
+type dataWarehouseAggregateMetricValuesServer struct {
+	grpc.ServerStream
+}
+
+func (x *dataWarehouseAggregateMetricValuesServer) Send(m *AggregatedMetric) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// DataWarehouse_ServiceDesc is the grpc.ServiceDesc for DataWarehouse service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DataWarehouse_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "dwh.v1.DataWarehouse",
+	HandlerType: (*DataWarehouseServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateService",
+			Handler:    _DataWarehouse_CreateService_Handler,
+		},
+		{
+			MethodName: "GetService",
+			Handler:    _DataWarehouse_GetService_Handler,
+		},
+		{
+			MethodName: "ListServices",
+			Handler:    _DataWarehouse_ListServices_Handler,
+		},
+		{
+			MethodName: "UpdateService",
+			Handler:    _DataWarehouse_UpdateService_Handler,
+		},
+		{
+			MethodName: "DeleteService",
+			Handler:    _DataWarehouse_DeleteService_Handler,
+		},
+		{
+			MethodName: "CreateMetric",
+			Handler:    _DataWarehouse_CreateMetric_Handler,
+		},
+		{
+			MethodName: "GetMetric",
+			Handler:    _DataWarehouse_GetMetric_Handler,
+		},
+		{
+			MethodName: "ListMetrics",
+			Handler:    _DataWarehouse_ListMetrics_Handler,
+		},
+		{
+			MethodName: "UpdateMetric",
+			Handler:    _DataWarehouse_UpdateMetric_Handler,
+		},
+		{
+			MethodName: "DeleteMetric",
+			Handler:    _DataWarehouse_DeleteMetric_Handler,
+		},
+		{
+			MethodName: "CreateEvent",
+			Handler:    _DataWarehouse_CreateEvent_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _DataWarehouse_StreamEvents_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "GetMetricValues",
+			Handler:       _DataWarehouse_GetMetricValues_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "AggregateMetricValues",
+			Handler:       _DataWarehouse_AggregateMetricValues_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "dwh/v1/dwh.proto",
+}
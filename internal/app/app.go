@@ -7,7 +7,13 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/AnatoliyBr/dwh-service/internal/controller/alerting"
 	"github.com/AnatoliyBr/dwh-service/internal/controller/apiserver"
+	"github.com/AnatoliyBr/dwh-service/internal/controller/grpcserver"
+	"github.com/AnatoliyBr/dwh-service/internal/controller/partition"
+	"github.com/AnatoliyBr/dwh-service/internal/controller/retention"
+	"github.com/AnatoliyBr/dwh-service/internal/controller/rollup"
+	"github.com/AnatoliyBr/dwh-service/internal/controller/statsd"
 	"github.com/AnatoliyBr/dwh-service/internal/repository"
 	"github.com/AnatoliyBr/dwh-service/internal/repository/sqlrepository"
 	"github.com/AnatoliyBr/dwh-service/internal/usecase"
@@ -39,9 +45,15 @@ func Run() {
 	sr := sqlrepository.NewServiceRepository(db)
 	mr := sqlrepository.NewMetricRepository(db)
 	er := sqlrepository.NewEventRepository(db)
+	kr := sqlrepository.NewAPIKeyRepository(db)
+	tr := sqlrepository.NewTenantRepository(db)
+	rr := sqlrepository.NewRetentionRepository(db)
+	ur := sqlrepository.NewRollupRepository(db)
+	pr := sqlrepository.NewPartitionRepository(db)
+	ar := sqlrepository.NewAlertRepository(db)
 
 	// UseCase
-	uc := usecase.NewAppUseCase(sr, mr, er)
+	uc := usecase.NewAppUseCase(sr, mr, er, kr, tr, rr, ur, pr, ar)
 
 	// Controller
 	flag.Parse()
@@ -51,12 +63,135 @@ func Run() {
 		logrus.Fatal(fmt.Errorf("app - Run - toml.DecodeFile: %w", err))
 	}
 
+	quotas := &usecase.Quotas{}
+	_, err = toml.DecodeFile(configPath, &struct {
+		Quotas *usecase.Quotas `toml:"quotas"`
+	}{quotas})
+	if err != nil {
+		logrus.Fatal(fmt.Errorf("app - Run - toml.DecodeFile: %w", err))
+	}
+	uc.SetQuotas(*quotas)
+
+	// the admin key is kept out of the config file in deployments
+	adminKey, hasAdminKey := os.LookupEnv("ADMIN_KEY")
+	if hasAdminKey {
+		configAPIServer.AdminKey = adminKey
+	}
+
+	if configAPIServer.LiveNotify {
+		vn := sqlrepository.NewValueNotifier(db, configDB.DatabaseURL)
+		if err := uc.RelayValues(vn); err != nil {
+			logrus.Fatal(fmt.Errorf("app - Run - uc.RelayValues: %w", err))
+		}
+		defer vn.Close()
+	}
+
 	s, err := apiserver.NewAPIServer(configAPIServer, uc)
 	if err != nil {
 		logrus.Fatal(fmt.Errorf("app - Run - apiServer.NewAPIServer: %w", err))
 	}
 
+	configStatsD := statsd.NewConfig()
+	_, err = toml.DecodeFile(configPath, &struct {
+		StatsD *statsd.Config `toml:"statsd"`
+	}{configStatsD})
+	if err != nil {
+		logrus.Fatal(fmt.Errorf("app - Run - toml.DecodeFile: %w", err))
+	}
+
+	ss, err := statsd.NewStatsDServer(configStatsD, uc)
+	if err != nil {
+		logrus.Fatal(fmt.Errorf("app - Run - statsd.NewStatsDServer: %w", err))
+	}
+
+	configGRPCServer := grpcserver.NewConfig()
+	_, err = toml.DecodeFile(configPath, &struct {
+		GRPC *grpcserver.Config `toml:"grpc"`
+	}{configGRPCServer})
+	if err != nil {
+		logrus.Fatal(fmt.Errorf("app - Run - toml.DecodeFile: %w", err))
+	}
+
+	if hasAdminKey {
+		configGRPCServer.AdminKey = adminKey
+	}
+
+	gs, err := grpcserver.NewGRPCServer(configGRPCServer, uc, s.RateLimiter(), s.Authenticate)
+	if err != nil {
+		logrus.Fatal(fmt.Errorf("app - Run - grpcserver.NewGRPCServer: %w", err))
+	}
+
+	configRetention := retention.NewConfig()
+	_, err = toml.DecodeFile(configPath, &struct {
+		Retention *retention.Config `toml:"retention"`
+	}{configRetention})
+	if err != nil {
+		logrus.Fatal(fmt.Errorf("app - Run - toml.DecodeFile: %w", err))
+	}
+
+	rw, err := retention.NewRetentionWorker(configRetention, uc)
+	if err != nil {
+		logrus.Fatal(fmt.Errorf("app - Run - retention.NewRetentionWorker: %w", err))
+	}
+
+	configRollup := rollup.NewConfig()
+	_, err = toml.DecodeFile(configPath, &struct {
+		Rollup *rollup.Config `toml:"rollup"`
+	}{configRollup})
+	if err != nil {
+		logrus.Fatal(fmt.Errorf("app - Run - toml.DecodeFile: %w", err))
+	}
+
+	uw, err := rollup.NewRollupWorker(configRollup, uc)
+	if err != nil {
+		logrus.Fatal(fmt.Errorf("app - Run - rollup.NewRollupWorker: %w", err))
+	}
+
+	configPartition := partition.NewConfig()
+	_, err = toml.DecodeFile(configPath, &struct {
+		Partition *partition.Config `toml:"partition"`
+	}{configPartition})
+	if err != nil {
+		logrus.Fatal(fmt.Errorf("app - Run - toml.DecodeFile: %w", err))
+	}
+
+	pw, err := partition.NewPartitionWorker(configPartition, uc)
+	if err != nil {
+		logrus.Fatal(fmt.Errorf("app - Run - partition.NewPartitionWorker: %w", err))
+	}
+
+	configAlerting := alerting.NewConfig()
+	_, err = toml.DecodeFile(configPath, &struct {
+		Alerting *alerting.Config `toml:"alerting"`
+	}{configAlerting})
+	if err != nil {
+		logrus.Fatal(fmt.Errorf("app - Run - toml.DecodeFile: %w", err))
+	}
+
+	ae, err := alerting.NewAlertEvaluator(configAlerting, uc)
+	if err != nil {
+		logrus.Fatal(fmt.Errorf("app - Run - alerting.NewAlertEvaluator: %w", err))
+	}
+
 	s.StartAPIServer()
+	if configGRPCServer.Enabled {
+		gs.StartGRPCServer()
+	}
+	if configStatsD.Enabled {
+		ss.StartStatsDServer()
+	}
+	if configRetention.Enabled {
+		rw.StartRetentionWorker()
+	}
+	if configRollup.Enabled {
+		uw.StartRollupWorker()
+	}
+	if configPartition.Enabled {
+		pw.StartPartitionWorker()
+	}
+	if configAlerting.Enabled {
+		ae.StartAlertEvaluator()
+	}
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
@@ -66,6 +201,10 @@ func Run() {
 		logrus.Info("app - Run - signal: " + signal.String())
 	case err = <-s.Notify():
 		logrus.Error(fmt.Errorf("app - Run - apiServer.Notify: %w", err))
+	case err = <-gs.Notify():
+		logrus.Error(fmt.Errorf("app - Run - grpcServer.Notify: %w", err))
+	case err = <-ss.Notify():
+		logrus.Error(fmt.Errorf("app - Run - statsDServer.Notify: %w", err))
 	}
 
 	// Shutdown
@@ -73,4 +212,19 @@ func Run() {
 	if err != nil {
 		logrus.Error(fmt.Errorf("app - Run - apiServer.Shutdown: %w", err))
 	}
+
+	err = gs.Shutdown()
+	if err != nil {
+		logrus.Error(fmt.Errorf("app - Run - grpcServer.Shutdown: %w", err))
+	}
+
+	err = ss.Shutdown()
+	if err != nil {
+		logrus.Error(fmt.Errorf("app - Run - statsDServer.Shutdown: %w", err))
+	}
+
+	rw.Shutdown()
+	uw.Shutdown()
+	pw.Shutdown()
+	ae.Shutdown()
 }
@@ -0,0 +1,105 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/testrepository"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAlertEvaluator(t *testing.T) {
+	er := testrepository.NewEventRepository()
+	uc := usecase.NewAppUseCase(
+		testrepository.NewServiceRepository(),
+		testrepository.NewMetricRepository(),
+		er,
+		testrepository.NewAPIKeyRepository(),
+		testrepository.NewTenantRepository(),
+		testrepository.NewRetentionRepository(),
+		testrepository.NewRollupRepository(er),
+		testrepository.NewPartitionRepository(er),
+		testrepository.NewAlertRepository(),
+	)
+
+	config := NewConfig()
+	config.Interval = 0
+	_, err := NewAlertEvaluator(config, uc)
+	assert.ErrorIs(t, err, errInvalidInterval)
+
+	config = NewConfig()
+	config.LogLevel = "loud"
+	_, err = NewAlertEvaluator(config, uc)
+	assert.Error(t, err)
+
+	e, err := NewAlertEvaluator(NewConfig(), uc)
+	assert.NoError(t, err)
+	e.Shutdown()
+
+	e.StartAlertEvaluator()
+	e.Shutdown()
+}
+
+func TestAlertEvaluator_Evaluate(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+	mr := testrepository.NewMetricRepository()
+	er := testrepository.NewEventRepository()
+	kr := testrepository.NewAPIKeyRepository()
+	tr := testrepository.NewTenantRepository()
+	rr := testrepository.NewRetentionRepository()
+	ur := testrepository.NewRollupRepository(er)
+	pr := testrepository.NewPartitionRepository(er)
+	ar := testrepository.NewAlertRepository()
+	uc := usecase.NewAppUseCase(sr, mr, er, kr, tr, rr, ur, pr, ar)
+
+	now := time.Date(2023, 10, 31, 12, 0, 0, 0, time.UTC)
+
+	rules := make([]*entity.AlertRule, 0)
+	for _, tenantID := range []int{entity.DefaultTenantID, entity.DefaultTenantID + 1} {
+		tuc := uc.ForTenant(tenantID)
+
+		s := entity.TestService(t)
+		m := entity.TestMetric(t)
+		assert.NoError(t, tuc.ServiceCreate(s))
+		assert.NoError(t, tuc.MetricCreate(m))
+
+		e := &entity.Event{ServiceID: s.ServiceID, TimeStamp: entity.CustomTime{Time: now.Add(-time.Minute)}}
+		assert.NoError(t, tuc.EventCreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: "1s"}}))
+
+		a := entity.TestAlertRule(t)
+		a.ServiceID = s.ServiceID
+		a.MetricID = m.MetricID
+		a.For = ""
+		assert.NoError(t, tuc.AlertRuleCreate(a))
+		rules = append(rules, a)
+	}
+
+	e, err := NewAlertEvaluator(NewConfig(), uc)
+	assert.NoError(t, err)
+
+	// the rules of every tenant are evaluated in their tenant
+	e.evaluate(now)
+
+	for _, a := range rules {
+		alerts, err := uc.ForTenant(a.TenantID).AlertList()
+		assert.NoError(t, err)
+		if assert.Len(t, alerts, 1) {
+			assert.Equal(t, a.RuleID, alerts[0].RuleID)
+			assert.Equal(t, entity.AlertFiring, alerts[0].State)
+		}
+	}
+
+	// a stopped evaluator gives up after the first rule
+	close(e.done)
+	e.evaluate(now.Add(10 * time.Minute))
+
+	for i, expected := range []string{entity.AlertResolved, entity.AlertFiring} {
+		history, err := uc.ForTenant(rules[i].TenantID).AlertHistory(rules[i].RuleID, 1)
+		assert.NoError(t, err)
+		if assert.Len(t, history, 1) {
+			assert.Equal(t, expected, history[0].To)
+		}
+	}
+}
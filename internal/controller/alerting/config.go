@@ -0,0 +1,19 @@
+package alerting
+
+import "time"
+
+type Config struct {
+	// the evaluator is started only if enabled
+	Enabled  bool   `toml:"enabled"`
+	LogLevel string `toml:"log_level"`
+
+	// period between evaluations of the rules, a rule with a shorter for fires at the next evaluation
+	Interval time.Duration `toml:"interval"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		LogLevel: "debug",
+		Interval: 30 * time.Second,
+	}
+}
@@ -0,0 +1,129 @@
+package alerting
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/sirupsen/logrus"
+)
+
+var errInvalidInterval = errors.New("interval: must be positive")
+
+// alertEvaluator evaluates the alert rules of every tenant and logs the changes of their states,
+// which are kept in the history of the rules.
+type alertEvaluator struct {
+	done    chan struct{}
+	wg      sync.WaitGroup
+	started bool
+	config  *Config
+	logger  *logrus.Logger
+	uc      usecase.UseCase
+}
+
+func NewAlertEvaluator(config *Config, uc usecase.UseCase) (*alertEvaluator, error) {
+	if config.Interval <= 0 {
+		return nil, errInvalidInterval
+	}
+
+	e := &alertEvaluator{
+		done:   make(chan struct{}),
+		config: config,
+		logger: logrus.New(),
+		uc:     uc,
+	}
+
+	if err := e.configureLogger(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *alertEvaluator) configureLogger() error {
+	level, err := logrus.ParseLevel(e.config.LogLevel)
+	if err != nil {
+		return err
+	}
+	e.logger.SetLevel(level)
+	return nil
+}
+
+// StartAlertEvaluator evaluates the rules right away and then every interval.
+func (e *alertEvaluator) StartAlertEvaluator() {
+	e.logger.Info("starting alert evaluator")
+	e.started = true
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.evaluateEvery(e.config.Interval)
+	}()
+}
+
+// Shutdown stops the evaluator after the rule being evaluated, it does nothing if the evaluator is not started.
+func (e *alertEvaluator) Shutdown() {
+	if !e.started {
+		return
+	}
+
+	close(e.done)
+	e.wg.Wait()
+}
+
+func (e *alertEvaluator) evaluateEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	e.evaluate(time.Now())
+	for {
+		select {
+		case now := <-ticker.C:
+			e.evaluate(now)
+		case <-e.done:
+			return
+		}
+	}
+}
+
+// evaluate evaluates every rule at now, a rule that cannot be evaluated keeps its state
+// and the others are evaluated all the same. It gives up the rest once the evaluator is stopped.
+func (e *alertEvaluator) evaluate(now time.Time) {
+	rules, err := e.uc.AlertRuleListAll()
+	if err != nil {
+		e.logger.Errorf("alerting: cannot list rules: %s", err)
+		return
+	}
+
+	for _, a := range rules {
+		t, err := e.uc.AlertEvaluate(a, now)
+		if err != nil {
+			e.logger.Errorf("alerting: cannot evaluate rule %d of tenant %d: %s", a.RuleID, a.TenantID, err)
+		} else if t != nil {
+			e.logTransition(a, t)
+		}
+
+		select {
+		case <-e.done:
+			e.logger.Info("alerting: stopped evaluating rules")
+			return
+		default:
+		}
+	}
+}
+
+func (e *alertEvaluator) logTransition(a *entity.AlertRule, t *entity.AlertTransition) {
+	entry := e.logger.WithFields(logrus.Fields{
+		"rule_id":   a.RuleID,
+		"tenant_id": a.TenantID,
+		"value":     t.Value,
+	})
+
+	if t.To == entity.AlertFiring {
+		entry.Warnf("alerting: %s is firing", a.Name)
+		return
+	}
+	entry.Infof("alerting: %s is %s, was %s", a.Name, t.To, t.From)
+}
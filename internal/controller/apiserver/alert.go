@@ -0,0 +1,189 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/gorilla/mux"
+)
+
+// defaultAlertHistoryLimit is the number of state changes returned when the limit is not set.
+const defaultAlertHistoryLimit = 100
+
+var errInvalidHistoryLimit = errors.New("limit: must be positive")
+
+// alertRuleRequest refers to the service and the metric of the rule by id or, if it is not set, by slug.
+type alertRuleRequest struct {
+	Name        string `json:"name"`
+	ServiceID   int    `json:"service_id"`
+	ServiceSlug string `json:"service_slug"`
+	MetricID    int    `json:"metric_id"`
+	MetricSlug  string `json:"metric_slug"`
+	Function    string `json:"function"`
+	Window      string `json:"window"`
+	Operator    string `json:"operator"`
+	Threshold   string `json:"threshold"`
+	For         string `json:"for"`
+}
+
+// alertRule decodes the rule of the request body, the service and the metric are looked up in the tenant.
+func (s *apiServer) alertRule(r *http.Request) (*entity.AlertRule, int, error) {
+	req := &alertRuleRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	uc := s.useCase(r)
+	service, err := s.findService(uc, req.ServiceID, req.ServiceSlug)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+
+	metric, err := s.findMetric(uc, req.MetricID, req.MetricSlug)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+
+	return &entity.AlertRule{
+		Name:      req.Name,
+		ServiceID: service.ServiceID,
+		MetricID:  metric.MetricID,
+		Function:  req.Function,
+		Window:    req.Window,
+		Operator:  req.Operator,
+		Threshold: req.Threshold,
+		For:       req.For,
+	}, http.StatusOK, nil
+}
+
+func (s *apiServer) handleAlertRuleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a, code, err := s.alertRule(r)
+		if err != nil {
+			s.error(w, r, code, err)
+			return
+		}
+
+		if err := s.useCase(r).AlertRuleCreate(a); err != nil {
+			s.error(w, r, updateErrorCode(err), err)
+			return
+		}
+
+		s.respond(w, r, http.StatusCreated, a)
+	}
+}
+
+// handleAlertRuleUpdate replaces the rule, which is evaluated afresh from the ok state.
+func (s *apiServer) handleAlertRuleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ruleID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		a, code, err := s.alertRule(r)
+		if err != nil {
+			s.error(w, r, code, err)
+			return
+		}
+		a.RuleID = ruleID
+
+		if err := s.useCase(r).AlertRuleUpdate(a); err != nil {
+			s.error(w, r, updateErrorCode(err), err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, a)
+	}
+}
+
+func (s *apiServer) handleAlertRuleFindByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ruleID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		a, err := s.useCase(r).AlertRuleFindByID(ruleID)
+		if err != nil {
+			s.error(w, r, deleteErrorCode(err), err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, a)
+	}
+}
+
+func (s *apiServer) handleAlertRuleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules, err := s.useCase(r).AlertRuleList()
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, rules)
+	}
+}
+
+func (s *apiServer) handleAlertRuleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ruleID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := s.useCase(r).AlertRuleDelete(ruleID); err != nil {
+			s.error(w, r, deleteErrorCode(err), err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleAlertRuleHistory returns the latest state changes of the rule, newest first.
+func (s *apiServer) handleAlertRuleHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ruleID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		limit := defaultAlertHistoryLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+				s.error(w, r, http.StatusBadRequest, errInvalidHistoryLimit)
+				return
+			}
+		}
+
+		history, err := s.useCase(r).AlertHistory(ruleID, limit)
+		if err != nil {
+			s.error(w, r, deleteErrorCode(err), err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, history)
+	}
+}
+
+// handleAlertList returns the pending and firing alerts.
+func (s *apiServer) handleAlertList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alerts, err := s.useCase(r).AlertList()
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, alerts)
+	}
+}
@@ -1,32 +1,62 @@
 package apiserver
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/AnatoliyBr/dwh-service/internal/controller/ratelimit"
 	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
 	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/golang/snappy"
 	"github.com/google/uuid"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
 type ctxKey uint8
 
+var (
+	errForbidden         = errors.New("forbidden")
+	errBatchTooLarge     = errors.New("batch too large")
+	errDryRunWithoutHard = errors.New("dry_run requires hard")
+)
+
 const (
 	ctxKeyRequestID ctxKey = iota
+	ctxKeyAPIKey
+	ctxKeyAuthError
+	ctxKeyUseCase
 )
 
 type apiServer struct {
 	httpServer      *http.Server
 	notify          chan error
+	done            chan struct{}
 	shutdownTimeout time.Duration
 	config          *Config
 	logger          *logrus.Logger
+	authenticator   authenticator
+	rateLimiter     *ratelimit.Limiter
 	uc              usecase.UseCase
 }
 
@@ -38,12 +68,26 @@ func NewAPIServer(config *Config, uc usecase.UseCase) (*apiServer, error) {
 			Addr:         config.BindAddr,
 		},
 		notify:          make(chan error, 1),
+		done:            make(chan struct{}),
 		shutdownTimeout: config.ShutdownTimeout,
 		config:          config,
 		logger:          logrus.New(),
 		uc:              uc,
 	}
 
+	// live streams never finish on their own, they are ended when the server shuts down
+	s.httpServer.RegisterOnShutdown(func() { close(s.done) })
+
+	if err := s.configureAuthenticator(); err != nil {
+		return nil, err
+	}
+
+	rl, err := ratelimit.NewLimiter(config.RateLimits)
+	if err != nil {
+		return nil, err
+	}
+	s.rateLimiter = rl
+
 	s.configureRouter()
 
 	if err := s.configureLogger(); err != nil {
@@ -58,18 +102,70 @@ func (s *apiServer) configureRouter() {
 
 	// middleware
 	r.Use(s.setRequestID)
+	r.Use(s.authenticate)
 	r.Use(s.logRequest)
-	r.Use(handlers.CORS(handlers.AllowedOrigins([]string{"*"})))
+	r.Use(handlers.CORS(
+		handlers.AllowedOrigins(s.config.AllowedOrigins),
+		handlers.AllowedHeaders([]string{"Authorization", "Content-Type", "X-API-Key", "X-Tenant"}),
+	))
+	r.Use(s.rateLimit)
+	r.Use(s.authorize)
+	r.Use(s.resolveTenant)
 
 	// public
 	r.HandleFunc("/services", s.handleServiceCreate()).Methods(http.MethodPost)
-	r.HandleFunc("/services", s.handleServiceFindByID()).Methods(http.MethodGet)
+	r.HandleFunc("/services", s.handleServiceList()).Methods(http.MethodGet)
+	r.HandleFunc("/services/{id:[0-9]+}", s.handleServiceFindByID()).Methods(http.MethodGet)
+	r.HandleFunc("/services/{id:[0-9]+}", s.handleServiceUpdate(false)).Methods(http.MethodPut)
+	r.HandleFunc("/services/{id:[0-9]+}", s.handleServiceUpdate(true)).Methods(http.MethodPatch)
+	r.HandleFunc("/services/{id:[0-9]+}", s.handleServiceDelete()).Methods(http.MethodDelete)
 
 	r.HandleFunc("/metrics", s.handleMetricCreate()).Methods(http.MethodPost)
-	r.HandleFunc("/metrics", s.handleMetricFindByID()).Methods(http.MethodGet)
-
-	r.HandleFunc("/events", s.handleEventCreate()).Methods(http.MethodPost)
-	r.HandleFunc("/events", s.handleGetMetricValuesForTimePeriod()).Methods(http.MethodGet)
+	r.HandleFunc("/metrics", s.handleMetricList()).Methods(http.MethodGet)
+	r.HandleFunc("/metrics/{id:[0-9]+}", s.handleMetricFindByID()).Methods(http.MethodGet)
+	r.HandleFunc("/metrics/{id:[0-9]+}", s.handleMetricUpdate(false)).Methods(http.MethodPut)
+	r.HandleFunc("/metrics/{id:[0-9]+}", s.handleMetricUpdate(true)).Methods(http.MethodPatch)
+	r.HandleFunc("/metrics/{id:[0-9]+}", s.handleMetricDelete()).Methods(http.MethodDelete)
+
+	r.HandleFunc("/events", s.handleEventCreate(false)).Methods(http.MethodPost)
+	r.HandleFunc("/events/batch", s.handleEventBatchCreate()).Methods(http.MethodPost)
+	r.HandleFunc("/services/{service}/metrics/{metric}/values", s.handleGetMetricValuesForTimePeriod(parseValuesQuery)).Methods(http.MethodGet)
+	r.HandleFunc("/services/{service}/metrics/{metric}/aggregate", s.handleAggregateMetricValuesForTimePeriod(parseValuesQuery)).Methods(http.MethodGet)
+	r.HandleFunc("/events/live", s.handleLiveValues()).Methods(http.MethodGet)
+
+	r.HandleFunc("/federate", s.handleFederate()).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/write", s.handleRemoteWrite()).Methods(http.MethodPost)
+	r.HandleFunc("/write", s.handleLineProtocolWrite()).Methods(http.MethodPost)
+	r.HandleFunc("/v1/metrics", s.handleOTLPMetrics()).Methods(http.MethodPost)
+
+	r.HandleFunc("/services/{service}/retention", s.handleRetentionPolicyFind()).Methods(http.MethodGet)
+	r.HandleFunc("/metrics/{metric}/retention", s.handleRetentionPolicyFind()).Methods(http.MethodGet)
+	r.HandleFunc("/retention-policies", s.handleRetentionPolicyList()).Methods(http.MethodGet)
+
+	r.HandleFunc("/alert-rules", s.handleAlertRuleList()).Methods(http.MethodGet)
+	r.HandleFunc("/alert-rules/{id:[0-9]+}", s.handleAlertRuleFindByID()).Methods(http.MethodGet)
+	r.HandleFunc("/alert-rules/{id:[0-9]+}/history", s.handleAlertRuleHistory()).Methods(http.MethodGet)
+	r.HandleFunc("/alerts", s.handleAlertList()).Methods(http.MethodGet)
+
+	// deprecated, the query is sent in the body
+	r.Handle("/events", deprecated(s.handleGetMetricValuesForTimePeriod(decodeValuesQuery))).Methods(http.MethodGet)
+	r.Handle("/events/aggregate", deprecated(s.handleAggregateMetricValuesForTimePeriod(decodeValuesQuery))).Methods(http.MethodGet)
+
+	// admin
+	r.Handle("/events/backfill", s.requireAdmin(s.handleEventCreate(true))).Methods(http.MethodPost)
+	r.HandleFunc("/api-keys", s.handleAPIKeyCreate()).Methods(http.MethodPost)
+	r.HandleFunc("/api-keys", s.handleAPIKeyList()).Methods(http.MethodGet)
+	r.HandleFunc("/api-keys/{id:[0-9]+}", s.handleAPIKeyDelete()).Methods(http.MethodDelete)
+	r.Handle("/tenants", s.requireUnbound(s.handleTenantCreate())).Methods(http.MethodPost)
+	r.Handle("/tenants", s.requireUnbound(s.handleTenantList())).Methods(http.MethodGet)
+	r.HandleFunc("/usage", s.handleUsage()).Methods(http.MethodGet)
+	r.HandleFunc("/services/{service}/retention", s.handleRetentionPolicySave()).Methods(http.MethodPut)
+	r.HandleFunc("/services/{service}/retention", s.handleRetentionPolicyDelete()).Methods(http.MethodDelete)
+	r.HandleFunc("/metrics/{metric}/retention", s.handleRetentionPolicySave()).Methods(http.MethodPut)
+	r.HandleFunc("/metrics/{metric}/retention", s.handleRetentionPolicyDelete()).Methods(http.MethodDelete)
+	r.HandleFunc("/alert-rules", s.handleAlertRuleCreate()).Methods(http.MethodPost)
+	r.HandleFunc("/alert-rules/{id:[0-9]+}", s.handleAlertRuleUpdate()).Methods(http.MethodPut)
+	r.HandleFunc("/alert-rules/{id:[0-9]+}", s.handleAlertRuleDelete()).Methods(http.MethodDelete)
 
 	s.httpServer.Handler = r
 }
@@ -117,10 +213,18 @@ func (s *apiServer) setRequestID(next http.Handler) http.Handler {
 
 func (s *apiServer) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger := s.logger.WithFields(logrus.Fields{
+		fields := logrus.Fields{
 			"remote_addr": r.RemoteAddr,
 			"request_id":  r.Context().Value(ctxKeyRequestID),
-		})
+		}
+		switch k := apiKey(r.Context()); {
+		case k == nil:
+		case k.KeyID != 0:
+			fields["key_id"] = k.KeyID
+		default:
+			fields["subject"] = k.Name
+		}
+		logger := s.logger.WithFields(fields)
 		logger.Infof("started %s %s", r.Method, r.RequestURI)
 
 		start := time.Now()
@@ -147,6 +251,14 @@ func (s *apiServer) logRequest(next http.Handler) http.Handler {
 	})
 }
 
+// deprecated marks the responses of an endpoint that is going to be removed with the Deprecation header.
+func deprecated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (s *apiServer) handleServiceCreate() http.HandlerFunc {
 	type request struct {
 		Slug    string `json:"slug"`
@@ -165,7 +277,7 @@ func (s *apiServer) handleServiceCreate() http.HandlerFunc {
 			Details: req.Details,
 		}
 
-		if err := s.uc.ServiceCreate(service); err != nil {
+		if err := s.useCase(r).ServiceCreate(service); err != nil {
 			s.error(w, r, http.StatusUnprocessableEntity, err)
 			return
 		}
@@ -175,6 +287,26 @@ func (s *apiServer) handleServiceCreate() http.HandlerFunc {
 }
 
 func (s *apiServer) handleServiceFindByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serviceID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		service, err := s.useCase(r).ServiceFindByID(serviceID)
+		if err != nil {
+			s.error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, service)
+	}
+}
+
+// handleServiceFindByBody looks the service up by the id sent in the body of GET /services,
+// which is kept for clients of the time before GET /services/{id}.
+func (s *apiServer) handleServiceFindByBody() http.HandlerFunc {
 	type request struct {
 		ServiceID int `json:"service_id"`
 	}
@@ -186,7 +318,7 @@ func (s *apiServer) handleServiceFindByID() http.HandlerFunc {
 			return
 		}
 
-		service, err := s.uc.ServiceFindByID(req.ServiceID)
+		service, err := s.useCase(r).ServiceFindByID(req.ServiceID)
 		if err != nil {
 			s.error(w, r, http.StatusNotFound, err)
 			return
@@ -196,6 +328,135 @@ func (s *apiServer) handleServiceFindByID() http.HandlerFunc {
 	}
 }
 
+// handleServiceList lists the services, a request with a body is answered by handleServiceFindByBody.
+func (s *apiServer) handleServiceList() http.HandlerFunc {
+	type response struct {
+		Services   []*entity.Service `json:"services"`
+		NextCursor string            `json:"next_cursor,omitempty"`
+	}
+
+	findByBody := deprecated(s.handleServiceFindByBody())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// deprecated, the id is sent in the body
+		if r.ContentLength > 0 {
+			findByBody.ServeHTTP(w, r)
+			return
+		}
+
+		o, err := listOptions(r)
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := o.Validate(); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		services, err := s.useCase(r).ServiceList(o)
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		resp := &response{
+			Services: services,
+		}
+
+		if len(services) == o.Limit {
+			last := services[len(services)-1]
+			resp.NextCursor = o.NextCursor(last.ServiceID, last.Slug)
+		}
+
+		s.respond(w, r, http.StatusOK, resp)
+	}
+}
+
+// handleServiceUpdate replaces the service with PUT, with PATCH only the fields present in the request are changed.
+func (s *apiServer) handleServiceUpdate(partial bool) http.HandlerFunc {
+	type request struct {
+		Slug    *string `json:"slug"`
+		Details *string `json:"details"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		serviceID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		req := &request{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		service := &entity.Service{ServiceID: serviceID}
+		if partial {
+			old, err := s.useCase(r).ServiceFindByID(serviceID)
+			if err != nil {
+				s.error(w, r, http.StatusNotFound, err)
+				return
+			}
+			*service = *old
+		}
+
+		if req.Slug != nil {
+			service.Slug = *req.Slug
+		}
+		if req.Details != nil {
+			service.Details = *req.Details
+		}
+
+		if err := s.useCase(r).ServiceUpdate(service); err != nil {
+			s.error(w, r, updateErrorCode(err), err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, service)
+	}
+}
+
+// handleServiceDelete archives the service. With ?hard=true the service is removed with its events
+// and the number of removed events and values is reported, ?dry_run=true only reports them.
+func (s *apiServer) handleServiceDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serviceID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		hard, dryRun, err := deleteOptions(r)
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if !hard {
+			service, err := s.useCase(r).ServiceArchive(serviceID)
+			if err != nil {
+				s.error(w, r, deleteErrorCode(err), err)
+				return
+			}
+
+			s.respond(w, r, http.StatusOK, service)
+			return
+		}
+
+		c, err := s.useCase(r).ServiceDelete(serviceID, dryRun)
+		if err != nil {
+			s.error(w, r, deleteErrorCode(err), err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, &deleteResponse{DryRun: dryRun, Cascade: c})
+	}
+}
+
 func (s *apiServer) handleMetricCreate() http.HandlerFunc {
 	type request struct {
 		Slug       string `json:"slug"`
@@ -216,7 +477,7 @@ func (s *apiServer) handleMetricCreate() http.HandlerFunc {
 			Details:    req.Details,
 		}
 
-		if err := s.uc.MetricCreate(metric); err != nil {
+		if err := s.useCase(r).MetricCreate(metric); err != nil {
 			s.error(w, r, http.StatusUnprocessableEntity, err)
 			return
 		}
@@ -226,6 +487,26 @@ func (s *apiServer) handleMetricCreate() http.HandlerFunc {
 }
 
 func (s *apiServer) handleMetricFindByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metricID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		metric, err := s.useCase(r).MetricFindByID(metricID)
+		if err != nil {
+			s.error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, metric)
+	}
+}
+
+// handleMetricFindByBody looks the metric up by the id sent in the body of GET /metrics,
+// which is kept for clients of the time before GET /metrics/{id}.
+func (s *apiServer) handleMetricFindByBody() http.HandlerFunc {
 	type request struct {
 		MetricID int `json:"metric_id"`
 	}
@@ -237,7 +518,7 @@ func (s *apiServer) handleMetricFindByID() http.HandlerFunc {
 			return
 		}
 
-		metric, err := s.uc.MetricFindByID(req.MetricID)
+		metric, err := s.useCase(r).MetricFindByID(req.MetricID)
 		if err != nil {
 			s.error(w, r, http.StatusNotFound, err)
 			return
@@ -247,10 +528,149 @@ func (s *apiServer) handleMetricFindByID() http.HandlerFunc {
 	}
 }
 
-func (s *apiServer) handleEventCreate() http.HandlerFunc {
+// handleMetricList lists the metrics, a request with a body is answered by handleMetricFindByBody.
+func (s *apiServer) handleMetricList() http.HandlerFunc {
+	type response struct {
+		Metrics    []*entity.Metric `json:"metrics"`
+		NextCursor string           `json:"next_cursor,omitempty"`
+	}
+
+	findByBody := deprecated(s.handleMetricFindByBody())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// deprecated, the id is sent in the body
+		if r.ContentLength > 0 {
+			findByBody.ServeHTTP(w, r)
+			return
+		}
+
+		o, err := listOptions(r)
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		o.MetricType = r.URL.Query().Get("metric_type")
+		if err := o.Validate(); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		metrics, err := s.useCase(r).MetricList(o)
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		resp := &response{
+			Metrics: metrics,
+		}
+
+		if len(metrics) == o.Limit {
+			last := metrics[len(metrics)-1]
+			resp.NextCursor = o.NextCursor(last.MetricID, last.Slug)
+		}
+
+		s.respond(w, r, http.StatusOK, resp)
+	}
+}
+
+// handleEventCreate registers an event at the client-supplied time_stamp or at the current time.
+// Backfill requests must carry a time_stamp and skip the age limits from Config.
+// handleMetricUpdate replaces the metric with PUT, with PATCH only the fields present in the request are changed.
+func (s *apiServer) handleMetricUpdate(partial bool) http.HandlerFunc {
+	type request struct {
+		Slug       *string `json:"slug"`
+		MetricType *string `json:"metric_type"`
+		Details    *string `json:"details"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		metricID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		req := &request{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		metric := &entity.Metric{MetricID: metricID}
+		if partial {
+			old, err := s.useCase(r).MetricFindByID(metricID)
+			if err != nil {
+				s.error(w, r, http.StatusNotFound, err)
+				return
+			}
+			*metric = *old
+		}
+
+		if req.Slug != nil {
+			metric.Slug = *req.Slug
+		}
+		if req.MetricType != nil {
+			metric.MetricType = *req.MetricType
+		}
+		if req.Details != nil {
+			metric.Details = *req.Details
+		}
+
+		if err := s.useCase(r).MetricUpdate(metric); err != nil {
+			s.error(w, r, updateErrorCode(err), err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, metric)
+	}
+}
+
+// handleMetricDelete archives the metric. With ?hard=true the metric is removed with its values
+// and the number of removed values is reported, ?dry_run=true only reports them.
+func (s *apiServer) handleMetricDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metricID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		hard, dryRun, err := deleteOptions(r)
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if !hard {
+			metric, err := s.useCase(r).MetricArchive(metricID)
+			if err != nil {
+				s.error(w, r, deleteErrorCode(err), err)
+				return
+			}
+
+			s.respond(w, r, http.StatusOK, metric)
+			return
+		}
+
+		c, err := s.useCase(r).MetricDelete(metricID, dryRun)
+		if err != nil {
+			s.error(w, r, deleteErrorCode(err), err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, &deleteResponse{DryRun: dryRun, Cascade: c})
+	}
+}
+
+func (s *apiServer) handleEventCreate(backfill bool) http.HandlerFunc {
 	type request struct {
-		ServiceID int                 `json:"service_id"`
-		Metrics   []*entity.AddMetric `json:"metrics"`
+		ServiceID   int                 `json:"service_id"`
+		ServiceSlug string              `json:"service_slug"`
+		TimeStamp   *entity.CustomTime  `json:"time_stamp"`
+		Labels      map[string]string   `json:"labels"`
+		Metrics     []*entity.AddMetric `json:"metrics"`
 	}
 
 	type response struct {
@@ -265,18 +685,36 @@ func (s *apiServer) handleEventCreate() http.HandlerFunc {
 			return
 		}
 
+		now := time.Now()
 		e := &entity.Event{
-			TimeStamp: entity.CustomTime{Time: time.Now()},
-			ServiceID: req.ServiceID,
+			TimeStamp:   entity.CustomTime{Time: now},
+			ServiceID:   req.ServiceID,
+			ServiceSlug: req.ServiceSlug,
+			Labels:      req.Labels,
 		}
 
-		if err := s.uc.EventCreate(e); err != nil {
-			s.error(w, r, http.StatusInternalServerError, err)
+		if req.TimeStamp != nil {
+			e.TimeStamp = *req.TimeStamp
+		} else if backfill {
+			s.error(w, r, http.StatusBadRequest, errors.New("time_stamp: cannot be blank"))
 			return
 		}
 
-		if err := s.uc.AddMetricsToEvent(e.EventID, req.Metrics); err != nil {
-			s.error(w, r, http.StatusInternalServerError, err)
+		if !backfill {
+			if err := e.ValidateTimeStamp(now, s.config.MaxEventAge, s.config.MaxEventFutureSkew); err != nil {
+				s.error(w, r, http.StatusUnprocessableEntity, err)
+				return
+			}
+		}
+
+		if err := s.eventAuthorizer(r)(e); err != nil {
+			s.error(w, r, http.StatusForbidden, err)
+			return
+		}
+
+		if err := s.useCase(r).EventCreateWithMetrics(e, req.Metrics); err != nil {
+			quotaRetryAfter(w, err)
+			s.error(w, r, ingestErrorCode(err), err)
 			return
 		}
 
@@ -289,57 +727,777 @@ func (s *apiServer) handleEventCreate() http.HandlerFunc {
 	}
 }
 
-func (s *apiServer) handleGetMetricValuesForTimePeriod() http.HandlerFunc {
-	type request struct {
-		ServiceID int                   `json:"service_id"`
-		Period    [2]*entity.CustomTime `json:"period"`
-		MetricID  int                   `json:"metric_id"`
+// handleEventBatchCreate accepts a JSON array or a newline-delimited stream of events in the format of POST /events
+// and reports every item as accepted or rejected. With ?atomic=true either all events are written or none.
+func (s *apiServer) handleEventBatchCreate() http.HandlerFunc {
+	type item struct {
+		ServiceID   int                 `json:"service_id"`
+		ServiceSlug string              `json:"service_slug"`
+		TimeStamp   *entity.CustomTime  `json:"time_stamp"`
+		Labels      map[string]string   `json:"labels"`
+		Metrics     []*entity.AddMetric `json:"metrics"`
+	}
+
+	type result struct {
+		Index  int           `json:"index"`
+		Status string        `json:"status"`
+		Event  *entity.Event `json:"event,omitempty"`
+		Error  string        `json:"error,omitempty"`
+	}
+
+	type response struct {
+		Accepted int       `json:"accepted"`
+		Rejected int       `json:"rejected"`
+		Items    []*result `json:"items"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic, err := queryBool(r, "atomic")
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		req := make([]*item, 0)
+		err = decodeStream(r.Body, func(dec *json.Decoder) error {
+			if len(req) == s.config.MaxBatchSize {
+				return errBatchTooLarge
+			}
+
+			i := &item{}
+			if err := dec.Decode(i); err != nil {
+				return err
+			}
+
+			req = append(req, i)
+			return nil
+		})
+		if errors.Is(err, errBatchTooLarge) {
+			s.error(w, r, http.StatusRequestEntityTooLarge, err)
+			return
+		} else if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		now := time.Now()
+		authorizeEvent := s.eventAuthorizer(r)
+		errs := make([]error, len(req))
+		events := make([]*entity.Event, len(req))
+		items := make([]*entity.BatchItem, 0, len(req))
+		indexes := make([]int, 0, len(req))
+
+		for i, it := range req {
+			e := &entity.Event{
+				TimeStamp:   entity.CustomTime{Time: now},
+				ServiceID:   it.ServiceID,
+				ServiceSlug: it.ServiceSlug,
+				Labels:      it.Labels,
+			}
+
+			if it.TimeStamp != nil {
+				e.TimeStamp = *it.TimeStamp
+			}
+
+			if err := e.ValidateTimeStamp(now, s.config.MaxEventAge, s.config.MaxEventFutureSkew); err != nil {
+				errs[i] = err
+				continue
+			}
+
+			if err := authorizeEvent(e); err != nil {
+				errs[i] = err
+				continue
+			}
+
+			events[i] = e
+			items = append(items, &entity.BatchItem{Event: e, Metrics: it.Metrics})
+			indexes = append(indexes, i)
+		}
+
+		if atomic && len(items) < len(req) {
+			for _, i := range indexes {
+				errs[i] = entity.ErrBatchRejected
+			}
+		} else {
+			for k, err := range s.useCase(r).EventBatchCreate(items, atomic) {
+				errs[indexes[k]] = err
+			}
+		}
+
+		resp := &response{
+			Items: make([]*result, len(req)),
+		}
+
+		quota := false
+		for i, err := range errs {
+			if err != nil {
+				quota = quotaRetryAfter(w, err) || quota
+				resp.Rejected++
+				resp.Items[i] = &result{Index: i, Status: "rejected", Error: err.Error()}
+				continue
+			}
+
+			resp.Accepted++
+			resp.Items[i] = &result{Index: i, Status: "accepted", Event: events[i]}
+		}
+
+		code := http.StatusOK
+		if atomic && quota {
+			code = http.StatusTooManyRequests
+		} else if atomic && resp.Rejected > 0 {
+			code = http.StatusUnprocessableEntity
+		}
+
+		s.respond(w, r, code, resp)
 	}
+}
 
+// handleGetMetricValuesForTimePeriod reports the values of a metric of a service over a period,
+// the query is read by parse.
+func (s *apiServer) handleGetMetricValuesForTimePeriod(parse func(*http.Request) (*valuesQuery, error)) http.HandlerFunc {
 	type response struct {
-		Request *request            `json:"request"`
+		Request *valuesQuery        `json:"request"`
 		Report  []*entity.GetMetric `json:"report"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		req := &request{}
-		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		q, err := parse(r)
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := q.validate(false); err != nil {
 			s.error(w, r, http.StatusBadRequest, err)
 			return
 		}
 
-		if !req.Period[0].Time.Before(req.Period[1].Time) {
-			s.error(w, r, http.StatusBadRequest, errors.New("invalid period"))
+		metric, ok := s.resolveValuesQuery(w, r, q)
+		if !ok {
 			return
 		}
 
-		_, err := s.uc.ServiceFindByID(req.ServiceID)
+		report, err := s.useCase(r).GetMetricValuesForTimePeriod(q.ServiceID, q.Period, metric, q.selector)
 		if err != nil {
-			s.error(w, r, http.StatusNotFound, err)
+			s.error(w, r, http.StatusInternalServerError, err)
 			return
 		}
 
-		metric, err := s.uc.MetricFindByID(req.MetricID)
+		resp := &response{
+			Request: q,
+			Report:  report.([]*entity.GetMetric),
+		}
+
+		s.respond(w, r, http.StatusOK, resp)
+	}
+}
+
+// handleAggregateMetricValuesForTimePeriod aggregates the values of a metric of a service by buckets over a period,
+// the query is read by parse.
+func (s *apiServer) handleAggregateMetricValuesForTimePeriod(parse func(*http.Request) (*valuesQuery, error)) http.HandlerFunc {
+	type response struct {
+		Request *valuesQuery               `json:"request"`
+		Report  []*entity.AggregatedMetric `json:"report"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parse(r)
 		if err != nil {
-			s.error(w, r, http.StatusNotFound, err)
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := q.validate(true); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		metric, ok := s.resolveValuesQuery(w, r, q)
+		if !ok {
+			return
+		}
+
+		a := &entity.Aggregation{
+			Bucket:    q.bucket,
+			Functions: q.Functions,
+		}
+
+		if err := a.Validate(metric.MetricType); err != nil {
+			s.error(w, r, http.StatusUnprocessableEntity, err)
 			return
 		}
 
-		report, err := s.uc.GetMetricValuesForTimePeriod(req.ServiceID, req.Period, metric)
+		report, err := s.useCase(r).AggregateMetricValuesForTimePeriod(q.ServiceID, q.Period, metric, a, q.selector)
 		if err != nil {
 			s.error(w, r, http.StatusInternalServerError, err)
 			return
 		}
 
 		resp := &response{
-			Request: req,
-			Report:  report.([]*entity.GetMetric),
+			Request: q,
+			Report:  report,
 		}
 
 		s.respond(w, r, http.StatusOK, resp)
 	}
 }
 
+// handleFederate renders the latest value of every metric of every service in the Prometheus text exposition format.
+// Services and metrics are selected by slug with ?service= and ?metric=.
+func (s *apiServer) handleFederate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		values, err := s.useCase(r).LatestMetricValues(listParam(q["service"]), listParam(q["metric"]))
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		b := &bytes.Buffer{}
+		if err := writeExposition(b, values); err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", expositionContentType)
+		w.WriteHeader(http.StatusOK)
+		b.WriteTo(w)
+	}
+}
+
+// handleRemoteWrite implements the Prometheus remote_write receiver, the body is a snappy-compressed protobuf WriteRequest.
+// Samples of a series are stored as events of the service from the job or instance label at the time stamps of the samples,
+// see remoteWriteEvents. Prometheus retries 5xx responses only, so a request with rejected samples is answered with 400.
+func (s *apiServer) handleRemoteWrite() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		compressed, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestSize))
+		if err != nil {
+			s.error(w, r, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+
+		if n, err := snappy.DecodedLen(compressed); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		} else if n > maxIngestSize {
+			s.error(w, r, http.StatusRequestEntityTooLarge, errWriteRequestTooLarge)
+			return
+		}
+
+		b, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		req, err := decodeWriteRequest(b)
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		events, rejected := remoteWriteEvents(req)
+		samples := rejected + events.points()
+
+		n, firstErr := s.authorizePoints(events, s.eventAuthorizer(r))
+		rejected += n
+
+		if s.config.RemoteWriteAutoRegister {
+			s.registerMetrics(s.useCase(r), "remote_write", events.metrics("Registered by Prometheus remote_write"))
+		}
+
+		n, storeErr, err := s.storePoints(s.useCase(r), events)
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		rejected += n
+		if firstErr == nil {
+			firstErr = storeErr
+		}
+
+		if rejected > 0 {
+			if firstErr == nil {
+				firstErr = errNoServiceOrMetric
+			}
+
+			code := http.StatusBadRequest
+			if quotaRetryAfter(w, firstErr) {
+				code = http.StatusTooManyRequests
+			}
+			s.error(w, r, code, fmt.Errorf("%d of %d samples rejected: %w", rejected, samples, firstErr))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleLineProtocolWrite accepts points in the InfluxDB line protocol, optionally gzip-compressed.
+// Every line is stored as an event of the service named by the measurement with the tags as labels
+// and the fields as metric values. Time stamps are read in the units of ?precision=, nanoseconds by default.
+func (s *apiServer) handleLineProtocolWrite() http.HandlerFunc {
+	type lineError struct {
+		Line  int    `json:"line"`
+		Error string `json:"error"`
+	}
+
+	type response struct {
+		Accepted int          `json:"accepted"`
+		Rejected int          `json:"rejected"`
+		Errors   []*lineError `json:"errors"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		precision, err := parseLinePrecision(r.URL.Query().Get("precision"))
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		body := io.Reader(http.MaxBytesReader(w, r.Body, maxIngestSize))
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(body)
+			if err != nil {
+				s.error(w, r, http.StatusBadRequest, err)
+				return
+			}
+			defer gz.Close()
+			body = &maxSizeReader{r: gz, n: maxIngestSize}
+		}
+
+		now := time.Now()
+		authorizeEvent := s.eventAuthorizer(r)
+		resp := &response{
+			Errors: make([]*lineError, 0),
+		}
+		items := make([]*entity.BatchItem, 0)
+		lines := make([]int, 0)
+		metrics := make([]*entity.Metric, 0)
+
+		sc := bufio.NewScanner(body)
+		sc.Buffer(nil, maxLineSize)
+		for n := 1; sc.Scan(); n++ {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			if len(items)+resp.Rejected == s.config.MaxBatchSize {
+				s.error(w, r, http.StatusRequestEntityTooLarge, errBatchTooLarge)
+				return
+			}
+
+			p, err := parseLine(line, precision)
+			if err != nil {
+				resp.Rejected++
+				resp.Errors = append(resp.Errors, &lineError{Line: n, Error: err.Error()})
+				continue
+			}
+
+			e := &entity.Event{
+				TimeStamp:   entity.CustomTime{Time: now},
+				ServiceSlug: entity.SanitizeSlug(p.measurement),
+				Labels:      p.tags,
+			}
+
+			if p.timestamp != nil {
+				e.TimeStamp = entity.CustomTime{Time: *p.timestamp}
+			}
+
+			if err := e.ValidateTimeStamp(now, s.config.MaxEventAge, s.config.MaxEventFutureSkew); err != nil {
+				resp.Rejected++
+				resp.Errors = append(resp.Errors, &lineError{Line: n, Error: err.Error()})
+				continue
+			}
+
+			if err := authorizeEvent(e); err != nil {
+				resp.Rejected++
+				resp.Errors = append(resp.Errors, &lineError{Line: n, Error: err.Error()})
+				continue
+			}
+
+			values := make([]*entity.AddMetric, len(p.fields))
+			for i, f := range p.fields {
+				slug := entity.SanitizeSlug(f.key)
+				values[i] = &entity.AddMetric{MetricSlug: slug, MetricValue: f.value}
+				metrics = append(metrics, &entity.Metric{
+					Slug:       slug,
+					MetricType: f.metricType,
+					Details:    "Registered by InfluxDB line protocol",
+				})
+			}
+
+			items = append(items, &entity.BatchItem{Event: e, Metrics: values})
+			lines = append(lines, n)
+		}
+		if err := sc.Err(); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.Is(err, errWriteRequestTooLarge) || errors.As(err, &maxBytesErr) {
+				s.error(w, r, http.StatusRequestEntityTooLarge, err)
+				return
+			}
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if s.config.LineProtocolAutoRegister {
+			s.registerMetrics(s.useCase(r), "line protocol", metrics)
+		}
+
+		errs := s.useCase(r).EventBatchCreate(items, false)
+		if err := retryableError(errs); err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		quota := false
+		for k, err := range errs {
+			if err == nil {
+				resp.Accepted++
+				continue
+			}
+
+			quota = quotaRetryAfter(w, err) || quota
+			resp.Rejected++
+			resp.Errors = append(resp.Errors, &lineError{Line: lines[k], Error: err.Error()})
+		}
+
+		if resp.Rejected > 0 {
+			sort.Slice(resp.Errors, func(i, j int) bool {
+				return resp.Errors[i].Line < resp.Errors[j].Line
+			})
+
+			code := http.StatusBadRequest
+			if quota {
+				code = http.StatusTooManyRequests
+			}
+			s.respond(w, r, code, resp)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleOTLPMetrics implements the OTLP/HTTP metrics receiver, the body is a protobuf or JSON encoded
+// ExportMetricsServiceRequest, optionally gzip-compressed. Data points are stored as described in otlpEvents,
+// rejected ones are reported as a partial success. A failure of the storage is answered with 503, which the
+// exporters retry, unless a part of the request is stored and the rest is reported as rejected instead.
+func (s *apiServer) handleOTLPMetrics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if contentType != otlpContentTypeProtobuf && contentType != otlpContentTypeJSON {
+			s.respondOTLP(w, r, otlpContentTypeProtobuf, http.StatusUnsupportedMediaType, &status.Status{
+				Code:    int32(codes.InvalidArgument),
+				Message: fmt.Sprintf("unsupported content type %q", contentType),
+			})
+			return
+		}
+
+		badRequest := func(err error) {
+			s.respondOTLP(w, r, contentType, http.StatusBadRequest, &status.Status{
+				Code:    int32(codes.InvalidArgument),
+				Message: err.Error(),
+			})
+		}
+
+		body := io.Reader(http.MaxBytesReader(w, r.Body, maxIngestSize))
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(body)
+			if err != nil {
+				badRequest(err)
+				return
+			}
+			defer gz.Close()
+			body = &maxSizeReader{r: gz, n: maxIngestSize}
+		}
+
+		b, err := io.ReadAll(body)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.Is(err, errWriteRequestTooLarge) || errors.As(err, &maxBytesErr) {
+				s.respondOTLP(w, r, contentType, http.StatusRequestEntityTooLarge, &status.Status{
+					Code:    int32(codes.InvalidArgument),
+					Message: errWriteRequestTooLarge.Error(),
+				})
+				return
+			}
+			badRequest(err)
+			return
+		}
+
+		req := &colmetricspb.ExportMetricsServiceRequest{}
+		if contentType == otlpContentTypeJSON {
+			err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(b, req)
+		} else {
+			err = proto.Unmarshal(b, req)
+		}
+		if err != nil {
+			badRequest(err)
+			return
+		}
+
+		events, rejected := otlpEvents(req, time.Now())
+
+		n, firstErr := s.authorizePoints(events, s.eventAuthorizer(r))
+		rejected += n
+
+		if s.config.OTLPAutoRegister {
+			s.registerMetrics(s.useCase(r), "otlp", events.metrics("Registered by OpenTelemetry"))
+		}
+
+		n, storeErr, err := s.storePoints(s.useCase(r), events)
+		if err != nil {
+			s.respondOTLP(w, r, contentType, http.StatusServiceUnavailable, &status.Status{
+				Code:    int32(codes.Unavailable),
+				Message: err.Error(),
+			})
+			return
+		}
+		rejected += n
+		if firstErr == nil {
+			firstErr = storeErr
+		}
+
+		resp := &colmetricspb.ExportMetricsServiceResponse{}
+		if rejected > 0 {
+			if firstErr == nil {
+				firstErr = errNoServiceName
+			}
+			resp.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+				RejectedDataPoints: int64(rejected),
+				ErrorMessage:       firstErr.Error(),
+			}
+		}
+
+		s.respondOTLP(w, r, contentType, http.StatusOK, resp)
+	}
+}
+
+// respondOTLP encodes msg with the encoding of the request.
+func (s *apiServer) respondOTLP(w http.ResponseWriter, r *http.Request, contentType string, code int, msg proto.Message) {
+	var (
+		b   []byte
+		err error
+	)
+
+	if contentType == otlpContentTypeJSON {
+		b, err = protojson.Marshal(msg)
+	} else {
+		b, err = proto.Marshal(msg)
+	}
+	if err != nil {
+		s.error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+// registerMetrics creates those of metrics that do not exist yet, source names the protocol in the logs.
+// A metric that cannot be created is left to be rejected on ingestion.
+func (s *apiServer) registerMetrics(uc usecase.UseCase, source string, metrics []*entity.Metric) {
+	seen := make(map[string]bool)
+
+	for _, m := range metrics {
+		if seen[m.Slug] {
+			continue
+		}
+		seen[m.Slug] = true
+
+		created, err := uc.MetricRegister(m)
+		if err != nil {
+			s.logger.Warnf("%s: cannot register metric %s: %s", source, m.Slug, err)
+		} else if created {
+			s.logger.Infof("%s: registered %s metric %s", source, m.MetricType, m.Slug)
+		}
+	}
+}
+
+// resolveValuesQuery looks up the service and the metric of the query and sets their ids,
+// it responds with 404 and returns false if any of them is not found.
+func (s *apiServer) resolveValuesQuery(w http.ResponseWriter, r *http.Request, q *valuesQuery) (*entity.Metric, bool) {
+	service, err := s.findService(s.useCase(r), q.ServiceID, q.ServiceSlug)
+	if err != nil {
+		s.error(w, r, http.StatusNotFound, err)
+		return nil, false
+	}
+	q.ServiceID = service.ServiceID
+
+	metric, err := s.findMetric(s.useCase(r), q.MetricID, q.MetricSlug)
+	if err != nil {
+		s.error(w, r, http.StatusNotFound, err)
+		return nil, false
+	}
+	q.MetricID = metric.MetricID
+
+	return metric, true
+}
+
+// listOptions reads the pagination, sort and filter query parameters shared by collection endpoints.
+// The options are validated by the caller after adding its own filters.
+// findService looks the service up by id or, if the id is not set, by slug.
+func (s *apiServer) findService(uc usecase.UseCase, serviceID int, slug string) (*entity.Service, error) {
+	if serviceID == 0 && slug != "" {
+		return uc.ServiceFindBySlug(slug)
+	}
+	return uc.ServiceFindByID(serviceID)
+}
+
+// findMetric looks the metric up by id or, if the id is not set, by slug.
+func (s *apiServer) findMetric(uc usecase.UseCase, metricID int, slug string) (*entity.Metric, error) {
+	if metricID == 0 && slug != "" {
+		return uc.MetricFindBySlug(slug)
+	}
+	return uc.MetricFindByID(metricID)
+}
+
+// deleteResponse reports the rows removed by a hard delete.
+type deleteResponse struct {
+	DryRun  bool            `json:"dry_run"`
+	Cascade *entity.Cascade `json:"cascade"`
+}
+
+func deleteOptions(r *http.Request) (hard, dryRun bool, err error) {
+	if hard, err = queryBool(r, "hard"); err != nil {
+		return false, false, err
+	}
+
+	if dryRun, err = queryBool(r, "dry_run"); err != nil {
+		return false, false, err
+	}
+
+	if dryRun && !hard {
+		return false, false, errDryRunWithoutHard
+	}
+	return hard, dryRun, nil
+}
+
+// queryBool parses an optional boolean query parameter, it is false when absent.
+func queryBool(r *http.Request, name string) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
+
+func listOptions(r *http.Request) (*entity.ListOptions, error) {
+	q := r.URL.Query()
+
+	o := &entity.ListOptions{
+		Cursor:     q.Get("cursor"),
+		SortBy:     q.Get("sort"),
+		Order:      q.Get("order"),
+		SlugPrefix: q.Get("slug_prefix"),
+		Search:     q.Get("q"),
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("limit: %w", err)
+		}
+		o.Limit = limit
+	}
+
+	archived, err := queryBool(r, "archived")
+	if err != nil {
+		return nil, err
+	}
+	o.IncludeArchived = archived
+
+	return o, nil
+}
+
+// decodeStream calls next for every element of a JSON array or of a stream of JSON values
+// separated by whitespace, e.g. newline-delimited JSON.
+func decodeStream(body io.Reader, next func(*json.Decoder) error) error {
+	br := bufio.NewReader(body)
+
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if !unicode.IsSpace(rune(b[0])) {
+			break
+		}
+		br.ReadByte()
+	}
+
+	dec := json.NewDecoder(br)
+
+	if b, _ := br.Peek(1); b[0] != '[' {
+		for dec.More() {
+			if err := next(dec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		if err := next(dec); err != nil {
+			return err
+		}
+	}
+
+	_, err := dec.Token()
+	return err
+}
+
+// ingestErrorCode responds with 422 to events referring to unknown or archived services or metrics
+// or carrying values of the wrong type or invalid labels, with 429 to events over a daily quota and with 500 to everything else.
+func ingestErrorCode(err error) int {
+	if errors.Is(err, repository.ErrRecordNotFound) ||
+		errors.Is(err, entity.ErrInvalidMetricValue) ||
+		errors.Is(err, entity.ErrInvalidLabels) ||
+		errors.Is(err, entity.ErrArchived) {
+		return http.StatusUnprocessableEntity
+	}
+	if errors.Is(err, entity.ErrQuotaExceeded) {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// updateErrorCode responds with 404 to updates of unknown services and metrics,
+// with 409 to changes of the type of a metric with stored values and with 422 to everything else.
+func updateErrorCode(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, entity.ErrMetricTypeLocked):
+		return http.StatusConflict
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+func deleteErrorCode(err error) int {
+	if errors.Is(err, repository.ErrRecordNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
 func (s *apiServer) error(w http.ResponseWriter, r *http.Request, code int, err error) {
 	s.respond(w, r, code, map[string]string{"error": err.Error()})
 }
@@ -1,24 +1,90 @@
 package apiserver
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/AnatoliyBr/dwh-service/internal/controller/ratelimit"
 	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
 	"github.com/AnatoliyBr/dwh-service/internal/repository/testrepository"
 	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/golang/snappy"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 )
 
+// testRepositories are the repositories of the use case of newTestUseCaseWithRepositories
+// for the tests that store records directly.
+type testRepositories struct {
+	services *testrepository.ServiceRepository
+	metrics  *testrepository.MetricRepository
+	events   *testrepository.EventRepository
+	tenants  *testrepository.TenantRepository
+}
+
+// newTestUseCase returns a use case of empty in-memory repositories.
+func newTestUseCase(t *testing.T) *usecase.AppUseCase {
+	t.Helper()
+
+	uc, _ := newTestUseCaseWithRepositories(t)
+	return uc
+}
+
+func newTestUseCaseWithRepositories(t *testing.T) (*usecase.AppUseCase, *testRepositories) {
+	t.Helper()
+
+	repos := &testRepositories{
+		services: testrepository.NewServiceRepository(),
+		metrics:  testrepository.NewMetricRepository(),
+		events:   testrepository.NewEventRepository(),
+		tenants:  testrepository.NewTenantRepository(),
+	}
+
+	uc := usecase.NewAppUseCase(
+		repos.services,
+		repos.metrics,
+		repos.events,
+		testrepository.NewAPIKeyRepository(),
+		repos.tenants,
+		testrepository.NewRetentionRepository(),
+		testrepository.NewRollupRepository(repos.events),
+		testrepository.NewPartitionRepository(repos.events),
+		testrepository.NewAlertRepository(),
+	)
+	return uc, repos
+}
+
 func TestAPIServer_SetRequestID(t *testing.T) {
-	sr := testrepository.NewServiceRepository()
-	mr := testrepository.NewMetricRepository()
-	er := testrepository.NewEventRepository()
-	uc := usecase.NewAppUseCase(sr, mr, er)
+	uc := newTestUseCase(t)
 	s, _ := NewAPIServer(NewConfig(), uc)
 
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -34,10 +100,7 @@ func TestAPIServer_SetRequestID(t *testing.T) {
 }
 
 func TestAPIServer_HandleServiceCreate(t *testing.T) {
-	sr := testrepository.NewServiceRepository()
-	mr := testrepository.NewMetricRepository()
-	er := testrepository.NewEventRepository()
-	uc := usecase.NewAppUseCase(sr, mr, er)
+	uc := newTestUseCase(t)
 	s, _ := NewAPIServer(NewConfig(), uc)
 
 	testCases := []struct {
@@ -84,33 +147,215 @@ func TestAPIServer_HandleServiceCreate(t *testing.T) {
 }
 
 func TestAPIServer_HandleServiceFindByID(t *testing.T) {
-	sr := testrepository.NewServiceRepository()
-	mr := testrepository.NewMetricRepository()
-	er := testrepository.NewEventRepository()
-	uc := usecase.NewAppUseCase(sr, mr, er)
+	uc, repos := newTestUseCaseWithRepositories(t)
 	s, _ := NewAPIServer(NewConfig(), uc)
 
 	service := entity.TestService(t)
-	sr.Create(service)
+	repos.services.Create(service)
 
 	testCases := []struct {
 		name         string
-		payload      interface{}
+		path         string
+		body         string
 		expectedCode int
 	}{
 		{
 			name:         "valid",
-			payload:      map[string]int{"service_id": 1},
+			path:         "/services/1",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "unexisted service",
+			path:         "/services/2",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "deprecated body",
+			path:         "/services",
+			body:         `{"service_id": 1}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "deprecated body of an unexisted service",
+			path:         "/services",
+			body:         `{"service_id": 2}`,
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tc.path, strings.NewReader(tc.body))
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+
+			if tc.body != "" {
+				assert.Equal(t, "true", rec.Header().Get("Deprecation"))
+			}
+		})
+	}
+}
+
+func TestAPIServer_HandleServiceList(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	for _, slug := range []string{"NOTE_BOOK", "NOTE_PAD", "TODO_APP"} {
+		service := entity.TestService(t)
+		service.Slug = slug
+		repos.services.Create(service)
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		chunked       bool
+		expectedCode  int
+		expectedCount int
+	}{
+		{
+			name:          "valid",
+			query:         "",
+			expectedCode:  http.StatusOK,
+			expectedCount: 3,
+		},
+		{
+			name:          "slug prefix",
+			query:         "?slug_prefix=note&sort=slug&order=desc",
+			expectedCode:  http.StatusOK,
+			expectedCount: 2,
+		},
+		{
+			name:          "chunked",
+			query:         "?slug_prefix=note",
+			chunked:       true,
+			expectedCode:  http.StatusOK,
+			expectedCount: 2,
+		},
+		{
+			name:          "search",
+			query:         "?q=unknown",
+			expectedCode:  http.StatusOK,
+			expectedCount: 0,
+		},
+		{
+			name:         "invalid limit",
+			query:        "?limit=ten",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid sort",
+			query:        "?sort=details",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid cursor",
+			query:        "?cursor=%3F%23%40",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/services"+tc.query, nil)
+			if tc.chunked {
+				// the length of a chunked request is unknown
+				req.ContentLength = -1
+			}
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+
+			if tc.expectedCode == http.StatusOK {
+				resp := struct {
+					Services []*entity.Service `json:"services"`
+				}{}
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+				assert.Len(t, resp.Services, tc.expectedCount)
+			}
+		})
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		var ids []int
+		cursor := ""
+		for {
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/services?limit=2&cursor="+cursor, nil)
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			resp := struct {
+				Services   []*entity.Service `json:"services"`
+				NextCursor string            `json:"next_cursor"`
+			}{}
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+
+			for _, service := range resp.Services {
+				ids = append(ids, service.ServiceID)
+			}
+
+			if resp.NextCursor == "" {
+				break
+			}
+			cursor = resp.NextCursor
+		}
+
+		assert.Equal(t, []int{1, 2, 3}, ids)
+	})
+}
+
+func TestAPIServer_HandleServiceUpdate(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	service := entity.TestService(t)
+	repos.services.Create(service)
+
+	testCases := []struct {
+		name         string
+		method       string
+		path         string
+		payload      interface{}
+		expectedCode int
+	}{
+		{
+			name:         "put",
+			method:       http.MethodPut,
+			path:         "/services/1",
+			payload:      map[string]string{"slug": "NOTE_PAD", "details": "Notes"},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "put without details",
+			method:       http.MethodPut,
+			path:         "/services/1",
+			payload:      map[string]string{"slug": "NOTE_PAD"},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "patch",
+			method:       http.MethodPatch,
+			path:         "/services/1",
+			payload:      map[string]string{"details": "Notes and lists"},
 			expectedCode: http.StatusOK,
 		},
 		{
 			name:         "invalid payload",
+			method:       http.MethodPatch,
+			path:         "/services/1",
 			payload:      "",
 			expectedCode: http.StatusBadRequest,
 		},
 		{
 			name:         "unexisted service",
-			payload:      map[string]int{"service_id": 2},
+			method:       http.MethodPatch,
+			path:         "/services/2",
+			payload:      map[string]string{"details": "Notes"},
 			expectedCode: http.StatusNotFound,
 		},
 	}
@@ -120,7 +365,66 @@ func TestAPIServer_HandleServiceFindByID(t *testing.T) {
 			rec := httptest.NewRecorder()
 			b := &bytes.Buffer{}
 			json.NewEncoder(b).Encode(tc.payload)
-			req, _ := http.NewRequest(http.MethodGet, "/services", b)
+			req, _ := http.NewRequest(tc.method, tc.path, b)
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+		})
+	}
+
+	updated, _ := repos.services.FindByID(1)
+	assert.Equal(t, "NOTE_PAD", updated.Slug)
+	assert.Equal(t, "Notes and lists", updated.Details)
+}
+
+func TestAPIServer_HandleServiceDelete(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	service := entity.TestService(t)
+	repos.services.Create(service)
+
+	testCases := []struct {
+		name         string
+		path         string
+		expectedCode int
+	}{
+		{
+			name:         "archive",
+			path:         "/services/1",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "dry run",
+			path:         "/services/1?hard=true&dry_run=true",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "dry run without hard",
+			path:         "/services/1?dry_run=true",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid hard",
+			path:         "/services/1?hard=yes",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "hard",
+			path:         "/services/1?hard=true",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "unexisted service",
+			path:         "/services/1",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodDelete, tc.path, nil)
 
 			s.ServeHTTP(rec, req)
 			assert.Equal(t, tc.expectedCode, rec.Code)
@@ -129,10 +433,7 @@ func TestAPIServer_HandleServiceFindByID(t *testing.T) {
 }
 
 func TestAPIServer_HandleMetricCreate(t *testing.T) {
-	sr := testrepository.NewServiceRepository()
-	mr := testrepository.NewMetricRepository()
-	er := testrepository.NewEventRepository()
-	uc := usecase.NewAppUseCase(sr, mr, er)
+	uc := newTestUseCase(t)
 	s, _ := NewAPIServer(NewConfig(), uc)
 
 	testCases := []struct {
@@ -181,33 +482,38 @@ func TestAPIServer_HandleMetricCreate(t *testing.T) {
 }
 
 func TestAPIServer_HandleMetricFindByID(t *testing.T) {
-	sr := testrepository.NewServiceRepository()
-	mr := testrepository.NewMetricRepository()
-	er := testrepository.NewEventRepository()
-	uc := usecase.NewAppUseCase(sr, mr, er)
+	uc, repos := newTestUseCaseWithRepositories(t)
 	s, _ := NewAPIServer(NewConfig(), uc)
 
 	metric := entity.TestMetric(t)
-	mr.Create(metric)
+	repos.metrics.Create(metric)
 
 	testCases := []struct {
 		name         string
-		payload      interface{}
+		path         string
+		body         string
 		expectedCode int
 	}{
 		{
 			name:         "valid",
-			payload:      map[string]int{"metric_id": 1},
+			path:         "/metrics/1",
 			expectedCode: http.StatusOK,
 		},
 		{
-			name:         "invalid payload",
-			payload:      "",
-			expectedCode: http.StatusBadRequest,
+			name:         "unexisted metric",
+			path:         "/metrics/2",
+			expectedCode: http.StatusNotFound,
 		},
 		{
-			name:         "unexisted metric",
-			payload:      map[string]int{"metric_id": 2},
+			name:         "deprecated body",
+			path:         "/metrics",
+			body:         `{"metric_id": 1}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "deprecated body of an unexisted metric",
+			path:         "/metrics",
+			body:         `{"metric_id": 2}`,
 			expectedCode: http.StatusNotFound,
 		},
 	}
@@ -215,57 +521,126 @@ func TestAPIServer_HandleMetricFindByID(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			rec := httptest.NewRecorder()
-			b := &bytes.Buffer{}
-			json.NewEncoder(b).Encode(tc.payload)
-			req, _ := http.NewRequest(http.MethodGet, "/metrics", b)
+			req, _ := http.NewRequest(http.MethodGet, tc.path, strings.NewReader(tc.body))
 
 			s.ServeHTTP(rec, req)
 			assert.Equal(t, tc.expectedCode, rec.Code)
+
+			if tc.body != "" {
+				assert.Equal(t, "true", rec.Header().Get("Deprecation"))
+			}
 		})
 	}
 }
 
-func TestAPIServer_HandleEventCreate(t *testing.T) {
-	sr := testrepository.NewServiceRepository()
-	mr := testrepository.NewMetricRepository()
-	er := testrepository.NewEventRepository()
-	uc := usecase.NewAppUseCase(sr, mr, er)
+func TestAPIServer_HandleMetricList(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	for _, metricType := range []string{"DURATION", "INT"} {
+		metric := entity.TestMetric(t)
+		metric.Slug = "READING_TIME_" + metricType
+		metric.MetricType = metricType
+		repos.metrics.Create(metric)
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		chunked       bool
+		expectedCode  int
+		expectedCount int
+	}{
+		{
+			name:          "valid",
+			query:         "",
+			expectedCode:  http.StatusOK,
+			expectedCount: 2,
+		},
+		{
+			name:          "metric type",
+			query:         "?metric_type=INT",
+			expectedCode:  http.StatusOK,
+			expectedCount: 1,
+		},
+		{
+			name:          "chunked",
+			query:         "?metric_type=INT",
+			chunked:       true,
+			expectedCode:  http.StatusOK,
+			expectedCount: 1,
+		},
+		{
+			name:         "invalid metric type",
+			query:        "?metric_type=-____-",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/metrics"+tc.query, nil)
+			if tc.chunked {
+				// the length of a chunked request is unknown
+				req.ContentLength = -1
+			}
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+
+			if tc.expectedCode == http.StatusOK {
+				resp := struct {
+					Metrics []*entity.Metric `json:"metrics"`
+				}{}
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+				assert.Len(t, resp.Metrics, tc.expectedCount)
+			}
+		})
+	}
+}
+
+func TestAPIServer_HandleMetricUpdate(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
 	s, _ := NewAPIServer(NewConfig(), uc)
 
 	service := entity.TestService(t)
-	m1 := entity.TestMetric(t)
-	m2 := entity.TestMetric(t)
-	m2.Slug = "READING_TIME_NOTE_2"
+	repos.services.Create(service)
+
+	metric := entity.TestMetric(t)
+	repos.metrics.Create(metric)
 
-	sr.Create(service)
-	mr.Create(m1)
-	mr.Create(m2)
+	e := entity.TestEvent(t)
+	e.ServiceID = service.ServiceID
+	uc.EventCreateWithMetrics(e, []*entity.AddMetric{{MetricID: metric.MetricID, MetricValue: "10s"}})
 
 	testCases := []struct {
 		name         string
+		method       string
 		payload      interface{}
 		expectedCode int
 	}{
 		{
-			name: "valid",
-			payload: map[string]interface{}{
-				"service_id": service.ServiceID,
-				"metrics": []*entity.AddMetric{
-					{
-						MetricID:    m1.MetricID,
-						MetricValue: time.Duration(10 * time.Second).String(),
-					},
-					{
-						MetricID:    m2.MetricID,
-						MetricValue: time.Duration(15 * time.Second).String(),
-					},
-				}},
-			expectedCode: http.StatusCreated,
+			name:         "patch details",
+			method:       http.MethodPatch,
+			payload:      map[string]string{"details": "Reading time"},
+			expectedCode: http.StatusOK,
 		},
 		{
-			name:         "invalid payload",
-			payload:      "",
-			expectedCode: http.StatusBadRequest,
+			name:         "patch type with values",
+			method:       http.MethodPatch,
+			payload:      map[string]string{"metric_type": "INT"},
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:   "put",
+			method: http.MethodPut,
+			payload: map[string]string{
+				"slug":        "READING_TIME",
+				"metric_type": "DURATION",
+				"details":     "Reading time",
+			},
+			expectedCode: http.StatusOK,
 		},
 	}
 
@@ -274,7 +649,7 @@ func TestAPIServer_HandleEventCreate(t *testing.T) {
 			rec := httptest.NewRecorder()
 			b := &bytes.Buffer{}
 			json.NewEncoder(b).Encode(tc.payload)
-			req, _ := http.NewRequest(http.MethodPost, "/events", b)
+			req, _ := http.NewRequest(tc.method, "/metrics/1", b)
 
 			s.ServeHTTP(rec, req)
 			assert.Equal(t, tc.expectedCode, rec.Code)
@@ -282,31 +657,54 @@ func TestAPIServer_HandleEventCreate(t *testing.T) {
 	}
 }
 
-func TestAPIServer_HandleGetMetricValuesForTimePeriod(t *testing.T) {
-	sr := testrepository.NewServiceRepository()
-	mr := testrepository.NewMetricRepository()
-	er := testrepository.NewEventRepository()
-	uc := usecase.NewAppUseCase(sr, mr, er)
+func TestAPIServer_HandleMetricDelete(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	metric := entity.TestMetric(t)
+	repos.metrics.Create(metric)
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodDelete, "/metrics/1", nil)
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/metrics?archived=true", nil)
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	resp := struct {
+		Metrics []*entity.Metric `json:"metrics"`
+	}{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	if assert.Len(t, resp.Metrics, 1) {
+		assert.True(t, resp.Metrics[0].Archived)
+	}
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodDelete, "/metrics/1?hard=true", nil)
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/metrics/1", nil)
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAPIServer_HandleEventCreate(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
 	s, _ := NewAPIServer(NewConfig(), uc)
 
 	service := entity.TestService(t)
 	m1 := entity.TestMetric(t)
 	m2 := entity.TestMetric(t)
 	m2.Slug = "READING_TIME_NOTE_2"
-	e := entity.TestEvent(t)
-
-	sr.Create(service)
-	e.ServiceID = service.ServiceID
-	mr.Create(m1)
-	mr.Create(m2)
-	er.Create(e)
 
-	er.AddMetricsToEvent(e.EventID, []*entity.AddMetric{
-		{
-			MetricID:    m1.MetricID,
-			MetricValue: time.Duration(10 * time.Second).String(),
-		},
-	})
+	repos.services.Create(service)
+	repos.metrics.Create(m1)
+	repos.metrics.Create(m2)
 
 	testCases := []struct {
 		name         string
@@ -317,18 +715,369 @@ func TestAPIServer_HandleGetMetricValuesForTimePeriod(t *testing.T) {
 			name: "valid",
 			payload: map[string]interface{}{
 				"service_id": service.ServiceID,
-				"period": [2]*entity.CustomTime{
-					{Time: time.Now().AddDate(0, 0, -1)},
-					{Time: time.Now().AddDate(0, 0, +1)},
-				},
-				"metric_id": m1.MetricID,
-			},
-			expectedCode: http.StatusOK,
+				"metrics": []*entity.AddMetric{
+					{
+						MetricID:    m1.MetricID,
+						MetricValue: time.Duration(10 * time.Second).String(),
+					},
+					{
+						MetricID:    m2.MetricID,
+						MetricValue: time.Duration(15 * time.Second).String(),
+					},
+				}},
+			expectedCode: http.StatusCreated,
 		},
 		{
-			name: "invalid period",
+			name: "slugs",
 			payload: map[string]interface{}{
-				"service_id": service.ServiceID,
+				"service_slug": "note book",
+				"metrics": []*entity.AddMetric{
+					{
+						MetricSlug:  m1.Slug,
+						MetricValue: time.Duration(10 * time.Second).String(),
+					},
+					{
+						MetricSlug:  "reading time note 2",
+						MetricValue: time.Duration(15 * time.Second).String(),
+					},
+				}},
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name: "unexisted metric slug",
+			payload: map[string]interface{}{
+				"service_slug": service.Slug,
+				"metrics": []*entity.AddMetric{
+					{
+						MetricSlug:  "READING_TIME",
+						MetricValue: time.Duration(10 * time.Second).String(),
+					},
+				}},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "client time stamp",
+			payload: map[string]interface{}{
+				"service_id": service.ServiceID,
+				"time_stamp": entity.CustomTime{Time: time.Now().Add(-time.Hour)},
+				"metrics": []*entity.AddMetric{
+					{
+						MetricID:    m1.MetricID,
+						MetricValue: time.Duration(10 * time.Second).String(),
+					},
+				}},
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name: "time stamp too old",
+			payload: map[string]interface{}{
+				"service_id": service.ServiceID,
+				"time_stamp": entity.CustomTime{Time: time.Now().AddDate(0, -1, 0)},
+				"metrics": []*entity.AddMetric{
+					{
+						MetricID:    m1.MetricID,
+						MetricValue: time.Duration(10 * time.Second).String(),
+					},
+				}},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "time stamp in the future",
+			payload: map[string]interface{}{
+				"service_id": service.ServiceID,
+				"time_stamp": entity.CustomTime{Time: time.Now().Add(time.Hour)},
+				"metrics": []*entity.AddMetric{
+					{
+						MetricID:    m1.MetricID,
+						MetricValue: time.Duration(10 * time.Second).String(),
+					},
+				}},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "value does not match metric type",
+			payload: map[string]interface{}{
+				"service_id": service.ServiceID,
+				"metrics": []*entity.AddMetric{
+					{
+						MetricID:    m1.MetricID,
+						MetricValue: 10,
+					},
+				}},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "unexisted service",
+			payload: map[string]interface{}{
+				"service_id": service.ServiceID + 1,
+				"metrics": []*entity.AddMetric{
+					{
+						MetricID:    m1.MetricID,
+						MetricValue: time.Duration(10 * time.Second).String(),
+					},
+				}},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "unexisted metric",
+			payload: map[string]interface{}{
+				"service_id": service.ServiceID,
+				"metrics": []*entity.AddMetric{
+					{
+						MetricID:    m2.MetricID + 1,
+						MetricValue: time.Duration(10 * time.Second).String(),
+					},
+				}},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "invalid payload",
+			payload:      "",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			b := &bytes.Buffer{}
+			json.NewEncoder(b).Encode(tc.payload)
+			req, _ := http.NewRequest(http.MethodPost, "/events", b)
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestAPIServer_HandleEventBatchCreate(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	config := NewConfig()
+	config.MaxBatchSize = 2
+	s, _ := NewAPIServer(config, uc)
+
+	service := entity.TestService(t)
+	m := entity.TestMetric(t)
+
+	repos.services.Create(service)
+	repos.metrics.Create(m)
+
+	valid := `{"service_id": 1, "metrics": [{"metric_id": 1, "metric_value": "10s"}]}`
+	invalid := `{"service_id": 1, "metrics": [{"metric_id": 1, "metric_value": 10}]}`
+
+	testCases := []struct {
+		name             string
+		target           string
+		body             string
+		expectedCode     int
+		expectedAccepted int
+		expectedRejected int
+	}{
+		{
+			name:             "array",
+			target:           "/events/batch",
+			body:             "[" + valid + ", " + valid + "]",
+			expectedCode:     http.StatusOK,
+			expectedAccepted: 2,
+		},
+		{
+			name:             "newline-delimited",
+			target:           "/events/batch",
+			body:             valid + "\n" + valid + "\n",
+			expectedCode:     http.StatusOK,
+			expectedAccepted: 2,
+		},
+		{
+			name:             "partial",
+			target:           "/events/batch",
+			body:             "[" + valid + ", " + invalid + "]",
+			expectedCode:     http.StatusOK,
+			expectedAccepted: 1,
+			expectedRejected: 1,
+		},
+		{
+			name:             "atomic",
+			target:           "/events/batch?atomic=true",
+			body:             "[" + valid + ", " + invalid + "]",
+			expectedCode:     http.StatusUnprocessableEntity,
+			expectedRejected: 2,
+		},
+		{
+			name:         "too large",
+			target:       "/events/batch",
+			body:         "[" + valid + ", " + valid + ", " + valid + "]",
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:         "invalid atomic",
+			target:       "/events/batch?atomic=maybe",
+			body:         "[" + valid + "]",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid payload",
+			target:       "/events/batch",
+			body:         "[" + valid,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, tc.target, bytes.NewBufferString(tc.body))
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+
+			if rec.Code == http.StatusOK || rec.Code == http.StatusUnprocessableEntity {
+				resp := &struct {
+					Accepted int `json:"accepted"`
+					Rejected int `json:"rejected"`
+				}{}
+				json.NewDecoder(rec.Body).Decode(resp)
+				assert.Equal(t, tc.expectedAccepted, resp.Accepted)
+				assert.Equal(t, tc.expectedRejected, resp.Rejected)
+			}
+		})
+	}
+}
+
+func TestAPIServer_HandleEventBackfill(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	config := NewConfig()
+	config.AdminKey = "secret"
+	s, _ := NewAPIServer(config, uc)
+
+	service := entity.TestService(t)
+	m := entity.TestMetric(t)
+
+	repos.services.Create(service)
+	repos.metrics.Create(m)
+
+	payload := map[string]interface{}{
+		"service_id": service.ServiceID,
+		"time_stamp": entity.CustomTime{Time: time.Now().AddDate(-1, 0, 0)},
+		"metrics": []*entity.AddMetric{
+			{
+				MetricID:    m.MetricID,
+				MetricValue: time.Duration(10 * time.Second).String(),
+			},
+		}}
+
+	testCases := []struct {
+		name         string
+		token        string
+		payload      interface{}
+		expectedCode int
+	}{
+		{
+			name:         "valid",
+			token:        "secret",
+			payload:      payload,
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name:         "missing time stamp",
+			token:        "secret",
+			payload:      map[string]interface{}{"service_id": service.ServiceID},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid token",
+			token:        "guess",
+			payload:      payload,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "without token",
+			payload:      payload,
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			b := &bytes.Buffer{}
+			json.NewEncoder(b).Encode(tc.payload)
+			req, _ := http.NewRequest(http.MethodPost, "/events/backfill", b)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestAPIServer_HandleGetMetricValuesForTimePeriod(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	service := entity.TestService(t)
+	m1 := entity.TestMetric(t)
+	m2 := entity.TestMetric(t)
+	m2.Slug = "READING_TIME_NOTE_2"
+	e := entity.TestEvent(t)
+
+	repos.services.Create(service)
+	e.ServiceID = service.ServiceID
+	repos.metrics.Create(m1)
+	repos.metrics.Create(m2)
+	repos.events.Create(e)
+
+	repos.events.AddMetricsToEvent(e.EventID, []*entity.AddMetric{
+		{
+			MetricID:    m1.MetricID,
+			MetricValue: time.Duration(10 * time.Second).String(),
+		},
+	})
+
+	testCases := []struct {
+		name         string
+		payload      interface{}
+		expectedCode int
+	}{
+		{
+			name: "valid",
+			payload: map[string]interface{}{
+				"service_id": service.ServiceID,
+				"period": [2]*entity.CustomTime{
+					{Time: time.Now().AddDate(0, 0, -1)},
+					{Time: time.Now().AddDate(0, 0, +1)},
+				},
+				"metric_id": m1.MetricID,
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "slugs",
+			payload: map[string]interface{}{
+				"service_slug": "note book",
+				"period": [2]*entity.CustomTime{
+					{Time: time.Now().AddDate(0, 0, -1)},
+					{Time: time.Now().AddDate(0, 0, +1)},
+				},
+				"metric_slug": "reading time note 1",
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "service slug not found",
+			payload: map[string]interface{}{
+				"service_slug": "TODO_APP",
+				"period": [2]*entity.CustomTime{
+					{Time: time.Now().AddDate(0, 0, -1)},
+					{Time: time.Now().AddDate(0, 0, +1)},
+				},
+				"metric_slug": m1.Slug,
+			},
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name: "invalid period",
+			payload: map[string]interface{}{
+				"service_id": service.ServiceID,
 				"period": [2]*entity.CustomTime{
 					{Time: time.Now().AddDate(0, 0, +1)},
 					{Time: time.Now().AddDate(0, 0, -1)},
@@ -389,6 +1138,2097 @@ func TestAPIServer_HandleGetMetricValuesForTimePeriod(t *testing.T) {
 
 			s.ServeHTTP(rec, req)
 			assert.Equal(t, tc.expectedCode, rec.Code)
+			assert.Equal(t, "true", rec.Header().Get("Deprecation"))
 		})
 	}
 }
+
+func TestAPIServer_HandleAggregateMetricValuesForTimePeriod(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	service := entity.TestService(t)
+	m1 := entity.TestMetric(t)
+	m2 := entity.TestMetric(t)
+	m2.Slug = "READING_TIME_NOTE_2"
+	e := entity.TestEvent(t)
+
+	repos.services.Create(service)
+	e.ServiceID = service.ServiceID
+	repos.metrics.Create(m1)
+	repos.metrics.Create(m2)
+	repos.events.Create(e)
+
+	repos.events.AddMetricsToEvent(e.EventID, []*entity.AddMetric{
+		{
+			MetricID:    m1.MetricID,
+			MetricValue: time.Duration(10 * time.Second).String(),
+		},
+	})
+
+	period := [2]*entity.CustomTime{
+		{Time: time.Now().AddDate(0, 0, -1)},
+		{Time: time.Now().AddDate(0, 0, +1)},
+	}
+
+	testCases := []struct {
+		name         string
+		payload      interface{}
+		expectedCode int
+	}{
+		{
+			name: "valid",
+			payload: map[string]interface{}{
+				"service_id": service.ServiceID,
+				"period":     period,
+				"metric_id":  m1.MetricID,
+				"bucket":     "1h",
+				"functions":  []string{"count", "avg", "p95"},
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "invalid bucket",
+			payload: map[string]interface{}{
+				"service_id": service.ServiceID,
+				"period":     period,
+				"metric_id":  m1.MetricID,
+				"bucket":     "hour",
+				"functions":  []string{"count"},
+			},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name: "function not supported by metric type",
+			payload: map[string]interface{}{
+				"service_id": service.ServiceID,
+				"period":     period,
+				"metric_id":  m1.MetricID,
+				"bucket":     "1h",
+				"functions":  []string{"true_ratio"},
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "metric not found",
+			payload: map[string]interface{}{
+				"service_id": service.ServiceID,
+				"period":     period,
+				"metric_id":  m2.MetricID + 1,
+				"bucket":     "1h",
+				"functions":  []string{"count"},
+			},
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "invalid payload",
+			payload:      "",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			b := &bytes.Buffer{}
+			json.NewEncoder(b).Encode(tc.payload)
+			req, _ := http.NewRequest(http.MethodGet, "/events/aggregate", b)
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+			assert.Equal(t, "true", rec.Header().Get("Deprecation"))
+		})
+	}
+}
+
+func TestAPIServer_HandleGetMetricValuesForTimePeriod_Query(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	service := entity.TestService(t)
+	metric := entity.TestMetric(t)
+	e := entity.TestEvent(t)
+
+	repos.services.Create(service)
+	repos.metrics.Create(metric)
+	e.ServiceID = service.ServiceID
+	uc.EventCreateWithMetrics(e, []*entity.AddMetric{{MetricID: metric.MetricID, MetricValue: "10s"}})
+
+	from := url.QueryEscape(time.Now().AddDate(0, 0, -1).Format(time.RFC3339))
+	to := url.QueryEscape(time.Now().AddDate(0, 0, +1).Format(time.RFC3339))
+
+	testCases := []struct {
+		name         string
+		path         string
+		expectedCode int
+	}{
+		{
+			name:         "ids",
+			path:         "/services/1/metrics/1/values?from=" + from + "&to=" + to,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "slugs",
+			path:         "/services/note_book/metrics/READING_TIME_NOTE_1/values?from=" + from + "&to=" + to,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "aggregate",
+			path:         "/services/1/metrics/1/aggregate?from=" + from + "&to=" + to + "&bucket=1h&functions=count,avg&functions=p95",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "blank period",
+			path:         "/services/1/metrics/1/values?from=" + from,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid period",
+			path:         "/services/1/metrics/1/values?from=" + to + "&to=" + from,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid time",
+			path:         "/services/1/metrics/1/values?from=yesterday&to=" + to,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid bucket",
+			path:         "/services/1/metrics/1/aggregate?from=" + from + "&to=" + to + "&bucket=week&functions=count",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid function",
+			path:         "/services/1/metrics/1/aggregate?from=" + from + "&to=" + to + "&bucket=1h&functions=median",
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "service not found",
+			path:         "/services/2/metrics/1/values?from=" + from + "&to=" + to,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "metric not found",
+			path:         "/services/1/metrics/READING_TIME/values?from=" + from + "&to=" + to,
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+			assert.Empty(t, rec.Header().Get("Deprecation"))
+		})
+	}
+}
+
+func TestParseValuesQuery(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/services/1/metrics/reading_time/aggregate?from=2023-10-06T10:00:00+03:00&to=2023-10-09T10:00:00Z&functions=count,avg&functions=p95", nil)
+	req = mux.SetURLVars(req, map[string]string{"service": "1", "metric": "reading_time"})
+
+	q, err := parseValuesQuery(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, q.ServiceID)
+	assert.Equal(t, "reading_time", q.MetricSlug)
+	assert.Equal(t, []string{"count", "avg", "p95"}, q.Functions)
+
+	_, offset := q.Period[0].Zone()
+	assert.Equal(t, 3*60*60, offset)
+
+	assert.Equal(t, errBlankPeriod, (&valuesQuery{}).validate(false))
+	q.Period[0], q.Period[1] = q.Period[1], q.Period[0]
+	assert.Equal(t, errInvalidPeriod, q.validate(false))
+}
+
+func TestWriteExposition(t *testing.T) {
+	ts := entity.CustomTime{Time: time.Date(2023, 10, 8, 20, 0, 0, 0, time.UTC)}
+	values := []*entity.LatestValue{
+		{ServiceSlug: "TODO_APP", MetricSlug: "INT_METRIC", TimeStamp: ts, Value: int64(25)},
+		{ServiceSlug: "TODO_APP", MetricSlug: "DURATION_METRIC", TimeStamp: ts, Value: 90 * time.Second},
+		{ServiceSlug: "TODO_APP", MetricSlug: "BOOL_METRIC", TimeStamp: ts, Value: true},
+		{ServiceSlug: "TODO_APP", MetricSlug: "STRING_METRIC", TimeStamp: ts, Value: `say "hi"`},
+		{ServiceSlug: "TODO_APP", MetricSlug: "TIMESTAMP_METRIC", TimeStamp: ts, Value: ts.Time},
+	}
+
+	b := &bytes.Buffer{}
+	assert.NoError(t, writeExposition(b, values))
+	assert.Equal(t, `# HELP dwh_metric_value Latest value of an INT, FLOAT or BOOL metric, BOOL is exported as 0 or 1.
+# TYPE dwh_metric_value gauge
+dwh_metric_value{service="TODO_APP",metric="INT_METRIC"} 25 1696795200000
+dwh_metric_value{service="TODO_APP",metric="BOOL_METRIC"} 1 1696795200000
+# HELP dwh_metric_duration_seconds Latest value of a DURATION metric in seconds.
+# TYPE dwh_metric_duration_seconds gauge
+dwh_metric_duration_seconds{service="TODO_APP",metric="DURATION_METRIC"} 90 1696795200000
+# HELP dwh_metric_timestamp_seconds Latest value of a TIMESTAMP_WITH_TIMEZONE metric in seconds since the unix epoch.
+# TYPE dwh_metric_timestamp_seconds gauge
+dwh_metric_timestamp_seconds{service="TODO_APP",metric="TIMESTAMP_METRIC"} 1.6967952e+09 1696795200000
+# HELP dwh_metric_info Latest value of a STRING metric in the value label.
+# TYPE dwh_metric_info gauge
+dwh_metric_info{service="TODO_APP",metric="STRING_METRIC",value="say \"hi\""} 1 1696795200000
+`, b.String())
+
+	assert.Error(t, writeExposition(b, []*entity.LatestValue{{Value: []int{1}}}))
+}
+
+func TestAPIServer_HandleFederate(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	service := entity.TestService(t)
+	m1 := entity.TestMetric(t)
+	m2 := entity.TestMetric(t)
+	m2.Slug = "READING_TIME_NOTE_2"
+
+	repos.services.Create(service)
+	repos.metrics.Create(m1)
+	repos.metrics.Create(m2)
+
+	for _, v := range []string{"10s", "15s"} {
+		e := entity.TestEvent(t)
+		e.ServiceID = service.ServiceID
+		uc.EventCreateWithMetrics(e, []*entity.AddMetric{
+			{MetricID: m1.MetricID, MetricValue: v},
+			{MetricID: m2.MetricID, MetricValue: v},
+		})
+	}
+
+	testCases := []struct {
+		name            string
+		query           string
+		expectedSamples int
+	}{
+		{
+			name:            "all",
+			query:           "",
+			expectedSamples: 2,
+		},
+		{
+			name:            "metric",
+			query:           "?service=note_book&metric=reading_time_note_2",
+			expectedSamples: 1,
+		},
+		{
+			name:            "unexisted service",
+			query:           "?service=TODO_APP",
+			expectedSamples: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/federate"+tc.query, nil)
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, expositionContentType, rec.Header().Get("Content-Type"))
+			assert.Equal(t, tc.expectedSamples, strings.Count(rec.Body.String(), "dwh_metric_duration_seconds{"))
+		})
+	}
+}
+
+// encodeWriteRequest encodes series as a prometheus.WriteRequest, every series is a set of labels and samples.
+func encodeWriteRequest(series []*timeSeries) []byte {
+	var req []byte
+	for _, ts := range series {
+		var b []byte
+
+		names := make([]string, 0, len(ts.labels))
+		for name := range ts.labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			var l []byte
+			l = protowire.AppendTag(l, 1, protowire.BytesType)
+			l = protowire.AppendString(l, name)
+			l = protowire.AppendTag(l, 2, protowire.BytesType)
+			l = protowire.AppendString(l, ts.labels[name])
+
+			b = protowire.AppendTag(b, 1, protowire.BytesType)
+			b = protowire.AppendBytes(b, l)
+		}
+
+		for _, s := range ts.samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(s.value))
+			sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(s.timestamp))
+
+			b = protowire.AppendTag(b, 2, protowire.BytesType)
+			b = protowire.AppendBytes(b, sb)
+		}
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, b)
+	}
+	return req
+}
+
+func TestDecodeWriteRequest(t *testing.T) {
+	series := []*timeSeries{
+		{
+			labels:  map[string]string{"__name__": "up", "job": "note-book", "instance": "localhost:9090"},
+			samples: []promSample{{value: 1, timestamp: 1696795200000}, {value: 0, timestamp: 1696795215000}},
+		},
+		{
+			labels:  map[string]string{"__name__": "http_requests_total", "job": "note-book"},
+			samples: []promSample{{value: 42.5, timestamp: 1696795200000}},
+		},
+	}
+
+	req, err := decodeWriteRequest(encodeWriteRequest(series))
+	assert.NoError(t, err)
+	assert.Equal(t, series, req.series)
+
+	_, err = decodeWriteRequest([]byte{0x0a, 0x05, 0x01})
+	assert.ErrorIs(t, err, errInvalidWriteRequest)
+}
+
+func TestRemoteWriteEvents(t *testing.T) {
+	now := int64(1696795200000)
+	req := &writeRequest{
+		series: []*timeSeries{
+			{
+				labels:  map[string]string{"__name__": "cpu_seconds_total", "job": "note-book", "mode": "user"},
+				samples: []promSample{{value: 1, timestamp: now}, {value: math.Float64frombits(0x7ff0000000000002), timestamp: now + 15000}},
+			},
+			{
+				labels:  map[string]string{"__name__": "memory:bytes", "job": "note-book", "mode": "user"},
+				samples: []promSample{{value: 2, timestamp: now}},
+			},
+			{
+				labels:  map[string]string{"__name__": "cpu_seconds_total", "instance": "localhost:9090"},
+				samples: []promSample{{value: 3, timestamp: now}},
+			},
+			{
+				labels:  map[string]string{"__name__": "up"},
+				samples: []promSample{{value: 1, timestamp: now}},
+			},
+		},
+	}
+
+	g, rejected := remoteWriteEvents(req)
+	assert.Equal(t, 1, rejected)
+	assert.Equal(t, 3, g.points())
+
+	events := g.events
+	assert.Len(t, events, 2)
+
+	assert.Equal(t, "note_book", events[0].event.ServiceSlug)
+	assert.Equal(t, map[string]string{"mode": "user"}, events[0].event.Labels)
+	assert.Equal(t, time.UnixMilli(now).UTC(), events[0].event.TimeStamp.Time)
+	assert.Equal(t, []*entity.AddMetric{
+		{MetricSlug: "cpu_seconds_total", MetricValue: float64(1)},
+		{MetricSlug: "memory_bytes", MetricValue: float64(2)},
+	}, events[0].metrics)
+
+	assert.Equal(t, "localhost_9090", events[1].event.ServiceSlug)
+	assert.Empty(t, events[1].event.Labels)
+}
+
+func TestRetryableError(t *testing.T) {
+	storageErr := fmt.Errorf("connection refused")
+
+	testCases := []struct {
+		name string
+		errs []error
+		err  error
+	}{
+		{
+			name: "stored",
+			errs: []error{nil, nil},
+		},
+		{
+			name: "rejected",
+			errs: []error{entity.ErrInvalidMetricValue, nil},
+		},
+		{
+			name: "nothing stored",
+			errs: []error{entity.ErrInvalidMetricValue, storageErr, storageErr},
+			err:  storageErr,
+		},
+		{
+			name: "partly stored",
+			errs: []error{storageErr, nil},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.err, retryableError(tc.errs))
+		})
+	}
+}
+
+func TestAPIServer_HandleRemoteWrite(t *testing.T) {
+	now := time.Now().UnixMilli()
+
+	testCases := []struct {
+		name         string
+		autoRegister bool
+		body         func() []byte
+		expectedCode int
+		expectedLen  int
+	}{
+		{
+			name: "valid",
+			body: func() []byte {
+				return snappy.Encode(nil, encodeWriteRequest([]*timeSeries{
+					{
+						labels:  map[string]string{"__name__": "reading_time_note_1", "job": "note_book"},
+						samples: []promSample{{value: 15, timestamp: now}},
+					},
+				}))
+			},
+			expectedCode: http.StatusNoContent,
+			expectedLen:  1,
+		},
+		{
+			name: "unknown metric",
+			body: func() []byte {
+				return snappy.Encode(nil, encodeWriteRequest([]*timeSeries{
+					{
+						labels:  map[string]string{"__name__": "go_goroutines", "job": "note_book"},
+						samples: []promSample{{value: 7, timestamp: now}},
+					},
+				}))
+			},
+			expectedCode: http.StatusBadRequest,
+			expectedLen:  0,
+		},
+		{
+			name:         "auto register",
+			autoRegister: true,
+			body: func() []byte {
+				return snappy.Encode(nil, encodeWriteRequest([]*timeSeries{
+					{
+						labels:  map[string]string{"__name__": "go_goroutines", "job": "note_book"},
+						samples: []promSample{{value: 7, timestamp: now}},
+					},
+				}))
+			},
+			expectedCode: http.StatusNoContent,
+			expectedLen:  1,
+		},
+		{
+			name: "stale marker",
+			body: func() []byte {
+				return snappy.Encode(nil, encodeWriteRequest([]*timeSeries{
+					{
+						labels:  map[string]string{"__name__": "reading_time_note_1", "job": "note_book"},
+						samples: []promSample{{value: math.Float64frombits(0x7ff0000000000002), timestamp: now}},
+					},
+				}))
+			},
+			expectedCode: http.StatusNoContent,
+			expectedLen:  0,
+		},
+		{
+			name: "not compressed",
+			body: func() []byte {
+				return []byte("up 1")
+			},
+			expectedCode: http.StatusBadRequest,
+			expectedLen:  0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			uc, repos := newTestUseCaseWithRepositories(t)
+
+			config := NewConfig()
+			config.RemoteWriteAutoRegister = tc.autoRegister
+			s, _ := NewAPIServer(config, uc)
+
+			service := entity.TestService(t)
+			m := entity.TestMetric(t)
+			m.MetricType = "FLOAT"
+			repos.services.Create(service)
+			repos.metrics.Create(m)
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(tc.body()))
+			req.Header.Set("Content-Encoding", "snappy")
+			req.Header.Set("Content-Type", "application/x-protobuf")
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+
+			values, err := uc.LatestMetricValues(nil, nil)
+			assert.NoError(t, err)
+			assert.Len(t, values, tc.expectedLen)
+		})
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	ts := time.Date(2023, 10, 8, 20, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name      string
+		line      string
+		precision time.Duration
+		expected  *linePoint
+		isValid   bool
+	}{
+		{
+			name:      "all field types",
+			line:      `weather,location=us-midwest,season=summer temperature=82,humidity=71i,raining=f,note="sunny, \"hot\"" 1696795200000000000`,
+			precision: time.Nanosecond,
+			expected: &linePoint{
+				measurement: "weather",
+				tags:        map[string]string{"location": "us-midwest", "season": "summer"},
+				fields: []*lineField{
+					{key: "temperature", value: float64(82), metricType: "FLOAT"},
+					{key: "humidity", value: int64(71), metricType: "INT"},
+					{key: "raining", value: false, metricType: "BOOL"},
+					{key: "note", value: `sunny, "hot"`, metricType: "STRING"},
+				},
+				timestamp: &ts,
+			},
+			isValid: true,
+		},
+		{
+			name:      "escaped names and precision",
+			line:      `my\ sensor,room\,floor=1\=2 reading\ count=5u 1696795200`,
+			precision: time.Second,
+			expected: &linePoint{
+				measurement: "my sensor",
+				tags:        map[string]string{"room,floor": "1=2"},
+				fields: []*lineField{
+					{key: "reading count", value: int64(5), metricType: "INT"},
+				},
+				timestamp: &ts,
+			},
+			isValid: true,
+		},
+		{
+			name:      "without timestamp",
+			line:      `cpu usage=0.5`,
+			precision: time.Nanosecond,
+			expected: &linePoint{
+				measurement: "cpu",
+				tags:        map[string]string{},
+				fields: []*lineField{
+					{key: "usage", value: 0.5, metricType: "FLOAT"},
+				},
+			},
+			isValid: true,
+		},
+		{
+			name:      "without fields",
+			line:      `cpu,host=a`,
+			precision: time.Nanosecond,
+			isValid:   false,
+		},
+		{
+			name:      "invalid integer",
+			line:      `cpu usage=0.5i`,
+			precision: time.Nanosecond,
+			isValid:   false,
+		},
+		{
+			name:      "unterminated string",
+			line:      `cpu note="abc`,
+			precision: time.Nanosecond,
+			isValid:   false,
+		},
+		{
+			name:      "invalid timestamp",
+			line:      `cpu usage=1 now`,
+			precision: time.Nanosecond,
+			isValid:   false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := parseLine(tc.line, tc.precision)
+			if tc.isValid {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, p)
+			} else {
+				assert.ErrorIs(t, err, errInvalidLine)
+			}
+		})
+	}
+}
+
+func TestAPIServer_HandleLineProtocolWrite(t *testing.T) {
+	now := time.Now()
+
+	gzipped := func(s string) []byte {
+		b := &bytes.Buffer{}
+		gz := gzip.NewWriter(b)
+		gz.Write([]byte(s))
+		gz.Close()
+		return b.Bytes()
+	}
+
+	testCases := []struct {
+		name           string
+		autoRegister   bool
+		query          string
+		body           []byte
+		gzip           bool
+		expectedCode   int
+		expectedErrors []int
+		expectedLen    int
+	}{
+		{
+			name:         "valid",
+			query:        "?precision=ms",
+			body:         []byte(fmt.Sprintf("note_book,host=a reading_time_note_1=\"15s\" %d\n", now.UnixMilli())),
+			expectedCode: http.StatusNoContent,
+			expectedLen:  1,
+		},
+		{
+			name:         "gzip",
+			body:         gzipped("note_book reading_time_note_1=\"15s\"\n"),
+			gzip:         true,
+			expectedCode: http.StatusNoContent,
+			expectedLen:  1,
+		},
+		{
+			name:         "too large",
+			body:         []byte(strings.Repeat("#\n", maxIngestSize/2+1)),
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedLen:  0,
+		},
+		{
+			name:         "too large decompressed",
+			body:         gzipped(strings.Repeat("#\n", maxIngestSize/2+1)),
+			gzip:         true,
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedLen:  0,
+		},
+		{
+			name:           "per-line errors",
+			body:           []byte("note_book reading_time_note_1=\"15s\"\n# comment\nnote_book reading_time_note_1=15i\nnote_book\ntodo_app reading_time_note_1=\"15s\"\n"),
+			expectedCode:   http.StatusBadRequest,
+			expectedErrors: []int{3, 4, 5},
+			expectedLen:    1,
+		},
+		{
+			name:           "unknown field",
+			body:           []byte("note_book errors=3i\n"),
+			expectedCode:   http.StatusBadRequest,
+			expectedErrors: []int{1},
+			expectedLen:    0,
+		},
+		{
+			name:         "auto register",
+			autoRegister: true,
+			body:         []byte("note_book errors=3i,healthy=t\n"),
+			expectedCode: http.StatusNoContent,
+			expectedLen:  2,
+		},
+		{
+			name:         "invalid precision",
+			query:        "?precision=h",
+			body:         []byte("note_book reading_time_note_1=\"15s\"\n"),
+			expectedCode: http.StatusBadRequest,
+			expectedLen:  0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			uc, repos := newTestUseCaseWithRepositories(t)
+
+			config := NewConfig()
+			config.LineProtocolAutoRegister = tc.autoRegister
+			s, _ := NewAPIServer(config, uc)
+
+			repos.services.Create(entity.TestService(t))
+			repos.metrics.Create(entity.TestMetric(t))
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/write"+tc.query, bytes.NewReader(tc.body))
+			if tc.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+
+			if tc.expectedErrors != nil {
+				resp := &struct {
+					Errors []struct {
+						Line int `json:"line"`
+					} `json:"errors"`
+				}{}
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(resp))
+
+				lines := make([]int, len(resp.Errors))
+				for i, e := range resp.Errors {
+					lines[i] = e.Line
+				}
+				assert.Equal(t, tc.expectedErrors, lines)
+			}
+
+			values, err := uc.LatestMetricValues(nil, nil)
+			assert.NoError(t, err)
+			assert.Len(t, values, tc.expectedLen)
+		})
+	}
+}
+
+func TestOTLPEvents(t *testing.T) {
+	now := time.Now()
+	ts := uint64(time.Date(2023, 10, 8, 20, 0, 0, 0, time.UTC).UnixNano())
+	sum := 7.5
+
+	attributes := []*commonpb.KeyValue{
+		{Key: "route", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "/notes"}}},
+	}
+
+	req := &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{
+			{
+				Resource: &resourcepb.Resource{
+					Attributes: []*commonpb.KeyValue{
+						{Key: "service.name", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "note-book"}}},
+					},
+				},
+				ScopeMetrics: []*metricspb.ScopeMetrics{
+					{
+						Metrics: []*metricspb.Metric{
+							{
+								Name: "http.server.active_requests",
+								Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{DataPoints: []*metricspb.NumberDataPoint{
+									{TimeUnixNano: ts, Attributes: attributes, Value: &metricspb.NumberDataPoint_AsInt{AsInt: 3}},
+								}}},
+							},
+							{
+								Name: "cpu.utilization",
+								Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+									{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 0.25}},
+									{TimeUnixNano: ts, Flags: 1, Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 0.5}},
+								}}},
+							},
+							{
+								Name: "http.server.duration",
+								Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{DataPoints: []*metricspb.HistogramDataPoint{
+									{
+										TimeUnixNano:   ts,
+										Attributes:     attributes,
+										Count:          3,
+										Sum:            &sum,
+										ExplicitBounds: []float64{1, 2.5},
+										BucketCounts:   []uint64{1, 1, 1},
+									},
+								}}},
+							},
+						},
+					},
+				},
+			},
+			{
+				ScopeMetrics: []*metricspb.ScopeMetrics{
+					{
+						Metrics: []*metricspb.Metric{
+							{
+								Name: "up",
+								Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+									{TimeUnixNano: ts, Value: &metricspb.NumberDataPoint_AsInt{AsInt: 1}},
+								}}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	g, rejected := otlpEvents(req, now)
+	assert.Equal(t, 1, rejected)
+	assert.Equal(t, 7, g.points())
+
+	events := g.events
+	assert.Len(t, events, 5)
+
+	assert.Equal(t, "note_book", events[0].event.ServiceSlug)
+	assert.Equal(t, time.Unix(0, int64(ts)).UTC(), events[0].event.TimeStamp.Time)
+	assert.Equal(t, map[string]string{"route": "/notes"}, events[0].event.Labels)
+	assert.Equal(t, []*entity.AddMetric{
+		{MetricSlug: "http_server_active_requests", MetricValue: int64(3)},
+		{MetricSlug: "http_server_duration_COUNT", MetricValue: int64(3)},
+		{MetricSlug: "http_server_duration_SUM", MetricValue: 7.5},
+	}, events[0].metrics)
+	assert.Equal(t, []string{"INT", "INT", "FLOAT"}, events[0].types)
+
+	assert.Equal(t, now, events[1].event.TimeStamp.Time)
+	assert.Equal(t, []*entity.AddMetric{{MetricSlug: "cpu_utilization", MetricValue: 0.25}}, events[1].metrics)
+
+	for i, le := range []string{"1", "2.5", "+Inf"} {
+		assert.Equal(t, map[string]string{"route": "/notes", "le": le}, events[i+2].event.Labels)
+		assert.Equal(t, []*entity.AddMetric{{MetricSlug: "http_server_duration_BUCKET", MetricValue: int64(i + 1)}}, events[i+2].metrics)
+	}
+}
+
+func TestAPIServer_HandleOTLPMetrics(t *testing.T) {
+	now := uint64(time.Now().UnixNano())
+
+	request := func(service string) *colmetricspb.ExportMetricsServiceRequest {
+		return &colmetricspb.ExportMetricsServiceRequest{
+			ResourceMetrics: []*metricspb.ResourceMetrics{
+				{
+					Resource: &resourcepb.Resource{
+						Attributes: []*commonpb.KeyValue{
+							{Key: "service.name", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: service}}},
+						},
+					},
+					ScopeMetrics: []*metricspb.ScopeMetrics{
+						{
+							Metrics: []*metricspb.Metric{
+								{
+									Name: "queue.size",
+									Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+										{TimeUnixNano: now, Value: &metricspb.NumberDataPoint_AsInt{AsInt: 12}},
+									}}},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	gzipped := func(b []byte) []byte {
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		gz.Write(b)
+		gz.Close()
+		return buf.Bytes()
+	}
+
+	testCases := []struct {
+		name             string
+		contentType      string
+		body             func() []byte
+		gzip             bool
+		expectedCode     int
+		expectedRejected int64
+		expectedLen      int
+	}{
+		{
+			name:        "protobuf",
+			contentType: otlpContentTypeProtobuf,
+			body: func() []byte {
+				b, _ := proto.Marshal(request("note_book"))
+				return b
+			},
+			expectedCode: http.StatusOK,
+			expectedLen:  1,
+		},
+		{
+			name:        "json",
+			contentType: otlpContentTypeJSON,
+			body: func() []byte {
+				b, _ := protojson.Marshal(request("note_book"))
+				return b
+			},
+			expectedCode: http.StatusOK,
+			expectedLen:  1,
+		},
+		{
+			name:        "gzip",
+			contentType: otlpContentTypeProtobuf,
+			body: func() []byte {
+				b, _ := proto.Marshal(request("note_book"))
+				return gzipped(b)
+			},
+			gzip:         true,
+			expectedCode: http.StatusOK,
+			expectedLen:  1,
+		},
+		{
+			name:        "too large decompressed",
+			contentType: otlpContentTypeProtobuf,
+			body: func() []byte {
+				return gzipped(make([]byte, maxIngestSize+1))
+			},
+			gzip:         true,
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedLen:  0,
+		},
+		{
+			name:        "unknown service",
+			contentType: otlpContentTypeProtobuf,
+			body: func() []byte {
+				b, _ := proto.Marshal(request("todo_app"))
+				return b
+			},
+			expectedCode:     http.StatusOK,
+			expectedRejected: 1,
+			expectedLen:      0,
+		},
+		{
+			name:        "invalid json",
+			contentType: otlpContentTypeJSON,
+			body: func() []byte {
+				return []byte(`{"resourceMetrics": 1}`)
+			},
+			expectedCode: http.StatusBadRequest,
+			expectedLen:  0,
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "text/plain",
+			body: func() []byte {
+				return []byte("queue.size 12")
+			},
+			expectedCode: http.StatusUnsupportedMediaType,
+			expectedLen:  0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			uc, repos := newTestUseCaseWithRepositories(t)
+
+			config := NewConfig()
+			config.OTLPAutoRegister = true
+			s, _ := NewAPIServer(config, uc)
+
+			repos.services.Create(entity.TestService(t))
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(tc.body()))
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+
+			if tc.expectedCode == http.StatusOK {
+				resp := &colmetricspb.ExportMetricsServiceResponse{}
+				if tc.contentType == otlpContentTypeJSON {
+					assert.NoError(t, protojson.Unmarshal(rec.Body.Bytes(), resp))
+				} else {
+					assert.NoError(t, proto.Unmarshal(rec.Body.Bytes(), resp))
+				}
+				assert.Equal(t, tc.expectedRejected, resp.GetPartialSuccess().GetRejectedDataPoints())
+			}
+
+			values, err := uc.LatestMetricValues(nil, nil)
+			assert.NoError(t, err)
+			assert.Len(t, values, tc.expectedLen)
+		})
+	}
+}
+
+func TestAPIServer_HandleLiveValues(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	service := entity.TestService(t)
+	metric := entity.TestMetric(t)
+	repos.services.Create(service)
+	repos.metrics.Create(metric)
+
+	testCases := []struct {
+		name         string
+		query        string
+		expectedCode int
+	}{
+		{
+			name:         "without series",
+			query:        "",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid series",
+			query:        "?series=note_book",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unexisted metric",
+			query:        "?series=note_book:reading_time",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/events/live"+tc.query, nil)
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+		})
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		ts := httptest.NewServer(s)
+		defer ts.Close()
+
+		resp, err := http.Get(ts.URL + "/events/live?series=note_book:" + metric.Slug)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		scanner := bufio.NewScanner(resp.Body)
+		assert.True(t, scanner.Scan())
+		assert.Equal(t, ": subscribed", scanner.Text())
+
+		e := entity.TestEvent(t)
+		e.ServiceID = service.ServiceID
+		assert.NoError(t, uc.EventCreateWithMetrics(e, []*entity.AddMetric{{MetricID: metric.MetricID, MetricValue: "15s"}}))
+
+		var lines []string
+		for scanner.Scan() && len(lines) < 2 {
+			if scanner.Text() != "" {
+				lines = append(lines, scanner.Text())
+			}
+		}
+
+		assert.Equal(t, "event: value", lines[0])
+
+		v := &liveValue{}
+		assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), v))
+		assert.Equal(t, e.EventID, v.EventID)
+		assert.Equal(t, "NOTE_BOOK", v.ServiceSlug)
+		assert.Equal(t, metric.Slug, v.MetricSlug)
+		assert.Equal(t, "15s", v.Value)
+	})
+}
+
+func TestAPIServer_Auth(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	config := NewConfig()
+	config.AuthMode = AuthAPIKey
+	config.AdminKey = "secret"
+	config.RemoteWriteAutoRegister = true
+	config.OTLPAutoRegister = true
+	s, _ := NewAPIServer(config, uc)
+
+	allowed := entity.TestService(t)
+	other := entity.TestService(t)
+	other.Slug = "other"
+	m := entity.TestMetric(t)
+	repos.services.Create(allowed)
+	repos.services.Create(other)
+	repos.metrics.Create(m)
+
+	serve := func(method, target, key string, body interface{}) *httptest.ResponseRecorder {
+		b := &bytes.Buffer{}
+		if body != nil {
+			json.NewEncoder(b).Encode(body)
+		}
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, target, b)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	createKey := func(scopes []string, serviceIDs []int) string {
+		rec := serve(http.MethodPost, "/api-keys", "secret", map[string]interface{}{
+			"name":        "collector",
+			"scopes":      scopes,
+			"service_ids": serviceIDs,
+		})
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		resp := &struct {
+			Key string `json:"key"`
+		}{}
+		json.NewDecoder(rec.Body).Decode(resp)
+		return resp.Key
+	}
+
+	event := func(serviceID int) map[string]interface{} {
+		return map[string]interface{}{
+			"service_id": serviceID,
+			"metrics":    []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: "10s"}},
+		}
+	}
+
+	readKey := createKey([]string{entity.ScopeRead}, nil)
+	writeKey := createKey([]string{entity.ScopeWrite}, []int{allowed.ServiceID})
+
+	rec := serve(http.MethodGet, "/services", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+
+	rec = serve(http.MethodGet, "/services", "dwh_unknown", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(http.MethodGet, "/services", readKey, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(http.MethodPost, "/events", readKey, event(allowed.ServiceID))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve(http.MethodPost, "/services", writeKey, map[string]string{"slug": "new"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve(http.MethodPost, "/events", writeKey, event(allowed.ServiceID))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = serve(http.MethodPost, "/events", writeKey, event(other.ServiceID))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve(http.MethodPost, "/events/batch", writeKey, []interface{}{event(allowed.ServiceID), event(other.ServiceID)})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	resp := &struct {
+		Accepted int `json:"accepted"`
+		Rejected int `json:"rejected"`
+	}{}
+	json.NewDecoder(rec.Body).Decode(resp)
+	assert.Equal(t, 1, resp.Accepted)
+	assert.Equal(t, 1, resp.Rejected)
+
+	// the metrics of points the key may not write are not registered
+	push := func(target, contentType string, body []byte) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+writeKey)
+		req.Header.Set("Content-Type", contentType)
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = push("/api/v1/write", "application/x-protobuf", snappy.Encode(nil, encodeWriteRequest([]*timeSeries{
+		{
+			labels:  map[string]string{"__name__": "go_goroutines", "job": other.Slug},
+			samples: []promSample{{value: 7, timestamp: time.Now().UnixMilli()}},
+		},
+	})))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = push("/v1/metrics", otlpContentTypeJSON, []byte(fmt.Sprintf(
+		`{"resourceMetrics": [{"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": %q}}]},
+		"scopeMetrics": [{"metrics": [{"name": "queue_size", "gauge": {"dataPoints": [{"timeUnixNano": "%d", "asInt": "12"}]}}]}]}]}`,
+		other.Slug,
+		time.Now().UnixNano(),
+	)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"rejectedDataPoints":"1"`)
+
+	for _, slug := range []string{"go_goroutines", "queue_size"} {
+		_, err := repos.metrics.FindBySlug(slug)
+		assert.ErrorIs(t, err, repository.ErrRecordNotFound, slug)
+	}
+
+	rec = serve(http.MethodGet, "/api-keys", writeKey, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve(http.MethodGet, "/api-keys", "secret", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var keys []*entity.APIKey
+	json.NewDecoder(rec.Body).Decode(&keys)
+	assert.Len(t, keys, 2)
+
+	rec = serve(http.MethodDelete, fmt.Sprintf("/api-keys/%d", keys[1].KeyID), "secret", nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = serve(http.MethodPost, "/events", writeKey, event(allowed.ServiceID))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(http.MethodPost, "/api-keys", "secret", map[string]interface{}{
+		"name":        "collector",
+		"scopes":      []string{entity.ScopeWrite},
+		"service_ids": []int{100},
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+}
+
+// signTestToken signs claims with an RSA key as RS256 or with an EC key as ES256.
+func signTestToken(t *testing.T, key crypto.Signer, kid string, claims map[string]interface{}) string {
+	t.Helper()
+
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		assert.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		assert.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestAPIServer_Tenants(t *testing.T) {
+	uc := newTestUseCase(t)
+	config := NewConfig()
+	config.AuthMode = AuthAPIKey
+	config.AdminKey = "secret"
+	s, _ := NewAPIServer(config, uc)
+
+	serve := func(method, target, key, tenant string, body interface{}) *httptest.ResponseRecorder {
+		b := &bytes.Buffer{}
+		if body != nil {
+			json.NewEncoder(b).Encode(body)
+		}
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, target, b)
+		req.Header.Set("Authorization", "Bearer "+key)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/tenants", "secret", "", map[string]string{"slug": "team_a", "details": "Notes team"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	tenant := &entity.Tenant{}
+	json.NewDecoder(rec.Body).Decode(tenant)
+	assert.Equal(t, "TEAM_A", tenant.Slug)
+
+	rec = serve(http.MethodPost, "/tenants", "secret", "", map[string]string{"slug": "TEAM_A", "details": "Notes team"})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = serve(http.MethodGet, "/tenants", "secret", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var tenants []*entity.Tenant
+	json.NewDecoder(rec.Body).Decode(&tenants)
+	assert.Len(t, tenants, 2)
+
+	// the same slug is created in both tenants, each one sees its own service
+	service := map[string]string{"slug": "note_book", "details": "Notebook service"}
+	rec = serve(http.MethodPost, "/services", "secret", "", service)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	defaultService := &entity.Service{}
+	json.NewDecoder(rec.Body).Decode(defaultService)
+
+	rec = serve(http.MethodPost, "/services", "secret", "team_a", service)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	tenantService := &entity.Service{}
+	json.NewDecoder(rec.Body).Decode(tenantService)
+
+	rec = serve(http.MethodGet, fmt.Sprintf("/services/%d", defaultService.ServiceID), "secret", "TEAM_A", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serve(http.MethodGet, fmt.Sprintf("/services/%d", tenantService.ServiceID), "secret", fmt.Sprint(tenant.TenantID), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(http.MethodGet, "/services", "secret", "unknown", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// a key created within a tenant is bound to it
+	rec = serve(http.MethodPost, "/api-keys", "secret", "team_a", map[string]interface{}{
+		"name":   "team_a",
+		"scopes": []string{entity.ScopeAdmin},
+	})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	resp := &struct {
+		Key string `json:"key"`
+	}{}
+	json.NewDecoder(rec.Body).Decode(resp)
+
+	rec = serve(http.MethodGet, "/services", resp.Key, "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	list := &struct {
+		Services []*entity.Service `json:"services"`
+	}{}
+	json.NewDecoder(rec.Body).Decode(list)
+	if assert.Len(t, list.Services, 1) {
+		assert.Equal(t, tenantService.ServiceID, list.Services[0].ServiceID)
+	}
+
+	rec = serve(http.MethodGet, fmt.Sprintf("/services/%d", defaultService.ServiceID), resp.Key, "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serve(http.MethodGet, "/services", resp.Key, "default", nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve(http.MethodGet, "/tenants", resp.Key, "", nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve(http.MethodGet, "/api-keys", "secret", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var keys []*entity.APIKey
+	json.NewDecoder(rec.Body).Decode(&keys)
+	assert.Empty(t, keys)
+}
+
+func TestAPIServer_JWTAuth(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	set, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": "AQAB"},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		},
+	})
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(jwksFile, set, 0o600))
+
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(set)
+	}))
+	defer jwksServer.Close()
+
+	for _, source := range []string{jwksFile, jwksServer.URL} {
+		t.Run(source, func(t *testing.T) {
+			uc, repos := newTestUseCaseWithRepositories(t)
+			config := NewConfig()
+			config.AuthMode = AuthJWT
+			config.JWKS = source
+			config.JWTIssuer = "https://auth.example.com"
+			config.JWTAudience = "dwh"
+			config.JWTScopePrefix = "dwh:"
+			config.JWTUnboundScope = "tenants"
+			s, err := NewAPIServer(config, uc)
+			assert.NoError(t, err)
+
+			allowed := entity.TestService(t)
+			other := entity.TestService(t)
+			other.Slug = "other"
+			m := entity.TestMetric(t)
+			repos.services.Create(allowed)
+			repos.services.Create(other)
+			repos.metrics.Create(m)
+			repos.tenants.Create(entity.TestTenant(t))
+
+			claims := func(scope string, changes map[string]interface{}) map[string]interface{} {
+				c := map[string]interface{}{
+					"iss":   "https://auth.example.com",
+					"aud":   []string{"dwh", "other"},
+					"sub":   "collector",
+					"exp":   time.Now().Add(time.Hour).Unix(),
+					"scope": scope,
+				}
+				for k, v := range changes {
+					c[k] = v
+				}
+				return c
+			}
+
+			event := func(serviceID int) *bytes.Buffer {
+				b := &bytes.Buffer{}
+				json.NewEncoder(b).Encode(map[string]interface{}{
+					"service_id": serviceID,
+					"metrics":    []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: "10s"}},
+				})
+				return b
+			}
+
+			testCases := []struct {
+				name         string
+				method       string
+				target       string
+				token        string
+				tenant       string
+				body         func() *bytes.Buffer
+				expectedCode int
+			}{
+				{
+					name:         "RS256 read",
+					method:       http.MethodGet,
+					target:       "/services",
+					token:        signTestToken(t, rsaKey, "rsa", claims("openid dwh:read", nil)),
+					expectedCode: http.StatusOK,
+				},
+				{
+					name:         "ES256 scopes array",
+					method:       http.MethodGet,
+					target:       "/services",
+					token:        signTestToken(t, ecKey, "ec", claims("", map[string]interface{}{"scope": []string{"dwh:admin"}})),
+					expectedCode: http.StatusOK,
+				},
+				{
+					name:         "tenant claim",
+					method:       http.MethodGet,
+					target:       fmt.Sprintf("/services/%d", allowed.ServiceID),
+					token:        signTestToken(t, rsaKey, "rsa", claims("dwh:read", map[string]interface{}{"tenant": "team_a"})),
+					expectedCode: http.StatusNotFound,
+				},
+				{
+					name:         "token without tenant claim picks a tenant",
+					method:       http.MethodGet,
+					target:       "/services",
+					token:        signTestToken(t, rsaKey, "rsa", claims("dwh:admin", nil)),
+					tenant:       "team_a",
+					expectedCode: http.StatusForbidden,
+				},
+				{
+					name:         "token without tenant claim manages tenants",
+					method:       http.MethodGet,
+					target:       "/tenants",
+					token:        signTestToken(t, rsaKey, "rsa", claims("dwh:admin", nil)),
+					expectedCode: http.StatusForbidden,
+				},
+				{
+					name:         "unbound token picks a tenant",
+					method:       http.MethodGet,
+					target:       "/services",
+					token:        signTestToken(t, rsaKey, "rsa", claims("dwh:admin dwh:tenants", nil)),
+					tenant:       "team_a",
+					expectedCode: http.StatusOK,
+				},
+				{
+					name:         "unbound token manages tenants",
+					method:       http.MethodGet,
+					target:       "/tenants",
+					token:        signTestToken(t, rsaKey, "rsa", claims("dwh:admin dwh:tenants", nil)),
+					expectedCode: http.StatusOK,
+				},
+				{
+					name:         "unbound scope of a token with tenant claim",
+					method:       http.MethodGet,
+					target:       "/tenants",
+					token:        signTestToken(t, rsaKey, "rsa", claims("dwh:admin dwh:tenants", map[string]interface{}{"tenant": "team_a"})),
+					expectedCode: http.StatusForbidden,
+				},
+				{
+					name:         "unknown tenant claim",
+					method:       http.MethodGet,
+					target:       "/services",
+					token:        signTestToken(t, rsaKey, "rsa", claims("dwh:read", map[string]interface{}{"tenant": "unknown"})),
+					expectedCode: http.StatusUnauthorized,
+				},
+				{
+					name:         "no token",
+					method:       http.MethodGet,
+					target:       "/services",
+					expectedCode: http.StatusUnauthorized,
+				},
+				{
+					name:         "expired",
+					method:       http.MethodGet,
+					target:       "/services",
+					token:        signTestToken(t, rsaKey, "rsa", claims("dwh:read", map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+					expectedCode: http.StatusUnauthorized,
+				},
+				{
+					name:         "not valid yet",
+					method:       http.MethodGet,
+					target:       "/services",
+					token:        signTestToken(t, rsaKey, "rsa", claims("dwh:read", map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})),
+					expectedCode: http.StatusUnauthorized,
+				},
+				{
+					name:         "no exp",
+					method:       http.MethodGet,
+					target:       "/services",
+					token:        signTestToken(t, rsaKey, "rsa", claims("dwh:read", map[string]interface{}{"exp": nil})),
+					expectedCode: http.StatusUnauthorized,
+				},
+				{
+					name:         "other issuer",
+					method:       http.MethodGet,
+					target:       "/services",
+					token:        signTestToken(t, rsaKey, "rsa", claims("dwh:read", map[string]interface{}{"iss": "https://evil.example.com"})),
+					expectedCode: http.StatusUnauthorized,
+				},
+				{
+					name:         "other audience",
+					method:       http.MethodGet,
+					target:       "/services",
+					token:        signTestToken(t, rsaKey, "rsa", claims("dwh:read", map[string]interface{}{"aud": "other"})),
+					expectedCode: http.StatusUnauthorized,
+				},
+				{
+					name:         "signed with an unknown key",
+					method:       http.MethodGet,
+					target:       "/services",
+					token:        signTestToken(t, otherKey, "ec", claims("dwh:read", nil)),
+					expectedCode: http.StatusUnauthorized,
+				},
+				{
+					name:   "alg none",
+					method: http.MethodGet,
+					target: "/services",
+					token: b64([]byte(`{"alg":"none","kid":"rsa"}`)) + "." +
+						b64([]byte(fmt.Sprintf(`{"iss":"https://auth.example.com","aud":"dwh","exp":%d,"scope":"dwh:admin"}`, time.Now().Add(time.Hour).Unix()))) + ".",
+					expectedCode: http.StatusUnauthorized,
+				},
+				{
+					name:         "scope without prefix",
+					method:       http.MethodGet,
+					target:       "/services",
+					token:        signTestToken(t, rsaKey, "rsa", claims("read", nil)),
+					expectedCode: http.StatusForbidden,
+				},
+				{
+					name:         "read token adds event",
+					method:       http.MethodPost,
+					target:       "/events",
+					token:        signTestToken(t, rsaKey, "rsa", claims("dwh:read", nil)),
+					body:         func() *bytes.Buffer { return event(allowed.ServiceID) },
+					expectedCode: http.StatusForbidden,
+				},
+				{
+					name:         "write token of the service",
+					method:       http.MethodPost,
+					target:       "/events",
+					token:        signTestToken(t, ecKey, "ec", claims("dwh:write", map[string]interface{}{"service_ids": []int{allowed.ServiceID}})),
+					body:         func() *bytes.Buffer { return event(allowed.ServiceID) },
+					expectedCode: http.StatusCreated,
+				},
+				{
+					name:         "write token of another service",
+					method:       http.MethodPost,
+					target:       "/events",
+					token:        signTestToken(t, ecKey, "ec", claims("dwh:write", map[string]interface{}{"service_ids": []int{allowed.ServiceID}})),
+					body:         func() *bytes.Buffer { return event(other.ServiceID) },
+					expectedCode: http.StatusForbidden,
+				},
+			}
+
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					body := &bytes.Buffer{}
+					if tc.body != nil {
+						body = tc.body()
+					}
+
+					rec := httptest.NewRecorder()
+					req, _ := http.NewRequest(tc.method, tc.target, body)
+					if tc.token != "" {
+						req.Header.Set("Authorization", "Bearer "+tc.token)
+					}
+					if tc.tenant != "" {
+						req.Header.Set("X-Tenant", tc.tenant)
+					}
+
+					s.ServeHTTP(rec, req)
+					assert.Equal(t, tc.expectedCode, rec.Code)
+				})
+			}
+		})
+	}
+
+	config := NewConfig()
+	config.AuthMode = AuthJWT
+	_, err = NewAPIServer(config, nil)
+	assert.ErrorIs(t, err, errBlankJWTConfig)
+
+	config.AuthMode = "basic"
+	_, err = NewAPIServer(config, nil)
+	assert.ErrorIs(t, err, errUnknownAuthMode)
+
+	config.AuthMode = AuthAPIKey
+	_, err = NewAPIServer(config, nil)
+	assert.ErrorIs(t, err, errBlankAdminKey)
+}
+
+func TestAPIServer_RateLimit(t *testing.T) {
+	uc := newTestUseCase(t)
+	config := NewConfig()
+	config.AuthMode = AuthAPIKey
+	config.AdminKey = "secret"
+	config.RateLimits = map[string]*RateLimit{
+		RouteGroupQuery: {Rate: 1, Burst: 2},
+	}
+	s, err := NewAPIServer(config, uc)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	s.rateLimiter.Now = func() time.Time { return now }
+
+	readKey, err := uc.APIKeyCreate(&entity.APIKey{Name: "dashboard", Scopes: []string{entity.ScopeRead}})
+	assert.NoError(t, err)
+
+	serve := func(method, target, key string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, target, &bytes.Buffer{})
+		req.RemoteAddr = "10.0.0.1:50000"
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/services", readKey)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Reset"))
+
+	rec = serve(http.MethodGet, "/services", readKey)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+
+	rec = serve(http.MethodGet, "/services", readKey)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	// the other clients and the groups without a limit are not affected
+	rec = serve(http.MethodGet, "/services", "secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(http.MethodGet, "/services", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Remaining"))
+
+	rec = serve(http.MethodPost, "/services", "secret")
+	assert.Empty(t, rec.Header().Get("X-RateLimit-Limit"))
+
+	now = now.Add(time.Second)
+	rec = serve(http.MethodGet, "/services", readKey)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(http.MethodGet, "/usage", "secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	resp := &struct {
+		RateLimits []*ratelimit.Status `json:"rate_limits"`
+	}{}
+	json.NewDecoder(rec.Body).Decode(resp)
+	assert.Len(t, resp.RateLimits, 3)
+
+	config.RateLimits = map[string]*RateLimit{"export": {Rate: 1, Burst: 1}}
+	_, err = NewAPIServer(config, uc)
+	assert.Error(t, err)
+
+	config.RateLimits = map[string]*RateLimit{RouteGroupIngest: {Rate: 1}}
+	_, err = NewAPIServer(config, uc)
+	assert.Error(t, err)
+}
+
+func TestRateLimitClient(t *testing.T) {
+	request := func(k *entity.APIKey) *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, "/services", nil)
+		req.RemoteAddr = "10.0.0.1:50000"
+		if k != nil {
+			req = req.WithContext(withAPIKey(req.Context(), k))
+		}
+		return req
+	}
+
+	assert.Equal(t, "admin_key", rateLimitClient(request(adminKey)))
+	assert.Equal(t, "key:7", rateLimitClient(request(&entity.APIKey{KeyID: 7, Name: "dashboard"})))
+	assert.Equal(t, "addr:10.0.0.1", rateLimitClient(request(nil)))
+
+	// the same subject in two tenants is two clients
+	first := rateLimitClient(request(&entity.APIKey{TenantID: 1, Name: "ci"}))
+	second := rateLimitClient(request(&entity.APIKey{TenantID: 2, Name: "ci"}))
+	assert.NotEqual(t, first, second)
+}
+
+func TestAPIServer_Quotas(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	uc.SetQuotas(usecase.Quotas{EventsPerDay: 2})
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	svc := entity.TestService(t)
+	m := entity.TestMetric(t)
+	repos.services.Create(svc)
+	repos.metrics.Create(m)
+
+	event := map[string]interface{}{
+		"service_id": svc.ServiceID,
+		"metrics":    []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: "10s"}},
+	}
+
+	serve := func(method, target string, body interface{}) *httptest.ResponseRecorder {
+		b := &bytes.Buffer{}
+		if body != nil {
+			json.NewEncoder(b).Encode(body)
+		}
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, target, b)
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/events", event)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = serve(http.MethodPost, "/events/batch?atomic=true", []interface{}{event, event})
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	rec = serve(http.MethodPost, "/events/batch", []interface{}{event, event})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	batch := &struct {
+		Accepted int `json:"accepted"`
+		Rejected int `json:"rejected"`
+	}{}
+	json.NewDecoder(rec.Body).Decode(batch)
+	assert.Equal(t, 1, batch.Accepted)
+	assert.Equal(t, 1, batch.Rejected)
+
+	rec = serve(http.MethodPost, "/events", event)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, retryAfter, 24*60*60)
+
+	rec = serve(http.MethodGet, "/usage", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	usage := &struct {
+		Day      string          `json:"day"`
+		Quotas   usecase.Quotas  `json:"quotas"`
+		Services []*entity.Usage `json:"services"`
+	}{}
+	json.NewDecoder(rec.Body).Decode(usage)
+	assert.Equal(t, time.Now().UTC().Format("2006-01-02"), usage.Day)
+	assert.Equal(t, 2, usage.Quotas.EventsPerDay)
+	assert.Equal(t, []*entity.Usage{{ServiceID: svc.ServiceID, Events: 2, MetricValues: 2}}, usage.Services)
+
+	rec = serve(http.MethodGet, "/usage?day=yesterday", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAPIServer_Labels(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	service := entity.TestService(t)
+	metric := entity.TestMetric(t)
+	repos.services.Create(service)
+	repos.metrics.Create(metric)
+
+	serve := func(method, target string, body interface{}) *httptest.ResponseRecorder {
+		b := &bytes.Buffer{}
+		if body != nil {
+			json.NewEncoder(b).Encode(body)
+		}
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, target, b)
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	now := time.Now()
+	for i, host := range []string{"a", "b", "a"} {
+		rec := serve(http.MethodPost, "/events", map[string]interface{}{
+			"service_id": service.ServiceID,
+			"time_stamp": now.Add(time.Duration(i-3) * time.Second).Format(time.RFC3339Nano),
+			"labels":     map[string]string{"host": host, "region": "eu"},
+			"metrics":    []*entity.AddMetric{{MetricID: metric.MetricID, MetricValue: fmt.Sprintf("%ds", i+1)}},
+		})
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	rec := serve(http.MethodPost, "/events/batch", []interface{}{
+		map[string]interface{}{
+			"service_id": service.ServiceID,
+			"labels":     map[string]string{"host": "c"},
+			"metrics":    []*entity.AddMetric{{MetricID: metric.MetricID, MetricValue: "10s"}},
+		},
+		map[string]interface{}{
+			"service_id": service.ServiceID,
+			"labels":     map[string]string{"": "c"},
+			"metrics":    []*entity.AddMetric{{MetricID: metric.MetricID, MetricValue: "10s"}},
+		},
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), entity.ErrInvalidLabels.Error())
+
+	rec = serve(http.MethodPost, "/events", map[string]interface{}{
+		"service_id": service.ServiceID,
+		"labels":     map[string]string{"host": strings.Repeat("a", entity.MaxLabelValueLength+1)},
+		"metrics":    []*entity.AddMetric{{MetricID: metric.MetricID, MetricValue: "10s"}},
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	period := "from=" + url.QueryEscape(now.Add(-time.Hour).Format(time.RFC3339)) + "&to=" + url.QueryEscape(now.Add(time.Hour).Format(time.RFC3339))
+
+	rec = serve(http.MethodGet, "/services/1/metrics/1/values?"+period+"&match="+url.QueryEscape(`host="a"`), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	values := &struct {
+		Request *valuesQuery        `json:"request"`
+		Report  []*entity.GetMetric `json:"report"`
+	}{}
+	json.NewDecoder(rec.Body).Decode(values)
+	assert.Equal(t, []string{`host="a"`}, values.Request.Match)
+	assert.Len(t, values.Report, 2)
+	assert.Equal(t, float64(time.Second), values.Report[0].Value)
+	assert.Equal(t, float64(3*time.Second), values.Report[1].Value)
+
+	rec = serve(http.MethodGet, "/services/1/metrics/1/values?"+period+"&match="+url.QueryEscape(`region=~"e.*"`)+"&match="+url.QueryEscape(`host!="a"`)+"&group_by=host", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	json.NewDecoder(rec.Body).Decode(values)
+	assert.Len(t, values.Report, 1)
+	assert.Equal(t, map[string]string{"host": "b"}, values.Report[0].Labels)
+
+	rec = serve(http.MethodGet, "/services/1/metrics/1/aggregate?"+period+"&bucket=1d&functions=count,sum&group_by=host", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	buckets := &struct {
+		Report []*entity.AggregatedMetric `json:"report"`
+	}{}
+	json.NewDecoder(rec.Body).Decode(buckets)
+	assert.Len(t, buckets.Report, 3)
+	assert.Equal(t, map[string]string{"host": "a"}, buckets.Report[0].Labels)
+	assert.Equal(t, map[string]interface{}{"count": float64(2), "sum": "4s"}, buckets.Report[0].Values)
+	assert.Equal(t, map[string]string{"host": "c"}, buckets.Report[2].Labels)
+
+	rec = serve(http.MethodGet, "/services/1/metrics/1/values?"+period+"&match="+url.QueryEscape(`host=~"("`), nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(http.MethodGet, "/services/1/metrics/1/aggregate?"+period+"&bucket=1h&functions=count&match=host", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAPIServer_Retention(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	svc := entity.TestService(t)
+	m := entity.TestMetric(t)
+	repos.services.Create(svc)
+	repos.metrics.Create(m)
+
+	serve := func(method, target string, body interface{}) *httptest.ResponseRecorder {
+		b := &bytes.Buffer{}
+		if body != nil {
+			json.NewEncoder(b).Encode(body)
+		}
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, target, b)
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	testCases := []struct {
+		name         string
+		method       string
+		target       string
+		payload      interface{}
+		expectedCode int
+	}{
+		{
+			name:         "service by slug",
+			method:       http.MethodPut,
+			target:       "/services/note_book/retention",
+			payload:      map[string]string{"keep_raw": "30d"},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "metric by id",
+			method:       http.MethodPut,
+			target:       fmt.Sprintf("/metrics/%d/retention", m.MetricID),
+			payload:      map[string]interface{}{"keep_raw": "7d", "keep_rollups": map[string]string{"1h": "365d"}},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "unknown rollup resolution",
+			method:       http.MethodPut,
+			target:       fmt.Sprintf("/metrics/%d/retention", m.MetricID),
+			payload:      map[string]interface{}{"keep_rollups": map[string]string{"5m": "30d"}},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "too short",
+			method:       http.MethodPut,
+			target:       fmt.Sprintf("/services/%d/retention", svc.ServiceID),
+			payload:      map[string]string{"keep_raw": "10m"},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "unknown service",
+			method:       http.MethodPut,
+			target:       "/services/unknown/retention",
+			payload:      map[string]string{"keep_raw": "30d"},
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "find",
+			method:       http.MethodGet,
+			target:       fmt.Sprintf("/services/%d/retention", svc.ServiceID),
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(tc.method, tc.target, tc.payload)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+		})
+	}
+
+	rec := serve(http.MethodGet, "/retention-policies", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	policies := make([]*entity.RetentionPolicy, 0)
+	json.NewDecoder(rec.Body).Decode(&policies)
+	assert.Len(t, policies, 2)
+	assert.Equal(t, svc.ServiceID, policies[0].ServiceID)
+	assert.Equal(t, "30d", policies[0].KeepRaw)
+	assert.Equal(t, m.MetricID, policies[1].MetricID)
+	assert.Equal(t, map[string]string{"1h": "365d"}, policies[1].KeepRollups)
+
+	rec = serve(http.MethodDelete, fmt.Sprintf("/metrics/%d/retention", m.MetricID), nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = serve(http.MethodDelete, fmt.Sprintf("/metrics/%d/retention", m.MetricID), nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serve(http.MethodGet, fmt.Sprintf("/metrics/%d/retention", m.MetricID), nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAPIServer_Alerting(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+	s, _ := NewAPIServer(NewConfig(), uc)
+
+	svc := entity.TestService(t)
+	m := entity.TestMetric(t)
+	repos.services.Create(svc)
+	repos.metrics.Create(m)
+
+	serve := func(method, target string, body interface{}) *httptest.ResponseRecorder {
+		b := &bytes.Buffer{}
+		if body != nil {
+			json.NewEncoder(b).Encode(body)
+		}
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, target, b)
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rule := func(threshold string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":         "slow reading",
+			"service_slug": "note_book",
+			"metric_id":    m.MetricID,
+			"function":     "avg",
+			"window":       "5m",
+			"operator":     ">",
+			"threshold":    threshold,
+			"for":          "10m",
+		}
+	}
+
+	testCases := []struct {
+		name         string
+		method       string
+		target       string
+		payload      interface{}
+		expectedCode int
+	}{
+		{
+			name:         "create",
+			method:       http.MethodPost,
+			target:       "/alert-rules",
+			payload:      rule("300ms"),
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name:         "invalid threshold",
+			method:       http.MethodPost,
+			target:       "/alert-rules",
+			payload:      rule("300"),
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "unknown service",
+			method:       http.MethodPost,
+			target:       "/alert-rules",
+			payload:      map[string]interface{}{"service_slug": "unknown", "metric_id": m.MetricID},
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "update",
+			method:       http.MethodPut,
+			target:       "/alert-rules/1",
+			payload:      rule("500ms"),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "update unknown rule",
+			method:       http.MethodPut,
+			target:       "/alert-rules/2",
+			payload:      rule("500ms"),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "find",
+			method:       http.MethodGet,
+			target:       "/alert-rules/1",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "history",
+			method:       http.MethodGet,
+			target:       "/alert-rules/1/history?limit=10",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "invalid history limit",
+			method:       http.MethodGet,
+			target:       "/alert-rules/1/history?limit=0",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(tc.method, tc.target, tc.payload)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+		})
+	}
+
+	rec := serve(http.MethodGet, "/alert-rules", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rules := make([]*entity.AlertRule, 0)
+	json.NewDecoder(rec.Body).Decode(&rules)
+	if assert.Len(t, rules, 1) {
+		assert.Equal(t, svc.ServiceID, rules[0].ServiceID)
+		assert.Equal(t, "500ms", rules[0].Threshold)
+	}
+
+	e := &entity.Event{ServiceID: svc.ServiceID, TimeStamp: entity.CustomTime{Time: time.Now().Add(-time.Minute)}}
+	uc.EventCreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: "1s"}})
+	a, _ := uc.AlertRuleFindByID(rules[0].RuleID)
+	_, err := uc.AlertEvaluate(a, time.Now())
+	assert.NoError(t, err)
+
+	rec = serve(http.MethodGet, "/alerts", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	alerts := make([]*entity.AlertState, 0)
+	json.NewDecoder(rec.Body).Decode(&alerts)
+	if assert.Len(t, alerts, 1) {
+		assert.Equal(t, entity.AlertPending, alerts[0].State)
+		assert.Equal(t, "1s", alerts[0].Value)
+	}
+
+	rec = serve(http.MethodDelete, "/alert-rules/1", nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = serve(http.MethodGet, "/alert-rules/1/history", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,293 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/gorilla/mux"
+)
+
+var (
+	errUnauthorized    = errors.New("unauthorized")
+	errInvalidAPIKey   = errors.New("invalid api key")
+	errUnknownAuthMode = errors.New("unknown auth_mode")
+	errBlankAdminKey   = errors.New("admin_key: required with auth_mode apikey to create the first API keys, set it or ADMIN_KEY")
+)
+
+// authenticator identifies the principal presenting the credentials of a request,
+// the principal is an API key or stands for one, so that its scopes are checked the same way.
+type authenticator interface {
+	authenticate(credentials string) (*entity.APIKey, error)
+}
+
+// apiKeyAuthenticator looks the credentials up among the stored API keys.
+type apiKeyAuthenticator struct {
+	uc usecase.UseCase
+}
+
+func (a *apiKeyAuthenticator) authenticate(credentials string) (*entity.APIKey, error) {
+	k, err := a.uc.APIKeyAuthenticate(credentials)
+	if errors.Is(err, repository.ErrRecordNotFound) {
+		return nil, errInvalidAPIKey
+	}
+	return k, err
+}
+
+// configureAuthenticator selects the authenticator of AuthMode, without authentication
+// API keys are still identified for backfill.
+func (s *apiServer) configureAuthenticator() error {
+	switch s.config.AuthMode {
+	case AuthNone, AuthAPIKey:
+		if s.config.AuthMode == AuthAPIKey && s.config.AdminKey == "" {
+			return errBlankAdminKey
+		}
+		s.authenticator = &apiKeyAuthenticator{uc: s.uc}
+	case AuthJWT:
+		a, err := newJWTAuthenticator(s.config, s.uc)
+		if err != nil {
+			return err
+		}
+		s.authenticator = a
+	default:
+		return fmt.Errorf("%w %q", errUnknownAuthMode, s.config.AuthMode)
+	}
+	return nil
+}
+
+// Authenticate identifies the principal presenting the credentials with the authenticator of auth_mode,
+// the gRPC API authenticates its calls with it.
+func (s *apiServer) Authenticate(credentials string) (*entity.APIKey, error) {
+	return s.authenticator.authenticate(credentials)
+}
+
+// adminKey is the key of the requests presenting the admin_key of the config.
+var adminKey = &entity.APIKey{
+	Name:   "admin_key",
+	Scopes: []string{entity.ScopeAdmin},
+}
+
+// writeRoutes are the routes that add events, they are granted by the write scope.
+var writeRoutes = map[string]bool{
+	"/events":       true,
+	"/events/batch": true,
+	"/api/v1/write": true,
+	"/write":        true,
+	"/v1/metrics":   true,
+}
+
+// requestCredentials reads the API key or the token from the Authorization header with the Bearer scheme
+// or the Token scheme of InfluxDB clients, or from the X-API-Key header.
+func requestCredentials(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	scheme, key, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && (strings.EqualFold(scheme, "Bearer") || strings.EqualFold(scheme, "Token")) {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
+
+func withAPIKey(ctx context.Context, k *entity.APIKey) context.Context {
+	return context.WithValue(ctx, ctxKeyAPIKey, k)
+}
+
+// apiKey returns the authenticated key of the request, nil if there is none.
+func apiKey(ctx context.Context) *entity.APIKey {
+	k, _ := ctx.Value(ctxKeyAPIKey).(*entity.APIKey)
+	return k
+}
+
+func withAuthError(ctx context.Context, err error) context.Context {
+	return context.WithValue(ctx, ctxKeyAuthError, err)
+}
+
+// authError returns the reason the key of the request is not authenticated.
+func authError(ctx context.Context) error {
+	err, _ := ctx.Value(ctxKeyAuthError).(error)
+	return err
+}
+
+// authenticate identifies the principal of the request, its scopes are checked by authorize.
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credentials := requestCredentials(r)
+		if credentials == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var (
+			k   *entity.APIKey
+			err error
+		)
+		if s.config.AdminKey != "" && subtle.ConstantTimeCompare([]byte(credentials), []byte(s.config.AdminKey)) == 1 {
+			k = adminKey
+		} else {
+			k, err = s.authenticator.authenticate(credentials)
+		}
+
+		ctx := r.Context()
+		if err != nil {
+			ctx = withAuthError(ctx, err)
+		} else {
+			ctx = withAPIKey(ctx, k)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authorize requires a principal granted the scope of the route when authentication is enabled:
+// queries take read, adding events takes write and everything else takes admin.
+func (s *apiServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.AuthMode == AuthNone {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := authError(r.Context()); err != nil {
+			s.unauthorized(w, r, err)
+			return
+		}
+
+		k := apiKey(r.Context())
+		if k == nil {
+			s.unauthorized(w, r, errUnauthorized)
+			return
+		}
+
+		if !k.Allows(routeScope(r)) {
+			s.error(w, r, http.StatusForbidden, errForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin requires an API key granting the admin scope even when authentication is disabled.
+func (s *apiServer) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k := apiKey(r.Context())
+		if k == nil || !k.Allows(entity.ScopeAdmin) {
+			s.error(w, r, http.StatusForbidden, errForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *apiServer) unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	s.error(w, r, http.StatusUnauthorized, err)
+}
+
+func routeScope(r *http.Request) string {
+	path, _ := mux.CurrentRoute(r).GetPathTemplate()
+
+	switch {
+	case strings.HasPrefix(path, "/api-keys"), strings.HasPrefix(path, "/tenants"), path == "/usage":
+		return entity.ScopeAdmin
+	case r.Method == http.MethodGet:
+		return entity.ScopeRead
+	case r.Method == http.MethodPost && writeRoutes[path]:
+		return entity.ScopeWrite
+	default:
+		return entity.ScopeAdmin
+	}
+}
+
+// eventAuthorizer returns the check that the principal of the request may add events to the service of an event.
+func (s *apiServer) eventAuthorizer(r *http.Request) func(*entity.Event) error {
+	if s.config.AuthMode == AuthNone {
+		return func(*entity.Event) error { return nil }
+	}
+	return s.useCase(r).EventAuthorizer(apiKey(r.Context()))
+}
+
+func (s *apiServer) handleAPIKeyCreate() http.HandlerFunc {
+	type request struct {
+		Name       string   `json:"name"`
+		Scopes     []string `json:"scopes"`
+		ServiceIDs []int    `json:"service_ids"`
+	}
+
+	type response struct {
+		*entity.APIKey
+		Key string `json:"key"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &request{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		k := &entity.APIKey{
+			Name:       req.Name,
+			Scopes:     req.Scopes,
+			ServiceIDs: req.ServiceIDs,
+		}
+		if k.ServiceIDs == nil {
+			k.ServiceIDs = []int{}
+		}
+
+		for _, id := range k.ServiceIDs {
+			if _, err := s.useCase(r).ServiceFindByID(id); err != nil {
+				s.error(w, r, http.StatusUnprocessableEntity, fmt.Errorf("service_ids: %d: %w", id, err))
+				return
+			}
+		}
+
+		key, err := s.useCase(r).APIKeyCreate(k)
+		if err != nil {
+			s.error(w, r, http.StatusUnprocessableEntity, err)
+			return
+		}
+
+		s.respond(w, r, http.StatusCreated, &response{APIKey: k, Key: key})
+	}
+}
+
+func (s *apiServer) handleAPIKeyList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := s.useCase(r).APIKeyList()
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, keys)
+	}
+}
+
+func (s *apiServer) handleAPIKeyDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := s.useCase(r).APIKeyDelete(keyID); err != nil {
+			s.error(w, r, deleteErrorCode(err), err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
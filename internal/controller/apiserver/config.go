@@ -2,6 +2,18 @@ package apiserver
 
 import "time"
 
+// Authenticators of the requests.
+const (
+	// AuthNone lets every request through, only backfill takes the admin key.
+	AuthNone = "none"
+
+	// AuthAPIKey requires an API key granting the scope of the endpoint.
+	AuthAPIKey = "apikey"
+
+	// AuthJWT requires a bearer token signed by a key of the JWKS whose claims grant the scope of the endpoint.
+	AuthJWT = "jwt"
+)
+
 type Config struct {
 	ReadTimeout  time.Duration `toml:"read_timeout"`
 	WriteTimeout time.Duration `toml:"write_timeout"`
@@ -9,14 +21,91 @@ type Config struct {
 
 	ShutdownTimeout time.Duration `toml:"shutdown_time"`
 	LogLevel        string        `toml:"log_level"`
+
+	// limits for client-supplied event timestamps, zero disables the check
+	MaxEventAge        time.Duration `toml:"max_event_age"`
+	MaxEventFutureSkew time.Duration `toml:"max_event_future_skew"`
+
+	// maximum number of events accepted by one batch request
+	MaxBatchSize int `toml:"max_batch_size"`
+
+	// authenticator of the requests: none, apikey or jwt
+	AuthMode string `toml:"auth_mode"`
+
+	// key granting the admin scope without being stored, e.g. to create the first API keys;
+	// backfill takes the admin scope even when AuthMode is none
+	AdminKey string `toml:"admin_key"`
+
+	// JWKS the tokens are verified with, a file path or an http(s) URL
+	JWKS string `toml:"jwks"`
+
+	// interval the JWKS of a URL is fetched again at, unknown key ids are fetched sooner
+	JWKSRefresh time.Duration `toml:"jwks_refresh"`
+
+	// required iss and aud claims of the tokens
+	JWTIssuer   string `toml:"jwt_issuer"`
+	JWTAudience string `toml:"jwt_audience"`
+
+	// claims holding the scopes, as a space-separated string or an array, and the service ids writing is limited to
+	JWTScopesClaim   string `toml:"jwt_scopes_claim"`
+	JWTServicesClaim string `toml:"jwt_services_claim"`
+
+	// claim holding the slug of the tenant the token is bound to, tokens without it are bound to the default tenant
+	JWTTenantClaim string `toml:"jwt_tenant_claim"`
+
+	// scope of the tokens without the tenant claim that may act in any tenant and manage tenants, e.g. "tenants",
+	// empty binds every token to a tenant
+	JWTUnboundScope string `toml:"jwt_unbound_scope"`
+
+	// prefix of the scopes in the claim, e.g. "dwh:" for "dwh:read"
+	JWTScopePrefix string `toml:"jwt_scope_prefix"`
+
+	// clock skew allowed when checking exp and nbf
+	JWTLeeway time.Duration `toml:"jwt_leeway"`
+
+	// token buckets of every client per route group: ingest, query or admin, groups without one are not limited
+	RateLimits map[string]*RateLimit `toml:"rate_limits"`
+
+	// origins allowed to make cross-origin requests
+	AllowedOrigins []string `toml:"allowed_origins"`
+
+	// create unknown metrics of Prometheus remote_write requests as FLOAT metrics
+	RemoteWriteAutoRegister bool `toml:"remote_write_auto_register"`
+
+	// create unknown fields of InfluxDB line protocol requests as metrics of the type of the field value
+	LineProtocolAutoRegister bool `toml:"line_protocol_auto_register"`
+
+	// create unknown metrics of OTLP requests as INT or FLOAT metrics depending on the data point values
+	OTLPAutoRegister bool `toml:"otlp_auto_register"`
+
+	// number of values kept for a live subscriber that lags behind before it is dropped
+	LiveBufferSize int `toml:"live_buffer_size"`
+
+	// interval of the comments that keep live streams open
+	LiveHeartbeat time.Duration `toml:"live_heartbeat"`
+
+	// relay live values between the replicas of the app with Postgres LISTEN/NOTIFY
+	LiveNotify bool `toml:"live_notify"`
 }
 
 func NewConfig() *Config {
 	return &Config{
-		ReadTimeout:     5 * time.Second,
-		WriteTimeout:    5 * time.Second,
-		BindAddr:        ":8080",
-		ShutdownTimeout: 3 * time.Second,
-		LogLevel:        "debug",
+		ReadTimeout:        5 * time.Second,
+		WriteTimeout:       5 * time.Second,
+		BindAddr:           ":8080",
+		ShutdownTimeout:    3 * time.Second,
+		LogLevel:           "debug",
+		MaxEventAge:        24 * time.Hour,
+		MaxEventFutureSkew: 5 * time.Minute,
+		MaxBatchSize:       1000,
+		AuthMode:           AuthNone,
+		JWKSRefresh:        time.Hour,
+		JWTScopesClaim:     "scope",
+		JWTServicesClaim:   "service_ids",
+		JWTTenantClaim:     "tenant",
+		JWTLeeway:          time.Minute,
+		AllowedOrigins:     []string{"*"},
+		LiveBufferSize:     256,
+		LiveHeartbeat:      15 * time.Second,
 	}
 }
@@ -0,0 +1,193 @@
+package apiserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+)
+
+// maxIngestSize limits the decompressed size of a request of a push protocol.
+const maxIngestSize = 32 << 20
+
+// maxSizeReader reads r until more than n bytes are read and fails with errWriteRequestTooLarge then,
+// unlike io.LimitReader, which ends the stream quietly in the middle of a line.
+type maxSizeReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *maxSizeReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return 0, errWriteRequestTooLarge
+	}
+	return n, err
+}
+
+// pointGroups collects the points of push protocols into events:
+// the points of a service sharing the time stamp and the labels form one event.
+type pointGroups struct {
+	byKey  map[string]*pointEvent
+	events []*pointEvent
+}
+
+// pointEvent is an event built from points together with the metric types the values suggest.
+type pointEvent struct {
+	event   *entity.Event
+	metrics []*entity.AddMetric
+	types   []string
+}
+
+func newPointGroups() *pointGroups {
+	return &pointGroups{
+		byKey: make(map[string]*pointEvent),
+	}
+}
+
+// add adds a value of the metric to the event of the service at t with labels,
+// a later value of the same metric replaces the earlier one.
+func (g *pointGroups) add(service string, t time.Time, labels map[string]string, metric string, value interface{}, metricType string) {
+	key := fmt.Sprintf("%s|%d|%s", service, t.UnixNano(), labelsKey(labels))
+
+	e, ok := g.byKey[key]
+	if !ok {
+		e = &pointEvent{
+			event: &entity.Event{
+				TimeStamp:   entity.CustomTime{Time: t},
+				ServiceSlug: service,
+				Labels:      labels,
+			},
+		}
+		g.byKey[key] = e
+		g.events = append(g.events, e)
+	}
+
+	for i, m := range e.metrics {
+		if m.MetricSlug == metric {
+			e.metrics[i].MetricValue = value
+			e.types[i] = metricType
+			return
+		}
+	}
+
+	e.metrics = append(e.metrics, &entity.AddMetric{MetricSlug: metric, MetricValue: value})
+	e.types = append(e.types, metricType)
+}
+
+// points returns the number of collected values.
+func (g *pointGroups) points() int {
+	n := 0
+	for _, e := range g.events {
+		n += len(e.metrics)
+	}
+	return n
+}
+
+// metrics returns the metrics the collected values refer to, details describe them when they are registered.
+func (g *pointGroups) metrics(details string) []*entity.Metric {
+	metrics := make([]*entity.Metric, 0)
+	for _, e := range g.events {
+		for i, m := range e.metrics {
+			metrics = append(metrics, &entity.Metric{
+				Slug:       m.MetricSlug,
+				MetricType: e.types[i],
+				Details:    details,
+			})
+		}
+	}
+	return metrics
+}
+
+// labelsKey renders labels in a stable order.
+func labelsKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := &strings.Builder{}
+	for _, name := range names {
+		fmt.Fprintf(b, "%q=%q,", name, labels[name])
+	}
+	return b.String()
+}
+
+// authorizePoints drops the collected events the request may not add with authorizeEvent or stamped out
+// of the accepted time range, so that only the metrics of the rest are registered, and reports how many
+// values are rejected along with the first reason.
+func (s *apiServer) authorizePoints(g *pointGroups, authorizeEvent func(*entity.Event) error) (rejected int, firstErr error) {
+	now := time.Now()
+	events := g.events[:0]
+
+	for _, e := range g.events {
+		err := e.event.ValidateTimeStamp(now, s.config.MaxEventAge, s.config.MaxEventFutureSkew)
+		if err == nil {
+			err = authorizeEvent(e.event)
+		}
+
+		if err != nil {
+			rejected += len(e.metrics)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		events = append(events, e)
+	}
+	g.events = events
+
+	return rejected, firstErr
+}
+
+// storePoints writes the collected events and reports how many values are rejected along with the first reason.
+// A failure of the storage, which is worth retrying, is returned as err, see retryableError.
+func (s *apiServer) storePoints(uc usecase.UseCase, g *pointGroups) (rejected int, firstErr error, err error) {
+	items := make([]*entity.BatchItem, 0, len(g.events))
+	for _, e := range g.events {
+		items = append(items, &entity.BatchItem{Event: e.event, Metrics: e.metrics})
+	}
+
+	errs := uc.EventBatchCreate(items, false)
+	if err := retryableError(errs); err != nil {
+		return 0, nil, err
+	}
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		rejected += len(items[i].Metrics)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return rejected, firstErr, nil
+}
+
+// retryableError returns a failure of the storage among the results of a batch written item by item
+// if none of its items is stored, so that the client may send the whole batch again. Once a part of
+// the batch is stored a retry would store it twice, so the failed items are rejected like invalid ones.
+func retryableError(errs []error) error {
+	var storageErr error
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+
+		if storageErr == nil && ingestErrorCode(err) == http.StatusInternalServerError {
+			storageErr = err
+		}
+	}
+	return storageErr
+}
@@ -0,0 +1,348 @@
+package apiserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	jose "gopkg.in/go-jose/go-jose.v2"
+	"gopkg.in/go-jose/go-jose.v2/jwt"
+)
+
+var (
+	errInvalidToken    = errors.New("invalid token")
+	errBlankJWTConfig  = errors.New("jwks, jwt_issuer and jwt_audience are required with auth_mode jwt")
+	errUnknownTokenKey = errors.New("unknown key")
+)
+
+// jwksMinRefresh limits how often tokens with unknown key ids make the JWKS be fetched.
+const jwksMinRefresh = 10 * time.Second
+
+// jwtAlgorithms are the signature algorithms the tokens are accepted with.
+var jwtAlgorithms = map[string]bool{
+	string(jose.RS256): true,
+	string(jose.ES256): true,
+}
+
+// jwks is a set of the public keys the tokens are signed with, a JWKS of a URL
+// is fetched again every refresh interval and when a token is signed with an unknown key.
+type jwks struct {
+	source  string
+	refresh time.Duration
+	client  *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+}
+
+func newJWKS(source string, refresh time.Duration) (*jwks, error) {
+	j := &jwks{
+		source:  source,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+
+	keys, err := j.load()
+	if err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	j.keys = keys
+	j.fetched = time.Now()
+	return j, nil
+}
+
+func (j *jwks) remote() bool {
+	return strings.HasPrefix(j.source, "http://") || strings.HasPrefix(j.source, "https://")
+}
+
+// load reads the keys of the JWKS, it does not touch the keys of the set.
+func (j *jwks) load() (map[string]interface{}, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if j.remote() {
+		b, err = j.fetch()
+	} else {
+		b, err = os.ReadFile(j.source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseJWKS(b)
+}
+
+func (j *jwks) fetch() ([]byte, error) {
+	resp, err := j.client.Get(j.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", j.source, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// key returns the key of kid, a token without kid is verified with the only key of the set.
+// The JWKS is fetched without holding the lock, the other tokens are verified with the keys fetched before
+// meanwhile and the keys are kept while the JWKS cannot be fetched.
+func (j *jwks) key(kid string) (interface{}, error) {
+	j.mu.Lock()
+	k, ok := j.find(kid)
+	stale := j.remote() && (!ok || time.Since(j.fetched) > j.refresh) && time.Since(j.fetched) > jwksMinRefresh
+	if stale {
+		j.fetched = time.Now()
+	}
+	j.mu.Unlock()
+
+	if stale {
+		keys, err := j.load()
+		if err != nil && !ok {
+			return nil, err
+		}
+
+		if err == nil {
+			j.mu.Lock()
+			j.keys = keys
+			k, ok = j.find(kid)
+			j.mu.Unlock()
+		}
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errUnknownTokenKey, kid)
+	}
+	return k, nil
+}
+
+// find returns the key of kid, the caller holds the lock.
+func (j *jwks) find(kid string) (interface{}, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, k := range j.keys {
+			return k, true
+		}
+	}
+	k, ok := j.keys[kid]
+	return k, ok
+}
+
+// parseJWKS reads the RSA and P-256 signing keys of a JWKS, keys of other types are skipped.
+func parseJWKS(b []byte) (map[string]interface{}, error) {
+	set := &jose.JSONWebKeySet{}
+	if err := json.Unmarshal(b, set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		switch pub := k.Key.(type) {
+		case *rsa.PublicKey:
+			keys[k.KeyID] = pub
+		case *ecdsa.PublicKey:
+			if pub.Curve == elliptic.P256() {
+				keys[k.KeyID] = pub
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no RSA or P-256 signing keys")
+	}
+	return keys, nil
+}
+
+// jwtAuthenticator verifies RS256 and ES256 tokens and maps their claims to the scopes of an API key.
+type jwtAuthenticator struct {
+	keys          *jwks
+	issuer        string
+	audience      string
+	scopesClaim   string
+	servicesClaim string
+	tenantClaim   string
+	unboundScope  string
+	scopePrefix   string
+	leeway        time.Duration
+	now           func() time.Time
+	uc            usecase.UseCase
+}
+
+func newJWTAuthenticator(config *Config, uc usecase.UseCase) (*jwtAuthenticator, error) {
+	if config.JWKS == "" || config.JWTIssuer == "" || config.JWTAudience == "" {
+		return nil, errBlankJWTConfig
+	}
+
+	keys, err := newJWKS(config.JWKS, config.JWKSRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jwtAuthenticator{
+		keys:          keys,
+		issuer:        config.JWTIssuer,
+		audience:      config.JWTAudience,
+		scopesClaim:   config.JWTScopesClaim,
+		servicesClaim: config.JWTServicesClaim,
+		tenantClaim:   config.JWTTenantClaim,
+		unboundScope:  config.JWTUnboundScope,
+		scopePrefix:   config.JWTScopePrefix,
+		leeway:        config.JWTLeeway,
+		now:           time.Now,
+		uc:            uc,
+	}, nil
+}
+
+// authenticate verifies the token and returns a key named after its subject with the scopes and the service ids
+// of its claims, bound to the tenant of the tenant claim or, if the token has none, to the default tenant
+// unless the token is granted the unbound scope.
+func (a *jwtAuthenticator) authenticate(token string) (*entity.APIKey, error) {
+	registered, claims, err := a.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidToken, err)
+	}
+
+	if err := a.validate(registered); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidToken, err)
+	}
+
+	scopes, err := a.scopes(claims[a.scopesClaim])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errInvalidToken, a.scopesClaim, err)
+	}
+
+	k := &entity.APIKey{
+		TenantID:   entity.DefaultTenantID,
+		Name:       registered.Subject,
+		Scopes:     keyScopes(scopes),
+		ServiceIDs: make([]int, 0),
+	}
+
+	if raw, ok := claims[a.servicesClaim]; ok {
+		if err := json.Unmarshal(raw, &k.ServiceIDs); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", errInvalidToken, a.servicesClaim, err)
+		}
+	}
+
+	if raw, ok := claims[a.tenantClaim]; ok {
+		var slug string
+		if err := json.Unmarshal(raw, &slug); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", errInvalidToken, a.tenantClaim, err)
+		}
+
+		t, err := a.uc.TenantFindBySlug(entity.NormalizeSlug(slug))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: unknown tenant %q", errInvalidToken, a.tenantClaim, slug)
+		}
+		k.TenantID = t.TenantID
+	} else if a.unboundScope != "" && contains(scopes, a.unboundScope) {
+		k.TenantID = 0
+	}
+
+	return k, nil
+}
+
+// verify checks the signature of the token and returns its registered claims and every claim.
+func (a *jwtAuthenticator) verify(token string) (*jwt.Claims, map[string]json.RawMessage, error) {
+	tok, err := jwt.ParseSigned(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(tok.Headers) != 1 {
+		return nil, nil, errors.New("malformed token")
+	}
+	header := tok.Headers[0]
+
+	if !jwtAlgorithms[header.Algorithm] {
+		return nil, nil, fmt.Errorf("unsupported alg %q", header.Algorithm)
+	}
+
+	key, err := a.keys.key(header.KeyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	registered := &jwt.Claims{}
+	claims := make(map[string]json.RawMessage)
+	if err := tok.Claims(key, registered, &claims); err != nil {
+		return nil, nil, err
+	}
+	return registered, claims, nil
+}
+
+// validate checks the issuer, the audience and the validity period of the token.
+func (a *jwtAuthenticator) validate(claims *jwt.Claims) error {
+	if claims.Expiry == nil {
+		return errors.New("exp is required")
+	}
+
+	return claims.ValidateWithLeeway(jwt.Expected{
+		Issuer:   a.issuer,
+		Audience: jwt.Audience{a.audience},
+		Time:     a.now(),
+	}, a.leeway)
+}
+
+// scopes reads the scopes of the claim without the prefix, a space-separated string like the scope claim
+// of OAuth or an array, scopes without the prefix are ignored.
+func (a *jwtAuthenticator) scopes(raw json.RawMessage) ([]string, error) {
+	scopes := make([]string, 0)
+	if raw == nil {
+		return scopes, nil
+	}
+
+	var values []string
+	if err := json.Unmarshal(raw, &values); err != nil {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("must be a string or an array of strings")
+		}
+		values = strings.Fields(s)
+	}
+
+	for _, v := range values {
+		if v, ok := strings.CutPrefix(v, a.scopePrefix); ok {
+			scopes = append(scopes, v)
+		}
+	}
+	return scopes, nil
+}
+
+// keyScopes returns the scopes of an API key among the scopes of a token.
+func keyScopes(scopes []string) []string {
+	granted := make([]string, 0, len(scopes))
+	for _, v := range scopes {
+		switch v {
+		case entity.ScopeAdmin, entity.ScopeRead, entity.ScopeWrite:
+			granted = append(granted, v)
+		}
+	}
+	return granted
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package apiserver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLineSize limits the length of a line of the line protocol.
+const maxLineSize = 1 << 20
+
+var (
+	errInvalidLine      = errors.New("invalid line")
+	errInvalidPrecision = errors.New("precision: must be one of ns, us, ms, s")
+)
+
+// linePrecisions are the units of line protocol time stamps, n and u are the InfluxDB 1.x spellings.
+var linePrecisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"n":  time.Nanosecond,
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// linePoint is a line of the InfluxDB line protocol:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+type linePoint struct {
+	measurement string
+	tags        map[string]string
+	fields      []*lineField
+	timestamp   *time.Time
+}
+
+// lineField is a field of a point, the value is an int64, float64, bool or string.
+type lineField struct {
+	key        string
+	value      interface{}
+	metricType string
+}
+
+// parseLinePrecision parses the precision query parameter, the default is nanoseconds.
+func parseLinePrecision(s string) (time.Duration, error) {
+	p, ok := linePrecisions[s]
+	if !ok {
+		return 0, errInvalidPrecision
+	}
+	return p, nil
+}
+
+// parseLine parses a line of the line protocol, the time stamp is read in the units of precision.
+func parseLine(line string, precision time.Duration) (*linePoint, error) {
+	p := &linePoint{
+		tags: make(map[string]string),
+	}
+
+	measurement, i := readLineToken(line, 0, ", ")
+	if measurement == "" {
+		return nil, fmt.Errorf("%w: missing measurement", errInvalidLine)
+	}
+	p.measurement = measurement
+
+	for i < len(line) && line[i] == ',' {
+		var key, value string
+		key, i = readLineToken(line, i+1, ",= ")
+		if i == len(line) || line[i] != '=' || key == "" {
+			return nil, fmt.Errorf("%w: invalid tag %q", errInvalidLine, key)
+		}
+
+		value, i = readLineToken(line, i+1, ", ")
+		if value == "" {
+			return nil, fmt.Errorf("%w: tag %s: missing value", errInvalidLine, key)
+		}
+		p.tags[key] = value
+	}
+
+	i = skipSpaces(line, i)
+	for i < len(line) {
+		var key string
+		key, i = readLineToken(line, i, ",= ")
+		if i == len(line) || line[i] != '=' || key == "" {
+			return nil, fmt.Errorf("%w: invalid field %q", errInvalidLine, key)
+		}
+
+		f, next, err := readLineField(line, i+1)
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %s: %s", errInvalidLine, key, err)
+		}
+		f.key = key
+		p.fields = append(p.fields, f)
+
+		i = next
+		if i == len(line) || line[i] == ' ' {
+			break
+		}
+		i++
+	}
+
+	if len(p.fields) == 0 {
+		return nil, fmt.Errorf("%w: missing fields", errInvalidLine)
+	}
+
+	if ts := strings.TrimSpace(line[i:]); ts != "" {
+		n, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid timestamp %q", errInvalidLine, ts)
+		}
+
+		t := time.Unix(0, 0).Add(time.Duration(n) * precision).UTC()
+		p.timestamp = &t
+	}
+
+	return p, nil
+}
+
+// readLineToken reads a token starting at i up to the first unescaped character of stops
+// and returns it together with the position of that character. Commas, equal signs, spaces
+// and backslashes are escaped with a backslash.
+func readLineToken(line string, i int, stops string) (string, int) {
+	b := &strings.Builder{}
+	for ; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) && strings.IndexByte(`,= \`, line[i+1]) >= 0 {
+			i++
+			b.WriteByte(line[i])
+			continue
+		}
+
+		if strings.IndexByte(stops, c) >= 0 {
+			break
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), i
+}
+
+// readLineField reads a field value starting at i and returns it together with the position after it.
+// Strings are quoted, integers end with i, unsigned integers with u, booleans are t, f, true, false
+// in any of the usual spellings and everything else is a float.
+func readLineField(line string, i int) (*lineField, int, error) {
+	if i < len(line) && line[i] == '"' {
+		b := &strings.Builder{}
+		for i++; i < len(line); i++ {
+			c := line[i]
+			if c == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+				i++
+				b.WriteByte(line[i])
+				continue
+			}
+
+			if c == '"' {
+				return &lineField{value: b.String(), metricType: "STRING"}, i + 1, nil
+			}
+			b.WriteByte(c)
+		}
+		return nil, i, errors.New("unterminated string")
+	}
+
+	end := i
+	for end < len(line) && line[end] != ',' && line[end] != ' ' {
+		end++
+	}
+	raw := line[i:end]
+
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return &lineField{value: true, metricType: "BOOL"}, end, nil
+	case "f", "F", "false", "False", "FALSE":
+		return &lineField{value: false, metricType: "BOOL"}, end, nil
+	case "":
+		return nil, end, errors.New("missing value")
+	}
+
+	switch raw[len(raw)-1] {
+	case 'i':
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return nil, end, fmt.Errorf("invalid integer %q", raw)
+		}
+		return &lineField{value: v, metricType: "INT"}, end, nil
+	case 'u':
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		if err != nil || v > math.MaxInt64 {
+			return nil, end, fmt.Errorf("invalid unsigned integer %q", raw)
+		}
+		return &lineField{value: int64(v), metricType: "INT"}, end, nil
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, end, fmt.Errorf("invalid float %q", raw)
+	}
+	return &lineField{value: v, metricType: "FLOAT"}, end, nil
+}
+
+func skipSpaces(line string, i int) int {
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,171 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+var (
+	errBlankSeries   = errors.New("series: cannot be blank")
+	errInvalidSeries = errors.New("series: must be <service>:<metric>")
+)
+
+// liveSeries is a series of a live subscription as it is requested, the service and the metric
+// are referred to by id or by slug like in the path of /services/{service}/metrics/{metric}/values.
+type liveSeries struct {
+	serviceID   int
+	serviceSlug string
+	metricID    int
+	metricSlug  string
+}
+
+// liveValue is a value sent to live subscribers.
+type liveValue struct {
+	EventID     int               `json:"event_id"`
+	TimeStamp   entity.CustomTime `json:"time_stamp"`
+	ServiceID   int               `json:"service_id"`
+	ServiceSlug string            `json:"service_slug"`
+	MetricID    int               `json:"metric_id"`
+	MetricSlug  string            `json:"metric_slug"`
+	Value       interface{}       `json:"value"`
+}
+
+// parseLiveSeries reads the series parameters, every one is a <service>:<metric> pair,
+// pairs are given as a comma-separated list or by repeating the parameter.
+func parseLiveSeries(r *http.Request) ([]*liveSeries, error) {
+	pairs := listParam(r.URL.Query()["series"])
+	if len(pairs) == 0 {
+		return nil, errBlankSeries
+	}
+
+	series := make([]*liveSeries, len(pairs))
+	for i, pair := range pairs {
+		service, metric, ok := strings.Cut(pair, ":")
+		if !ok || service == "" || metric == "" {
+			return nil, fmt.Errorf("%w, got %q", errInvalidSeries, pair)
+		}
+
+		ls := &liveSeries{}
+		ls.serviceID, ls.serviceSlug = pathRef(service)
+		ls.metricID, ls.metricSlug = pathRef(metric)
+		series[i] = ls
+	}
+
+	return series, nil
+}
+
+// handleLiveValues streams the values of the requested series as Server-Sent Events as they are stored.
+// Every value is sent as a "value" event. A subscriber that does not keep up is sent a "dropped" event
+// and disconnected, it is expected to reconnect. Comments are sent every LiveHeartbeat to keep the connection open.
+func (s *apiServer) handleLiveValues() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requested, err := parseLiveSeries(r)
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		series := make([]entity.Series, len(requested))
+		services := make(map[int]string)
+		metrics := make(map[int]string)
+
+		for i, ls := range requested {
+			service, err := s.findService(s.useCase(r), ls.serviceID, ls.serviceSlug)
+			if err != nil {
+				s.error(w, r, http.StatusNotFound, err)
+				return
+			}
+
+			metric, err := s.findMetric(s.useCase(r), ls.metricID, ls.metricSlug)
+			if err != nil {
+				s.error(w, r, http.StatusNotFound, err)
+				return
+			}
+
+			series[i] = entity.Series{ServiceID: service.ServiceID, MetricID: metric.MetricID}
+			services[service.ServiceID] = service.Slug
+			metrics[metric.MetricID] = metric.Slug
+		}
+
+		sub := s.useCase(r).Subscribe(series, s.config.LiveBufferSize)
+		defer sub.Close()
+
+		// the stream outlives the write timeout of the server
+		rc := http.NewResponseController(w)
+		rc.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		send := func(format string, args ...interface{}) bool {
+			if _, err := fmt.Fprintf(w, format, args...); err != nil {
+				return false
+			}
+			return rc.Flush() == nil
+		}
+
+		if !send(": subscribed\n\n") {
+			return
+		}
+
+		heartbeat := time.NewTicker(s.config.LiveHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-s.done:
+				return
+			case <-heartbeat.C:
+				if !send(": heartbeat\n\n") {
+					return
+				}
+			case v, ok := <-sub.Values():
+				if !ok {
+					if sub.Dropped() {
+						send("event: dropped\ndata: {\"error\":\"subscriber is too slow\"}\n\n")
+					}
+					return
+				}
+
+				b, err := json.Marshal(&liveValue{
+					EventID:     v.EventID,
+					TimeStamp:   v.TimeStamp,
+					ServiceID:   v.ServiceID,
+					ServiceSlug: services[v.ServiceID],
+					MetricID:    v.MetricID,
+					MetricSlug:  metrics[v.MetricID],
+					Value:       displayValue(v.Value),
+				})
+				if err != nil {
+					return
+				}
+
+				if !send("event: value\ndata: %s\n\n", b) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// displayValue renders durations and time stamps the way the values endpoints do.
+func displayValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return &entity.CustomTime{Time: v}
+	default:
+		return v
+	}
+}
@@ -0,0 +1,219 @@
+package apiserver
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var errNoServiceName = errors.New("resource without the service.name attribute")
+
+const (
+	otlpContentTypeProtobuf = "application/x-protobuf"
+	otlpContentTypeJSON     = "application/json"
+)
+
+// otlpEvents groups the data points of req into events at the time stamps of the points,
+// points without a time stamp are taken at now. The service is the service.name resource attribute,
+// the metric is the metric name and the data point attributes are kept as the labels of the event.
+//
+// Gauges and sums are stored as INT or FLOAT values depending on the point value.
+// Histograms are stored the way Prometheus exposes them: <name>_COUNT, <name>_SUM and the cumulative
+// <name>_BUCKET counts with the upper bound in the le label; only the count and the sum are kept
+// of exponential histograms. Summaries are stored as <name>_COUNT, <name>_SUM and <name> values
+// with the quantile label.
+//
+// Points of resources without service.name are reported in rejected.
+func otlpEvents(req *colmetricspb.ExportMetricsServiceRequest, now time.Time) (g *pointGroups, rejected int) {
+	g = newPointGroups()
+
+	for _, rm := range req.GetResourceMetrics() {
+		service := ""
+		for _, kv := range rm.GetResource().GetAttributes() {
+			if kv.GetKey() == "service.name" {
+				service = entity.SanitizeSlug(otlpValue(kv.GetValue()))
+			}
+		}
+
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				if service == "" {
+					rejected += otlpPoints(m)
+					continue
+				}
+
+				addOTLPMetric(g, service, m, now)
+			}
+		}
+	}
+
+	return g, rejected
+}
+
+func addOTLPMetric(g *pointGroups, service string, m *metricspb.Metric, now time.Time) {
+	name := entity.SanitizeSlug(m.GetName())
+
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		addOTLPNumbers(g, service, name, data.Gauge.GetDataPoints(), now)
+	case *metricspb.Metric_Sum:
+		addOTLPNumbers(g, service, name, data.Sum.GetDataPoints(), now)
+	case *metricspb.Metric_Histogram:
+		for _, dp := range data.Histogram.GetDataPoints() {
+			if noRecordedValue(dp.GetFlags()) {
+				continue
+			}
+
+			t := otlpTime(dp.GetTimeUnixNano(), now)
+			labels := otlpLabels(dp.GetAttributes())
+
+			g.add(service, t, labels, name+"_COUNT", int64(dp.GetCount()), "INT")
+			if dp.Sum != nil {
+				g.add(service, t, labels, name+"_SUM", dp.GetSum(), "FLOAT")
+			}
+
+			bounds := dp.GetExplicitBounds()
+			var count uint64
+			for i, c := range dp.GetBucketCounts() {
+				count += c
+
+				le := "+Inf"
+				if i < len(bounds) {
+					le = strconv.FormatFloat(bounds[i], 'g', -1, 64)
+				}
+				g.add(service, t, withLabel(labels, "le", le), name+"_BUCKET", int64(count), "INT")
+			}
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		for _, dp := range data.ExponentialHistogram.GetDataPoints() {
+			if noRecordedValue(dp.GetFlags()) {
+				continue
+			}
+
+			t := otlpTime(dp.GetTimeUnixNano(), now)
+			labels := otlpLabels(dp.GetAttributes())
+
+			g.add(service, t, labels, name+"_COUNT", int64(dp.GetCount()), "INT")
+			if dp.Sum != nil {
+				g.add(service, t, labels, name+"_SUM", dp.GetSum(), "FLOAT")
+			}
+		}
+	case *metricspb.Metric_Summary:
+		for _, dp := range data.Summary.GetDataPoints() {
+			if noRecordedValue(dp.GetFlags()) {
+				continue
+			}
+
+			t := otlpTime(dp.GetTimeUnixNano(), now)
+			labels := otlpLabels(dp.GetAttributes())
+
+			g.add(service, t, labels, name+"_COUNT", int64(dp.GetCount()), "INT")
+			g.add(service, t, labels, name+"_SUM", dp.GetSum(), "FLOAT")
+
+			for _, q := range dp.GetQuantileValues() {
+				quantile := strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)
+				g.add(service, t, withLabel(labels, "quantile", quantile), name, q.GetValue(), "FLOAT")
+			}
+		}
+	}
+}
+
+func addOTLPNumbers(g *pointGroups, service, name string, points []*metricspb.NumberDataPoint, now time.Time) {
+	for _, dp := range points {
+		if noRecordedValue(dp.GetFlags()) {
+			continue
+		}
+
+		t := otlpTime(dp.GetTimeUnixNano(), now)
+		labels := otlpLabels(dp.GetAttributes())
+
+		switch v := dp.GetValue().(type) {
+		case *metricspb.NumberDataPoint_AsInt:
+			g.add(service, t, labels, name, v.AsInt, "INT")
+		case *metricspb.NumberDataPoint_AsDouble:
+			if math.IsNaN(v.AsDouble) || math.IsInf(v.AsDouble, 0) {
+				continue
+			}
+			g.add(service, t, labels, name, v.AsDouble, "FLOAT")
+		}
+	}
+}
+
+// otlpPoints counts the data points of m.
+func otlpPoints(m *metricspb.Metric) int {
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		return len(data.Gauge.GetDataPoints())
+	case *metricspb.Metric_Sum:
+		return len(data.Sum.GetDataPoints())
+	case *metricspb.Metric_Histogram:
+		return len(data.Histogram.GetDataPoints())
+	case *metricspb.Metric_ExponentialHistogram:
+		return len(data.ExponentialHistogram.GetDataPoints())
+	case *metricspb.Metric_Summary:
+		return len(data.Summary.GetDataPoints())
+	default:
+		return 0
+	}
+}
+
+func noRecordedValue(flags uint32) bool {
+	mask := uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK)
+	return flags&mask == mask
+}
+
+func otlpTime(ns uint64, now time.Time) time.Time {
+	if ns == 0 {
+		return now
+	}
+	return time.Unix(0, int64(ns)).UTC()
+}
+
+func otlpLabels(attributes []*commonpb.KeyValue) map[string]string {
+	labels := make(map[string]string, len(attributes))
+	for _, kv := range attributes {
+		labels[kv.GetKey()] = otlpValue(kv.GetValue())
+	}
+	return labels
+}
+
+// otlpValue renders an attribute value as a string, arrays and maps are rendered as JSON.
+func otlpValue(v *commonpb.AnyValue) string {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+	case *commonpb.AnyValue_ArrayValue:
+		b, _ := protojson.Marshal(v.ArrayValue)
+		return string(b)
+	case *commonpb.AnyValue_KvlistValue:
+		b, _ := protojson.Marshal(v.KvlistValue)
+		return string(b)
+	case *commonpb.AnyValue_BytesValue:
+		return string(v.BytesValue)
+	default:
+		return ""
+	}
+}
+
+// withLabel returns a copy of labels with the label set.
+func withLabel(labels map[string]string, name, value string) map[string]string {
+	l := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		l[k] = v
+	}
+	l[name] = value
+	return l
+}
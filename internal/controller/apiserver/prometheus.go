@@ -0,0 +1,110 @@
+package apiserver
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+const expositionContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metricFamily is a Prometheus metric the latest values of DWH metrics of some types are exported as.
+type metricFamily struct {
+	name string
+	help string
+}
+
+var (
+	valueFamily     = &metricFamily{"dwh_metric_value", "Latest value of an INT, FLOAT or BOOL metric, BOOL is exported as 0 or 1."}
+	durationFamily  = &metricFamily{"dwh_metric_duration_seconds", "Latest value of a DURATION metric in seconds."}
+	timestampFamily = &metricFamily{"dwh_metric_timestamp_seconds", "Latest value of a TIMESTAMP_WITH_TIMEZONE metric in seconds since the unix epoch."}
+	infoFamily      = &metricFamily{"dwh_metric_info", "Latest value of a STRING metric in the value label."}
+
+	metricFamilies = []*metricFamily{valueFamily, durationFamily, timestampFamily, infoFamily}
+)
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeExposition renders values in the Prometheus text exposition format. The service and metric slugs
+// become the service and metric labels and every sample carries the time stamp of its event.
+func writeExposition(w io.Writer, values []*entity.LatestValue) error {
+	samples := make(map[*metricFamily][]string)
+
+	for _, lv := range values {
+		family, x, labels, err := sample(lv)
+		if err != nil {
+			return fmt.Errorf("service %s: metric %s: %w", lv.ServiceSlug, lv.MetricSlug, err)
+		}
+
+		samples[family] = append(samples[family], fmt.Sprintf(
+			"%s{%s} %s %d\n",
+			family.name,
+			labels,
+			formatSampleValue(x),
+			lv.TimeStamp.UnixNano()/int64(time.Millisecond),
+		))
+	}
+
+	for _, family := range metricFamilies {
+		if len(samples[family]) == 0 {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", family.name, family.help, family.name); err != nil {
+			return err
+		}
+
+		for _, s := range samples[family] {
+			if _, err := io.WriteString(w, s); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// sample converts the latest value of a metric to a sample of the family of its type.
+func sample(lv *entity.LatestValue) (*metricFamily, float64, string, error) {
+	labels := fmt.Sprintf(`service="%s",metric="%s"`, labelValueReplacer.Replace(lv.ServiceSlug), labelValueReplacer.Replace(lv.MetricSlug))
+
+	switch v := lv.Value.(type) {
+	case int64:
+		return valueFamily, float64(v), labels, nil
+	case int:
+		return valueFamily, float64(v), labels, nil
+	case float64:
+		return valueFamily, v, labels, nil
+	case bool:
+		if v {
+			return valueFamily, 1, labels, nil
+		}
+		return valueFamily, 0, labels, nil
+	case time.Duration:
+		return durationFamily, v.Seconds(), labels, nil
+	case time.Time:
+		return timestampFamily, float64(v.UnixNano()) / float64(time.Second), labels, nil
+	case string:
+		return infoFamily, 1, labels + fmt.Sprintf(`,value="%s"`, labelValueReplacer.Replace(v)), nil
+	default:
+		return nil, 0, "", fmt.Errorf("%w: unsupported type %T", entity.ErrInvalidMetricValue, v)
+	}
+}
+
+func formatSampleValue(x float64) string {
+	switch {
+	case math.IsInf(x, +1):
+		return "+Inf"
+	case math.IsInf(x, -1):
+		return "-Inf"
+	case math.IsNaN(x):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,134 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/gorilla/mux"
+)
+
+var (
+	errBlankPeriod   = errors.New("period: from and to cannot be blank")
+	errInvalidPeriod = errors.New("period: from must be before to")
+)
+
+// valuesQuery selects the values of a metric of a service over a period,
+// the service and the metric are referred to by id or, if it is not set, by slug.
+// The values are narrowed to the events whose labels satisfy every matcher of Match
+// and split by the values of the GroupBy labels.
+type valuesQuery struct {
+	ServiceID   int                   `json:"service_id"`
+	ServiceSlug string                `json:"service_slug,omitempty"`
+	Period      [2]*entity.CustomTime `json:"period"`
+	MetricID    int                   `json:"metric_id"`
+	MetricSlug  string                `json:"metric_slug,omitempty"`
+	Bucket      string                `json:"bucket,omitempty"`
+	Functions   []string              `json:"functions,omitempty"`
+	Match       []string              `json:"match,omitempty"`
+	GroupBy     []string              `json:"group_by,omitempty"`
+
+	bucket   time.Duration
+	selector *entity.LabelSelector
+}
+
+// decodeValuesQuery reads the query from the JSON body of the deprecated GET /events and GET /events/aggregate.
+func decodeValuesQuery(r *http.Request) (*valuesQuery, error) {
+	q := &valuesQuery{}
+	if err := json.NewDecoder(r.Body).Decode(q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// parseValuesQuery reads the query from the path and query parameters of /services/{service}/metrics/{metric}/...
+// Numeric path segments are ids, other ones are slugs. Functions are given as a comma-separated list
+// or by repeating the parameter, so are the labels of group_by. Every matcher such as host="a" or region=~"eu-.*"
+// is given in a match parameter of its own.
+func parseValuesQuery(r *http.Request) (*valuesQuery, error) {
+	vars := mux.Vars(r)
+	values := r.URL.Query()
+
+	q := &valuesQuery{
+		Bucket: values.Get("bucket"),
+	}
+	q.ServiceID, q.ServiceSlug = pathRef(vars["service"])
+	q.MetricID, q.MetricSlug = pathRef(vars["metric"])
+
+	for i, name := range []string{"from", "to"} {
+		v := values.Get(name)
+		if v == "" {
+			continue
+		}
+
+		// an unescaped "+" of the zone offset is decoded as a space
+		t, err := time.Parse(time.RFC3339, strings.ReplaceAll(v, " ", "+"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		q.Period[i] = &entity.CustomTime{Time: t}
+	}
+
+	q.Functions = listParam(values["functions"])
+	q.Match = values["match"]
+	q.GroupBy = listParam(values["group_by"])
+
+	return q, nil
+}
+
+func pathRef(v string) (int, string) {
+	if id, err := strconv.Atoi(v); err == nil {
+		return id, ""
+	}
+	return 0, v
+}
+
+// validate checks the period, parses the label matchers and, for aggregations, the bucket.
+func (q *valuesQuery) validate(aggregate bool) error {
+	if q.Period[0] == nil || q.Period[1] == nil {
+		return errBlankPeriod
+	}
+
+	if !q.Period[0].Before(q.Period[1].Time) {
+		return errInvalidPeriod
+	}
+
+	if len(q.Match) > 0 || len(q.GroupBy) > 0 {
+		q.selector = &entity.LabelSelector{GroupBy: q.GroupBy}
+		for _, v := range q.Match {
+			m, err := entity.ParseLabelMatcher(v)
+			if err != nil {
+				return fmt.Errorf("match: %w", err)
+			}
+			q.selector.Matchers = append(q.selector.Matchers, m)
+		}
+	}
+
+	if aggregate {
+		bucket, err := entity.ParseBucket(q.Bucket)
+		if err != nil {
+			return fmt.Errorf("bucket: %w", err)
+		}
+		q.bucket = bucket
+	}
+
+	return nil
+}
+
+// listParam joins the values of a query parameter that is repeated or holds a comma-separated list.
+func listParam(values []string) []string {
+	var res []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item != "" {
+				res = append(res, item)
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,84 @@
+package apiserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/AnatoliyBr/dwh-service/internal/controller/ratelimit"
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+// Route groups the rate limits are configured for.
+const (
+	// RouteGroupIngest is the routes adding events, the ones granted by the write scope.
+	RouteGroupIngest = ratelimit.GroupIngest
+
+	// RouteGroupQuery is the GET routes, the ones granted by the read scope.
+	RouteGroupQuery = ratelimit.GroupQuery
+
+	// RouteGroupAdmin is everything else.
+	RouteGroupAdmin = ratelimit.GroupAdmin
+)
+
+// RateLimit is a token bucket of a client: every request takes a token
+// and the bucket is refilled with Rate tokens a second up to Burst tokens.
+type RateLimit = ratelimit.Limit
+
+// RateLimiter returns the limiter of the requests, the gRPC API shares it.
+func (s *apiServer) RateLimiter() *ratelimit.Limiter {
+	return s.rateLimiter
+}
+
+// rateLimit limits the requests of every client by the bucket of the route group, a client is identified
+// by its API key, by the subject and the tenant of its token or, if the request has neither, by its address,
+// like the calls of the gRPC API.
+func (s *apiServer) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st, ok := s.rateLimiter.Take(rateLimitClient(r), routeGroup(r))
+		if st != nil {
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(st.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(st.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ratelimit.CeilSeconds(st.Reset)))
+		}
+
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(ratelimit.CeilSeconds(st.RetryAfter)))
+			s.error(w, r, http.StatusTooManyRequests, ratelimit.ErrRateLimited)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func rateLimitClient(r *http.Request) string {
+	switch k := apiKey(r.Context()); {
+	case k == adminKey:
+		return "admin_key"
+	case k != nil && k.KeyID != 0:
+		return fmt.Sprintf("key:%d", k.KeyID)
+	case k != nil:
+		// subjects are unique only within the tenant of the token
+		return fmt.Sprintf("subject:%d:%s", k.TenantID, k.Name)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// routeGroup returns the group of the route by the scope granting it.
+func routeGroup(r *http.Request) string {
+	switch routeScope(r) {
+	case entity.ScopeWrite:
+		return RouteGroupIngest
+	case entity.ScopeRead:
+		return RouteGroupQuery
+	default:
+		return RouteGroupAdmin
+	}
+}
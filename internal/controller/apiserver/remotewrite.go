@@ -0,0 +1,185 @@
+package apiserver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	errInvalidWriteRequest  = errors.New("invalid write request")
+	errWriteRequestTooLarge = errors.New("write request too large")
+	errNoServiceOrMetric    = errors.New("series without a job or instance label or a metric name")
+)
+
+// writeRequest holds the parts of a prometheus.WriteRequest the receiver uses,
+// metadata, exemplars and native histograms are skipped.
+type writeRequest struct {
+	series []*timeSeries
+}
+
+type timeSeries struct {
+	labels  map[string]string
+	samples []promSample
+}
+
+type promSample struct {
+	value     float64
+	timestamp int64
+}
+
+// decodeWriteRequest decodes a protobuf encoded prometheus.WriteRequest:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; ... }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; ... }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func decodeWriteRequest(b []byte) (*writeRequest, error) {
+	req := &writeRequest{}
+
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+
+		ts, err := decodeTimeSeries(v)
+		if err != nil {
+			return err
+		}
+		req.series = append(req.series, ts)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func decodeTimeSeries(b []byte) (*timeSeries, error) {
+	ts := &timeSeries{
+		labels: make(map[string]string),
+	}
+
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+
+		switch num {
+		case 1:
+			var name, value string
+			if err := decodeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if typ == protowire.BytesType {
+					switch num {
+					case 1:
+						name = string(v)
+					case 2:
+						value = string(v)
+					}
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			ts.labels[name] = value
+		case 2:
+			s := promSample{}
+			if err := decodeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				switch {
+				case num == 1 && typ == protowire.Fixed64Type:
+					x, _ := protowire.ConsumeFixed64(v)
+					s.value = math.Float64frombits(x)
+				case num == 2 && typ == protowire.VarintType:
+					x, _ := protowire.ConsumeVarint(v)
+					s.timestamp = int64(x)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			ts.samples = append(ts.samples, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ts, nil
+}
+
+// decodeMessage calls field for every field of a protobuf message. Length-delimited values are passed
+// without their length, other values are passed in their wire encoding.
+func decodeMessage(b []byte, field func(protowire.Number, protowire.Type, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("%w: %s", errInvalidWriteRequest, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var v []byte
+		if typ == protowire.BytesType {
+			v, n = protowire.ConsumeBytes(b)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n >= 0 {
+				v = b[:n]
+			}
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: %s", errInvalidWriteRequest, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if err := field(num, typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remoteWriteEvents groups the samples of req into events. The service is taken from the job label
+// or, if there is none, from the instance label, the metric from __name__ and all other labels are kept
+// as the labels of the event. Stale markers and other NaN samples are skipped.
+// Series without a service or a metric name are reported in rejected.
+func remoteWriteEvents(req *writeRequest) (g *pointGroups, rejected int) {
+	g = newPointGroups()
+
+	for _, ts := range req.series {
+		labels := make(map[string]string, len(ts.labels))
+		for name, value := range ts.labels {
+			labels[name] = value
+		}
+
+		metric := entity.SanitizeSlug(labels["__name__"])
+		delete(labels, "__name__")
+
+		serviceLabel := "job"
+		if labels[serviceLabel] == "" {
+			serviceLabel = "instance"
+		}
+		service := entity.SanitizeSlug(labels[serviceLabel])
+		delete(labels, serviceLabel)
+
+		if metric == "" || service == "" {
+			rejected += len(ts.samples)
+			continue
+		}
+
+		for _, s := range ts.samples {
+			if math.IsNaN(s.value) {
+				continue
+			}
+
+			g.add(service, time.UnixMilli(s.timestamp).UTC(), labels, metric, s.value, "FLOAT")
+		}
+	}
+
+	return g, rejected
+}
@@ -0,0 +1,125 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/gorilla/mux"
+)
+
+// retentionTarget returns an empty policy of the service or the metric of the path,
+// which are referred to by id or by slug.
+func (s *apiServer) retentionTarget(r *http.Request) (*entity.RetentionPolicy, error) {
+	vars := mux.Vars(r)
+	p := &entity.RetentionPolicy{}
+
+	if v, ok := vars["service"]; ok {
+		id, slug := pathRef(v)
+		service, err := s.findService(s.useCase(r), id, slug)
+		if err != nil {
+			return nil, err
+		}
+		p.ServiceID = service.ServiceID
+		return p, nil
+	}
+
+	id, slug := pathRef(vars["metric"])
+	metric, err := s.findMetric(s.useCase(r), id, slug)
+	if err != nil {
+		return nil, err
+	}
+	p.MetricID = metric.MetricID
+	return p, nil
+}
+
+// findRetentionPolicy looks up the policy of the target.
+func findRetentionPolicy(uc usecase.UseCase, target *entity.RetentionPolicy) (*entity.RetentionPolicy, error) {
+	if target.ServiceID != 0 {
+		return uc.RetentionPolicyFindByService(target.ServiceID)
+	}
+	return uc.RetentionPolicyFindByMetric(target.MetricID)
+}
+
+// handleRetentionPolicySave creates or replaces the policy of a service or a metric.
+func (s *apiServer) handleRetentionPolicySave() http.HandlerFunc {
+	type request struct {
+		KeepRaw     string            `json:"keep_raw"`
+		KeepRollups map[string]string `json:"keep_rollups"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &request{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		p, err := s.retentionTarget(r)
+		if err != nil {
+			s.error(w, r, http.StatusNotFound, err)
+			return
+		}
+		p.KeepRaw = req.KeepRaw
+		p.KeepRollups = req.KeepRollups
+
+		if err := s.useCase(r).RetentionPolicySave(p); err != nil {
+			s.error(w, r, updateErrorCode(err), err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, p)
+	}
+}
+
+func (s *apiServer) handleRetentionPolicyFind() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target, err := s.retentionTarget(r)
+		if err != nil {
+			s.error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		p, err := findRetentionPolicy(s.useCase(r), target)
+		if err != nil {
+			s.error(w, r, deleteErrorCode(err), err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, p)
+	}
+}
+
+func (s *apiServer) handleRetentionPolicyDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target, err := s.retentionTarget(r)
+		if err != nil {
+			s.error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		p, err := findRetentionPolicy(s.useCase(r), target)
+		if err == nil {
+			err = s.useCase(r).RetentionPolicyDelete(p.PolicyID)
+		}
+		if err != nil {
+			s.error(w, r, deleteErrorCode(err), err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *apiServer) handleRetentionPolicyList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policies, err := s.useCase(r).RetentionPolicyList()
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, policies)
+	}
+}
@@ -0,0 +1,120 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+)
+
+var errUnknownTenant = errors.New("X-Tenant: unknown tenant")
+
+// useCase returns the use cases of the tenant of the request.
+func (s *apiServer) useCase(r *http.Request) usecase.UseCase {
+	if uc, ok := r.Context().Value(ctxKeyUseCase).(usecase.UseCase); ok {
+		return uc
+	}
+	return s.uc
+}
+
+// resolveTenant scopes the request to the tenant its key is bound to. Requests without a bound key,
+// i.e. the requests of the admin_key, of unbound tokens or without authentication, name the tenant by id or by slug
+// in the X-Tenant header and are scoped to the default tenant if they do not.
+func (s *apiServer) resolveTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID := entity.DefaultTenantID
+		if k := apiKey(r.Context()); k != nil && k.TenantID != 0 {
+			tenantID = k.TenantID
+		}
+
+		if header := r.Header.Get("X-Tenant"); header != "" {
+			id, slug := pathRef(header)
+			t, err := s.findTenant(id, slug)
+			if err != nil {
+				s.error(w, r, http.StatusBadRequest, errUnknownTenant)
+				return
+			}
+
+			if k := apiKey(r.Context()); k != nil && k.TenantID != 0 && k.TenantID != t.TenantID {
+				s.error(w, r, http.StatusForbidden, errForbidden)
+				return
+			}
+			tenantID = t.TenantID
+		}
+
+		uc := s.uc
+		if tenantID != s.uc.TenantID() {
+			uc = s.uc.ForTenant(tenantID)
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyUseCase, uc)))
+	})
+}
+
+// requireUnbound leaves managing tenants to the keys that are not bound to a tenant when authentication is enabled.
+func (s *apiServer) requireUnbound(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if k := apiKey(r.Context()); s.config.AuthMode != AuthNone && (k == nil || k.TenantID != 0) {
+			s.error(w, r, http.StatusForbidden, errForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// findTenant looks the tenant up by id or, if the id is not set, by slug.
+func (s *apiServer) findTenant(tenantID int, slug string) (*entity.Tenant, error) {
+	if tenantID == 0 && slug != "" {
+		return s.uc.TenantFindBySlug(entity.NormalizeSlug(slug))
+	}
+	return s.uc.TenantFindByID(tenantID)
+}
+
+func (s *apiServer) handleTenantCreate() http.HandlerFunc {
+	type request struct {
+		Slug    string `json:"slug"`
+		Details string `json:"details"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &request{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		t := &entity.Tenant{
+			Slug:    req.Slug,
+			Details: req.Details,
+		}
+
+		if _, err := s.uc.TenantFindBySlug(entity.NormalizeSlug(t.Slug)); err == nil {
+			s.error(w, r, http.StatusConflict, fmt.Errorf("slug: tenant %s already exists", entity.NormalizeSlug(t.Slug)))
+			return
+		}
+
+		if err := s.uc.TenantCreate(t); err != nil {
+			s.error(w, r, http.StatusUnprocessableEntity, err)
+			return
+		}
+
+		s.respond(w, r, http.StatusCreated, t)
+	}
+}
+
+func (s *apiServer) handleTenantList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenants, err := s.uc.TenantList()
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.respond(w, r, http.StatusOK, tenants)
+	}
+}
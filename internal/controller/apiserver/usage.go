@@ -0,0 +1,66 @@
+package apiserver
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/controller/ratelimit"
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+)
+
+const usageDayLayout = "2006-01-02"
+
+// quotaRetryAfter tells the clients rejected by a daily quota to retry once the quotas are reset
+// and reports whether err is such a rejection.
+func quotaRetryAfter(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, entity.ErrQuotaExceeded) {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(ratelimit.CeilSeconds(entity.UsageReset(time.Now()))))
+	return true
+}
+
+// handleUsage reports the usage of the daily quotas by the services of the tenant, today or on ?day=YYYY-MM-DD,
+// and to the keys that are not bound to a tenant the rate limits of the clients of this replica.
+func (s *apiServer) handleUsage() http.HandlerFunc {
+	type response struct {
+		Day        string              `json:"day"`
+		Quotas     usecase.Quotas      `json:"quotas"`
+		Services   []*entity.Usage     `json:"services"`
+		RateLimits []*ratelimit.Status `json:"rate_limits,omitempty"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		day := entity.UsageDay(time.Now())
+		if v := r.URL.Query().Get("day"); v != "" {
+			d, err := time.Parse(usageDayLayout, v)
+			if err != nil {
+				s.error(w, r, http.StatusBadRequest, errors.New("day: must be a date in the format YYYY-MM-DD"))
+				return
+			}
+			day = d
+		}
+
+		usage, err := s.useCase(r).Usage(day)
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		resp := &response{
+			Day:      day.Format(usageDayLayout),
+			Quotas:   s.uc.Quotas(),
+			Services: usage,
+		}
+
+		if k := apiKey(r.Context()); k == nil || k.TenantID == 0 {
+			resp.RateLimits = s.rateLimiter.Usage()
+		}
+
+		s.respond(w, r, http.StatusOK, resp)
+	}
+}
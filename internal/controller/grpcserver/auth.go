@@ -0,0 +1,144 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type ctxKey uint8
+
+const (
+	ctxKeyAPIKey ctxKey = iota
+	ctxKeyUseCase
+)
+
+// Authenticator identifies the principal presenting the credentials of a call, an API key or a token
+// standing for one depending on the auth_mode of the REST API.
+type Authenticator func(credentials string) (*entity.APIKey, error)
+
+// adminKey is the key of the calls presenting the admin_key of the config.
+var adminKey = &entity.APIKey{
+	Name:   "admin_key",
+	Scopes: []string{entity.ScopeAdmin},
+}
+
+// methodScopes are the scopes of the methods other than the admin ones.
+var methodScopes = map[string]string{
+	"GetService":            entity.ScopeRead,
+	"ListServices":          entity.ScopeRead,
+	"GetMetric":             entity.ScopeRead,
+	"ListMetrics":           entity.ScopeRead,
+	"GetMetricValues":       entity.ScopeRead,
+	"AggregateMetricValues": entity.ScopeRead,
+	"CreateEvent":           entity.ScopeWrite,
+	"StreamEvents":          entity.ScopeWrite,
+}
+
+// apiKey returns the authenticated key of the call, nil if there is none.
+func apiKey(ctx context.Context) *entity.APIKey {
+	k, _ := ctx.Value(ctxKeyAPIKey).(*entity.APIKey)
+	return k
+}
+
+// authStream passes the context with the authenticated key and the tenant to the handler of a stream.
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *grpcServer) authUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err = s.resolveTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *grpcServer) authStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	ctx, err = s.resolveTenant(ctx)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+}
+
+// authorize requires a principal granting the scope of the method when authentication is enabled,
+// the credentials are read from the authorization metadata with the Bearer scheme or from x-api-key.
+func (s *grpcServer) authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	if !s.config.Auth {
+		return ctx, nil
+	}
+
+	key := callAPIKey(ctx)
+	if key == "" {
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	var (
+		k   *entity.APIKey
+		err error
+	)
+	if s.config.AdminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.config.AdminKey)) == 1 {
+		k = adminKey
+	} else if k, err = s.authenticate(key); err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	if !k.Allows(methodScope(fullMethod)) {
+		return nil, status.Error(codes.PermissionDenied, entity.ErrForbidden.Error())
+	}
+
+	return context.WithValue(ctx, ctxKeyAPIKey, k), nil
+}
+
+// methodScope returns the scope granting the method.
+func methodScope(fullMethod string) string {
+	if scope, ok := methodScopes[fullMethod[strings.LastIndex(fullMethod, "/")+1:]]; ok {
+		return scope
+	}
+	return entity.ScopeAdmin
+}
+
+func callAPIKey(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if keys := md.Get("x-api-key"); len(keys) > 0 {
+		return keys[0]
+	}
+
+	for _, v := range md.Get("authorization") {
+		if scheme, key, ok := strings.Cut(v, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(key)
+		}
+	}
+	return ""
+}
+
+// eventAuthorizer returns the check that the API key of the call may add events to the service of an event.
+func (s *grpcServer) eventAuthorizer(ctx context.Context) func(*entity.Event) error {
+	if !s.config.Auth {
+		return func(*entity.Event) error { return nil }
+	}
+	return s.useCase(ctx).EventAuthorizer(apiKey(ctx))
+}
@@ -0,0 +1,37 @@
+package grpcserver
+
+import "time"
+
+type Config struct {
+	// the server is started only if enabled
+	Enabled         bool          `toml:"enabled"`
+	BindAddr        string        `toml:"bind_addr"`
+	ShutdownTimeout time.Duration `toml:"shutdown_time"`
+	LogLevel        string        `toml:"log_level"`
+
+	// limits for client-supplied event timestamps, zero disables the check
+	MaxEventAge        time.Duration `toml:"max_event_age"`
+	MaxEventFutureSkew time.Duration `toml:"max_event_future_skew"`
+
+	// number of streamed events written at once
+	MaxBatchSize int `toml:"max_batch_size"`
+
+	// require an API key or, with auth_mode jwt of the REST API, a token granting the scope of the method
+	// on every call, on unless turned off
+	Auth bool `toml:"auth"`
+
+	// key granting the admin scope without being stored
+	AdminKey string `toml:"admin_key"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		BindAddr:           ":9090",
+		ShutdownTimeout:    3 * time.Second,
+		LogLevel:           "debug",
+		MaxEventAge:        24 * time.Hour,
+		MaxEventFutureSkew: 5 * time.Minute,
+		MaxBatchSize:       1000,
+		Auth:               true,
+	}
+}
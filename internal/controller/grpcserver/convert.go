@@ -0,0 +1,221 @@
+package grpcserver
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	dwhv1 "github.com/AnatoliyBr/dwh-service/api/dwh/v1"
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	errBlankService  = errors.New("service: cannot be blank")
+	errBlankMetric   = errors.New("metric: cannot be blank")
+	errBlankPeriod   = errors.New("period: from and to cannot be blank")
+	errInvalidPeriod = errors.New("period: from must be before to")
+)
+
+func toService(s *entity.Service) *dwhv1.Service {
+	return &dwhv1.Service{
+		ServiceId:  int64(s.ServiceID),
+		Slug:       s.Slug,
+		Details:    s.Details,
+		Archived:   s.Archived,
+		ArchivedAt: toArchivedAt(s.ArchivedAt),
+	}
+}
+
+func toMetric(m *entity.Metric) *dwhv1.Metric {
+	return &dwhv1.Metric{
+		MetricId:   int64(m.MetricID),
+		Slug:       m.Slug,
+		MetricType: m.MetricType,
+		Details:    m.Details,
+		Archived:   m.Archived,
+		ArchivedAt: toArchivedAt(m.ArchivedAt),
+	}
+}
+
+func toArchivedAt(t *entity.CustomTime) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(t.Time)
+}
+
+func toCascade(c *entity.Cascade) *dwhv1.Cascade {
+	return &dwhv1.Cascade{
+		Events: int64(c.Events),
+		Values: int64(c.Values),
+	}
+}
+
+func toEvent(e *entity.Event) *dwhv1.Event {
+	return &dwhv1.Event{
+		EventId:   int64(e.EventID),
+		TimeStamp: toTimestamp(e.TimeStamp.Time),
+		ServiceId: int64(e.ServiceID),
+		Labels:    e.Labels,
+	}
+}
+
+func toTimestamp(t time.Time) *timestamppb.Timestamp {
+	return timestamppb.New(t)
+}
+
+// toValue converts a stored value or an aggregate of a metric of metricType,
+// durations are returned by aggregations as strings.
+func toValue(metricType string, v interface{}) (*dwhv1.Value, error) {
+	switch v := v.(type) {
+	case int:
+		return &dwhv1.Value{Value: &dwhv1.Value_IntValue{IntValue: int64(v)}}, nil
+	case int64:
+		return &dwhv1.Value{Value: &dwhv1.Value_IntValue{IntValue: v}}, nil
+	case float64:
+		return &dwhv1.Value{Value: &dwhv1.Value_FloatValue{FloatValue: v}}, nil
+	case time.Duration:
+		return &dwhv1.Value{Value: &dwhv1.Value_DurationValue{DurationValue: durationpb.New(v)}}, nil
+	case time.Time:
+		return &dwhv1.Value{Value: &dwhv1.Value_TimestampValue{TimestampValue: timestamppb.New(v)}}, nil
+	case entity.CustomTime:
+		return &dwhv1.Value{Value: &dwhv1.Value_TimestampValue{TimestampValue: timestamppb.New(v.Time)}}, nil
+	case *entity.CustomTime:
+		return &dwhv1.Value{Value: &dwhv1.Value_TimestampValue{TimestampValue: timestamppb.New(v.Time)}}, nil
+	case bool:
+		return &dwhv1.Value{Value: &dwhv1.Value_BoolValue{BoolValue: v}}, nil
+	case string:
+		if metricType == "DURATION" {
+			if d, err := time.ParseDuration(v); err == nil {
+				return &dwhv1.Value{Value: &dwhv1.Value_DurationValue{DurationValue: durationpb.New(d)}}, nil
+			}
+		}
+		return &dwhv1.Value{Value: &dwhv1.Value_StringValue{StringValue: v}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+// fromValue converts a value of a request into the form the metric value parsers accept.
+func fromValue(v *dwhv1.Value) interface{} {
+	switch v := v.GetValue().(type) {
+	case *dwhv1.Value_IntValue:
+		return v.IntValue
+	case *dwhv1.Value_FloatValue:
+		return v.FloatValue
+	case *dwhv1.Value_DurationValue:
+		return v.DurationValue.AsDuration()
+	case *dwhv1.Value_TimestampValue:
+		return v.TimestampValue.AsTime()
+	case *dwhv1.Value_BoolValue:
+		return v.BoolValue
+	case *dwhv1.Value_StringValue:
+		return v.StringValue
+	default:
+		return nil
+	}
+}
+
+func listOptions(req *dwhv1.ListRequest) *entity.ListOptions {
+	return &entity.ListOptions{
+		Cursor:          req.GetCursor(),
+		Limit:           int(req.GetLimit()),
+		SortBy:          req.GetSortBy(),
+		Order:           req.GetOrder(),
+		SlugPrefix:      req.GetSlugPrefix(),
+		MetricType:      req.GetMetricType(),
+		Search:          req.GetSearch(),
+		IncludeArchived: req.GetIncludeArchived(),
+	}
+}
+
+// toLabelSelector converts the label matchers and the grouping of a query, nil if it has neither.
+func toLabelSelector(matchers []*dwhv1.LabelMatcher, groupBy []string) (*entity.LabelSelector, error) {
+	if len(matchers) == 0 && len(groupBy) == 0 {
+		return nil, nil
+	}
+
+	sel := &entity.LabelSelector{GroupBy: groupBy}
+	for _, m := range matchers {
+		lm, err := entity.NewLabelMatcher(m.GetName(), m.GetType(), m.GetValue())
+		if err != nil {
+			return nil, err
+		}
+		sel.Matchers = append(sel.Matchers, lm)
+	}
+
+	return sel, nil
+}
+
+// checkPaths rejects update mask paths other than the allowed ones.
+func checkPaths(paths []string, allowed ...string) error {
+	for _, p := range paths {
+		if !masked(allowed, p) {
+			return status.Errorf(codes.InvalidArgument, "update_mask: unknown field %s", p)
+		}
+	}
+	return nil
+}
+
+// masked reports whether the field is changed by an update with paths, an empty mask changes every field.
+func masked(paths []string, field string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		if p == field {
+			return true
+		}
+	}
+	return false
+}
+
+// findError responds with NotFound to lookups of unknown services and metrics.
+func findError(err error) error {
+	switch {
+	case errors.Is(err, errBlankService), errors.Is(err, errBlankMetric):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, repository.ErrRecordNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// updateError responds with NotFound to updates of unknown services and metrics,
+// with FailedPrecondition to changes of the type of a metric with stored values and with InvalidArgument to everything else.
+func updateError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrRecordNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, entity.ErrMetricTypeLocked):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+}
+
+func ingestError(err error) error {
+	return status.Error(ingestErrorCode(err), err.Error())
+}
+
+// ingestErrorCode tells the events that refer to unknown or archived services and metrics, hold invalid values or labels
+// or exceed a daily quota from failures of the storage.
+func ingestErrorCode(err error) codes.Code {
+	if errors.Is(err, repository.ErrRecordNotFound) ||
+		errors.Is(err, entity.ErrInvalidMetricValue) ||
+		errors.Is(err, entity.ErrInvalidLabels) ||
+		errors.Is(err, entity.ErrArchived) ||
+		errors.Is(err, entity.ErrBatchRejected) {
+		return codes.InvalidArgument
+	}
+	if errors.Is(err, entity.ErrQuotaExceeded) {
+		return codes.ResourceExhausted
+	}
+	return codes.Internal
+}
@@ -0,0 +1,616 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"time"
+
+	dwhv1 "github.com/AnatoliyBr/dwh-service/api/dwh/v1"
+	"github.com/AnatoliyBr/dwh-service/internal/controller/ratelimit"
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var errDryRunWithoutHard = errors.New("dry_run requires hard")
+
+type grpcServer struct {
+	dwhv1.UnimplementedDataWarehouseServer
+
+	server          *grpc.Server
+	notify          chan error
+	started         bool
+	shutdownTimeout time.Duration
+	config          *Config
+	logger          *logrus.Logger
+	uc              usecase.UseCase
+	rateLimiter     *ratelimit.Limiter
+	authenticate    Authenticator
+}
+
+// NewGRPCServer creates the server authenticating and limiting the calls like the REST API does.
+func NewGRPCServer(config *Config, uc usecase.UseCase, rl *ratelimit.Limiter, authenticate Authenticator) (*grpcServer, error) {
+	s := &grpcServer{
+		notify:          make(chan error, 1),
+		shutdownTimeout: config.ShutdownTimeout,
+		config:          config,
+		logger:          logrus.New(),
+		uc:              uc,
+		rateLimiter:     rl,
+		authenticate:    authenticate,
+	}
+
+	if err := s.configureLogger(); err != nil {
+		return nil, err
+	}
+
+	s.server = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.logUnary, s.authUnary, s.rateLimitUnary),
+		grpc.ChainStreamInterceptor(s.logStream, s.authStream, s.rateLimitStream),
+	)
+	dwhv1.RegisterDataWarehouseServer(s.server, s)
+
+	return s, nil
+}
+
+func (s *grpcServer) configureLogger() error {
+	level, err := logrus.ParseLevel(s.config.LogLevel)
+	if err != nil {
+		return err
+	}
+	s.logger.SetLevel(level)
+	return nil
+}
+
+func (s *grpcServer) StartGRPCServer() {
+	s.logger.Info("starting grpc server")
+	s.started = true
+
+	lis, err := net.Listen("tcp", s.config.BindAddr)
+	if err != nil {
+		s.notify <- err
+		close(s.notify)
+		return
+	}
+
+	go func() {
+		s.notify <- s.server.Serve(lis)
+		close(s.notify)
+	}()
+}
+
+func (s *grpcServer) Notify() <-chan error {
+	return s.notify
+}
+
+// Shutdown waits for the running calls to finish for up to the shutdown timeout and then cancels them,
+// it does nothing if the server is not started.
+func (s *grpcServer) Shutdown() error {
+	if !s.started {
+		return nil
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(s.shutdownTimeout):
+		s.server.Stop()
+	}
+	return nil
+}
+
+func (s *grpcServer) logUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	s.logCall(info.FullMethod, start, err)
+	return resp, err
+}
+
+func (s *grpcServer) logStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	s.logCall(info.FullMethod, start, err)
+	return err
+}
+
+func (s *grpcServer) logCall(method string, start time.Time, err error) {
+	code := status.Code(err)
+
+	var level logrus.Level
+	switch code {
+	case codes.OK:
+		level = logrus.InfoLevel
+	case codes.Internal, codes.Unknown, codes.Unavailable:
+		level = logrus.ErrorLevel
+	default:
+		level = logrus.WarnLevel
+	}
+
+	s.logger.WithField("method", method).Logf(level, "completed with %s in %v", code, time.Since(start))
+}
+
+func (s *grpcServer) CreateService(ctx context.Context, req *dwhv1.CreateServiceRequest) (*dwhv1.Service, error) {
+	service := &entity.Service{
+		Slug:    req.GetSlug(),
+		Details: req.GetDetails(),
+	}
+
+	if err := s.useCase(ctx).ServiceCreate(service); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return toService(service), nil
+}
+
+func (s *grpcServer) GetService(ctx context.Context, req *dwhv1.Ref) (*dwhv1.Service, error) {
+	service, err := s.findService(ctx, req)
+	if err != nil {
+		return nil, findError(err)
+	}
+
+	return toService(service), nil
+}
+
+func (s *grpcServer) ListServices(ctx context.Context, req *dwhv1.ListRequest) (*dwhv1.ListServicesResponse, error) {
+	o := listOptions(req)
+	if err := o.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	services, err := s.useCase(ctx).ServiceList(o)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &dwhv1.ListServicesResponse{
+		Services: make([]*dwhv1.Service, len(services)),
+	}
+	for i, service := range services {
+		resp.Services[i] = toService(service)
+	}
+
+	if len(services) == o.Limit {
+		last := services[len(services)-1]
+		resp.NextCursor = o.NextCursor(last.ServiceID, last.Slug)
+	}
+
+	return resp, nil
+}
+
+// UpdateService replaces the service or, with an update mask, changes only the listed fields.
+func (s *grpcServer) UpdateService(ctx context.Context, req *dwhv1.UpdateServiceRequest) (*dwhv1.Service, error) {
+	paths := req.GetUpdateMask().GetPaths()
+	if err := checkPaths(paths, "slug", "details"); err != nil {
+		return nil, err
+	}
+
+	service := &entity.Service{ServiceID: int(req.GetService().GetServiceId())}
+	if len(paths) > 0 {
+		old, err := s.useCase(ctx).ServiceFindByID(service.ServiceID)
+		if err != nil {
+			return nil, findError(err)
+		}
+		*service = *old
+	}
+
+	if masked(paths, "slug") {
+		service.Slug = req.GetService().GetSlug()
+	}
+	if masked(paths, "details") {
+		service.Details = req.GetService().GetDetails()
+	}
+
+	if err := s.useCase(ctx).ServiceUpdate(service); err != nil {
+		return nil, updateError(err)
+	}
+
+	return toService(service), nil
+}
+
+// DeleteService archives the service or, with hard set, removes it together with its events.
+func (s *grpcServer) DeleteService(ctx context.Context, req *dwhv1.DeleteRequest) (*dwhv1.DeleteServiceResponse, error) {
+	if req.GetDryRun() && !req.GetHard() {
+		return nil, status.Error(codes.InvalidArgument, errDryRunWithoutHard.Error())
+	}
+
+	if !req.GetHard() {
+		service, err := s.useCase(ctx).ServiceArchive(int(req.GetId()))
+		if err != nil {
+			return nil, findError(err)
+		}
+
+		return &dwhv1.DeleteServiceResponse{Service: toService(service)}, nil
+	}
+
+	c, err := s.useCase(ctx).ServiceDelete(int(req.GetId()), req.GetDryRun())
+	if err != nil {
+		return nil, findError(err)
+	}
+
+	return &dwhv1.DeleteServiceResponse{Cascade: toCascade(c), DryRun: req.GetDryRun()}, nil
+}
+
+func (s *grpcServer) CreateMetric(ctx context.Context, req *dwhv1.CreateMetricRequest) (*dwhv1.Metric, error) {
+	metric := &entity.Metric{
+		Slug:       req.GetSlug(),
+		MetricType: req.GetMetricType(),
+		Details:    req.GetDetails(),
+	}
+
+	if err := s.useCase(ctx).MetricCreate(metric); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return toMetric(metric), nil
+}
+
+func (s *grpcServer) GetMetric(ctx context.Context, req *dwhv1.Ref) (*dwhv1.Metric, error) {
+	metric, err := s.findMetric(ctx, req)
+	if err != nil {
+		return nil, findError(err)
+	}
+
+	return toMetric(metric), nil
+}
+
+func (s *grpcServer) ListMetrics(ctx context.Context, req *dwhv1.ListRequest) (*dwhv1.ListMetricsResponse, error) {
+	o := listOptions(req)
+	if err := o.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	metrics, err := s.useCase(ctx).MetricList(o)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &dwhv1.ListMetricsResponse{
+		Metrics: make([]*dwhv1.Metric, len(metrics)),
+	}
+	for i, metric := range metrics {
+		resp.Metrics[i] = toMetric(metric)
+	}
+
+	if len(metrics) == o.Limit {
+		last := metrics[len(metrics)-1]
+		resp.NextCursor = o.NextCursor(last.MetricID, last.Slug)
+	}
+
+	return resp, nil
+}
+
+// UpdateMetric replaces the metric or, with an update mask, changes only the listed fields.
+// The type of a metric with stored values cannot be changed.
+func (s *grpcServer) UpdateMetric(ctx context.Context, req *dwhv1.UpdateMetricRequest) (*dwhv1.Metric, error) {
+	paths := req.GetUpdateMask().GetPaths()
+	if err := checkPaths(paths, "slug", "metric_type", "details"); err != nil {
+		return nil, err
+	}
+
+	metric := &entity.Metric{MetricID: int(req.GetMetric().GetMetricId())}
+	if len(paths) > 0 {
+		old, err := s.useCase(ctx).MetricFindByID(metric.MetricID)
+		if err != nil {
+			return nil, findError(err)
+		}
+		*metric = *old
+	}
+
+	if masked(paths, "slug") {
+		metric.Slug = req.GetMetric().GetSlug()
+	}
+	if masked(paths, "metric_type") {
+		metric.MetricType = req.GetMetric().GetMetricType()
+	}
+	if masked(paths, "details") {
+		metric.Details = req.GetMetric().GetDetails()
+	}
+
+	if err := s.useCase(ctx).MetricUpdate(metric); err != nil {
+		return nil, updateError(err)
+	}
+
+	return toMetric(metric), nil
+}
+
+// DeleteMetric archives the metric or, with hard set, removes it together with its values.
+func (s *grpcServer) DeleteMetric(ctx context.Context, req *dwhv1.DeleteRequest) (*dwhv1.DeleteMetricResponse, error) {
+	if req.GetDryRun() && !req.GetHard() {
+		return nil, status.Error(codes.InvalidArgument, errDryRunWithoutHard.Error())
+	}
+
+	if !req.GetHard() {
+		metric, err := s.useCase(ctx).MetricArchive(int(req.GetId()))
+		if err != nil {
+			return nil, findError(err)
+		}
+
+		return &dwhv1.DeleteMetricResponse{Metric: toMetric(metric)}, nil
+	}
+
+	c, err := s.useCase(ctx).MetricDelete(int(req.GetId()), req.GetDryRun())
+	if err != nil {
+		return nil, findError(err)
+	}
+
+	return &dwhv1.DeleteMetricResponse{Cascade: toCascade(c), DryRun: req.GetDryRun()}, nil
+}
+
+// CreateEvent stores an event together with its metric values, either everything is written or nothing is.
+func (s *grpcServer) CreateEvent(ctx context.Context, req *dwhv1.CreateEventRequest) (*dwhv1.Event, error) {
+	e, metrics, err := s.event(req, time.Now())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := s.eventAuthorizer(ctx)(e); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	if err := s.useCase(ctx).EventCreateWithMetrics(e, metrics); err != nil {
+		return nil, ingestError(err)
+	}
+
+	return toEvent(e), nil
+}
+
+// StreamEvents stores the streamed events in batches of up to MaxBatchSize events
+// and reports every rejected event by its position in the stream.
+func (s *grpcServer) StreamEvents(stream dwhv1.DataWarehouse_StreamEventsServer) error {
+	resp := &dwhv1.StreamEventsResponse{}
+	uc := s.useCase(stream.Context())
+	authorizeEvent := s.eventAuthorizer(stream.Context())
+	items := make([]*entity.BatchItem, 0)
+	indexes := make([]int, 0)
+
+	reject := func(i int, err error) {
+		resp.Rejected++
+		resp.Errors = append(resp.Errors, &dwhv1.EventError{Index: int32(i), Error: err.Error()})
+	}
+
+	flush := func() error {
+		for k, err := range uc.EventBatchCreate(items, false) {
+			if err == nil {
+				resp.Accepted++
+				continue
+			}
+
+			if ingestErrorCode(err) == codes.Internal {
+				return status.Error(codes.Internal, err.Error())
+			}
+			reject(indexes[k], err)
+		}
+
+		items = items[:0]
+		indexes = indexes[:0]
+		return nil
+	}
+
+	for i := 0; ; i++ {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		e, metrics, err := s.event(req, time.Now())
+		if err == nil {
+			err = authorizeEvent(e)
+		}
+
+		if err != nil {
+			reject(i, err)
+			continue
+		}
+
+		items = append(items, &entity.BatchItem{Event: e, Metrics: metrics})
+		indexes = append(indexes, i)
+
+		if len(items) >= s.config.MaxBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	sort.Slice(resp.Errors, func(i, j int) bool { return resp.Errors[i].Index < resp.Errors[j].Index })
+
+	return stream.SendAndClose(resp)
+}
+
+// GetMetricValues streams the values of a metric of a service over a period in time order,
+// values grouped by labels are streamed group by group.
+func (s *grpcServer) GetMetricValues(req *dwhv1.GetMetricValuesRequest, stream dwhv1.DataWarehouse_GetMetricValuesServer) error {
+	service, metric, p, err := s.valuesQuery(stream.Context(), req.GetService(), req.GetMetric(), req.GetFrom(), req.GetTo())
+	if err != nil {
+		return err
+	}
+
+	sel, err := toLabelSelector(req.GetMatchers(), req.GetGroupBy())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	report, err := s.useCase(stream.Context()).GetMetricValuesForTimePeriod(service.ServiceID, p, metric, sel)
+	if errors.Is(err, repository.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	for _, v := range report.([]*entity.GetMetric) {
+		value, err := toValue(metric.MetricType, v.Value)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		if err := stream.Send(&dwhv1.MetricValue{TimeStamp: toTimestamp(v.TimeStamp.Time), Value: value, Labels: v.Labels}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AggregateMetricValues streams the aggregates of a metric of a service by buckets over a period.
+func (s *grpcServer) AggregateMetricValues(req *dwhv1.AggregateMetricValuesRequest, stream dwhv1.DataWarehouse_AggregateMetricValuesServer) error {
+	service, metric, p, err := s.valuesQuery(stream.Context(), req.GetService(), req.GetMetric(), req.GetFrom(), req.GetTo())
+	if err != nil {
+		return err
+	}
+
+	a := &entity.Aggregation{
+		Bucket:    req.GetBucket().AsDuration(),
+		Functions: req.GetFunctions(),
+	}
+
+	if err := a.Validate(metric.MetricType); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	sel, err := toLabelSelector(req.GetMatchers(), req.GetGroupBy())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	report, err := s.useCase(stream.Context()).AggregateMetricValuesForTimePeriod(service.ServiceID, p, metric, a, sel)
+	if errors.Is(err, repository.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	for _, b := range report {
+		m := &dwhv1.AggregatedMetric{
+			TimeStamp: toTimestamp(b.TimeStamp.Time),
+			Values:    make(map[string]*dwhv1.Value, len(b.Values)),
+			Labels:    b.Labels,
+		}
+
+		for f, v := range b.Values {
+			if v == nil {
+				continue
+			}
+
+			value, err := toValue(metric.MetricType, v)
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			m.Values[f] = value
+		}
+
+		if err := stream.Send(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// event converts an event request, the event is taken at now unless it has a time stamp.
+func (s *grpcServer) event(req *dwhv1.CreateEventRequest, now time.Time) (*entity.Event, []*entity.AddMetric, error) {
+	e := &entity.Event{
+		TimeStamp: entity.CustomTime{Time: now},
+		Labels:    req.GetLabels(),
+	}
+
+	switch ref := req.GetService().GetRef().(type) {
+	case *dwhv1.Ref_Id:
+		e.ServiceID = int(ref.Id)
+	case *dwhv1.Ref_Slug:
+		e.ServiceSlug = ref.Slug
+	default:
+		return nil, nil, errBlankService
+	}
+
+	if req.GetTimeStamp() != nil {
+		e.TimeStamp = entity.CustomTime{Time: req.GetTimeStamp().AsTime()}
+	}
+
+	if err := e.ValidateTimeStamp(now, s.config.MaxEventAge, s.config.MaxEventFutureSkew); err != nil {
+		return nil, nil, err
+	}
+
+	metrics := make([]*entity.AddMetric, len(req.GetMetrics()))
+	for i, m := range req.GetMetrics() {
+		metrics[i] = &entity.AddMetric{MetricValue: fromValue(m.GetValue())}
+
+		switch ref := m.GetMetric().GetRef().(type) {
+		case *dwhv1.Ref_Id:
+			metrics[i].MetricID = int(ref.Id)
+		case *dwhv1.Ref_Slug:
+			metrics[i].MetricSlug = ref.Slug
+		default:
+			return nil, nil, &entity.MetricError{Index: i, Err: errBlankMetric}
+		}
+	}
+
+	return e, metrics, nil
+}
+
+// valuesQuery looks up the service and the metric of a range query and checks the period.
+func (s *grpcServer) valuesQuery(ctx context.Context, serviceRef, metricRef *dwhv1.Ref, from, to *timestamppb.Timestamp) (*entity.Service, *entity.Metric, [2]*entity.CustomTime, error) {
+	var p [2]*entity.CustomTime
+
+	if from == nil || to == nil {
+		return nil, nil, p, status.Error(codes.InvalidArgument, errBlankPeriod.Error())
+	}
+
+	p[0] = &entity.CustomTime{Time: from.AsTime()}
+	p[1] = &entity.CustomTime{Time: to.AsTime()}
+	if !p[0].Before(p[1].Time) {
+		return nil, nil, p, status.Error(codes.InvalidArgument, errInvalidPeriod.Error())
+	}
+
+	service, err := s.findService(ctx, serviceRef)
+	if err != nil {
+		return nil, nil, p, findError(err)
+	}
+
+	metric, err := s.findMetric(ctx, metricRef)
+	if err != nil {
+		return nil, nil, p, findError(err)
+	}
+
+	return service, metric, p, nil
+}
+
+func (s *grpcServer) findService(ctx context.Context, ref *dwhv1.Ref) (*entity.Service, error) {
+	switch ref := ref.GetRef().(type) {
+	case *dwhv1.Ref_Id:
+		return s.useCase(ctx).ServiceFindByID(int(ref.Id))
+	case *dwhv1.Ref_Slug:
+		return s.useCase(ctx).ServiceFindBySlug(ref.Slug)
+	default:
+		return nil, errBlankService
+	}
+}
+
+func (s *grpcServer) findMetric(ctx context.Context, ref *dwhv1.Ref) (*entity.Metric, error) {
+	switch ref := ref.GetRef().(type) {
+	case *dwhv1.Ref_Id:
+		return s.useCase(ctx).MetricFindByID(int(ref.Id))
+	case *dwhv1.Ref_Slug:
+		return s.useCase(ctx).MetricFindBySlug(ref.Slug)
+	default:
+		return nil, errBlankMetric
+	}
+}
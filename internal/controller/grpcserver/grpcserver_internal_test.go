@@ -0,0 +1,464 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	dwhv1 "github.com/AnatoliyBr/dwh-service/api/dwh/v1"
+	"github.com/AnatoliyBr/dwh-service/internal/controller/ratelimit"
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/testrepository"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// newTestClient calls the methods without authentication.
+func newTestClient(t *testing.T) (dwhv1.DataWarehouseClient, usecase.UseCase) {
+	t.Helper()
+
+	config := NewConfig()
+	config.Auth = false
+	return newTestClientWithConfig(t, config)
+}
+
+func newTestClientWithConfig(t *testing.T, config *Config) (dwhv1.DataWarehouseClient, usecase.UseCase) {
+	t.Helper()
+
+	rl, err := ratelimit.NewLimiter(nil)
+	assert.NoError(t, err)
+	return newTestClientWithLimiter(t, config, rl, nil)
+}
+
+// newTestClientWithLimiter authenticates the calls with the stored API keys unless authenticate is set.
+func newTestClientWithLimiter(t *testing.T, config *Config, rl *ratelimit.Limiter, authenticate Authenticator) (dwhv1.DataWarehouseClient, usecase.UseCase) {
+	t.Helper()
+
+	sr := testrepository.NewServiceRepository()
+	mr := testrepository.NewMetricRepository()
+	er := testrepository.NewEventRepository()
+	kr := testrepository.NewAPIKeyRepository()
+	tr := testrepository.NewTenantRepository()
+	rr := testrepository.NewRetentionRepository()
+	ur := testrepository.NewRollupRepository(er)
+	pr := testrepository.NewPartitionRepository(er)
+	ar := testrepository.NewAlertRepository()
+	uc := usecase.NewAppUseCase(sr, mr, er, kr, tr, rr, ur, pr, ar)
+
+	if authenticate == nil {
+		authenticate = uc.APIKeyAuthenticate
+	}
+
+	s, err := NewGRPCServer(config, uc, rl, authenticate)
+	assert.NoError(t, err)
+
+	lis := bufconn.Listen(1 << 20)
+	go s.server.Serve(lis)
+	t.Cleanup(func() { s.Shutdown() })
+
+	conn, err := grpc.Dial(
+		"bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return dwhv1.NewDataWarehouseClient(conn), uc
+}
+
+func TestGRPCServer_Services(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+	ts := entity.TestService(t)
+
+	_, err := c.CreateService(ctx, &dwhv1.CreateServiceRequest{Slug: "note book"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	service, err := c.CreateService(ctx, &dwhv1.CreateServiceRequest{Slug: ts.Slug, Details: ts.Details})
+	assert.NoError(t, err)
+	assert.NotZero(t, service.GetServiceId())
+
+	got, err := c.GetService(ctx, &dwhv1.Ref{Ref: &dwhv1.Ref_Slug{Slug: "note_book"}})
+	assert.NoError(t, err)
+	assert.Equal(t, service.GetServiceId(), got.GetServiceId())
+
+	_, err = c.GetService(ctx, &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: 100}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	updated, err := c.UpdateService(ctx, &dwhv1.UpdateServiceRequest{
+		Service:    &dwhv1.Service{ServiceId: service.GetServiceId(), Details: "Notes"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"details"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, ts.Slug, updated.GetSlug())
+	assert.Equal(t, "Notes", updated.GetDetails())
+
+	_, err = c.UpdateService(ctx, &dwhv1.UpdateServiceRequest{
+		Service:    &dwhv1.Service{ServiceId: service.GetServiceId()},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"archived"}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	list, err := c.ListServices(ctx, &dwhv1.ListRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, list.GetServices(), 1)
+
+	_, err = c.DeleteService(ctx, &dwhv1.DeleteRequest{Id: service.GetServiceId(), DryRun: true})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	deleted, err := c.DeleteService(ctx, &dwhv1.DeleteRequest{Id: service.GetServiceId()})
+	assert.NoError(t, err)
+	assert.True(t, deleted.GetService().GetArchived())
+}
+
+func TestGRPCServer_Events(t *testing.T) {
+	c, uc := newTestClient(t)
+	ctx := context.Background()
+
+	service := entity.TestService(t)
+	metric := entity.TestMetric(t)
+	assert.NoError(t, uc.ServiceCreate(service))
+	assert.NoError(t, uc.MetricCreate(metric))
+
+	now := time.Now().Truncate(time.Second)
+	request := func(t time.Time, v time.Duration) *dwhv1.CreateEventRequest {
+		return &dwhv1.CreateEventRequest{
+			Service:   &dwhv1.Ref{Ref: &dwhv1.Ref_Slug{Slug: service.Slug}},
+			TimeStamp: timestamppb.New(t),
+			Metrics: []*dwhv1.AddMetric{{
+				Metric: &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(metric.MetricID)}},
+				Value:  &dwhv1.Value{Value: &dwhv1.Value_DurationValue{DurationValue: durationpb.New(v)}},
+			}},
+		}
+	}
+
+	e, err := c.CreateEvent(ctx, request(now.Add(-3*time.Minute), time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(service.ServiceID), e.GetServiceId())
+
+	invalid := request(now, time.Minute)
+	invalid.Metrics[0].Value = &dwhv1.Value{Value: &dwhv1.Value_BoolValue{BoolValue: true}}
+	_, err = c.CreateEvent(ctx, invalid)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err := c.StreamEvents(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(request(now.Add(-2*time.Minute), 2*time.Minute)))
+	assert.NoError(t, stream.Send(invalid))
+	assert.NoError(t, stream.Send(request(now.Add(-48*time.Hour), time.Minute)))
+	assert.NoError(t, stream.Send(request(now.Add(-time.Minute), 3*time.Minute)))
+
+	resp, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), resp.GetAccepted())
+	assert.Equal(t, int32(2), resp.GetRejected())
+	assert.Len(t, resp.GetErrors(), 2)
+	assert.Equal(t, int32(1), resp.GetErrors()[0].GetIndex())
+	assert.Equal(t, int32(2), resp.GetErrors()[1].GetIndex())
+
+	values, err := c.GetMetricValues(ctx, &dwhv1.GetMetricValuesRequest{
+		Service: &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(service.ServiceID)}},
+		Metric:  &dwhv1.Ref{Ref: &dwhv1.Ref_Slug{Slug: metric.Slug}},
+		From:    timestamppb.New(now.Add(-time.Hour)),
+		To:      timestamppb.New(now.Add(time.Hour)),
+	})
+	assert.NoError(t, err)
+
+	var got []time.Duration
+	for {
+		v, err := values.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		got = append(got, v.GetValue().GetDurationValue().AsDuration())
+	}
+	assert.ElementsMatch(t, []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute}, got)
+
+	values, err = c.GetMetricValues(ctx, &dwhv1.GetMetricValuesRequest{
+		Service: &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(service.ServiceID)}},
+		Metric:  &dwhv1.Ref{Ref: &dwhv1.Ref_Slug{Slug: metric.Slug}},
+		From:    timestamppb.New(now),
+		To:      timestamppb.New(now.Add(-time.Hour)),
+	})
+	assert.NoError(t, err)
+	_, err = values.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCServer_Auth(t *testing.T) {
+	config := NewConfig()
+	config.Auth = true
+	config.AdminKey = "secret"
+	c, uc := newTestClientWithConfig(t, config)
+
+	allowed := entity.TestService(t)
+	other := entity.TestService(t)
+	other.Slug = "other"
+	metric := entity.TestMetric(t)
+	assert.NoError(t, uc.ServiceCreate(allowed))
+	assert.NoError(t, uc.ServiceCreate(other))
+	assert.NoError(t, uc.MetricCreate(metric))
+
+	k := entity.TestAPIKey(t)
+	k.Scopes = []string{entity.ScopeWrite}
+	k.ServiceIDs = []int{allowed.ServiceID}
+	key, err := uc.APIKeyCreate(k)
+	assert.NoError(t, err)
+
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+key)
+	}
+	request := func(serviceID int) *dwhv1.CreateEventRequest {
+		return &dwhv1.CreateEventRequest{
+			Service: &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(serviceID)}},
+			Metrics: []*dwhv1.AddMetric{{
+				Metric: &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(metric.MetricID)}},
+				Value:  &dwhv1.Value{Value: &dwhv1.Value_DurationValue{DurationValue: durationpb.New(time.Minute)}},
+			}},
+		}
+	}
+
+	_, err = c.ListServices(context.Background(), &dwhv1.ListRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = c.ListServices(withKey("dwh_unknown"), &dwhv1.ListRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = c.ListServices(withKey("secret"), &dwhv1.ListRequest{})
+	assert.NoError(t, err)
+
+	_, err = c.ListServices(withKey(key), &dwhv1.ListRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = c.CreateEvent(withKey(key), request(allowed.ServiceID))
+	assert.NoError(t, err)
+
+	_, err = c.CreateEvent(withKey(key), request(other.ServiceID))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err := c.StreamEvents(withKey(key))
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(request(other.ServiceID)))
+	assert.NoError(t, stream.Send(request(allowed.ServiceID)))
+
+	resp, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), resp.GetAccepted())
+	assert.Equal(t, int32(1), resp.GetRejected())
+	assert.Equal(t, int32(0), resp.GetErrors()[0].GetIndex())
+}
+
+func TestGRPCServer_TokenAuth(t *testing.T) {
+	rl, err := ratelimit.NewLimiter(nil)
+	assert.NoError(t, err)
+
+	// the REST API verifies the tokens of auth_mode jwt
+	authenticate := func(token string) (*entity.APIKey, error) {
+		if token != "token" {
+			return nil, errors.New("invalid token")
+		}
+		return &entity.APIKey{Name: "collector", TenantID: entity.DefaultTenantID, Scopes: []string{entity.ScopeRead}}, nil
+	}
+
+	c, _ := newTestClientWithLimiter(t, NewConfig(), rl, authenticate)
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	_, err = c.ListServices(withToken("token"), &dwhv1.ListRequest{})
+	assert.NoError(t, err)
+
+	_, err = c.ListServices(withToken("forged"), &dwhv1.ListRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = c.CreateService(withToken("token"), &dwhv1.CreateServiceRequest{Slug: "note_book", Details: "notes"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestGRPCServer_Tenants(t *testing.T) {
+	config := NewConfig()
+	config.Auth = true
+	config.AdminKey = "secret"
+	c, uc := newTestClientWithConfig(t, config)
+
+	tenant := entity.TestTenant(t)
+	assert.NoError(t, uc.TenantCreate(tenant))
+
+	s1 := entity.TestService(t)
+	assert.NoError(t, uc.ServiceCreate(s1))
+	s2 := entity.TestService(t)
+	assert.NoError(t, uc.ForTenant(tenant.TenantID).ServiceCreate(s2))
+
+	k := entity.TestAPIKey(t)
+	key, err := uc.ForTenant(tenant.TenantID).APIKeyCreate(k)
+	assert.NoError(t, err)
+
+	withTenant := func(key, tenant string) context.Context {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+key)
+		if tenant != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "x-tenant", tenant)
+		}
+		return ctx
+	}
+	ref := &dwhv1.Ref{Ref: &dwhv1.Ref_Slug{Slug: "note_book"}}
+
+	got, err := c.GetService(withTenant("secret", ""), ref)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(s1.ServiceID), got.GetServiceId())
+
+	got, err = c.GetService(withTenant("secret", "team_a"), ref)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(s2.ServiceID), got.GetServiceId())
+
+	_, err = c.GetService(withTenant("secret", "unknown"), ref)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	got, err = c.GetService(withTenant(key, ""), ref)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(s2.ServiceID), got.GetServiceId())
+
+	_, err = c.GetService(withTenant(key, ""), &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(s1.ServiceID)}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = c.GetService(withTenant(key, "default"), ref)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestGRPCServer_Labels(t *testing.T) {
+	c, uc := newTestClient(t)
+	ctx := context.Background()
+
+	service := entity.TestService(t)
+	metric := entity.TestMetric(t)
+	assert.NoError(t, uc.ServiceCreate(service))
+	assert.NoError(t, uc.MetricCreate(metric))
+
+	now := time.Now().Truncate(time.Second)
+	for i, host := range []string{"a", "b", "a"} {
+		_, err := c.CreateEvent(ctx, &dwhv1.CreateEventRequest{
+			Service:   &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(service.ServiceID)}},
+			TimeStamp: timestamppb.New(now.Add(time.Duration(i-3) * time.Minute)),
+			Labels:    map[string]string{"host": host},
+			Metrics: []*dwhv1.AddMetric{{
+				Metric: &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(metric.MetricID)}},
+				Value:  &dwhv1.Value{Value: &dwhv1.Value_DurationValue{DurationValue: durationpb.New(time.Duration(i+1) * time.Minute)}},
+			}},
+		})
+		assert.NoError(t, err)
+	}
+
+	values, err := c.GetMetricValues(ctx, &dwhv1.GetMetricValuesRequest{
+		Service:  &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(service.ServiceID)}},
+		Metric:   &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(metric.MetricID)}},
+		From:     timestamppb.New(now.Add(-time.Hour)),
+		To:       timestamppb.New(now.Add(time.Hour)),
+		Matchers: []*dwhv1.LabelMatcher{{Name: "host", Type: entity.MatchEqual, Value: "a"}},
+		GroupBy:  []string{"host"},
+	})
+	assert.NoError(t, err)
+
+	var got []time.Duration
+	for {
+		v, err := values.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"host": "a"}, v.GetLabels())
+		got = append(got, v.GetValue().GetDurationValue().AsDuration())
+	}
+	assert.Equal(t, []time.Duration{time.Minute, 3 * time.Minute}, got)
+
+	buckets, err := c.AggregateMetricValues(ctx, &dwhv1.AggregateMetricValuesRequest{
+		Service:   &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(service.ServiceID)}},
+		Metric:    &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(metric.MetricID)}},
+		From:      timestamppb.New(now.Add(-time.Hour)),
+		To:        timestamppb.New(now.Add(time.Hour)),
+		Bucket:    durationpb.New(24 * time.Hour),
+		Functions: []string{"count"},
+		GroupBy:   []string{"host"},
+	})
+	assert.NoError(t, err)
+
+	counts := make(map[string]int64)
+	for {
+		b, err := buckets.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		counts[b.GetLabels()["host"]] += b.GetValues()["count"].GetIntValue()
+	}
+	assert.Equal(t, map[string]int64{"a": 2, "b": 1}, counts)
+
+	values, err = c.GetMetricValues(ctx, &dwhv1.GetMetricValuesRequest{
+		Service:  &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(service.ServiceID)}},
+		Metric:   &dwhv1.Ref{Ref: &dwhv1.Ref_Id{Id: int64(metric.MetricID)}},
+		From:     timestamppb.New(now.Add(-time.Hour)),
+		To:       timestamppb.New(now.Add(time.Hour)),
+		Matchers: []*dwhv1.LabelMatcher{{Name: "host", Type: "~", Value: "a"}},
+	})
+	assert.NoError(t, err)
+	_, err = values.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCServer_RateLimit(t *testing.T) {
+	rl, err := ratelimit.NewLimiter(map[string]*ratelimit.Limit{
+		ratelimit.GroupQuery: {Rate: 1, Burst: 2},
+	})
+	assert.NoError(t, err)
+	now := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	rl.Now = func() time.Time { return now }
+
+	config := NewConfig()
+	config.AdminKey = "secret"
+	c, _ := newTestClientWithLimiter(t, config, rl, nil)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+
+	var header metadata.MD
+	_, err = c.ListServices(ctx, &dwhv1.ListRequest{}, grpc.Header(&header))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, header.Get("x-ratelimit-limit"))
+	assert.Equal(t, []string{"1"}, header.Get("x-ratelimit-remaining"))
+
+	// the REST API takes from the same bucket of the admin key
+	_, ok := rl.Take("admin_key", ratelimit.GroupQuery)
+	assert.True(t, ok)
+
+	_, err = c.ListServices(ctx, &dwhv1.ListRequest{}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"1"}, header.Get("retry-after"))
+
+	// the admin methods are not limited
+	_, err = c.CreateService(ctx, &dwhv1.CreateServiceRequest{Slug: "note_book", Details: "notes"})
+	assert.NoError(t, err)
+
+	now = now.Add(time.Second)
+	_, err = c.ListServices(ctx, &dwhv1.ListRequest{})
+	assert.NoError(t, err)
+}
+
+func TestRateLimitClient(t *testing.T) {
+	client := func(k *entity.APIKey) string {
+		return rateLimitClient(context.WithValue(context.Background(), ctxKeyAPIKey, k))
+	}
+
+	// the same subject in two tenants is two clients, as in the REST API
+	assert.Equal(t, "subject:1:ci", client(&entity.APIKey{TenantID: 1, Name: "ci"}))
+	assert.Equal(t, "subject:2:ci", client(&entity.APIKey{TenantID: 2, Name: "ci"}))
+}
@@ -0,0 +1,91 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/AnatoliyBr/dwh-service/internal/controller/ratelimit"
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func (s *grpcServer) rateLimitUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.rateLimit(ctx, info.FullMethod, func(md metadata.MD) error { return grpc.SetHeader(ctx, md) }); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *grpcServer) rateLimitStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.rateLimit(ss.Context(), info.FullMethod, ss.SetHeader); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// rateLimit limits the calls of every client by the bucket of the group of the method, the buckets are shared
+// with the REST API and a client is identified the same way: by its API key, by the subject and the tenant
+// of its token or, if the call has neither, by its address.
+// The state of the bucket is sent in the x-ratelimit-* headers.
+func (s *grpcServer) rateLimit(ctx context.Context, fullMethod string, setHeader func(metadata.MD) error) error {
+	st, ok := s.rateLimiter.Take(rateLimitClient(ctx), methodGroup(fullMethod))
+	if st == nil {
+		return nil
+	}
+
+	md := metadata.Pairs(
+		"x-ratelimit-limit", strconv.Itoa(st.Limit),
+		"x-ratelimit-remaining", strconv.Itoa(st.Remaining),
+		"x-ratelimit-reset", strconv.Itoa(ratelimit.CeilSeconds(st.Reset)),
+	)
+	if !ok {
+		md.Set("retry-after", strconv.Itoa(ratelimit.CeilSeconds(st.RetryAfter)))
+	}
+	setHeader(md)
+
+	if !ok {
+		return status.Error(codes.ResourceExhausted, ratelimit.ErrRateLimited.Error())
+	}
+	return nil
+}
+
+func rateLimitClient(ctx context.Context) string {
+	switch k := apiKey(ctx); {
+	case k == adminKey:
+		return "admin_key"
+	case k != nil && k.KeyID != 0:
+		return fmt.Sprintf("key:%d", k.KeyID)
+	case k != nil:
+		// subjects are unique only within the tenant of the token
+		return fmt.Sprintf("subject:%d:%s", k.TenantID, k.Name)
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "addr:"
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "addr:" + host
+}
+
+// methodGroup returns the group of the method by the scope granting it.
+func methodGroup(fullMethod string) string {
+	switch methodScope(fullMethod) {
+	case entity.ScopeWrite:
+		return ratelimit.GroupIngest
+	case entity.ScopeRead:
+		return ratelimit.GroupQuery
+	default:
+		return ratelimit.GroupAdmin
+	}
+}
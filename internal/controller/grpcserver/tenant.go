@@ -0,0 +1,56 @@
+package grpcserver
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// useCase returns the use cases of the tenant of the call.
+func (s *grpcServer) useCase(ctx context.Context) usecase.UseCase {
+	if uc, ok := ctx.Value(ctxKeyUseCase).(usecase.UseCase); ok {
+		return uc
+	}
+	return s.uc
+}
+
+// resolveTenant scopes the call to the tenant its key is bound to. Calls without a bound key
+// name the tenant by id or by slug in the x-tenant metadata and are scoped to the default tenant if they do not.
+func (s *grpcServer) resolveTenant(ctx context.Context) (context.Context, error) {
+	tenantID := entity.DefaultTenantID
+	k := apiKey(ctx)
+	if k != nil && k.TenantID != 0 {
+		tenantID = k.TenantID
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-tenant"); len(values) > 0 {
+		t, err := s.findTenant(values[0])
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "x-tenant: unknown tenant")
+		}
+
+		if k != nil && k.TenantID != 0 && k.TenantID != t.TenantID {
+			return nil, status.Error(codes.PermissionDenied, entity.ErrForbidden.Error())
+		}
+		tenantID = t.TenantID
+	}
+
+	uc := s.uc
+	if tenantID != s.uc.TenantID() {
+		uc = s.uc.ForTenant(tenantID)
+	}
+	return context.WithValue(ctx, ctxKeyUseCase, uc), nil
+}
+
+func (s *grpcServer) findTenant(ref string) (*entity.Tenant, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		return s.uc.TenantFindByID(id)
+	}
+	return s.uc.TenantFindBySlug(entity.NormalizeSlug(ref))
+}
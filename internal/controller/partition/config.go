@@ -0,0 +1,44 @@
+package partition
+
+import (
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+type Config struct {
+	// the worker is started only if enabled
+	Enabled  bool   `toml:"enabled"`
+	LogLevel string `toml:"log_level"`
+
+	// period between checks of the partitions
+	Interval time.Duration `toml:"interval"`
+
+	// length of new partitions, day or month; existing partitions are kept as they are
+	Period string `toml:"period"`
+
+	// number of partitions created ahead of the current one
+	Ahead int `toml:"ahead"`
+
+	// partitions older than keep, a duration such as 90d, are dropped with their events,
+	// empty keeps them forever; it has to be longer than the delay of rollups
+	Keep string `toml:"keep"`
+
+	// events of the default partition deleted by one statement before a partition is dropped,
+	// small batches keep locks short
+	BatchSize int `toml:"batch_size"`
+
+	// pause between batches to give way to ingestion
+	BatchPause time.Duration `toml:"batch_pause"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		LogLevel:   "debug",
+		Interval:   time.Hour,
+		Period:     entity.PartitionMonth,
+		Ahead:      2,
+		BatchSize:  1000,
+		BatchPause: 100 * time.Millisecond,
+	}
+}
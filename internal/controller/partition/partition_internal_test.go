@@ -0,0 +1,130 @@
+package partition
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/testrepository"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPartitionWorker(t *testing.T) {
+	er := testrepository.NewEventRepository()
+	uc := usecase.NewAppUseCase(
+		testrepository.NewServiceRepository(),
+		testrepository.NewMetricRepository(),
+		er,
+		testrepository.NewAPIKeyRepository(),
+		testrepository.NewTenantRepository(),
+		testrepository.NewRetentionRepository(),
+		testrepository.NewRollupRepository(er),
+		testrepository.NewPartitionRepository(er),
+		testrepository.NewAlertRepository(),
+	)
+
+	testCases := []struct {
+		name   string
+		config func(*Config)
+		err    error
+	}{
+		{
+			name:   "interval",
+			config: func(c *Config) { c.Interval = 0 },
+			err:    errInvalidInterval,
+		},
+		{
+			name:   "period",
+			config: func(c *Config) { c.Period = "week" },
+			err:    errInvalidPeriod,
+		},
+		{
+			name:   "ahead",
+			config: func(c *Config) { c.Ahead = -1 },
+			err:    errInvalidAhead,
+		},
+		{
+			name:   "keep",
+			config: func(c *Config) { c.Keep = "10m" },
+			err:    errInvalidKeep,
+		},
+		{
+			name:   "batch size",
+			config: func(c *Config) { c.BatchSize = 0 },
+			err:    errInvalidBatchSize,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := NewConfig()
+			tc.config(config)
+			_, err := NewPartitionWorker(config, uc)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	w, err := NewPartitionWorker(NewConfig(), uc)
+	assert.NoError(t, err)
+	w.Shutdown()
+
+	w.StartPartitionWorker()
+	w.Shutdown()
+}
+
+func TestPartitionWorker_Manage(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+	mr := testrepository.NewMetricRepository()
+	er := testrepository.NewEventRepository()
+	kr := testrepository.NewAPIKeyRepository()
+	tr := testrepository.NewTenantRepository()
+	rr := testrepository.NewRetentionRepository()
+	ur := testrepository.NewRollupRepository(er)
+	pr := testrepository.NewPartitionRepository(er)
+	ar := testrepository.NewAlertRepository()
+	uc := usecase.NewAppUseCase(sr, mr, er, kr, tr, rr, ur, pr, ar)
+
+	month := func(m time.Month) time.Time { return time.Date(2023, m, 1, 0, 0, 0, 0, time.UTC) }
+	day := func(m time.Month, d int) time.Time { return time.Date(2023, m, d, 0, 0, 0, 0, time.UTC) }
+
+	config := NewConfig()
+	config.Keep = "45d"
+	config.BatchSize = 1
+	config.BatchPause = 0
+	w, err := NewPartitionWorker(config, uc)
+	assert.NoError(t, err)
+
+	// the current month and the two next ones
+	w.manage(day(time.October, 15))
+
+	partitions, err := uc.PartitionList()
+	assert.NoError(t, err)
+	assert.Equal(t, []*entity.Partition{
+		{From: month(time.October), To: month(time.November)},
+		{From: month(time.November), To: month(time.December)},
+		{From: month(time.December), To: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}, partitions)
+
+	// the events of September are in the default partition and are deleted in batches of 1 before October is dropped
+	for _, ts := range []time.Time{day(time.September, 10), day(time.September, 20), day(time.October, 20), day(time.November, 20)} {
+		assert.NoError(t, er.Create(&entity.Event{ServiceID: 1, TimeStamp: entity.CustomTime{Time: ts}}))
+	}
+
+	// daily partitions follow the monthly ones, October expired on the 15th of December
+	config.Period = entity.PartitionDay
+	config.Ahead = 1
+	w.manage(day(time.December, 31))
+
+	partitions, err = uc.PartitionList()
+	assert.NoError(t, err)
+	assert.Equal(t, []*entity.Partition{
+		{From: month(time.November), To: month(time.December)},
+		{From: month(time.December), To: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}, partitions)
+
+	c, err := er.ServiceCascade(1)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 1}, c)
+}
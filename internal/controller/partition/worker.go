@@ -0,0 +1,229 @@
+package partition
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	errInvalidInterval  = errors.New("interval: must be positive")
+	errInvalidPeriod    = errors.New("period: must be day or month")
+	errInvalidAhead     = errors.New("ahead: must not be negative")
+	errInvalidKeep      = errors.New("keep: must be a duration such as 90d and no less than 1h")
+	errInvalidBatchSize = errors.New("batch_size: must be positive")
+)
+
+// partitionWorker creates the partitions of events ahead of time and drops the expired ones,
+// partitions follow each other from the end of the last one, gaps are left to the default partition.
+type partitionWorker struct {
+	done    chan struct{}
+	wg      sync.WaitGroup
+	started bool
+	config  *Config
+	keep    time.Duration
+	logger  *logrus.Logger
+	uc      usecase.UseCase
+}
+
+func NewPartitionWorker(config *Config, uc usecase.UseCase) (*partitionWorker, error) {
+	if config.Interval <= 0 {
+		return nil, errInvalidInterval
+	}
+
+	if !entity.IsPartitionPeriod(config.Period) {
+		return nil, errInvalidPeriod
+	}
+
+	if config.Ahead < 0 {
+		return nil, errInvalidAhead
+	}
+
+	var keep time.Duration
+	if config.Keep != "" {
+		d, err := entity.ParseBucket(config.Keep)
+		if err != nil || d < entity.MinRetention {
+			return nil, errInvalidKeep
+		}
+		keep = d
+	}
+
+	if config.BatchSize <= 0 {
+		return nil, errInvalidBatchSize
+	}
+
+	w := &partitionWorker{
+		done:   make(chan struct{}),
+		config: config,
+		keep:   keep,
+		logger: logrus.New(),
+		uc:     uc,
+	}
+
+	if err := w.configureLogger(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *partitionWorker) configureLogger() error {
+	level, err := logrus.ParseLevel(w.config.LogLevel)
+	if err != nil {
+		return err
+	}
+	w.logger.SetLevel(level)
+	return nil
+}
+
+// StartPartitionWorker manages the partitions right away and then every interval.
+func (w *partitionWorker) StartPartitionWorker() {
+	w.logger.Info("starting partition worker")
+	w.started = true
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.manageEvery(w.config.Interval)
+	}()
+}
+
+// Shutdown stops the worker after the partition or the batch being dropped, it does nothing if the worker is not started.
+func (w *partitionWorker) Shutdown() {
+	if !w.started {
+		return
+	}
+
+	close(w.done)
+	w.wg.Wait()
+}
+
+func (w *partitionWorker) manageEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	w.manage(time.Now())
+	for {
+		select {
+		case now := <-ticker.C:
+			w.manage(now)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// manage creates the partitions up to the end of the ahead partitions after the one of now
+// and then drops the partitions expired at now.
+func (w *partitionWorker) manage(now time.Time) {
+	partitions, err := w.uc.PartitionList()
+	if err != nil {
+		w.logger.Errorf("partition: cannot list partitions: %s", err)
+		return
+	}
+
+	w.create(partitions, now)
+	w.drop(partitions, now)
+}
+
+// create adds the partitions of the period after the last existing one, the first of them is cut short
+// if the last one ends within it, e.g. after the period is changed from month to day.
+func (w *partitionWorker) create(partitions []*entity.Partition, now time.Time) {
+	var covered time.Time
+	if len(partitions) > 0 {
+		covered = partitions[len(partitions)-1].To
+	}
+
+	until := entity.PartitionAt(now, w.config.Period)
+	for i := 0; i < w.config.Ahead; i++ {
+		until = entity.PartitionAt(until.To, w.config.Period)
+	}
+
+	next := entity.PartitionAt(now, w.config.Period)
+	if !covered.IsZero() && covered.Before(next.From) {
+		next = entity.PartitionAt(covered, w.config.Period)
+	}
+
+	for ; next.From.Before(until.To); next = entity.PartitionAt(next.To, w.config.Period) {
+		if !next.To.After(covered) {
+			continue
+		}
+
+		p := &entity.Partition{From: next.From, To: next.To}
+		if p.From.Before(covered) {
+			p.From = covered
+		}
+
+		if err := w.uc.PartitionCreate(p); err != nil {
+			w.logger.Errorf("partition: cannot create partition of %s: %s", formatPartition(p), err)
+			return
+		}
+		w.logger.Infof("partition: created partition of %s", formatPartition(p))
+	}
+}
+
+// drop removes the expired partitions oldest first along with the earlier events of the default partition,
+// it gives up the rest once the worker is stopped.
+func (w *partitionWorker) drop(partitions []*entity.Partition, now time.Time) {
+	if w.keep == 0 {
+		return
+	}
+
+	for _, p := range partitions {
+		if !p.Expired(now, w.keep) {
+			return
+		}
+
+		if !w.purgeDefault(p) {
+			return
+		}
+
+		if err := w.uc.PartitionDrop(p); err != nil {
+			w.logger.Errorf("partition: cannot drop partition of %s: %s", formatPartition(p), err)
+			return
+		}
+		w.logger.Infof("partition: dropped partition of %s older than %s", formatPartition(p), w.config.Keep)
+
+		select {
+		case <-w.done:
+			w.logger.Info("partition: stopped dropping partitions")
+			return
+		default:
+		}
+	}
+}
+
+// purgeDefault deletes the events of the default partition before the end of the partition in batches
+// until one is not full, it returns false if they cannot be deleted or once the worker is stopped.
+func (w *partitionWorker) purgeDefault(p *entity.Partition) bool {
+	for {
+		deleted, err := w.uc.PartitionPurgeDefault(p, w.config.BatchSize)
+		if err != nil {
+			w.logger.Errorf("partition: cannot delete events of the default partition before %s: %s", p.To.Format(time.RFC3339), err)
+			return false
+		}
+
+		if deleted > 0 {
+			w.logger.Debugf("partition: deleted %d events of the default partition before %s", deleted, p.To.Format(time.RFC3339))
+		}
+
+		if deleted < w.config.BatchSize {
+			return true
+		}
+
+		select {
+		case <-w.done:
+			w.logger.Info("partition: stopped deleting events of the default partition")
+			return false
+		case <-time.After(w.config.BatchPause):
+		}
+	}
+}
+
+func formatPartition(p *entity.Partition) string {
+	return p.From.Format(time.RFC3339) + " to " + p.To.Format(time.RFC3339)
+}
@@ -0,0 +1,185 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Groups the rate limits are configured for.
+const (
+	// GroupIngest is the calls adding events, the ones granted by the write scope.
+	GroupIngest = "ingest"
+
+	// GroupQuery is the calls reading data, the ones granted by the read scope.
+	GroupQuery = "query"
+
+	// GroupAdmin is everything else.
+	GroupAdmin = "admin"
+)
+
+// sweepInterval is how often the buckets of the clients that have been idle long enough to refill are dropped.
+const sweepInterval = time.Minute
+
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// Limit is a token bucket of a client: every call takes a token
+// and the bucket is refilled with Rate tokens a second up to Burst tokens.
+type Limit struct {
+	Rate  float64 `toml:"rate"`
+	Burst int     `toml:"burst"`
+}
+
+// Limiter keeps a token bucket per client and group, the calls of the groups without a limit are not limited.
+// It is shared by the REST and the gRPC API, so a client has the same buckets in both.
+type Limiter struct {
+	limits map[string]*Limit
+
+	// Now returns the current time, it is replaced in tests
+	Now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+	swept   time.Time
+}
+
+type bucketKey struct {
+	client string
+	group  string
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Status is the state of a bucket, Reset is the time until the bucket is full
+// and RetryAfter until a rejected call may be retried.
+type Status struct {
+	Client    string `json:"client"`
+	Group     string `json:"group"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+
+	Reset      time.Duration `json:"-"`
+	RetryAfter time.Duration `json:"-"`
+}
+
+func NewLimiter(limits map[string]*Limit) (*Limiter, error) {
+	for group, l := range limits {
+		switch group {
+		case GroupIngest, GroupQuery, GroupAdmin:
+		default:
+			return nil, fmt.Errorf("rate_limits: unknown route group %q", group)
+		}
+
+		if l.Rate <= 0 || l.Burst < 1 {
+			return nil, fmt.Errorf("rate_limits.%s: rate and burst must be positive", group)
+		}
+	}
+
+	return &Limiter{
+		limits:  limits,
+		Now:     time.Now,
+		buckets: make(map[bucketKey]*bucket),
+	}, nil
+}
+
+// Take takes a token from the bucket of the client in the group and reports whether the call is allowed,
+// the status is nil if the group is not limited.
+func (l *Limiter) Take(client, group string) (*Status, bool) {
+	limit, ok := l.limits[group]
+	if !ok {
+		return nil, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Now()
+	l.sweep(now)
+
+	k := bucketKey{client: client, group: group}
+	b, ok := l.buckets[k]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		l.buckets[k] = b
+	}
+	b.refill(limit, now)
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	st := b.status(limit)
+	st.Client, st.Group = client, group
+	if !allowed {
+		st.RetryAfter = time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	}
+	return st, allowed
+}
+
+// sweep drops the buckets that are full by now, a new bucket starts full anyway.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+
+	for k, b := range l.buckets {
+		limit := l.limits[k.group]
+		if b.tokens+now.Sub(b.updated).Seconds()*limit.Rate >= float64(limit.Burst) {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// Usage returns the state of the buckets of the clients that made calls lately.
+func (l *Limiter) Usage() []*Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Now()
+	usage := make([]*Status, 0, len(l.buckets))
+	for k, b := range l.buckets {
+		limit := l.limits[k.group]
+		c := *b
+		c.refill(limit, now)
+
+		st := c.status(limit)
+		st.Client, st.Group = k.client, k.group
+		usage = append(usage, st)
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Client != usage[j].Client {
+			return usage[i].Client < usage[j].Client
+		}
+		return usage[i].Group < usage[j].Group
+	})
+	return usage
+}
+
+func (b *bucket) refill(limit *Limit, now time.Time) {
+	if now.After(b.updated) {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+		b.updated = now
+	}
+}
+
+func (b *bucket) status(limit *Limit) *Status {
+	return &Status{
+		Limit:     limit.Burst,
+		Remaining: int(b.tokens),
+		Reset:     time.Duration((float64(limit.Burst) - b.tokens) / limit.Rate * float64(time.Second)),
+	}
+}
+
+// CeilSeconds rounds the duration up to whole seconds like the Retry-After header takes it.
+func CeilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,27 @@
+package retention
+
+import "time"
+
+type Config struct {
+	// the worker is started only if enabled
+	Enabled  bool   `toml:"enabled"`
+	LogLevel string `toml:"log_level"`
+
+	// period between purges of the values expired by every policy
+	Interval time.Duration `toml:"interval"`
+
+	// events of a service, values of a metric or rollups deleted by one statement, small batches keep locks short
+	BatchSize int `toml:"batch_size"`
+
+	// pause between batches to give way to ingestion
+	BatchPause time.Duration `toml:"batch_pause"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		LogLevel:   "debug",
+		Interval:   10 * time.Minute,
+		BatchSize:  1000,
+		BatchPause: 100 * time.Millisecond,
+	}
+}
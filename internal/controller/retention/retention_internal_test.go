@@ -0,0 +1,167 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/testrepository"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRetentionWorker(t *testing.T) {
+	er := testrepository.NewEventRepository()
+	uc := usecase.NewAppUseCase(
+		testrepository.NewServiceRepository(),
+		testrepository.NewMetricRepository(),
+		er,
+		testrepository.NewAPIKeyRepository(),
+		testrepository.NewTenantRepository(),
+		testrepository.NewRetentionRepository(),
+		testrepository.NewRollupRepository(er),
+		testrepository.NewPartitionRepository(er),
+		testrepository.NewAlertRepository(),
+	)
+
+	config := NewConfig()
+	config.Interval = 0
+	_, err := NewRetentionWorker(config, uc)
+	assert.ErrorIs(t, err, errInvalidInterval)
+
+	config = NewConfig()
+	config.BatchSize = 0
+	_, err = NewRetentionWorker(config, uc)
+	assert.ErrorIs(t, err, errInvalidBatchSize)
+
+	w, err := NewRetentionWorker(NewConfig(), uc)
+	assert.NoError(t, err)
+	w.Shutdown()
+
+	w.StartRetentionWorker()
+	w.Shutdown()
+}
+
+func TestRetentionWorker_Purge(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+	mr := testrepository.NewMetricRepository()
+	er := testrepository.NewEventRepository()
+	kr := testrepository.NewAPIKeyRepository()
+	tr := testrepository.NewTenantRepository()
+	rr := testrepository.NewRetentionRepository()
+	ur := testrepository.NewRollupRepository(er)
+	pr := testrepository.NewPartitionRepository(er)
+	ar := testrepository.NewAlertRepository()
+	uc := usecase.NewAppUseCase(sr, mr, er, kr, tr, rr, ur, pr, ar)
+
+	tenant := entity.TestTenant(t)
+	tr.Create(tenant)
+	tuc := uc.ForTenant(tenant.TenantID)
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	tuc.ServiceCreate(s)
+	tuc.MetricCreate(m)
+
+	now := time.Now()
+	ter := er.ForTenant(tenant.TenantID)
+	for i := 0; i < 5; i++ {
+		e := &entity.Event{ServiceID: s.ServiceID, TimeStamp: entity.CustomTime{Time: now.Add(-time.Duration(i*24+1) * time.Hour)}}
+		assert.NoError(t, ter.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: time.Second}}))
+	}
+
+	assert.NoError(t, tuc.RetentionPolicySave(&entity.RetentionPolicy{ServiceID: s.ServiceID, KeepRaw: "2d"}))
+
+	config := NewConfig()
+	config.BatchSize = 1
+	config.BatchPause = 0
+	w, err := NewRetentionWorker(config, uc)
+	assert.NoError(t, err)
+
+	w.purge(now)
+
+	// the events of 1h and 25h ago are kept, the batches of 1 are deleted until one is not full
+	c, err := ter.ServiceCascade(s.ServiceID)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 2, Values: 2}, c)
+}
+
+func TestRetentionWorker_Shutdown(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+	mr := testrepository.NewMetricRepository()
+	er := testrepository.NewEventRepository()
+	kr := testrepository.NewAPIKeyRepository()
+	tr := testrepository.NewTenantRepository()
+	rr := testrepository.NewRetentionRepository()
+	ur := testrepository.NewRollupRepository(er)
+	pr := testrepository.NewPartitionRepository(er)
+	ar := testrepository.NewAlertRepository()
+	uc := usecase.NewAppUseCase(sr, mr, er, kr, tr, rr, ur, pr, ar)
+
+	s := entity.TestService(t)
+	uc.ServiceCreate(s)
+	assert.NoError(t, uc.RetentionPolicySave(&entity.RetentionPolicy{ServiceID: s.ServiceID, KeepRaw: "1h"}))
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, er.Create(&entity.Event{ServiceID: s.ServiceID, TimeStamp: entity.CustomTime{Time: now.Add(-time.Duration(i+2) * time.Hour)}}))
+	}
+
+	config := NewConfig()
+	config.BatchSize = 1
+	config.BatchPause = time.Hour
+	w, _ := NewRetentionWorker(config, uc)
+
+	// the first batch is deleted, the pause after it is cut short by Shutdown
+	close(w.done)
+	w.purge(now)
+
+	c, err := er.ServiceCascade(s.ServiceID)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 2}, c)
+}
+
+func TestRetentionWorker_PurgeRollups(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+	mr := testrepository.NewMetricRepository()
+	er := testrepository.NewEventRepository()
+	kr := testrepository.NewAPIKeyRepository()
+	tr := testrepository.NewTenantRepository()
+	rr := testrepository.NewRetentionRepository()
+	ur := testrepository.NewRollupRepository(er)
+	pr := testrepository.NewPartitionRepository(er)
+	ar := testrepository.NewAlertRepository()
+	uc := usecase.NewAppUseCase(sr, mr, er, kr, tr, rr, ur, pr, ar)
+
+	m := entity.TestMetric(t)
+	m.MetricType = "INT"
+	uc.MetricCreate(m)
+
+	now := time.Now().Truncate(time.Minute)
+	for i := 0; i < 4; i++ {
+		e := &entity.Event{ServiceID: 1, TimeStamp: entity.CustomTime{Time: now.Add(-time.Duration(i*24+1) * time.Hour)}}
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: int64(i)}}))
+	}
+
+	_, err := uc.Rollup(time.Minute, now.Add(-7*24*time.Hour), now)
+	assert.NoError(t, err)
+
+	// only the minute rollups expire, the raw values are kept
+	assert.NoError(t, uc.RetentionPolicySave(&entity.RetentionPolicy{MetricID: m.MetricID, KeepRollups: map[string]string{"1m": "2d"}}))
+
+	config := NewConfig()
+	config.BatchSize = 1
+	config.BatchPause = 0
+	w, err := NewRetentionWorker(config, uc)
+	assert.NoError(t, err)
+
+	w.purge(now)
+
+	n, err := ur.PurgeMetric(time.Minute, m.MetricID, now, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	c, err := er.MetricCascade(m.MetricID)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Values: 4}, c)
+}
@@ -0,0 +1,195 @@
+package retention
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	errInvalidInterval  = errors.New("interval: must be positive")
+	errInvalidBatchSize = errors.New("batch_size: must be positive")
+)
+
+// retentionWorker purges the raw values expired by the retention policies of every tenant.
+type retentionWorker struct {
+	done    chan struct{}
+	wg      sync.WaitGroup
+	started bool
+	config  *Config
+	logger  *logrus.Logger
+	uc      usecase.UseCase
+}
+
+func NewRetentionWorker(config *Config, uc usecase.UseCase) (*retentionWorker, error) {
+	if config.Interval <= 0 {
+		return nil, errInvalidInterval
+	}
+
+	if config.BatchSize <= 0 {
+		return nil, errInvalidBatchSize
+	}
+
+	w := &retentionWorker{
+		done:   make(chan struct{}),
+		config: config,
+		logger: logrus.New(),
+		uc:     uc,
+	}
+
+	if err := w.configureLogger(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *retentionWorker) configureLogger() error {
+	level, err := logrus.ParseLevel(w.config.LogLevel)
+	if err != nil {
+		return err
+	}
+	w.logger.SetLevel(level)
+	return nil
+}
+
+// StartRetentionWorker purges the expired values right away and then every interval.
+func (w *retentionWorker) StartRetentionWorker() {
+	w.logger.Info("starting retention worker")
+	w.started = true
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.purgeEvery(w.config.Interval)
+	}()
+}
+
+// Shutdown stops the worker after the batch being deleted, it does nothing if the worker is not started.
+func (w *retentionWorker) Shutdown() {
+	if !w.started {
+		return
+	}
+
+	close(w.done)
+	w.wg.Wait()
+}
+
+func (w *retentionWorker) purgeEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	w.purge(time.Now())
+	for {
+		select {
+		case now := <-ticker.C:
+			w.purge(now)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// purgeTotals counts what a purge deleted.
+type purgeTotals struct {
+	events  int
+	values  int
+	rollups int
+}
+
+// purge deletes the values every policy expires at now, it gives up the rest once the worker is stopped.
+func (w *retentionWorker) purge(now time.Time) {
+	policies, err := w.uc.RetentionPolicyListAll()
+	if err != nil {
+		w.logger.Errorf("retention: cannot list policies: %s", err)
+		return
+	}
+
+	total := &purgeTotals{}
+	for _, p := range policies {
+		if !w.purgePolicy(p, now, total) {
+			return
+		}
+	}
+
+	w.logger.Infof("retention: purged %d events, %d values and %d rollups of %d policies", total.events, total.values, total.rollups, len(policies))
+}
+
+// purgePolicy deletes the raw values and then the rollups the policy expires at now,
+// it returns false once the worker is stopped.
+func (w *retentionWorker) purgePolicy(p *entity.RetentionPolicy, now time.Time, total *purgeTotals) bool {
+	if p.KeepRaw != "" {
+		ok := w.purgeBatches(p, "raw values", func() (int, error) {
+			c, err := w.uc.RetentionPurge(p, now, w.config.BatchSize)
+			if err != nil {
+				return 0, err
+			}
+
+			total.events += c.Events
+			total.values += c.Values
+			if c.Events > 0 || c.Values > 0 {
+				w.logger.Debugf("retention: policy %d: deleted %d events and %d values older than %s", p.PolicyID, c.Events, c.Values, p.KeepRaw)
+			}
+
+			// a policy of a service is limited by events, one of a metric by values
+			if p.MetricID != 0 {
+				return c.Values, nil
+			}
+			return c.Events, nil
+		})
+		if !ok {
+			return false
+		}
+	}
+
+	for _, res := range entity.RollupResolutions {
+		if p.RollupRetention(res) == 0 {
+			continue
+		}
+
+		name := entity.FormatBucket(res)
+		ok := w.purgeBatches(p, name+" rollups", func() (int, error) {
+			n, err := w.uc.RetentionPurgeRollups(p, res, now, w.config.BatchSize)
+			if err != nil {
+				return 0, err
+			}
+
+			total.rollups += n
+			if n > 0 {
+				w.logger.Debugf("retention: policy %d: deleted %d %s rollups older than %s", p.PolicyID, n, name, p.KeepRollups[name])
+			}
+			return n, nil
+		})
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// purgeBatches deletes batches with purge until one is not full, it returns false once the worker is stopped.
+func (w *retentionWorker) purgeBatches(p *entity.RetentionPolicy, what string, purge func() (int, error)) bool {
+	for {
+		deleted, err := purge()
+		if err != nil {
+			w.logger.Errorf("retention: policy %d: %s: %s", p.PolicyID, what, err)
+			return true
+		}
+
+		if deleted < w.config.BatchSize {
+			return true
+		}
+
+		select {
+		case <-w.done:
+			w.logger.Infof("retention: policy %d: stopped purging %s", p.PolicyID, what)
+			return false
+		case <-time.After(w.config.BatchPause):
+		}
+	}
+}
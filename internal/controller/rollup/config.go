@@ -0,0 +1,28 @@
+package rollup
+
+import "time"
+
+type Config struct {
+	// the worker is started only if enabled
+	Enabled  bool   `toml:"enabled"`
+	LogLevel string `toml:"log_level"`
+
+	// period between rollups
+	Interval time.Duration `toml:"interval"`
+
+	// values stamped later than now minus the delay are left for the next rollups to let late events arrive,
+	// values stamped before the watermark when they are written are rolled up again by the next rollup
+	Delay time.Duration `toml:"delay"`
+
+	// longest period rolled up by one statement, at least one bucket of the resolution
+	MaxWindow time.Duration `toml:"max_window"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		LogLevel:  "debug",
+		Interval:  time.Minute,
+		Delay:     5 * time.Minute,
+		MaxWindow: 6 * time.Hour,
+	}
+}
@@ -0,0 +1,116 @@
+package rollup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/testrepository"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRollupWorker(t *testing.T) {
+	er := testrepository.NewEventRepository()
+	uc := usecase.NewAppUseCase(
+		testrepository.NewServiceRepository(),
+		testrepository.NewMetricRepository(),
+		er,
+		testrepository.NewAPIKeyRepository(),
+		testrepository.NewTenantRepository(),
+		testrepository.NewRetentionRepository(),
+		testrepository.NewRollupRepository(er),
+		testrepository.NewPartitionRepository(er),
+		testrepository.NewAlertRepository(),
+	)
+
+	config := NewConfig()
+	config.Interval = 0
+	_, err := NewRollupWorker(config, uc)
+	assert.ErrorIs(t, err, errInvalidInterval)
+
+	config = NewConfig()
+	config.Delay = -time.Minute
+	_, err = NewRollupWorker(config, uc)
+	assert.ErrorIs(t, err, errInvalidDelay)
+
+	config = NewConfig()
+	config.MaxWindow = 0
+	_, err = NewRollupWorker(config, uc)
+	assert.ErrorIs(t, err, errInvalidMaxWindow)
+
+	w, err := NewRollupWorker(NewConfig(), uc)
+	assert.NoError(t, err)
+	w.Shutdown()
+
+	w.StartRollupWorker()
+	w.Shutdown()
+}
+
+func TestRollupWorker_Rollup(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+	mr := testrepository.NewMetricRepository()
+	er := testrepository.NewEventRepository()
+	kr := testrepository.NewAPIKeyRepository()
+	tr := testrepository.NewTenantRepository()
+	rr := testrepository.NewRetentionRepository()
+	ur := testrepository.NewRollupRepository(er)
+	pr := testrepository.NewPartitionRepository(er)
+	ar := testrepository.NewAlertRepository()
+	uc := usecase.NewAppUseCase(sr, mr, er, kr, tr, rr, ur, pr, ar)
+
+	day := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		e := &entity.Event{ServiceID: 1, TimeStamp: entity.CustomTime{Time: day.Add(time.Duration(i*40) * time.Minute)}}
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: 1, MetricValue: int64(i)}}))
+	}
+
+	config := NewConfig()
+	config.Delay = 5 * time.Minute
+	config.MaxWindow = time.Hour
+	w, err := NewRollupWorker(config, uc)
+	assert.NoError(t, err)
+
+	// the events of 0:00 to 2:40 are rolled up to 2:50, the hours up to 2:00 and no day yet
+	w.rollup(day.Add(2*time.Hour + 55*time.Minute))
+
+	for res, expected := range map[time.Duration]time.Time{
+		time.Minute:    day.Add(2*time.Hour + 50*time.Minute),
+		time.Hour:      day.Add(2 * time.Hour),
+		24 * time.Hour: day,
+	} {
+		watermark, err := uc.RollupWatermark(res)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, watermark, entity.FormatBucket(res))
+	}
+
+	p := [2]*entity.CustomTime{{Time: day}, {Time: day.Add(2 * time.Hour)}}
+	a := &entity.Aggregation{Bucket: time.Hour, Functions: []string{"count", "sum"}}
+	buckets, err := ur.Aggregate(1, p, &entity.Metric{MetricID: 1, MetricType: "INT"}, a, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []*entity.AggregatedMetric{
+		{TimeStamp: entity.CustomTime{Time: day}, Values: map[string]interface{}{"count": 2, "sum": int64(1)}},
+		{TimeStamp: entity.CustomTime{Time: day.Add(time.Hour)}, Values: map[string]interface{}{"count": 1, "sum": int64(2)}},
+	}, buckets)
+
+	// a value written behind the watermarks is rolled up again with its hour
+	e := &entity.Event{ServiceID: 1, TimeStamp: entity.CustomTime{Time: day.Add(30 * time.Minute)}}
+	assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: 1, MetricValue: int64(10)}}))
+	w.rollup(day.Add(2*time.Hour + 55*time.Minute))
+
+	buckets, err = ur.Aggregate(1, p, &entity.Metric{MetricID: 1, MetricType: "INT"}, a, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"count": 3, "sum": int64(11)}, buckets[0].Values)
+
+	// a stopped worker gives up after the first window
+	close(w.done)
+	w.rollup(day.Add(26 * time.Hour))
+
+	watermark, err := uc.RollupWatermark(time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, day.Add(3*time.Hour+50*time.Minute), watermark)
+
+	watermark, err = uc.RollupWatermark(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, day.Add(2*time.Hour), watermark)
+}
@@ -0,0 +1,206 @@
+package rollup
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/sirupsen/logrus"
+)
+
+// lateBatchSize is the number of late minutes rolled up again by one statement.
+const lateBatchSize = 1000
+
+var (
+	errInvalidInterval  = errors.New("interval: must be positive")
+	errInvalidDelay     = errors.New("delay: must not be negative")
+	errInvalidMaxWindow = errors.New("max_window: must be positive")
+)
+
+// rollupWorker keeps the rollups of every resolution up to date, each resolution is rolled up
+// from its watermark to the watermark of the previous one, the finest one up to now minus the delay.
+type rollupWorker struct {
+	done    chan struct{}
+	wg      sync.WaitGroup
+	started bool
+	config  *Config
+	logger  *logrus.Logger
+	uc      usecase.UseCase
+}
+
+func NewRollupWorker(config *Config, uc usecase.UseCase) (*rollupWorker, error) {
+	if config.Interval <= 0 {
+		return nil, errInvalidInterval
+	}
+
+	if config.Delay < 0 {
+		return nil, errInvalidDelay
+	}
+
+	if config.MaxWindow <= 0 {
+		return nil, errInvalidMaxWindow
+	}
+
+	w := &rollupWorker{
+		done:   make(chan struct{}),
+		config: config,
+		logger: logrus.New(),
+		uc:     uc,
+	}
+
+	if err := w.configureLogger(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *rollupWorker) configureLogger() error {
+	level, err := logrus.ParseLevel(w.config.LogLevel)
+	if err != nil {
+		return err
+	}
+	w.logger.SetLevel(level)
+	return nil
+}
+
+// StartRollupWorker rolls the values up right away and then every interval.
+func (w *rollupWorker) StartRollupWorker() {
+	w.logger.Info("starting rollup worker")
+	w.started = true
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.rollupEvery(w.config.Interval)
+	}()
+}
+
+// Shutdown stops the worker after the window being rolled up, it does nothing if the worker is not started.
+func (w *rollupWorker) Shutdown() {
+	if !w.started {
+		return
+	}
+
+	close(w.done)
+	w.wg.Wait()
+}
+
+func (w *rollupWorker) rollupEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	w.rollup(time.Now())
+	for {
+		select {
+		case now := <-ticker.C:
+			w.rollup(now)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// rollup rolls up the late values again and brings every resolution up to date at now,
+// it gives up the rest once the worker is stopped.
+func (w *rollupWorker) rollup(now time.Time) {
+	if !w.rollupLate() {
+		return
+	}
+
+	end := now.Add(-w.config.Delay)
+	for _, res := range entity.RollupResolutions {
+		watermark, ok := w.rollupTo(res, end)
+		if !ok {
+			return
+		}
+		end = watermark
+	}
+}
+
+// rollupLate rolls up again the minutes with values written behind the watermark in batches,
+// it returns false once the worker is stopped.
+func (w *rollupWorker) rollupLate() bool {
+	var total int
+	defer func() {
+		if total > 0 {
+			w.logger.Infof("rollup: rolled up %d late minutes again", total)
+		}
+	}()
+
+	for {
+		n, err := w.uc.RollupLate(lateBatchSize)
+		if err != nil {
+			w.logger.Errorf("rollup: late values: %s", err)
+			return true
+		}
+
+		total += n
+		if n < lateBatchSize {
+			return true
+		}
+
+		select {
+		case <-w.done:
+			return false
+		default:
+		}
+	}
+}
+
+// rollupTo rolls the resolution up from its watermark to the bucket end belongs to in windows of at most
+// max_window, it returns the new watermark and false once the worker is stopped.
+func (w *rollupWorker) rollupTo(res time.Duration, end time.Time) (time.Time, bool) {
+	name := entity.FormatBucket(res)
+
+	from, err := w.uc.RollupWatermark(res)
+	if err != nil {
+		w.logger.Errorf("rollup: %s: cannot read watermark: %s", name, err)
+		return from, true
+	}
+
+	// there are no events yet
+	if from.IsZero() {
+		return from, true
+	}
+
+	a := &entity.Aggregation{Bucket: res}
+	from = a.BucketStart(from)
+	to := a.BucketStart(end)
+
+	window := w.config.MaxWindow - w.config.MaxWindow%res
+	if window < res {
+		window = res
+	}
+
+	var total int
+	for from.Before(to) {
+		next := from.Add(window)
+		if next.After(to) {
+			next = to
+		}
+
+		n, err := w.uc.Rollup(res, from, next)
+		if err != nil {
+			w.logger.Errorf("rollup: %s: %s", name, err)
+			return from, true
+		}
+
+		total += n
+		from = next
+
+		select {
+		case <-w.done:
+			w.logger.Infof("rollup: %s: stopped at %s", name, from.Format(time.RFC3339))
+			return from, false
+		default:
+		}
+	}
+
+	if total > 0 {
+		w.logger.Infof("rollup: %s: wrote %d rollups up to %s", name, total, from.Format(time.RFC3339))
+	}
+	return from, true
+}
@@ -0,0 +1,198 @@
+package statsd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+// metricTypes are the types of the metrics the StatsD types are stored in.
+var metricTypes = map[string]string{
+	kindCounter: "INT",
+	kindGauge:   "FLOAT",
+	kindTimer:   "DURATION",
+	kindSet:     "INT",
+}
+
+// key tells apart the series of samples, tags holds the tags of the samples in a stable order.
+type key struct {
+	service string
+	metric  string
+	tags    string
+}
+
+type timerStat struct {
+	sum   float64
+	count int
+}
+
+// aggregator collects samples between flushes:
+// counters are summed up scaled by their sample rates, the last value of a gauge is kept,
+// timers are averaged and the unique values of a set are counted.
+type aggregator struct {
+	mu sync.Mutex
+
+	kinds    map[key]string
+	names    map[key]string
+	tags     map[key]map[string]string
+	counters map[key]float64
+	gauges   map[key]float64
+	timers   map[key]*timerStat
+	sets     map[key]map[string]struct{}
+
+	// gauges keep their value across flushes for relative changes
+	// but are written only if they are set since the last flush
+	lastGauges map[key]float64
+}
+
+func newAggregator() *aggregator {
+	a := &aggregator{
+		lastGauges: make(map[key]float64),
+	}
+	a.reset()
+	return a
+}
+
+func (a *aggregator) reset() {
+	a.kinds = make(map[key]string)
+	a.names = make(map[key]string)
+	a.tags = make(map[key]map[string]string)
+	a.counters = make(map[key]float64)
+	a.gauges = make(map[key]float64)
+	a.timers = make(map[key]*timerStat)
+	a.sets = make(map[key]map[string]struct{})
+}
+
+// add aggregates s, a name may be used with one StatsD type only between flushes whatever its tags are.
+func (a *aggregator) add(s *sample) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	name := key{service: s.service, metric: s.metric}
+	if kind, ok := a.names[name]; ok && kind != s.kind {
+		return fmt.Errorf("%s.%s: type %q conflicts with %q", s.service, s.metric, s.kind, kind)
+	}
+	a.names[name] = s.kind
+
+	k := key{service: s.service, metric: s.metric, tags: tagsKey(s.tags)}
+	a.kinds[k] = s.kind
+	a.tags[k] = s.tags
+
+	switch s.kind {
+	case kindCounter:
+		a.counters[k] += s.value / s.rate
+	case kindGauge:
+		v := s.value
+		if s.relative {
+			v += a.lastGauges[k]
+		}
+		a.gauges[k] = v
+		a.lastGauges[k] = v
+	case kindTimer:
+		t, ok := a.timers[k]
+		if !ok {
+			t = &timerStat{}
+			a.timers[k] = t
+		}
+		t.sum += s.value
+		t.count++
+	case kindSet:
+		set, ok := a.sets[k]
+		if !ok {
+			set = make(map[string]struct{})
+			a.sets[k] = set
+		}
+		set[s.raw] = struct{}{}
+	}
+
+	return nil
+}
+
+// flush turns the values aggregated since the last flush into one event per service and tags at now
+// and returns the events along with the metrics they refer to.
+func (a *aggregator) flush(now time.Time) ([]*entity.BatchItem, []*entity.Metric) {
+	a.mu.Lock()
+	kinds, tags, counters, gauges, timers, sets := a.kinds, a.tags, a.counters, a.gauges, a.timers, a.sets
+	a.reset()
+	a.mu.Unlock()
+
+	keys := make([]key, 0, len(kinds))
+	for k := range kinds {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].service != keys[j].service {
+			return keys[i].service < keys[j].service
+		}
+		if keys[i].tags != keys[j].tags {
+			return keys[i].tags < keys[j].tags
+		}
+		return keys[i].metric < keys[j].metric
+	})
+
+	items := make([]*entity.BatchItem, 0)
+	metrics := make([]*entity.Metric, 0, len(keys))
+	registered := make(map[string]bool, len(keys))
+
+	for _, k := range keys {
+		var value interface{}
+
+		switch kinds[k] {
+		case kindCounter:
+			value = int64(math.Round(counters[k]))
+		case kindGauge:
+			value = gauges[k]
+		case kindTimer:
+			t := timers[k]
+			value = time.Duration(t.sum / float64(t.count) * float64(time.Millisecond))
+		case kindSet:
+			value = int64(len(sets[k]))
+		}
+
+		if len(items) == 0 || items[len(items)-1].Event.ServiceSlug != k.service || tagsKey(items[len(items)-1].Event.Labels) != k.tags {
+			items = append(items, &entity.BatchItem{
+				Event: &entity.Event{
+					TimeStamp:   entity.CustomTime{Time: now},
+					ServiceSlug: k.service,
+					Labels:      tags[k],
+				},
+			})
+		}
+
+		item := items[len(items)-1]
+		item.Metrics = append(item.Metrics, &entity.AddMetric{MetricSlug: k.metric, MetricValue: value})
+
+		if registered[k.metric] {
+			continue
+		}
+		registered[k.metric] = true
+
+		metrics = append(metrics, &entity.Metric{
+			Slug:       k.metric,
+			MetricType: metricTypes[kinds[k]],
+			Details:    "Registered by StatsD",
+		})
+	}
+
+	return items, metrics
+}
+
+// tagsKey renders tags in a stable order.
+func tagsKey(tags map[string]string) string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := &strings.Builder{}
+	for _, name := range names {
+		fmt.Fprintf(b, "%q=%q,", name, tags[name])
+	}
+	return b.String()
+}
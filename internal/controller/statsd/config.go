@@ -0,0 +1,30 @@
+package statsd
+
+import "time"
+
+type Config struct {
+	// the listener is started only if enabled
+	Enabled  bool   `toml:"enabled"`
+	BindAddr string `toml:"bind_addr"`
+	LogLevel string `toml:"log_level"`
+
+	// period over which received values are aggregated into one event per service
+	FlushInterval time.Duration `toml:"flush_interval"`
+
+	// slug of the tenant the values are written to, empty writes them to the default tenant
+	Tenant string `toml:"tenant"`
+
+	// service of names without a service prefix, empty rejects such names
+	DefaultService string `toml:"default_service"`
+
+	// create unknown metrics with the type matching the StatsD type
+	AutoRegister bool `toml:"auto_register"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		BindAddr:      ":8125",
+		LogLevel:      "debug",
+		FlushInterval: 10 * time.Second,
+	}
+}
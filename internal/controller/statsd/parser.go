@@ -0,0 +1,123 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+const (
+	kindCounter   = "c"
+	kindGauge     = "g"
+	kindTimer     = "ms"
+	kindHistogram = "h"
+	kindSet       = "s"
+)
+
+var errInvalidLine = errors.New("invalid line")
+
+// sample is a line of the StatsD protocol:
+//
+//	<service>.<metric>:<value>|<type>[|@<sample rate>][|#<tags>]
+//
+// DogStatsD tags such as #host:a,canary become the labels of the event, a tag without a value is an empty label.
+type sample struct {
+	service string
+	metric  string
+	kind    string
+	tags    map[string]string
+
+	// value of counters, gauges and timers, raw value of sets
+	value float64
+	raw   string
+
+	// relative gauge change, the value has a sign
+	relative bool
+	rate     float64
+}
+
+// parseLine parses a line, names without a service prefix belong to defaultService.
+func parseLine(line, defaultService string) (*sample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("%w: missing name", errInvalidLine)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("%w: %s: missing type", errInvalidLine, name)
+	}
+
+	s := &sample{
+		kind: parts[1],
+		raw:  parts[0],
+		rate: 1,
+	}
+
+	service, metric, ok := strings.Cut(name, ".")
+	if !ok {
+		service, metric = defaultService, name
+	}
+	if service == "" || metric == "" {
+		return nil, fmt.Errorf("%w: %s: missing service", errInvalidLine, name)
+	}
+	s.service = entity.NormalizeSlug(entity.SanitizeSlug(service))
+	s.metric = entity.NormalizeSlug(entity.SanitizeSlug(metric))
+
+	for _, p := range parts[2:] {
+		if strings.HasPrefix(p, "@") {
+			rate, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("%w: %s: invalid sample rate %q", errInvalidLine, name, p[1:])
+			}
+			s.rate = rate
+		}
+
+		if strings.HasPrefix(p, "#") {
+			s.tags = parseTags(p[1:])
+		}
+	}
+
+	switch s.kind {
+	case kindSet:
+		if s.raw == "" {
+			return nil, fmt.Errorf("%w: %s: missing value", errInvalidLine, name)
+		}
+		return s, nil
+	case kindCounter, kindTimer:
+	case kindHistogram:
+		// histograms are timers in the original StatsD
+		s.kind = kindTimer
+	case kindGauge:
+		s.relative = strings.HasPrefix(s.raw, "+") || strings.HasPrefix(s.raw, "-")
+	default:
+		return nil, fmt.Errorf("%w: %s: unknown type %q", errInvalidLine, name, s.kind)
+	}
+
+	v, err := strconv.ParseFloat(s.raw, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, fmt.Errorf("%w: %s: invalid value %q", errInvalidLine, name, s.raw)
+	}
+
+	if s.kind == kindTimer && v < 0 {
+		return nil, fmt.Errorf("%w: %s: negative duration %q", errInvalidLine, name, s.raw)
+	}
+
+	s.value = v
+	return s, nil
+}
+
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		name, value, _ := strings.Cut(tag, ":")
+		if name != "" {
+			tags[name] = value
+		}
+	}
+	return tags
+}
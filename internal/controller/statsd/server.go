@@ -0,0 +1,185 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/sirupsen/logrus"
+)
+
+// maxPacketSize is the largest UDP payload.
+const maxPacketSize = 65535
+
+var errInvalidFlushInterval = errors.New("flush_interval: must be positive")
+
+type statsDServer struct {
+	conn       net.PacketConn
+	notify     chan error
+	done       chan struct{}
+	wg         sync.WaitGroup
+	config     *Config
+	logger     *logrus.Logger
+	uc         usecase.UseCase
+	aggregator *aggregator
+}
+
+func NewStatsDServer(config *Config, uc usecase.UseCase) (*statsDServer, error) {
+	if config.FlushInterval <= 0 {
+		return nil, errInvalidFlushInterval
+	}
+
+	if config.Tenant != "" {
+		t, err := uc.TenantFindBySlug(entity.NormalizeSlug(config.Tenant))
+		if err != nil {
+			return nil, fmt.Errorf("tenant: %w", err)
+		}
+		uc = uc.ForTenant(t.TenantID)
+	}
+
+	s := &statsDServer{
+		notify:     make(chan error, 1),
+		done:       make(chan struct{}),
+		config:     config,
+		logger:     logrus.New(),
+		uc:         uc,
+		aggregator: newAggregator(),
+	}
+
+	if err := s.configureLogger(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *statsDServer) configureLogger() error {
+	level, err := logrus.ParseLevel(s.config.LogLevel)
+	if err != nil {
+		return err
+	}
+	s.logger.SetLevel(level)
+	return nil
+}
+
+// StartStatsDServer listens for StatsD packets and writes the aggregated values every flush interval.
+func (s *statsDServer) StartStatsDServer() {
+	s.logger.Info("starting statsd server")
+
+	conn, err := net.ListenPacket("udp", s.config.BindAddr)
+	if err != nil {
+		s.notify <- err
+		close(s.notify)
+		return
+	}
+	s.conn = conn
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.flushEvery(s.config.FlushInterval)
+	}()
+
+	go func() {
+		if err := s.serve(); err != nil {
+			s.notify <- err
+		}
+		close(s.notify)
+	}()
+}
+
+func (s *statsDServer) Notify() <-chan error {
+	return s.notify
+}
+
+// Shutdown stops listening and writes the values received since the last flush,
+// it does nothing if the server is not started.
+func (s *statsDServer) Shutdown() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	close(s.done)
+	err := s.conn.Close()
+	s.wg.Wait()
+
+	s.flush(time.Now())
+	return err
+}
+
+func (s *statsDServer) serve() error {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		s.handlePacket(string(buf[:n]))
+	}
+}
+
+// handlePacket aggregates the lines of a packet, malformed lines are logged and skipped.
+func (s *statsDServer) handlePacket(packet string) {
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		sample, err := parseLine(line, s.config.DefaultService)
+		if err == nil {
+			err = s.aggregator.add(sample)
+		}
+		if err != nil {
+			s.logger.Debugf("statsd: %s", err)
+		}
+	}
+}
+
+func (s *statsDServer) flushEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.flush(now)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// flush writes one event per service with the values aggregated since the last flush.
+func (s *statsDServer) flush(now time.Time) {
+	items, metrics := s.aggregator.flush(now)
+	if len(items) == 0 {
+		return
+	}
+
+	if s.config.AutoRegister {
+		for _, m := range metrics {
+			created, err := s.uc.MetricRegister(m)
+			if err != nil {
+				s.logger.Warnf("statsd: cannot register metric %s: %s", m.Slug, err)
+			} else if created {
+				s.logger.Infof("statsd: registered %s metric %s", m.MetricType, m.Slug)
+			}
+		}
+	}
+
+	for i, err := range s.uc.EventBatchCreate(items, false) {
+		if err != nil {
+			s.logger.Errorf("statsd: service %s: %s", items[i].Event.ServiceSlug, err)
+		}
+	}
+}
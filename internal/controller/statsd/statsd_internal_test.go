@@ -0,0 +1,209 @@
+package statsd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/testrepository"
+	"github.com/AnatoliyBr/dwh-service/internal/usecase"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLine(t *testing.T) {
+	testCases := []struct {
+		name           string
+		line           string
+		defaultService string
+		expected       *sample
+		isValid        bool
+	}{
+		{
+			name:     "counter with sample rate",
+			line:     "note_book.page.views:3|c|@0.5",
+			expected: &sample{service: "NOTE_BOOK", metric: "PAGE_VIEWS", kind: kindCounter, value: 3, raw: "3", rate: 0.5},
+			isValid:  true,
+		},
+		{
+			name:     "relative gauge",
+			line:     "note_book.queue:-2|g",
+			expected: &sample{service: "NOTE_BOOK", metric: "QUEUE", kind: kindGauge, value: -2, raw: "-2", relative: true, rate: 1},
+			isValid:  true,
+		},
+		{
+			name:     "histogram with tags",
+			line:     "note_book.render:12.5|h|#env:prod,canary",
+			expected: &sample{service: "NOTE_BOOK", metric: "RENDER", kind: kindTimer, tags: map[string]string{"env": "prod", "canary": ""}, value: 12.5, raw: "12.5", rate: 1},
+			isValid:  true,
+		},
+		{
+			name:           "set of the default service",
+			line:           "users:alice|s",
+			defaultService: "note-book",
+			expected:       &sample{service: "NOTE_BOOK", metric: "USERS", kind: kindSet, raw: "alice", rate: 1},
+			isValid:        true,
+		},
+		{
+			name:    "without service",
+			line:    "users:alice|s",
+			isValid: false,
+		},
+		{
+			name:    "unknown type",
+			line:    "note_book.users:1|x",
+			isValid: false,
+		},
+		{
+			name:    "negative timer",
+			line:    "note_book.render:-1|ms",
+			isValid: false,
+		},
+		{
+			name:    "invalid sample rate",
+			line:    "note_book.page.views:3|c|@2",
+			isValid: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := parseLine(tc.line, tc.defaultService)
+			if tc.isValid {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, s)
+			} else {
+				assert.ErrorIs(t, err, errInvalidLine)
+			}
+		})
+	}
+}
+
+func TestAggregator_Flush(t *testing.T) {
+	a := newAggregator()
+	now := time.Now()
+
+	for _, line := range []string{
+		"note_book.views:1|c",
+		"note_book.views:2|c|@0.5",
+		"note_book.queue:10|g",
+		"note_book.queue:+5|g",
+		"note_book.render:10|ms",
+		"note_book.render:20|ms",
+		"todo_app.users:alice|s",
+		"todo_app.users:bob|s",
+		"todo_app.users:alice|s",
+	} {
+		s, err := parseLine(line, "")
+		assert.NoError(t, err)
+		assert.NoError(t, a.add(s))
+	}
+
+	s, _ := parseLine("note_book.views:1|g", "")
+	assert.Error(t, a.add(s))
+
+	items, metrics := a.flush(now)
+	assert.Len(t, items, 2)
+	assert.Len(t, metrics, 4)
+
+	assert.Equal(t, "NOTE_BOOK", items[0].Event.ServiceSlug)
+	assert.Equal(t, now, items[0].Event.TimeStamp.Time)
+	assert.Equal(t, []*entity.AddMetric{
+		{MetricSlug: "QUEUE", MetricValue: float64(15)},
+		{MetricSlug: "RENDER", MetricValue: 15 * time.Millisecond},
+		{MetricSlug: "VIEWS", MetricValue: int64(5)},
+	}, items[0].Metrics)
+
+	assert.Equal(t, "TODO_APP", items[1].Event.ServiceSlug)
+	assert.Equal(t, []*entity.AddMetric{{MetricSlug: "USERS", MetricValue: int64(2)}}, items[1].Metrics)
+
+	// gauges are written only when set, but keep their value for relative changes
+	items, _ = a.flush(now)
+	assert.Empty(t, items)
+
+	s, _ = parseLine("note_book.queue:-3|g", "")
+	assert.NoError(t, a.add(s))
+
+	items, _ = a.flush(now)
+	assert.Equal(t, []*entity.AddMetric{{MetricSlug: "QUEUE", MetricValue: float64(12)}}, items[0].Metrics)
+
+	// every set of tags is an event of its own
+	for _, line := range []string{
+		"note_book.views:1|c|#host:a",
+		"note_book.views:2|c|#host:b",
+		"note_book.views:3|c|#host:a",
+	} {
+		s, _ = parseLine(line, "")
+		assert.NoError(t, a.add(s))
+	}
+
+	s, _ = parseLine("note_book.views:1|g|#host:c", "")
+	assert.Error(t, a.add(s))
+
+	items, metrics = a.flush(now)
+	assert.Len(t, items, 2)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, map[string]string{"host": "a"}, items[0].Event.Labels)
+	assert.Equal(t, []*entity.AddMetric{{MetricSlug: "VIEWS", MetricValue: int64(4)}}, items[0].Metrics)
+	assert.Equal(t, map[string]string{"host": "b"}, items[1].Event.Labels)
+	assert.Equal(t, []*entity.AddMetric{{MetricSlug: "VIEWS", MetricValue: int64(2)}}, items[1].Metrics)
+}
+
+func TestStatsDServer(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+	mr := testrepository.NewMetricRepository()
+	er := testrepository.NewEventRepository()
+	kr := testrepository.NewAPIKeyRepository()
+	tr := testrepository.NewTenantRepository()
+	rr := testrepository.NewRetentionRepository()
+	ur := testrepository.NewRollupRepository(er)
+	pr := testrepository.NewPartitionRepository(er)
+	ar := testrepository.NewAlertRepository()
+	uc := usecase.NewAppUseCase(sr, mr, er, kr, tr, rr, ur, pr, ar)
+
+	sr.Create(entity.TestService(t))
+
+	config := NewConfig()
+	config.BindAddr = "127.0.0.1:0"
+	config.FlushInterval = time.Hour
+	config.AutoRegister = true
+
+	s, err := NewStatsDServer(config, uc)
+	assert.NoError(t, err)
+
+	s.StartStatsDServer()
+
+	conn, err := net.Dial("udp", s.conn.LocalAddr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("note_book.page_views:1|c\nnote_book.page_views:2|c\nnote_book.render:15|ms"))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		s.aggregator.mu.Lock()
+		defer s.aggregator.mu.Unlock()
+		return len(s.aggregator.kinds) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, s.Shutdown())
+
+	values, err := uc.LatestMetricValues(nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, values, 2)
+
+	m, err := uc.MetricFindBySlug("PAGE_VIEWS")
+	assert.NoError(t, err)
+	assert.Equal(t, "INT", m.MetricType)
+
+	_, ok := <-s.Notify()
+	assert.False(t, ok)
+}
+
+func TestNewStatsDServer_InvalidFlushInterval(t *testing.T) {
+	config := NewConfig()
+	config.FlushInterval = 0
+
+	_, err := NewStatsDServer(config, nil)
+	assert.ErrorIs(t, err, errInvalidFlushInterval)
+}
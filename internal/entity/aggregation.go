@@ -0,0 +1,92 @@
+package entity
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+var (
+	numericAggregateFunctions   = []interface{}{"count", "sum", "min", "max", "avg", "p50", "p95", "p99", "first", "last"}
+	timestampAggregateFunctions = []interface{}{"count", "min", "max", "first", "last"}
+	boolAggregateFunctions      = []interface{}{"count", "true_ratio", "first", "last"}
+	stringAggregateFunctions    = []interface{}{"count", "count_distinct", "first", "last"}
+
+	defaultAggregateFunctions = map[string][]interface{}{
+		"INT":                     numericAggregateFunctions,
+		"FLOAT":                   numericAggregateFunctions,
+		"DURATION":                numericAggregateFunctions,
+		"TIMESTAMP_WITH_TIMEZONE": timestampAggregateFunctions,
+		"BOOL":                    boolAggregateFunctions,
+		"STRING":                  stringAggregateFunctions,
+	}
+
+	// Percentiles maps percentile aggregate functions to their fraction.
+	Percentiles = map[string]float64{
+		"p50": 0.5,
+		"p95": 0.95,
+		"p99": 0.99,
+	}
+)
+
+var errInvalidBucket = errors.New("invalid bucket")
+
+type Aggregation struct {
+	Bucket    time.Duration `json:"bucket"`
+	Functions []string      `json:"functions"`
+}
+
+// AggregatedMetric is a bucket of values, Labels hold the values of the labels the buckets are grouped by.
+type AggregatedMetric struct {
+	TimeStamp CustomTime             `json:"time_stamp"`
+	Values    map[string]interface{} `json:"values"`
+	Labels    map[string]string      `json:"labels,omitempty"`
+}
+
+func (a *Aggregation) Validate(metricType string) error {
+	functions, ok := defaultAggregateFunctions[metricType]
+	if !ok {
+		return errors.New("unknown metric type")
+	}
+
+	return validation.ValidateStruct(
+		a,
+		validation.Field(
+			&a.Bucket,
+			validation.Required,
+			validation.Min(time.Second),
+		),
+		validation.Field(
+			&a.Functions,
+			validation.Required,
+			validation.Each(validation.In(functions...)),
+		),
+	)
+}
+
+// BucketStart aligns t to the beginning of the bucket it belongs to.
+// Buckets are counted from the unix epoch, so daily buckets start at UTC midnight.
+func (a *Aggregation) BucketStart(t time.Time) time.Time {
+	return time.Unix(0, t.UnixNano()-t.UnixNano()%int64(a.Bucket)).UTC()
+}
+
+// ParseBucket parses a bucket width such as "30s", "1m", "1h" or "1d".
+// On top of time.ParseDuration it supports the "d" (day) unit.
+func ParseBucket(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, errInvalidBucket
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errInvalidBucket
+	}
+	return d, nil
+}
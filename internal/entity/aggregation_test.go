@@ -0,0 +1,175 @@
+package entity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregation_Validate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		a          func() *entity.Aggregation
+		metricType string
+		isValid    bool
+	}{
+		{
+			name: "valid numeric",
+			a: func() *entity.Aggregation {
+				return entity.TestAggregation(t)
+			},
+			metricType: "DURATION",
+			isValid:    true,
+		},
+		{
+			name: "valid bool",
+			a: func() *entity.Aggregation {
+				a := entity.TestAggregation(t)
+				a.Functions = []string{"count", "true_ratio"}
+				return a
+			},
+			metricType: "BOOL",
+			isValid:    true,
+		},
+		{
+			name: "valid string",
+			a: func() *entity.Aggregation {
+				a := entity.TestAggregation(t)
+				a.Functions = []string{"count_distinct", "last"}
+				return a
+			},
+			metricType: "STRING",
+			isValid:    true,
+		},
+		{
+			name: "numeric function for string",
+			a: func() *entity.Aggregation {
+				return entity.TestAggregation(t)
+			},
+			metricType: "STRING",
+			isValid:    false,
+		},
+		{
+			name: "true ratio for int",
+			a: func() *entity.Aggregation {
+				a := entity.TestAggregation(t)
+				a.Functions = []string{"true_ratio"}
+				return a
+			},
+			metricType: "INT",
+			isValid:    false,
+		},
+		{
+			name: "unknown function",
+			a: func() *entity.Aggregation {
+				a := entity.TestAggregation(t)
+				a.Functions = []string{"median"}
+				return a
+			},
+			metricType: "FLOAT",
+			isValid:    false,
+		},
+		{
+			name: "empty functions",
+			a: func() *entity.Aggregation {
+				a := entity.TestAggregation(t)
+				a.Functions = nil
+				return a
+			},
+			metricType: "FLOAT",
+			isValid:    false,
+		},
+		{
+			name: "short bucket",
+			a: func() *entity.Aggregation {
+				a := entity.TestAggregation(t)
+				a.Bucket = time.Millisecond
+				return a
+			},
+			metricType: "FLOAT",
+			isValid:    false,
+		},
+		{
+			name: "unknown metric type",
+			a: func() *entity.Aggregation {
+				return entity.TestAggregation(t)
+			},
+			metricType: "TIMESTAMP",
+			isValid:    false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.isValid {
+				assert.NoError(t, tc.a().Validate(tc.metricType))
+			} else {
+				assert.Error(t, tc.a().Validate(tc.metricType))
+			}
+		})
+	}
+}
+
+func TestAggregation_BucketStart(t *testing.T) {
+	a := &entity.Aggregation{Bucket: time.Hour}
+	ts := time.Date(2023, 10, 8, 20, 44, 59, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2023, 10, 8, 20, 0, 0, 0, time.UTC), a.BucketStart(ts))
+}
+
+func TestParseBucket(t *testing.T) {
+	testCases := []struct {
+		name     string
+		s        string
+		expected time.Duration
+		isValid  bool
+	}{
+		{
+			name:     "minute",
+			s:        "1m",
+			expected: time.Minute,
+			isValid:  true,
+		},
+		{
+			name:     "hour",
+			s:        "1h",
+			expected: time.Hour,
+			isValid:  true,
+		},
+		{
+			name:     "days",
+			s:        "7d",
+			expected: 7 * 24 * time.Hour,
+			isValid:  true,
+		},
+		{
+			name:    "empty",
+			s:       "",
+			isValid: false,
+		},
+		{
+			name:    "negative",
+			s:       "-1h",
+			isValid: false,
+		},
+		{
+			name:    "invalid days",
+			s:       "xd",
+			isValid: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := entity.ParseBucket(tc.s)
+			if tc.isValid {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, d)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// Alert states: a rule is pending while its condition holds for less than For and firing after that,
+// it is resolved at the first evaluation its condition no longer holds and ok at the next one.
+const (
+	AlertOK       = "ok"
+	AlertPending  = "pending"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Alert rule operators. Counts and numeric results are compared with the threshold, the last value
+// of a BOOL metric is tested and the last value of a STRING metric is compared with the threshold.
+const (
+	OpGreater        = ">"
+	OpGreaterOrEqual = ">="
+	OpLess           = "<"
+	OpLessOrEqual    = "<="
+	OpEqual          = "=="
+	OpNotEqual       = "!="
+
+	OpIsTrue  = "is_true"
+	OpIsFalse = "is_false"
+
+	OpEquals    = "equals"
+	OpNotEquals = "not_equals"
+	OpMatches   = "matches"
+)
+
+var (
+	numericAlertFunctions = []interface{}{"count", "sum", "min", "max", "avg", "last"}
+
+	alertFunctions = map[string][]interface{}{
+		"INT":                     numericAlertFunctions,
+		"FLOAT":                   numericAlertFunctions,
+		"DURATION":                numericAlertFunctions,
+		"TIMESTAMP_WITH_TIMEZONE": {"count"},
+		"BOOL":                    {"count", "true_ratio", "last"},
+		"STRING":                  {"count", "last"},
+	}
+
+	numericAlertOperators = []interface{}{OpGreater, OpGreaterOrEqual, OpLess, OpLessOrEqual, OpEqual, OpNotEqual}
+	boolAlertOperators    = []interface{}{OpIsTrue, OpIsFalse}
+	stringAlertOperators  = []interface{}{OpEquals, OpNotEquals, OpMatches}
+)
+
+// AlertRule watches the result of Function over the values of a metric of a service stamped within
+// the last Window, e.g. the avg of RESPONSE_TIME over 5m > 300ms for 10m. Window and For are durations
+// such as 5m or 1d, the threshold of a DURATION metric is a duration and a regexp for matches.
+type AlertRule struct {
+	RuleID    int        `json:"rule_id"`
+	TenantID  int        `json:"-"`
+	Name      string     `json:"name"`
+	ServiceID int        `json:"service_id"`
+	MetricID  int        `json:"metric_id"`
+	Function  string     `json:"function"`
+	Window    string     `json:"window"`
+	Operator  string     `json:"operator"`
+	Threshold string     `json:"threshold,omitempty"`
+	For       string     `json:"for,omitempty"`
+	UpdatedAt CustomTime `json:"updated_at"`
+}
+
+// AlertState is the state of a rule after its last evaluation, ActiveAt is when its condition began
+// to hold and Value is the last result of its function.
+type AlertState struct {
+	RuleID      int         `json:"rule_id"`
+	State       string      `json:"state"`
+	Value       string      `json:"value,omitempty"`
+	ActiveAt    *CustomTime `json:"active_at,omitempty"`
+	ChangedAt   CustomTime  `json:"changed_at"`
+	EvaluatedAt CustomTime  `json:"evaluated_at"`
+}
+
+// AlertTransition is a change of the state of a rule kept in its history.
+type AlertTransition struct {
+	RuleID    int        `json:"rule_id"`
+	From      string     `json:"from"`
+	To        string     `json:"to"`
+	Value     string     `json:"value,omitempty"`
+	TimeStamp CustomTime `json:"time_stamp"`
+}
+
+// Validate checks the rule against the type of its metric.
+func (r *AlertRule) Validate(metricType string) error {
+	functions, ok := alertFunctions[metricType]
+	if !ok {
+		return errors.New("unknown metric type")
+	}
+
+	return validation.ValidateStruct(
+		r,
+		validation.Field(
+			&r.Name,
+			validation.Required,
+			validation.Length(1, 255),
+		),
+		validation.Field(
+			&r.ServiceID,
+			validation.Required,
+		),
+		validation.Field(
+			&r.MetricID,
+			validation.Required,
+		),
+		validation.Field(
+			&r.Function,
+			validation.Required,
+			validation.In(functions...),
+		),
+		validation.Field(
+			&r.Window,
+			validation.Required,
+			validation.By(validateAlertDuration),
+		),
+		validation.Field(
+			&r.Operator,
+			validation.Required,
+			validation.In(r.operators(metricType)...),
+		),
+		validation.Field(
+			&r.Threshold,
+			validation.By(func(interface{}) error { return r.validateThreshold(metricType) }),
+		),
+		validation.Field(
+			&r.For,
+			validation.By(validateAlertDuration),
+		),
+	)
+}
+
+// operators returns the operators that apply to the result of the function of the rule.
+func (r *AlertRule) operators(metricType string) []interface{} {
+	if r.Function != "last" {
+		return numericAlertOperators
+	}
+
+	switch metricType {
+	case "BOOL":
+		return boolAlertOperators
+	case "STRING":
+		return stringAlertOperators
+	default:
+		return numericAlertOperators
+	}
+}
+
+func (r *AlertRule) validateThreshold(metricType string) error {
+	switch r.Operator {
+	case OpIsTrue, OpIsFalse:
+		if r.Threshold != "" {
+			return errors.New("must be blank")
+		}
+		return nil
+	case OpEquals, OpNotEquals:
+		return nil
+	case OpMatches:
+		if _, err := regexp.Compile("^(?:" + r.Threshold + ")$"); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	if r.Threshold == "" {
+		return errors.New("cannot be blank")
+	}
+
+	if metricType == "DURATION" && r.Function != "count" {
+		if _, err := time.ParseDuration(r.Threshold); err != nil {
+			return errors.New("must be a duration such as 300ms")
+		}
+		return nil
+	}
+
+	if _, err := strconv.ParseFloat(r.Threshold, 64); err != nil {
+		return errors.New("must be a number")
+	}
+	return nil
+}
+
+func validateAlertDuration(v interface{}) error {
+	s, _ := v.(string)
+	if s == "" {
+		return nil
+	}
+
+	if _, err := ParseBucket(s); err != nil {
+		return errors.New("must be a duration such as 5m or 1d")
+	}
+	return nil
+}
+
+// WindowDuration returns the length of the window, zero if Window is invalid.
+func (r *AlertRule) WindowDuration() time.Duration {
+	d, _ := ParseBucket(r.Window)
+	return d
+}
+
+// ForDuration returns how long the condition has to hold before the rule fires, zero if For is blank.
+func (r *AlertRule) ForDuration() time.Duration {
+	d, _ := ParseBucket(r.For)
+	return d
+}
+
+// Aggregation returns the aggregation of the function of the rule in a single bucket. Buckets are counted
+// from the unix epoch, so the bucket is as wide as possible for any window to fall into it.
+func (r *AlertRule) Aggregation() *Aggregation {
+	return &Aggregation{Bucket: time.Duration(math.MaxInt64), Functions: []string{r.Function}}
+}
+
+// Evaluate tests the result of the function of the rule over its window, nil if the window has no values.
+// A window without values counts zero values, any other function has no result and does not hold.
+func (r *AlertRule) Evaluate(metricType string, v interface{}) (string, bool, error) {
+	if v == nil {
+		if r.Function != "count" {
+			return "", false, nil
+		}
+		v = 0
+	}
+
+	switch {
+	case metricType == "BOOL" && r.Function == "last":
+		b, ok := v.(bool)
+		if !ok {
+			return "", false, fmt.Errorf("unexpected value %v", v)
+		}
+		return strconv.FormatBool(b), b == (r.Operator == OpIsTrue), nil
+	case metricType == "STRING" && r.Function == "last":
+		s, ok := v.(string)
+		if !ok {
+			return "", false, fmt.Errorf("unexpected value %v", v)
+		}
+		return s, matchAlertString(r.Operator, s, r.Threshold), nil
+	}
+
+	x, err := alertValue(v)
+	if err != nil {
+		return "", false, err
+	}
+
+	if metricType == "DURATION" && r.Function != "count" {
+		return alertDuration(x).String(), compareAlertValue(r.Operator, x, r.Threshold, parseAlertSeconds), nil
+	}
+	return formatAlertFloat(x), compareAlertValue(r.Operator, x, r.Threshold, parseAlertFloat), nil
+}
+
+// Next moves the state to the result of an evaluation at now and returns the transition, nil if the state is kept.
+func (s *AlertState) Next(r *AlertRule, value string, holds bool, now time.Time) *AlertTransition {
+	from := s.State
+	if from == "" {
+		from = AlertOK
+	}
+
+	to := from
+	switch {
+	case holds && (from == AlertOK || from == AlertResolved):
+		s.ActiveAt = &CustomTime{Time: now}
+		to = AlertPending
+		if r.ForDuration() == 0 {
+			to = AlertFiring
+		}
+	case holds && from == AlertPending:
+		if !now.Before(s.ActiveAt.Add(r.ForDuration())) {
+			to = AlertFiring
+		}
+	case !holds && from == AlertPending:
+		s.ActiveAt = nil
+		to = AlertOK
+	case !holds && from == AlertFiring:
+		s.ActiveAt = nil
+		to = AlertResolved
+	case !holds && from == AlertResolved:
+		to = AlertOK
+	}
+
+	s.RuleID = r.RuleID
+	s.State = to
+	s.Value = value
+	s.EvaluatedAt = CustomTime{Time: now}
+
+	if s.ChangedAt.IsZero() {
+		s.ChangedAt = CustomTime{Time: now}
+	}
+	if to == from {
+		return nil
+	}
+
+	s.ChangedAt = CustomTime{Time: now}
+	return &AlertTransition{RuleID: r.RuleID, From: from, To: to, Value: value, TimeStamp: CustomTime{Time: now}}
+}
+
+// Active reports whether the condition of the rule holds.
+func (s *AlertState) Active() bool {
+	return s.State == AlertPending || s.State == AlertFiring
+}
+
+// alertValue converts an aggregated value to a number, durations in seconds.
+func alertValue(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case time.Duration:
+		return v.Seconds(), nil
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, err
+		}
+		return d.Seconds(), nil
+	default:
+		return 0, fmt.Errorf("unexpected value %v", v)
+	}
+}
+
+// compareAlertValue compares x with the threshold parsed by parse, an invalid threshold never holds.
+func compareAlertValue(op string, x float64, threshold string, parse func(string) (float64, error)) bool {
+	y, err := parse(threshold)
+	if err != nil {
+		return false
+	}
+
+	switch op {
+	case OpGreater:
+		return x > y
+	case OpGreaterOrEqual:
+		return x >= y
+	case OpLess:
+		return x < y
+	case OpLessOrEqual:
+		return x <= y
+	case OpEqual:
+		return x == y
+	case OpNotEqual:
+		return x != y
+	default:
+		return false
+	}
+}
+
+func matchAlertString(op, s, threshold string) bool {
+	switch op {
+	case OpEquals:
+		return s == threshold
+	case OpNotEquals:
+		return s != threshold
+	case OpMatches:
+		re, err := regexp.Compile("^(?:" + threshold + ")$")
+		return err == nil && re.MatchString(s)
+	default:
+		return false
+	}
+}
+
+func parseAlertFloat(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseAlertSeconds(s string) (float64, error) {
+	d, err := time.ParseDuration(s)
+	return d.Seconds(), err
+}
+
+func formatAlertFloat(x float64) string {
+	return strconv.FormatFloat(x, 'f', -1, 64)
+}
+
+func alertDuration(x float64) time.Duration {
+	return time.Duration(x * float64(time.Second))
+}
@@ -0,0 +1,413 @@
+package entity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertRule_Validate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		r          func() *entity.AlertRule
+		metricType string
+		isValid    bool
+	}{
+		{
+			name: "valid",
+			r: func() *entity.AlertRule {
+				return entity.TestAlertRule(t)
+			},
+			metricType: "DURATION",
+			isValid:    true,
+		},
+		{
+			name: "numeric threshold",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Threshold = "0.3"
+				r.For = ""
+				return r
+			},
+			metricType: "FLOAT",
+			isValid:    true,
+		},
+		{
+			name: "duration threshold of a number",
+			r: func() *entity.AlertRule {
+				return entity.TestAlertRule(t)
+			},
+			metricType: "INT",
+			isValid:    false,
+		},
+		{
+			name: "count of timestamps",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "count"
+				r.Operator = entity.OpLess
+				r.Threshold = "1"
+				return r
+			},
+			metricType: "TIMESTAMP_WITH_TIMEZONE",
+			isValid:    true,
+		},
+		{
+			name: "avg of timestamps",
+			r: func() *entity.AlertRule {
+				return entity.TestAlertRule(t)
+			},
+			metricType: "TIMESTAMP_WITH_TIMEZONE",
+			isValid:    false,
+		},
+		{
+			name: "last bool",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "last"
+				r.Operator = entity.OpIsFalse
+				r.Threshold = ""
+				return r
+			},
+			metricType: "BOOL",
+			isValid:    true,
+		},
+		{
+			name: "last bool with threshold",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "last"
+				r.Operator = entity.OpIsFalse
+				return r
+			},
+			metricType: "BOOL",
+			isValid:    false,
+		},
+		{
+			name: "last bool compared",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "last"
+				r.Threshold = "1"
+				return r
+			},
+			metricType: "BOOL",
+			isValid:    false,
+		},
+		{
+			name: "true ratio",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "true_ratio"
+				r.Operator = entity.OpLess
+				r.Threshold = "0.9"
+				return r
+			},
+			metricType: "BOOL",
+			isValid:    true,
+		},
+		{
+			name: "last string matches",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "last"
+				r.Operator = entity.OpMatches
+				r.Threshold = "ERR.*"
+				return r
+			},
+			metricType: "STRING",
+			isValid:    true,
+		},
+		{
+			name: "invalid regexp",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "last"
+				r.Operator = entity.OpMatches
+				r.Threshold = "ERR("
+				return r
+			},
+			metricType: "STRING",
+			isValid:    false,
+		},
+		{
+			name: "blank threshold",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Threshold = ""
+				return r
+			},
+			metricType: "DURATION",
+			isValid:    false,
+		},
+		{
+			name: "invalid window",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Window = "five minutes"
+				return r
+			},
+			metricType: "DURATION",
+			isValid:    false,
+		},
+		{
+			name: "invalid for",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.For = "-10m"
+				return r
+			},
+			metricType: "DURATION",
+			isValid:    false,
+		},
+		{
+			name: "empty name",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Name = ""
+				return r
+			},
+			metricType: "DURATION",
+			isValid:    false,
+		},
+		{
+			name: "unknown metric type",
+			r: func() *entity.AlertRule {
+				return entity.TestAlertRule(t)
+			},
+			metricType: "JSON",
+			isValid:    false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.isValid {
+				assert.NoError(t, tc.r().Validate(tc.metricType))
+			} else {
+				assert.Error(t, tc.r().Validate(tc.metricType))
+			}
+		})
+	}
+}
+
+func TestAlertRule_Evaluate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		r          func() *entity.AlertRule
+		metricType string
+		v          interface{}
+		value      string
+		holds      bool
+	}{
+		{
+			name: "avg duration",
+			r: func() *entity.AlertRule {
+				return entity.TestAlertRule(t)
+			},
+			metricType: "DURATION",
+			v:          "350ms",
+			value:      "350ms",
+			holds:      true,
+		},
+		{
+			name: "avg duration below the threshold",
+			r: func() *entity.AlertRule {
+				return entity.TestAlertRule(t)
+			},
+			metricType: "DURATION",
+			v:          "250ms",
+			value:      "250ms",
+			holds:      false,
+		},
+		{
+			name: "count of durations",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "count"
+				r.Threshold = "2"
+				return r
+			},
+			metricType: "DURATION",
+			v:          3,
+			value:      "3",
+			holds:      true,
+		},
+		{
+			name: "max int",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "max"
+				r.Operator = entity.OpGreaterOrEqual
+				r.Threshold = "10"
+				return r
+			},
+			metricType: "INT",
+			v:          int64(10),
+			value:      "10",
+			holds:      true,
+		},
+		{
+			name: "avg int",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Operator = entity.OpLess
+				r.Threshold = "7"
+				return r
+			},
+			metricType: "INT",
+			v:          6.5,
+			value:      "6.5",
+			holds:      true,
+		},
+		{
+			name: "last float",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "last"
+				r.Operator = entity.OpLess
+				r.Threshold = "0.5"
+				return r
+			},
+			metricType: "FLOAT",
+			v:          0.7,
+			value:      "0.7",
+			holds:      false,
+		},
+		{
+			name: "count of an empty window",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "count"
+				r.Operator = entity.OpEqual
+				r.Threshold = "0"
+				return r
+			},
+			metricType: "TIMESTAMP_WITH_TIMEZONE",
+			value:      "0",
+			holds:      true,
+		},
+		{
+			name: "avg of an empty window",
+			r: func() *entity.AlertRule {
+				return entity.TestAlertRule(t)
+			},
+			metricType: "DURATION",
+			value:      "",
+			holds:      false,
+		},
+		{
+			name: "last bool",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "last"
+				r.Operator = entity.OpIsFalse
+				return r
+			},
+			metricType: "BOOL",
+			v:          false,
+			value:      "false",
+			holds:      true,
+		},
+		{
+			name: "true ratio",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "true_ratio"
+				r.Operator = entity.OpLess
+				r.Threshold = "0.9"
+				return r
+			},
+			metricType: "BOOL",
+			v:          0.75,
+			value:      "0.75",
+			holds:      true,
+		},
+		{
+			name: "last string matches",
+			r: func() *entity.AlertRule {
+				r := entity.TestAlertRule(t)
+				r.Function = "last"
+				r.Operator = entity.OpMatches
+				r.Threshold = "ERR.*"
+				return r
+			},
+			metricType: "STRING",
+			v:          "OK",
+			value:      "OK",
+			holds:      false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, holds, err := tc.r().Evaluate(tc.metricType, tc.v)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.value, value)
+			assert.Equal(t, tc.holds, holds)
+		})
+	}
+}
+
+func TestAlertRule_Aggregation(t *testing.T) {
+	r := entity.TestAlertRule(t)
+	now := time.Date(2023, 10, 31, 12, 3, 0, 0, time.UTC)
+
+	a := r.Aggregation()
+	assert.Equal(t, []string{r.Function}, a.Functions)
+	assert.Equal(t, a.BucketStart(now), a.BucketStart(now.Add(-r.WindowDuration())))
+}
+
+func TestAlertState_Next(t *testing.T) {
+	r := entity.TestAlertRule(t)
+	now := time.Date(2023, 10, 31, 12, 0, 0, 0, time.UTC)
+	s := &entity.AlertState{}
+
+	assert.Nil(t, s.Next(r, "", false, now))
+	assert.Equal(t, entity.AlertOK, s.State)
+
+	tr := s.Next(r, "350ms", true, now.Add(time.Minute))
+	if assert.NotNil(t, tr) {
+		assert.Equal(t, entity.AlertOK, tr.From)
+		assert.Equal(t, entity.AlertPending, tr.To)
+	}
+	assert.True(t, s.Active())
+
+	assert.Nil(t, s.Next(r, "400ms", true, now.Add(5*time.Minute)))
+	assert.Equal(t, entity.AlertPending, s.State)
+
+	tr = s.Next(r, "400ms", true, now.Add(11*time.Minute))
+	if assert.NotNil(t, tr) {
+		assert.Equal(t, entity.AlertFiring, tr.To)
+	}
+	assert.Equal(t, now.Add(time.Minute), s.ActiveAt.Time)
+
+	tr = s.Next(r, "250ms", false, now.Add(12*time.Minute))
+	if assert.NotNil(t, tr) {
+		assert.Equal(t, entity.AlertResolved, tr.To)
+	}
+	assert.False(t, s.Active())
+	assert.Nil(t, s.ActiveAt)
+
+	tr = s.Next(r, "250ms", false, now.Add(13*time.Minute))
+	if assert.NotNil(t, tr) {
+		assert.Equal(t, entity.AlertOK, tr.To)
+	}
+
+	r.For = ""
+	tr = s.Next(r, "350ms", true, now.Add(14*time.Minute))
+	if assert.NotNil(t, tr) {
+		assert.Equal(t, entity.AlertFiring, tr.To)
+	}
+
+	r.For = "10m"
+	s = &entity.AlertState{}
+	s.Next(r, "350ms", true, now)
+	tr = s.Next(r, "250ms", false, now.Add(time.Minute))
+	if assert.NotNil(t, tr) {
+		assert.Equal(t, entity.AlertPending, tr.From)
+		assert.Equal(t, entity.AlertOK, tr.To)
+	}
+}
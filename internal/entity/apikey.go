@@ -0,0 +1,110 @@
+package entity
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+const (
+	ScopeAdmin = "admin"
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// ErrForbidden is reported for events of services the API key does not grant writing to.
+var ErrForbidden = errors.New("forbidden")
+
+// apiKeyPrefix marks the keys of the service so that they are easy to recognize in configs and leaks.
+const apiKeyPrefix = "dwh_"
+
+// APIKey grants its scopes to the requests that present it. Only the hash of the key is stored,
+// the key itself is known once, when it is generated.
+//
+// The admin scope grants everything, read grants the queries and write grants adding events
+// to the services in ServiceIDs or, if it is empty, to any service. A key is bound to the tenant
+// it is created in, TenantID is zero only for keys that are not stored and may act in any tenant.
+type APIKey struct {
+	KeyID      int        `json:"key_id"`
+	TenantID   int        `json:"tenant_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ServiceIDs []int      `json:"service_ids"`
+	CreatedAt  CustomTime `json:"created_at"`
+
+	Hash string `json:"-"`
+}
+
+func (k *APIKey) Validate() error {
+	return validation.ValidateStruct(
+		k,
+		validation.Field(
+			&k.Name,
+			validation.Required,
+			validation.Length(0, 255),
+		),
+		validation.Field(
+			&k.Scopes,
+			validation.Required,
+			validation.Each(validation.In(ScopeAdmin, ScopeRead, ScopeWrite)),
+		),
+	)
+}
+
+// Generate generates a new key, sets its hash and prefix and returns the key.
+func (k *APIKey) Generate() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	k.Hash = HashAPIKey(key)
+	k.Prefix = key[:len(apiKeyPrefix)+6]
+	k.CreatedAt = CustomTime{Time: time.Now()}
+
+	return key, nil
+}
+
+// HashAPIKey returns the hash a key is stored and looked up by.
+// Keys are random, so a fast hash is enough to keep them from being read from the database.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Allows reports whether the key grants scope, admin grants every scope.
+func (k *APIKey) Allows(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// CanWrite reports whether the key grants adding events to the service.
+func (k *APIKey) CanWrite(serviceID int) bool {
+	if k.Allows(ScopeAdmin) {
+		return true
+	}
+	if !k.Allows(ScopeWrite) {
+		return false
+	}
+
+	if len(k.ServiceIDs) == 0 {
+		return true
+	}
+	for _, id := range k.ServiceIDs {
+		if id == serviceID {
+			return true
+		}
+	}
+	return false
+}
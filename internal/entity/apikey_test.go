@@ -0,0 +1,93 @@
+package entity_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKey_Validate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		k       func() *entity.APIKey
+		isValid bool
+	}{
+		{
+			name: "valid",
+			k: func() *entity.APIKey {
+				return entity.TestAPIKey(t)
+			},
+			isValid: true,
+		},
+		{
+			name: "empty name",
+			k: func() *entity.APIKey {
+				k := entity.TestAPIKey(t)
+				k.Name = ""
+				return k
+			},
+			isValid: false,
+		},
+		{
+			name: "no scopes",
+			k: func() *entity.APIKey {
+				k := entity.TestAPIKey(t)
+				k.Scopes = nil
+				return k
+			},
+			isValid: false,
+		},
+		{
+			name: "unknown scope",
+			k: func() *entity.APIKey {
+				k := entity.TestAPIKey(t)
+				k.Scopes = []string{entity.ScopeRead, "delete"}
+				return k
+			},
+			isValid: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.isValid {
+				assert.NoError(t, tc.k().Validate())
+			} else {
+				assert.Error(t, tc.k().Validate())
+			}
+		})
+	}
+}
+
+func TestAPIKey_Generate(t *testing.T) {
+	k := entity.TestAPIKey(t)
+
+	key, err := k.Generate()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, "dwh_"))
+	assert.True(t, strings.HasPrefix(key, k.Prefix))
+	assert.Equal(t, entity.HashAPIKey(key), k.Hash)
+	assert.False(t, k.CreatedAt.IsZero())
+
+	other, err := k.Generate()
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestAPIKey_CanWrite(t *testing.T) {
+	k := entity.TestAPIKey(t)
+	assert.True(t, k.CanWrite(1))
+
+	k.ServiceIDs = []int{2}
+	assert.False(t, k.CanWrite(1))
+	assert.True(t, k.CanWrite(2))
+
+	k.Scopes = []string{entity.ScopeRead}
+	assert.False(t, k.CanWrite(2))
+
+	k.Scopes = []string{entity.ScopeAdmin}
+	assert.True(t, k.CanWrite(1))
+	assert.True(t, k.Allows(entity.ScopeWrite))
+}
@@ -0,0 +1,12 @@
+package entity
+
+import "errors"
+
+var ErrArchived = errors.New("archived")
+
+// Cascade counts the rows removed together with a service or a metric:
+// a service takes its events and their metric values, a metric takes its values.
+type Cascade struct {
+	Events int `json:"events"`
+	Values int `json:"values"`
+}
@@ -1,7 +1,71 @@
 package entity
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrBatchRejected is reported for valid items of an all-or-nothing batch that was not written
+// because of another item.
+var ErrBatchRejected = errors.New("batch rejected")
+
+// ErrInvalidLabels is reported for events with too many labels or with labels that are too long.
+var ErrInvalidLabels = errors.New("invalid labels")
+
+// Event belongs to the service with ServiceID or, if it is not set, with ServiceSlug.
+// Labels keep the attributes of the source that have no column of their own.
 type Event struct {
-	EventID   int        `json:"event_id"`
-	TimeStamp CustomTime `json:"time_stamp"`
-	ServiceID int        `json:"service_id"`
+	EventID     int               `json:"event_id"`
+	TimeStamp   CustomTime        `json:"time_stamp"`
+	ServiceID   int               `json:"service_id"`
+	ServiceSlug string            `json:"service_slug,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// BatchItem is an event submitted in a batch together with its metric values.
+type BatchItem struct {
+	Event   *Event
+	Metrics []*AddMetric
+}
+
+// ValidateTimeStamp checks that the event is not older than maxAge and
+// not further in the future than maxFutureSkew relative to now. A zero limit is not checked.
+func (e *Event) ValidateTimeStamp(now time.Time, maxAge, maxFutureSkew time.Duration) error {
+	if maxAge > 0 && e.TimeStamp.Before(now.Add(-maxAge)) {
+		return fmt.Errorf("time_stamp: must be no older than %s", maxAge)
+	}
+
+	if maxFutureSkew > 0 && e.TimeStamp.After(now.Add(maxFutureSkew)) {
+		return fmt.Errorf("time_stamp: must be no more than %s in the future", maxFutureSkew)
+	}
+
+	return nil
+}
+
+// ValidateLabels checks the number of the labels of the event and the length of their names and values.
+func (e *Event) ValidateLabels() error {
+	if len(e.Labels) > MaxLabels {
+		return fmt.Errorf("%w: must be no more than %d", ErrInvalidLabels, MaxLabels)
+	}
+
+	names := make([]string, 0, len(e.Labels))
+	for name := range e.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		switch {
+		case name == "":
+			return fmt.Errorf("%w: name cannot be blank", ErrInvalidLabels)
+		case len(name) > MaxLabelNameLength:
+			return fmt.Errorf("%w: %.16s...: name must be no longer than %d", ErrInvalidLabels, name, MaxLabelNameLength)
+		case len(e.Labels[name]) > MaxLabelValueLength:
+			return fmt.Errorf("%w: %s: value must be no longer than %d", ErrInvalidLabels, name, MaxLabelValueLength)
+		}
+	}
+
+	return nil
 }
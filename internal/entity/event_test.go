@@ -0,0 +1,129 @@
+package entity_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvent_ValidateTimeStamp(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name          string
+		timeStamp     time.Time
+		maxAge        time.Duration
+		maxFutureSkew time.Duration
+		isValid       bool
+	}{
+		{
+			name:          "now",
+			timeStamp:     now,
+			maxAge:        time.Hour,
+			maxFutureSkew: time.Minute,
+			isValid:       true,
+		},
+		{
+			name:          "within limits",
+			timeStamp:     now.Add(-30 * time.Minute),
+			maxAge:        time.Hour,
+			maxFutureSkew: time.Minute,
+			isValid:       true,
+		},
+		{
+			name:          "too old",
+			timeStamp:     now.Add(-2 * time.Hour),
+			maxAge:        time.Hour,
+			maxFutureSkew: time.Minute,
+			isValid:       false,
+		},
+		{
+			name:          "too far in the future",
+			timeStamp:     now.Add(time.Hour),
+			maxAge:        time.Hour,
+			maxFutureSkew: time.Minute,
+			isValid:       false,
+		},
+		{
+			name:          "no limits",
+			timeStamp:     now.AddDate(-10, 0, 0),
+			maxAge:        0,
+			maxFutureSkew: 0,
+			isValid:       true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := entity.TestEvent(t)
+			e.TimeStamp.Time = tc.timeStamp
+
+			if tc.isValid {
+				assert.NoError(t, e.ValidateTimeStamp(now, tc.maxAge, tc.maxFutureSkew))
+			} else {
+				assert.Error(t, e.ValidateTimeStamp(now, tc.maxAge, tc.maxFutureSkew))
+			}
+		})
+	}
+}
+
+func TestEvent_ValidateLabels(t *testing.T) {
+	tooMany := make(map[string]string, entity.MaxLabels+1)
+	for i := 0; i <= entity.MaxLabels; i++ {
+		tooMany[fmt.Sprintf("label_%d", i)] = "x"
+	}
+
+	testCases := []struct {
+		name    string
+		labels  map[string]string
+		isValid bool
+	}{
+		{
+			name:    "without labels",
+			labels:  nil,
+			isValid: true,
+		},
+		{
+			name:    "valid",
+			labels:  map[string]string{"host": "a", "host.name": "", "region": "eu-west"},
+			isValid: true,
+		},
+		{
+			name:    "blank name",
+			labels:  map[string]string{"": "a"},
+			isValid: false,
+		},
+		{
+			name:    "long name",
+			labels:  map[string]string{strings.Repeat("a", entity.MaxLabelNameLength+1): "a"},
+			isValid: false,
+		},
+		{
+			name:    "long value",
+			labels:  map[string]string{"host": strings.Repeat("a", entity.MaxLabelValueLength+1)},
+			isValid: false,
+		},
+		{
+			name:    "too many labels",
+			labels:  tooMany,
+			isValid: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := entity.TestEvent(t)
+			e.Labels = tc.labels
+
+			if tc.isValid {
+				assert.NoError(t, e.ValidateLabels())
+			} else {
+				assert.ErrorIs(t, e.ValidateLabels(), entity.ErrInvalidLabels)
+			}
+		})
+	}
+}
@@ -14,6 +14,13 @@ func TestService(t *testing.T) *Service {
 	}
 }
 
+func TestTenant(t *testing.T) *Tenant {
+	return &Tenant{
+		Slug:    "TEAM_A",
+		Details: "Notes team",
+	}
+}
+
 func TestMetric(t *testing.T) *Metric {
 	return &Metric{
 		Slug:       "READING_TIME_NOTE_1",
@@ -28,3 +35,38 @@ func TestEvent(t *testing.T) *Event {
 	return &Event{
 		TimeStamp: CustomTime{time.Now()}}
 }
+
+func TestAggregation(t *testing.T) *Aggregation {
+	return &Aggregation{
+		Bucket:    time.Hour,
+		Functions: []string{"count", "avg", "p95", "last"},
+	}
+}
+
+func TestAPIKey(t *testing.T) *APIKey {
+	return &APIKey{
+		Name:       "collector",
+		Scopes:     []string{ScopeRead, ScopeWrite},
+		ServiceIDs: []int{},
+	}
+}
+
+func TestRetentionPolicy(t *testing.T) *RetentionPolicy {
+	return &RetentionPolicy{
+		ServiceID: 1,
+		KeepRaw:   "30d",
+	}
+}
+
+func TestAlertRule(t *testing.T) *AlertRule {
+	return &AlertRule{
+		Name:      "slow reading",
+		ServiceID: 1,
+		MetricID:  1,
+		Function:  "avg",
+		Window:    "5m",
+		Operator:  OpGreater,
+		Threshold: "300ms",
+		For:       "10m",
+	}
+}
@@ -0,0 +1,147 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Label matcher types, a label that is not set matches as an empty value.
+const (
+	MatchEqual     = "="
+	MatchNotEqual  = "!="
+	MatchRegexp    = "=~"
+	MatchNotRegexp = "!~"
+)
+
+// Limits of the labels of an event.
+const (
+	MaxLabels           = 64
+	MaxLabelNameLength  = 128
+	MaxLabelValueLength = 1024
+)
+
+var ErrInvalidLabelMatcher = errors.New("invalid label matcher")
+
+// LabelMatcher selects events by the value of a label.
+// Regular expressions are anchored, so they have to match the whole value.
+type LabelMatcher struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+
+	re *regexp.Regexp
+}
+
+// NewLabelMatcher checks the matcher type and compiles the value of regexp matchers.
+func NewLabelMatcher(name, matchType, value string) (*LabelMatcher, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: missing label name", ErrInvalidLabelMatcher)
+	}
+
+	m := &LabelMatcher{Name: name, Type: matchType, Value: value}
+
+	switch matchType {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidLabelMatcher, name, err)
+		}
+		m.re = re
+	default:
+		return nil, fmt.Errorf("%w: %s: unknown type %q", ErrInvalidLabelMatcher, name, matchType)
+	}
+
+	return m, nil
+}
+
+// ParseLabelMatcher parses a matcher such as host="a", region!=eu or version=~"1\\..*",
+// the value may be given as a quoted Go string.
+func ParseLabelMatcher(s string) (*LabelMatcher, error) {
+	i := strings.IndexAny(s, "=!")
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %q: missing operator", ErrInvalidLabelMatcher, s)
+	}
+
+	name, rest := strings.TrimSpace(s[:i]), s[i:]
+
+	matchType := MatchEqual
+	for _, t := range []string{MatchNotEqual, MatchRegexp, MatchNotRegexp} {
+		if strings.HasPrefix(rest, t) {
+			matchType = t
+		}
+	}
+	if matchType == MatchEqual && !strings.HasPrefix(rest, MatchEqual) {
+		return nil, fmt.Errorf("%w: %q: unknown operator", ErrInvalidLabelMatcher, s)
+	}
+
+	value := strings.TrimSpace(rest[len(matchType):])
+	if strings.HasPrefix(value, `"`) {
+		v, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidLabelMatcher, s, err)
+		}
+		value = v
+	}
+
+	return NewLabelMatcher(name, matchType, value)
+}
+
+// Matches reports whether the labels satisfy the matcher.
+func (m *LabelMatcher) Matches(labels map[string]string) bool {
+	v := labels[m.Name]
+
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	default:
+		return false
+	}
+}
+
+func (m *LabelMatcher) String() string {
+	return m.Name + m.Type + strconv.Quote(m.Value)
+}
+
+// LabelSelector narrows a query to the events whose labels satisfy all Matchers
+// and splits its results by the values of the GroupBy labels.
+type LabelSelector struct {
+	Matchers []*LabelMatcher
+	GroupBy  []string
+}
+
+// Matches reports whether the labels satisfy every matcher, a nil selector matches everything.
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+	if s == nil {
+		return true
+	}
+
+	for _, m := range s.Matchers {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Group returns the values of the GroupBy labels, nil if the results are not grouped.
+func (s *LabelSelector) Group(labels map[string]string) map[string]string {
+	if s == nil || len(s.GroupBy) == 0 {
+		return nil
+	}
+
+	group := make(map[string]string, len(s.GroupBy))
+	for _, name := range s.GroupBy {
+		group[name] = labels[name]
+	}
+	return group
+}
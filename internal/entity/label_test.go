@@ -0,0 +1,118 @@
+package entity_test
+
+import (
+	"testing"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLabelMatcher(t *testing.T) {
+	testCases := []struct {
+		name     string
+		matcher  string
+		expected *entity.LabelMatcher
+		isValid  bool
+	}{
+		{
+			name:     "equal",
+			matcher:  `host="a"`,
+			expected: &entity.LabelMatcher{Name: "host", Type: entity.MatchEqual, Value: "a"},
+			isValid:  true,
+		},
+		{
+			name:     "not equal without quotes",
+			matcher:  "region != eu",
+			expected: &entity.LabelMatcher{Name: "region", Type: entity.MatchNotEqual, Value: "eu"},
+			isValid:  true,
+		},
+		{
+			name:     "regexp",
+			matcher:  `version=~"1\\..*"`,
+			expected: &entity.LabelMatcher{Name: "version", Type: entity.MatchRegexp, Value: `1\..*`},
+			isValid:  true,
+		},
+		{
+			name:     "not regexp",
+			matcher:  `host!~"db-.*"`,
+			expected: &entity.LabelMatcher{Name: "host", Type: entity.MatchNotRegexp, Value: "db-.*"},
+			isValid:  true,
+		},
+		{
+			name:     "empty value",
+			matcher:  `canary=""`,
+			expected: &entity.LabelMatcher{Name: "canary", Type: entity.MatchEqual, Value: ""},
+			isValid:  true,
+		},
+		{
+			name:    "without operator",
+			matcher: "host",
+			isValid: false,
+		},
+		{
+			name:    "unknown operator",
+			matcher: "host!a",
+			isValid: false,
+		},
+		{
+			name:    "without name",
+			matcher: `="a"`,
+			isValid: false,
+		},
+		{
+			name:    "invalid regexp",
+			matcher: `host=~"("`,
+			isValid: false,
+		},
+		{
+			name:    "invalid quoting",
+			matcher: `host="a`,
+			isValid: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := entity.ParseLabelMatcher(tc.matcher)
+			if !tc.isValid {
+				assert.ErrorIs(t, err, entity.ErrInvalidLabelMatcher)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected.Name, m.Name)
+			assert.Equal(t, tc.expected.Type, m.Type)
+			assert.Equal(t, tc.expected.Value, m.Value)
+		})
+	}
+}
+
+func TestLabelSelector(t *testing.T) {
+	parse := func(s string) *entity.LabelMatcher {
+		m, err := entity.ParseLabelMatcher(s)
+		assert.NoError(t, err)
+		return m
+	}
+
+	sel := &entity.LabelSelector{
+		Matchers: []*entity.LabelMatcher{
+			parse(`region=~"eu-.*"`),
+			parse(`host!="db"`),
+			parse(`canary=""`),
+		},
+		GroupBy: []string{"region", "zone"},
+	}
+
+	assert.True(t, sel.Matches(map[string]string{"region": "eu-west", "host": "app"}))
+	assert.False(t, sel.Matches(map[string]string{"region": "us-east", "host": "app"}))
+	assert.False(t, sel.Matches(map[string]string{"region": "eu-west", "host": "db"}))
+	assert.False(t, sel.Matches(map[string]string{"region": "eu-west", "canary": "true"}))
+	// regular expressions are anchored
+	assert.False(t, sel.Matches(map[string]string{"region": "not-eu-west"}))
+
+	assert.Equal(t, map[string]string{"region": "eu-west", "zone": ""}, sel.Group(map[string]string{"region": "eu-west", "host": "app"}))
+
+	var none *entity.LabelSelector
+	assert.True(t, none.Matches(map[string]string{"host": "db"}))
+	assert.Nil(t, none.Group(map[string]string{"host": "db"}))
+}
@@ -0,0 +1,13 @@
+package entity
+
+// LatestValue is the most recent value of a metric of a service.
+// Value holds one of the types returned by Metric.ParseValue.
+type LatestValue struct {
+	ServiceID   int         `json:"service_id"`
+	ServiceSlug string      `json:"service_slug"`
+	MetricID    int         `json:"metric_id"`
+	MetricSlug  string      `json:"metric_slug"`
+	MetricType  string      `json:"metric_type"`
+	TimeStamp   CustomTime  `json:"time_stamp"`
+	Value       interface{} `json:"value"`
+}
@@ -0,0 +1,122 @@
+package entity
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 1000
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListOptions describes a page of services or metrics.
+// Pages are addressed by an opaque cursor pointing after the last item of the previous page.
+type ListOptions struct {
+	Cursor     string
+	Limit      int
+	SortBy     string
+	Order      string
+	SlugPrefix string
+	MetricType string
+	Search     string
+
+	// IncludeArchived lists archived items along with active ones.
+	IncludeArchived bool
+}
+
+// Cursor is the decoded position of a page: the sort key and id of the last item of the previous page.
+type Cursor struct {
+	SortBy string `json:"s"`
+	ID     int    `json:"id"`
+	Slug   string `json:"slug,omitempty"`
+}
+
+// Validate fills in defaults and normalizes the slug prefix the same way slugs are normalized.
+func (o *ListOptions) Validate() error {
+	if o.Limit == 0 {
+		o.Limit = defaultListLimit
+	}
+	if o.SortBy == "" {
+		o.SortBy = "id"
+	}
+	if o.Order == "" {
+		o.Order = "asc"
+	}
+	o.SlugPrefix = NormalizeSlug(o.SlugPrefix)
+
+	if _, err := o.After(); err != nil {
+		return err
+	}
+
+	return validation.ValidateStruct(
+		o,
+		validation.Field(
+			&o.Limit,
+			validation.Min(1),
+			validation.Max(maxListLimit),
+		),
+		validation.Field(
+			&o.SortBy,
+			validation.In("id", "slug"),
+		),
+		validation.Field(
+			&o.Order,
+			validation.In("asc", "desc"),
+		),
+		validation.Field(
+			&o.MetricType,
+			validation.In(toInterfaces(defaultMetricTypes)...),
+		),
+		validation.Field(
+			&o.Search,
+			validation.Length(0, 255),
+		),
+	)
+}
+
+// After decodes the cursor, it returns nil for the first page.
+func (o *ListOptions) After() (*Cursor, error) {
+	if o.Cursor == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &Cursor{}
+	if err := json.Unmarshal(b, c); err != nil || c.SortBy != o.SortBy {
+		return nil, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// NextCursor returns the cursor of the page following the item with the given id and slug.
+func (o *ListOptions) NextCursor(id int, slug string) string {
+	c := &Cursor{
+		SortBy: o.SortBy,
+		ID:     id,
+	}
+	if o.SortBy == "slug" {
+		c.Slug = slug
+	}
+
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func toInterfaces(values []string) []interface{} {
+	res := make([]interface{}, len(values))
+	for i, v := range values {
+		res[i] = v
+	}
+	return res
+}
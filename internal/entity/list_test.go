@@ -0,0 +1,105 @@
+package entity_test
+
+import (
+	"testing"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListOptions_Validate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		o       func() *entity.ListOptions
+		isValid bool
+	}{
+		{
+			name: "defaults",
+			o: func() *entity.ListOptions {
+				return &entity.ListOptions{}
+			},
+			isValid: true,
+		},
+		{
+			name: "all filters",
+			o: func() *entity.ListOptions {
+				return &entity.ListOptions{
+					Limit:      10,
+					SortBy:     "slug",
+					Order:      "desc",
+					SlugPrefix: "note book",
+					MetricType: "DURATION",
+					Search:     "notes",
+				}
+			},
+			isValid: true,
+		},
+		{
+			name: "negative limit",
+			o: func() *entity.ListOptions {
+				return &entity.ListOptions{Limit: -1}
+			},
+			isValid: false,
+		},
+		{
+			name: "large limit",
+			o: func() *entity.ListOptions {
+				return &entity.ListOptions{Limit: 100000}
+			},
+			isValid: false,
+		},
+		{
+			name: "unknown sort",
+			o: func() *entity.ListOptions {
+				return &entity.ListOptions{SortBy: "details"}
+			},
+			isValid: false,
+		},
+		{
+			name: "unknown order",
+			o: func() *entity.ListOptions {
+				return &entity.ListOptions{Order: "up"}
+			},
+			isValid: false,
+		},
+		{
+			name: "unknown metric type",
+			o: func() *entity.ListOptions {
+				return &entity.ListOptions{MetricType: "TIMESTAMP"}
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid cursor",
+			o: func() *entity.ListOptions {
+				return &entity.ListOptions{Cursor: "?#@*&%!"}
+			},
+			isValid: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.isValid {
+				assert.NoError(t, tc.o().Validate())
+			} else {
+				assert.Error(t, tc.o().Validate())
+			}
+		})
+	}
+}
+
+func TestListOptions_NextCursor(t *testing.T) {
+	o := &entity.ListOptions{SortBy: "slug", SlugPrefix: "note book"}
+	assert.NoError(t, o.Validate())
+	assert.Equal(t, "NOTE_BOOK", o.SlugPrefix)
+
+	o.Cursor = o.NextCursor(2, "NOTE_BOOK_2")
+	c, err := o.After()
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cursor{SortBy: "slug", ID: 2, Slug: "NOTE_BOOK_2"}, c)
+
+	o.SortBy = "id"
+	_, err = o.After()
+	assert.ErrorIs(t, err, entity.ErrInvalidCursor)
+}
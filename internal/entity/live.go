@@ -0,0 +1,22 @@
+package entity
+
+// LiveValue is a metric value of a stored event as it is delivered to live subscribers.
+// Value holds one of the types returned by Metric.ParseValue.
+type LiveValue struct {
+	EventID   int         `json:"event_id"`
+	TimeStamp CustomTime  `json:"time_stamp"`
+	ServiceID int         `json:"service_id"`
+	MetricID  int         `json:"metric_id"`
+	Value     interface{} `json:"value"`
+}
+
+// Series identifies the values of a metric of a service.
+type Series struct {
+	ServiceID int
+	MetricID  int
+}
+
+// Series returns the series the value belongs to.
+func (v *LiveValue) Series() Series {
+	return Series{ServiceID: v.ServiceID, MetricID: v.MetricID}
+}
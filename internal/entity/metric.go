@@ -1,34 +1,70 @@
 package entity
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"regexp"
 	"strings"
+	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation"
 )
 
 var defaultMetricTypes = []string{"INT", "FLOAT", "DURATION", "TIMESTAMP_WITH_TIMEZONE", "BOOL", "STRING"}
 
+var (
+	ErrInvalidMetricValue = errors.New("invalid metric value")
+	ErrMetricTypeLocked   = errors.New("metric type cannot be changed while the metric has stored values")
+)
+
 type Metric struct {
 	MetricID   int    `json:"metric_id"`
 	Slug       string `json:"slug"`
 	MetricType string `json:"metric_type"`
 	Details    string `json:"details"`
+
+	Archived   bool        `json:"archived"`
+	ArchivedAt *CustomTime `json:"archived_at,omitempty"`
 }
 
+// AddMetric is a metric value of an event. The metric is referred to by MetricID
+// or, if it is not set, by MetricSlug.
 type AddMetric struct {
-	MetricID    int         `json:"metric_id"`
+	MetricID    int         `json:"metric_id,omitempty"`
+	MetricSlug  string      `json:"metric_slug,omitempty"`
 	MetricValue interface{} `json:"metric_value"`
 }
 
+// MetricError reports which entry of an event's metrics could not be stored and why.
+type MetricError struct {
+	Index      int
+	MetricID   int
+	MetricSlug string
+	Err        error
+}
+
+func (e *MetricError) Error() string {
+	if e.MetricID == 0 && e.MetricSlug != "" {
+		return fmt.Sprintf("metrics[%d]: metric_slug %s: %s", e.Index, e.MetricSlug, e.Err)
+	}
+	return fmt.Sprintf("metrics[%d]: metric_id %d: %s", e.Index, e.MetricID, e.Err)
+}
+
+func (e *MetricError) Unwrap() error {
+	return e.Err
+}
+
+// GetMetric is a value of a metric, Labels hold the values of the labels the values are grouped by.
 type GetMetric struct {
-	TimeStamp CustomTime  `json:"time_stamp"`
-	Value     interface{} `json:"value"`
+	TimeStamp CustomTime        `json:"time_stamp"`
+	Value     interface{}       `json:"value"`
+	Labels    map[string]string `json:"labels,omitempty"`
 }
 
 func (m *Metric) Validate() error {
-	m.Slug = strings.Join(strings.Fields(m.Slug), "_")
-	m.Slug = strings.ToUpper(m.Slug)
+	m.Slug = NormalizeSlug(m.Slug)
 
 	return validation.ValidateStruct(
 		m,
@@ -51,3 +87,100 @@ func (m *Metric) Validate() error {
 		),
 	)
 }
+
+// ParseValue checks that v matches the metric type and converts it to the canonical Go type:
+// int64, float64, time.Duration, time.Time, bool or string.
+func (m *Metric) ParseValue(v interface{}) (interface{}, error) {
+	var (
+		value interface{}
+		ok    bool
+	)
+
+	switch m.MetricType {
+	case "INT":
+		value, ok = parseInt(v)
+	case "FLOAT":
+		value, ok = parseFloat(v)
+	case "DURATION":
+		value, ok = parseDuration(v)
+	case "TIMESTAMP_WITH_TIMEZONE":
+		value, ok = parseTimestamp(v)
+	case "BOOL":
+		value, ok = v.(bool)
+	case "STRING":
+		value, ok = v.(string)
+	default:
+		return nil, errors.New("unknown metric type")
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s expected, got %#v", ErrInvalidMetricValue, m.MetricType, v)
+	}
+	return value, nil
+}
+
+func parseInt(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func parseFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func parseDuration(v interface{}) (time.Duration, bool) {
+	switch v := v.(type) {
+	case time.Duration:
+		return v, true
+	case string:
+		d, err := time.ParseDuration(v)
+		return d, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func parseTimestamp(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case CustomTime:
+		return v.Time, true
+	case *CustomTime:
+		if v == nil {
+			return time.Time{}, false
+		}
+		return v.Time, true
+	case string:
+		t, err := time.Parse(defaultLayout, v)
+		return t, err == nil
+	default:
+		return time.Time{}, false
+	}
+}
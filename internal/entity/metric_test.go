@@ -2,6 +2,7 @@ package entity_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/AnatoliyBr/dwh-service/internal/entity"
 	"github.com/stretchr/testify/assert"
@@ -128,3 +129,126 @@ func TestMetric_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestMetric_ParseValue(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	testCases := []struct {
+		name        string
+		metricType  string
+		metricValue interface{}
+		expected    interface{}
+		isValid     bool
+	}{
+		{
+			name:        "int",
+			metricType:  "INT",
+			metricValue: 25,
+			expected:    int64(25),
+			isValid:     true,
+		},
+		{
+			name:        "int from json number",
+			metricType:  "INT",
+			metricValue: float64(25),
+			expected:    int64(25),
+			isValid:     true,
+		},
+		{
+			name:        "fractional int",
+			metricType:  "INT",
+			metricValue: 25.5,
+			isValid:     false,
+		},
+		{
+			name:        "string as int",
+			metricType:  "INT",
+			metricValue: "25",
+			isValid:     false,
+		},
+		{
+			name:        "float",
+			metricType:  "FLOAT",
+			metricValue: 36.6,
+			expected:    36.6,
+			isValid:     true,
+		},
+		{
+			name:        "bool as float",
+			metricType:  "FLOAT",
+			metricValue: true,
+			isValid:     false,
+		},
+		{
+			name:        "duration",
+			metricType:  "DURATION",
+			metricValue: "1h13m0.5s",
+			expected:    time.Hour + 13*time.Minute + 500*time.Millisecond,
+			isValid:     true,
+		},
+		{
+			name:        "invalid duration",
+			metricType:  "DURATION",
+			metricValue: "an hour",
+			isValid:     false,
+		},
+		{
+			name:        "timestamp with timezone",
+			metricType:  "TIMESTAMP_WITH_TIMEZONE",
+			metricValue: now.Format(time.RFC3339),
+			expected:    now,
+			isValid:     true,
+		},
+		{
+			name:        "invalid timestamp with timezone",
+			metricType:  "TIMESTAMP_WITH_TIMEZONE",
+			metricValue: "2023-10-08",
+			isValid:     false,
+		},
+		{
+			name:        "bool",
+			metricType:  "BOOL",
+			metricValue: true,
+			expected:    true,
+			isValid:     true,
+		},
+		{
+			name:        "string as bool",
+			metricType:  "BOOL",
+			metricValue: "true",
+			isValid:     false,
+		},
+		{
+			name:        "string",
+			metricType:  "STRING",
+			metricValue: "Suspicious activity",
+			expected:    "Suspicious activity",
+			isValid:     true,
+		},
+		{
+			name:        "number as string",
+			metricType:  "STRING",
+			metricValue: 10,
+			isValid:     false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := entity.TestMetric(t)
+			m.MetricType = tc.metricType
+
+			v, err := m.ParseValue(tc.metricValue)
+			if tc.isValid {
+				assert.NoError(t, err)
+				if expected, ok := tc.expected.(time.Time); ok {
+					assert.True(t, expected.Equal(v.(time.Time)))
+				} else {
+					assert.Equal(t, tc.expected, v)
+				}
+			} else {
+				assert.ErrorIs(t, err, entity.ErrInvalidMetricValue)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package entity
+
+import "time"
+
+// Lengths of the time partitions of events, partitions start at midnight UTC.
+const (
+	PartitionDay   = "day"
+	PartitionMonth = "month"
+)
+
+// Partition is a time partition of the events of every tenant and of their metric values, it holds [From, To).
+type Partition struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+func IsPartitionPeriod(period string) bool {
+	return period == PartitionDay || period == PartitionMonth
+}
+
+// PartitionAt returns the partition of the period t belongs to.
+func PartitionAt(t time.Time, period string) *Partition {
+	t = t.UTC()
+
+	if period == PartitionMonth {
+		from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return &Partition{From: from, To: from.AddDate(0, 1, 0)}
+	}
+
+	from := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return &Partition{From: from, To: from.AddDate(0, 0, 1)}
+}
+
+// Contains reports whether t belongs to the partition.
+func (p *Partition) Contains(t time.Time) bool {
+	return !t.Before(p.From) && t.Before(p.To)
+}
+
+// Expired reports whether every event of the partition is older than keep at now.
+func (p *Partition) Expired(now time.Time, keep time.Duration) bool {
+	return !p.To.After(now.Add(-keep))
+}
@@ -0,0 +1,64 @@
+package entity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionAt(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+
+	testCases := []struct {
+		name     string
+		t        time.Time
+		period   string
+		expected *entity.Partition
+	}{
+		{
+			name:   "day",
+			t:      time.Date(2023, 10, 31, 23, 59, 0, 0, time.UTC),
+			period: entity.PartitionDay,
+			expected: &entity.Partition{
+				From: time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "day in UTC",
+			t:      time.Date(2023, 11, 1, 1, 0, 0, 0, msk),
+			period: entity.PartitionDay,
+			expected: &entity.Partition{
+				From: time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "month",
+			t:      time.Date(2023, 12, 15, 12, 0, 0, 0, time.UTC),
+			period: entity.PartitionMonth,
+			expected: &entity.Partition{
+				From: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := entity.PartitionAt(tc.t, tc.period)
+			assert.Equal(t, tc.expected, p)
+			assert.True(t, p.Contains(tc.t))
+			assert.False(t, p.Contains(p.To))
+		})
+	}
+}
+
+func TestPartition_Expired(t *testing.T) {
+	p := entity.PartitionAt(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC), entity.PartitionDay)
+
+	assert.False(t, p.Expired(time.Date(2023, 10, 31, 23, 0, 0, 0, time.UTC), 30*24*time.Hour))
+	assert.True(t, p.Expired(time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC), 30*24*time.Hour))
+}
@@ -0,0 +1,112 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// MinRetention keeps a typo such as "1m" instead of "1d" from purging almost everything.
+const MinRetention = time.Hour
+
+// RetentionPolicy keeps the raw values of a service or of a metric for KeepRaw and their rollups
+// for KeepRollups by resolution such as 1m, older values are purged, unset ones are kept forever.
+// A policy of a service removes its events with all their values, a policy of a metric removes
+// its values only. Exactly one of ServiceID and MetricID is set.
+type RetentionPolicy struct {
+	PolicyID    int               `json:"policy_id"`
+	TenantID    int               `json:"-"`
+	ServiceID   int               `json:"service_id,omitempty"`
+	MetricID    int               `json:"metric_id,omitempty"`
+	KeepRaw     string            `json:"keep_raw,omitempty"`
+	KeepRollups map[string]string `json:"keep_rollups,omitempty"`
+	UpdatedAt   CustomTime        `json:"updated_at"`
+}
+
+func (p *RetentionPolicy) Validate() error {
+	return validation.ValidateStruct(
+		p,
+		validation.Field(
+			&p.ServiceID,
+			validation.By(p.validateTarget),
+		),
+		validation.Field(
+			&p.KeepRaw,
+			validation.By(p.validateKept),
+			validation.By(validateRetention),
+		),
+		validation.Field(
+			&p.KeepRollups,
+			validation.By(validateRollupRetention),
+		),
+	)
+}
+
+// RawRetention returns how long raw values are kept, zero if KeepRaw is invalid.
+func (p *RetentionPolicy) RawRetention() time.Duration {
+	d, _ := ParseBucket(p.KeepRaw)
+	return d
+}
+
+// Expired returns the time before which the raw values are purged at now.
+func (p *RetentionPolicy) Expired(now time.Time) time.Time {
+	return now.Add(-p.RawRetention())
+}
+
+// RollupRetention returns how long the rollups of the resolution are kept, zero if they are kept forever.
+func (p *RetentionPolicy) RollupRetention(res time.Duration) time.Duration {
+	d, _ := ParseBucket(p.KeepRollups[FormatBucket(res)])
+	return d
+}
+
+func (p *RetentionPolicy) validateTarget(interface{}) error {
+	if (p.ServiceID == 0) == (p.MetricID == 0) {
+		return errors.New("exactly one of service_id and metric_id must be set")
+	}
+	return nil
+}
+
+func (p *RetentionPolicy) validateKept(interface{}) error {
+	if p.KeepRaw == "" && len(p.KeepRollups) == 0 {
+		return errors.New("keep_raw or keep_rollups must be set")
+	}
+	return nil
+}
+
+func validateRollupRetention(v interface{}) error {
+	keep, _ := v.(map[string]string)
+	for name, retention := range keep {
+		res, err := ParseBucket(name)
+		if err != nil || !IsRollupResolution(res) || FormatBucket(res) != name {
+			return fmt.Errorf("%s: unknown rollup resolution", name)
+		}
+
+		if retention == "" {
+			return fmt.Errorf("%s: cannot be blank", name)
+		}
+
+		if err := validateRetention(retention); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func validateRetention(v interface{}) error {
+	s, _ := v.(string)
+	if s == "" {
+		return nil
+	}
+
+	d, err := ParseBucket(s)
+	if err != nil {
+		return errors.New("must be a duration such as 12h or 30d")
+	}
+
+	if d < MinRetention {
+		return errors.New("must be no less than 1h")
+	}
+	return nil
+}
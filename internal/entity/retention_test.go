@@ -0,0 +1,130 @@
+package entity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionPolicy_Validate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		p       func() *entity.RetentionPolicy
+		isValid bool
+	}{
+		{
+			name: "valid",
+			p: func() *entity.RetentionPolicy {
+				return entity.TestRetentionPolicy(t)
+			},
+			isValid: true,
+		},
+		{
+			name: "metric",
+			p: func() *entity.RetentionPolicy {
+				p := entity.TestRetentionPolicy(t)
+				p.ServiceID = 0
+				p.MetricID = 1
+				return p
+			},
+			isValid: true,
+		},
+		{
+			name: "service and metric",
+			p: func() *entity.RetentionPolicy {
+				p := entity.TestRetentionPolicy(t)
+				p.MetricID = 1
+				return p
+			},
+			isValid: false,
+		},
+		{
+			name: "no target",
+			p: func() *entity.RetentionPolicy {
+				p := entity.TestRetentionPolicy(t)
+				p.ServiceID = 0
+				return p
+			},
+			isValid: false,
+		},
+		{
+			name: "empty keep_raw",
+			p: func() *entity.RetentionPolicy {
+				p := entity.TestRetentionPolicy(t)
+				p.KeepRaw = ""
+				return p
+			},
+			isValid: false,
+		},
+		{
+			name: "rollups only",
+			p: func() *entity.RetentionPolicy {
+				p := entity.TestRetentionPolicy(t)
+				p.KeepRaw = ""
+				p.KeepRollups = map[string]string{"1m": "7d", "1d": "365d"}
+				return p
+			},
+			isValid: true,
+		},
+		{
+			name: "unknown rollup resolution",
+			p: func() *entity.RetentionPolicy {
+				p := entity.TestRetentionPolicy(t)
+				p.KeepRollups = map[string]string{"5m": "7d"}
+				return p
+			},
+			isValid: false,
+		},
+		{
+			name: "blank rollup retention",
+			p: func() *entity.RetentionPolicy {
+				p := entity.TestRetentionPolicy(t)
+				p.KeepRollups = map[string]string{"1h": ""}
+				return p
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid keep_raw",
+			p: func() *entity.RetentionPolicy {
+				p := entity.TestRetentionPolicy(t)
+				p.KeepRaw = "month"
+				return p
+			},
+			isValid: false,
+		},
+		{
+			name: "too short keep_raw",
+			p: func() *entity.RetentionPolicy {
+				p := entity.TestRetentionPolicy(t)
+				p.KeepRaw = "30m"
+				return p
+			},
+			isValid: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.isValid {
+				assert.NoError(t, tc.p().Validate())
+			} else {
+				assert.Error(t, tc.p().Validate())
+			}
+		})
+	}
+}
+
+func TestRetentionPolicy_Expired(t *testing.T) {
+	p := entity.TestRetentionPolicy(t)
+	now := time.Date(2023, 10, 31, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 30*24*time.Hour, p.RawRetention())
+	assert.Equal(t, time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC), p.Expired(now))
+
+	p.KeepRollups = map[string]string{"1h": "90d"}
+	assert.Equal(t, 90*24*time.Hour, p.RollupRetention(time.Hour))
+	assert.Zero(t, p.RollupRetention(time.Minute))
+}
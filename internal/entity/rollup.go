@@ -0,0 +1,81 @@
+package entity
+
+import (
+	"fmt"
+	"time"
+)
+
+// RollupResolutions are the widths of the rollup buckets from the finest to the coarsest,
+// each resolution is rolled up from the previous one and the finest one from the raw values.
+var RollupResolutions = []time.Duration{time.Minute, time.Hour, 24 * time.Hour}
+
+var (
+	// rollupFunctions are the aggregate functions computed from the count, sum, min, max and last of rollups.
+	rollupFunctions = map[string]bool{"count": true, "sum": true, "min": true, "max": true, "avg": true, "last": true}
+
+	// rollupMetricTypes are the metric types with rollups, their values are rolled up as numbers.
+	rollupMetricTypes = map[string]bool{"INT": true, "FLOAT": true, "DURATION": true}
+)
+
+// IsRollupMetricType reports whether the values of the metric type are rolled up.
+func IsRollupMetricType(metricType string) bool {
+	return rollupMetricTypes[metricType]
+}
+
+// IsRollupResolution reports whether d is one of RollupResolutions.
+func IsRollupResolution(d time.Duration) bool {
+	for _, res := range RollupResolutions {
+		if d == res {
+			return true
+		}
+	}
+	return false
+}
+
+// FinerRollupResolution returns the resolution res is rolled up from, false for the finest one
+// which is rolled up from the raw values.
+func FinerRollupResolution(res time.Duration) (time.Duration, bool) {
+	for i := 1; i < len(RollupResolutions); i++ {
+		if RollupResolutions[i] == res {
+			return RollupResolutions[i-1], true
+		}
+	}
+	return 0, false
+}
+
+// RollupResolution returns the coarsest rollup resolution the aggregation of a metric of the type can be
+// read from over the period p: it divides the bucket, the period starts and ends on its boundaries
+// and every function is computed from rollups. The period is read from rollups as [p[0], p[1]).
+func (a *Aggregation) RollupResolution(metricType string, p [2]*CustomTime) (time.Duration, bool) {
+	if !rollupMetricTypes[metricType] {
+		return 0, false
+	}
+
+	for _, f := range a.Functions {
+		if !rollupFunctions[f] {
+			return 0, false
+		}
+	}
+
+	for i := len(RollupResolutions) - 1; i >= 0; i-- {
+		res := RollupResolutions[i]
+		if a.Bucket%res == 0 && p[0].UnixNano()%int64(res) == 0 && p[1].UnixNano()%int64(res) == 0 {
+			return res, true
+		}
+	}
+	return 0, false
+}
+
+// FormatBucket formats a bucket width the way ParseBucket reads it, e.g. 1m30s, 1m, 1h or 1d.
+func FormatBucket(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
@@ -0,0 +1,101 @@
+package entity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregation_RollupResolution(t *testing.T) {
+	day := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	period := func(from, to time.Time) [2]*entity.CustomTime {
+		return [2]*entity.CustomTime{{Time: from}, {Time: to}}
+	}
+
+	testCases := []struct {
+		name       string
+		metricType string
+		a          *entity.Aggregation
+		p          [2]*entity.CustomTime
+		expected   time.Duration
+		ok         bool
+	}{
+		{
+			name:       "days",
+			metricType: "INT",
+			a:          &entity.Aggregation{Bucket: 24 * time.Hour, Functions: []string{"avg", "max"}},
+			p:          period(day, day.AddDate(0, 1, 0)),
+			expected:   24 * time.Hour,
+			ok:         true,
+		},
+		{
+			name:       "days of a period starting within a day",
+			metricType: "FLOAT",
+			a:          &entity.Aggregation{Bucket: 24 * time.Hour, Functions: []string{"sum"}},
+			p:          period(day.Add(3*time.Hour), day.AddDate(0, 1, 0)),
+			expected:   time.Hour,
+			ok:         true,
+		},
+		{
+			name:       "5 minutes",
+			metricType: "DURATION",
+			a:          &entity.Aggregation{Bucket: 5 * time.Minute, Functions: []string{"count", "last"}},
+			p:          period(day, day.AddDate(0, 0, 1)),
+			expected:   time.Minute,
+			ok:         true,
+		},
+		{
+			name:       "seconds",
+			metricType: "INT",
+			a:          &entity.Aggregation{Bucket: 30 * time.Second, Functions: []string{"count"}},
+			p:          period(day, day.AddDate(0, 0, 1)),
+			ok:         false,
+		},
+		{
+			name:       "period ending within a minute",
+			metricType: "INT",
+			a:          &entity.Aggregation{Bucket: time.Hour, Functions: []string{"count"}},
+			p:          period(day, day.Add(time.Hour-time.Second)),
+			ok:         false,
+		},
+		{
+			name:       "percentile",
+			metricType: "INT",
+			a:          &entity.Aggregation{Bucket: time.Hour, Functions: []string{"avg", "p95"}},
+			p:          period(day, day.AddDate(0, 0, 1)),
+			ok:         false,
+		},
+		{
+			name:       "bool",
+			metricType: "BOOL",
+			a:          &entity.Aggregation{Bucket: time.Hour, Functions: []string{"count"}},
+			p:          period(day, day.AddDate(0, 0, 1)),
+			ok:         false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, ok := tc.a.RollupResolution(tc.metricType, tc.p)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}
+
+func TestFormatBucket(t *testing.T) {
+	for _, s := range []string{"1m", "90m", "1h", "36h", "1d", "30d", "1m30s"} {
+		d, err := entity.ParseBucket(s)
+		assert.NoError(t, err)
+		assert.Equal(t, s, entity.FormatBucket(d))
+	}
+
+	res, ok := entity.FinerRollupResolution(24 * time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, res)
+
+	_, ok = entity.FinerRollupResolution(time.Minute)
+	assert.False(t, ok)
+}
@@ -2,7 +2,6 @@ package entity
 
 import (
 	"regexp"
-	"strings"
 
 	validation "github.com/go-ozzo/ozzo-validation"
 )
@@ -11,11 +10,13 @@ type Service struct {
 	ServiceID int    `json:"service_id"`
 	Slug      string `json:"slug"`
 	Details   string `json:"details"`
+
+	Archived   bool        `json:"archived"`
+	ArchivedAt *CustomTime `json:"archived_at,omitempty"`
 }
 
 func (s *Service) Validate() error {
-	s.Slug = strings.Join(strings.Fields(s.Slug), "_")
-	s.Slug = strings.ToUpper(s.Slug)
+	s.Slug = NormalizeSlug(s.Slug)
 
 	return validation.ValidateStruct(
 		s,
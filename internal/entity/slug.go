@@ -0,0 +1,19 @@
+package entity
+
+import "strings"
+
+// NormalizeSlug upper-cases the slug and joins its words with underscores.
+func NormalizeSlug(slug string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(slug), "_"))
+}
+
+// SanitizeSlug turns a name of an external system into a slug: characters that are not allowed in slugs,
+// e.g. the colons of Prometheus recording rules or the dots and dashes of StatsD names, become underscores.
+func SanitizeSlug(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
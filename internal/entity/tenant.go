@@ -0,0 +1,37 @@
+package entity
+
+import (
+	"regexp"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// DefaultTenantID is the tenant of the requests that name none, everything created before tenants belongs to it.
+const DefaultTenantID = 1
+
+// Tenant is an isolated namespace of services, metrics, events and API keys,
+// slugs are unique within a tenant.
+type Tenant struct {
+	TenantID int    `json:"tenant_id"`
+	Slug     string `json:"slug"`
+	Details  string `json:"details"`
+}
+
+func (t *Tenant) Validate() error {
+	t.Slug = NormalizeSlug(t.Slug)
+
+	return validation.ValidateStruct(
+		t,
+		validation.Field(
+			&t.Slug,
+			validation.Required,
+			validation.Match(regexp.MustCompile(`^[\w]+$`)),
+			validation.Length(0, 255),
+		),
+		validation.Field(
+			&t.Details,
+			validation.Required,
+			validation.Length(0, 255),
+		),
+	)
+}
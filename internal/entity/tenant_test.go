@@ -0,0 +1,70 @@
+package entity_test
+
+import (
+	"testing"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenant_Validate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		t       func() *entity.Tenant
+		isValid bool
+	}{
+		{
+			name: "valid",
+			t: func() *entity.Tenant {
+				return entity.TestTenant(t)
+			},
+			isValid: true,
+		},
+		{
+			name: "mixedcase with whitespace in slug",
+			t: func() *entity.Tenant {
+				tenant := entity.TestTenant(t)
+				tenant.Slug = " team  A "
+				return tenant
+			},
+			isValid: true,
+		},
+		{
+			name: "empty slug",
+			t: func() *entity.Tenant {
+				tenant := entity.TestTenant(t)
+				tenant.Slug = ""
+				return tenant
+			},
+			isValid: false,
+		},
+		{
+			name: "invalid symbols in slug",
+			t: func() *entity.Tenant {
+				tenant := entity.TestTenant(t)
+				tenant.Slug = "TEAM-A/B"
+				return tenant
+			},
+			isValid: false,
+		},
+		{
+			name: "empty details",
+			t: func() *entity.Tenant {
+				tenant := entity.TestTenant(t)
+				tenant.Details = ""
+				return tenant
+			},
+			isValid: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.isValid {
+				assert.NoError(t, tc.t().Validate())
+			} else {
+				assert.Error(t, tc.t().Validate())
+			}
+		})
+	}
+}
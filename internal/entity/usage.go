@@ -0,0 +1,44 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrQuotaExceeded is reported for events that would take a service over its daily quota.
+var ErrQuotaExceeded = errors.New("daily quota exceeded")
+
+// Usage is the number of events and metric values written to a service on a day,
+// days start at midnight UTC.
+type Usage struct {
+	ServiceID    int `json:"service_id"`
+	Events       int `json:"events"`
+	MetricValues int `json:"metric_values"`
+}
+
+// UsageDay returns the day the usage of a write at t is counted for.
+func UsageDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// UsageReset returns how long it is from t until the next day starts and the quotas are reset.
+func UsageReset(t time.Time) time.Duration {
+	return UsageDay(t).AddDate(0, 0, 1).Sub(t)
+}
+
+// CountUsage sums up the events and the metric values of the items by service.
+func CountUsage(items []*BatchItem) map[int]*Usage {
+	usage := make(map[int]*Usage)
+	for _, item := range items {
+		u, ok := usage[item.Event.ServiceID]
+		if !ok {
+			u = &Usage{ServiceID: item.Event.ServiceID}
+			usage[item.Event.ServiceID] = u
+		}
+
+		u.Events++
+		u.MetricValues += len(item.Metrics)
+	}
+	return usage
+}
@@ -0,0 +1,30 @@
+package entity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsageDay(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2023, 10, 26, 1, 30, 0, 0, loc)
+
+	assert.Equal(t, time.Date(2023, 10, 25, 0, 0, 0, 0, time.UTC), entity.UsageDay(now))
+	assert.Equal(t, 90*time.Minute, entity.UsageReset(now))
+}
+
+func TestCountUsage(t *testing.T) {
+	items := []*entity.BatchItem{
+		{Event: &entity.Event{ServiceID: 1}, Metrics: make([]*entity.AddMetric, 2)},
+		{Event: &entity.Event{ServiceID: 2}, Metrics: make([]*entity.AddMetric, 1)},
+		{Event: &entity.Event{ServiceID: 1}, Metrics: make([]*entity.AddMetric, 3)},
+	}
+
+	usage := entity.CountUsage(items)
+	assert.Len(t, usage, 2)
+	assert.Equal(t, &entity.Usage{ServiceID: 1, Events: 2, MetricValues: 5}, usage[1])
+	assert.Equal(t, &entity.Usage{ServiceID: 2, Events: 1, MetricValues: 1}, usage[2])
+}
@@ -1,18 +1,166 @@
 package repository
 
-import "github.com/AnatoliyBr/dwh-service/internal/entity"
+import (
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+// The repositories of services, metrics, events, API keys and retention policies work within one tenant,
+// the default one unless they are scoped to another with ForTenant.
+
+type TenantRepository interface {
+	Create(*entity.Tenant) error
+	FindByID(int) (*entity.Tenant, error)
+	FindBySlug(string) (*entity.Tenant, error)
+	List() ([]*entity.Tenant, error)
+}
 
 type ServiceRepository interface {
+	ForTenant(int) ServiceRepository
 	Create(*entity.Service) error
 	FindByID(int) (*entity.Service, error)
+	FindBySlug(string) (*entity.Service, error)
+	List(*entity.ListOptions) ([]*entity.Service, error)
+	Update(*entity.Service) error
+	Archive(int) error
+	Delete(int) error
 }
 
 type MetricRepository interface {
+	ForTenant(int) MetricRepository
 	Create(*entity.Metric) error
 	FindByID(int) (*entity.Metric, error)
+	FindBySlug(string) (*entity.Metric, error)
+	List(*entity.ListOptions) ([]*entity.Metric, error)
+	Update(*entity.Metric) error
+	Archive(int) error
+	Delete(int) error
 }
+
 type EventRepository interface {
+	ForTenant(int) EventRepository
 	Create(*entity.Event) error
 	AddMetricsToEvent(int, []*entity.AddMetric) error
-	GetMetricValuesForTimePeriod(int, [2]*entity.CustomTime, *entity.Metric) (interface{}, error)
+	CreateWithMetrics(*entity.Event, []*entity.AddMetric) error
+	CreateBatch([]*entity.BatchItem) error
+	GetMetricValuesForTimePeriod(int, [2]*entity.CustomTime, *entity.Metric, *entity.LabelSelector) (interface{}, error)
+	AggregateMetricValuesForTimePeriod(int, [2]*entity.CustomTime, *entity.Metric, *entity.Aggregation, *entity.LabelSelector) ([]*entity.AggregatedMetric, error)
+	LatestMetricValues([]int, []int) ([]*entity.LatestValue, error)
+	ServiceCascade(int) (*entity.Cascade, error)
+	MetricCascade(int) (*entity.Cascade, error)
+
+	// PurgeService deletes at most limit of the oldest events of the service stored before the time
+	// together with their values, PurgeMetric deletes the values of the metric the same way.
+	PurgeService(int, time.Time, int) (*entity.Cascade, error)
+	PurgeMetric(int, time.Time, int) (*entity.Cascade, error)
+
+	// Usage returns the events and the metric values written to the services on a day,
+	// every write of events counts towards the usage of the day it is made on.
+	Usage(time.Time, []int) ([]*entity.Usage, error)
+}
+
+// ValueNotifier relays the values of stored events between the replicas of the app.
+type ValueNotifier interface {
+	Notify([]*entity.LiveValue) error
+	Listen(func([]*entity.LiveValue)) error
+	Close() error
+}
+
+// APIKeyRepository looks keys up by hash in every tenant, the tenant of a request is only known
+// once its key is found.
+type APIKeyRepository interface {
+	ForTenant(int) APIKeyRepository
+	Create(*entity.APIKey) error
+	FindByHash(string) (*entity.APIKey, error)
+	List() ([]*entity.APIKey, error)
+	Delete(int) error
+}
+
+// RetentionRepository keeps at most one policy per service and per metric, Save replaces the policy
+// of the target if there is one. All lists the policies of every tenant for the purge worker.
+type RetentionRepository interface {
+	ForTenant(int) RetentionRepository
+	Save(*entity.RetentionPolicy) error
+	FindByService(int) (*entity.RetentionPolicy, error)
+	FindByMetric(int) (*entity.RetentionPolicy, error)
+	List() ([]*entity.RetentionPolicy, error)
+	All() ([]*entity.RetentionPolicy, error)
+	Delete(int) error
+}
+
+// RollupRepository keeps the values of the metrics with entity.IsRollupMetricType aggregated by every
+// entity.RollupResolutions, the rollups of a resolution are complete before its watermark.
+// Watermark and Rollup work across tenants.
+type RollupRepository interface {
+	ForTenant(int) RollupRepository
+
+	// Watermark returns the watermark of the resolution, before the first rollup it is the time stamp
+	// of the earliest event and the zero time if there are none.
+	Watermark(time.Duration) (time.Time, error)
+
+	// Rollup aggregates the values stored in [from, to) into the rollups of the resolution,
+	// from the raw values for the finest resolution and from the previous resolution otherwise,
+	// and moves the watermark of the resolution to the end. It reports the number of rollups written.
+	Rollup(time.Duration, time.Time, time.Time) (int, error)
+
+	// RollupLate rolls up again at most limit minutes of services that received values behind the watermark
+	// of the finest resolution and the buckets of the coarser resolutions they belong to that are behind their
+	// watermarks. It reports the number of minutes, the events repository records them as values are written.
+	RollupLate(int) (int, error)
+
+	// Late reports whether the service received values in [p[0], p[1]) that are not rolled up yet
+	// although they are behind the watermark of the finest resolution.
+	Late(int, [2]*entity.CustomTime) (bool, error)
+
+	// Aggregate reads the aggregation of the values of [p[0], p[1]) from the rollups of the resolution.
+	Aggregate(int, [2]*entity.CustomTime, *entity.Metric, *entity.Aggregation, time.Duration) ([]*entity.AggregatedMetric, error)
+
+	// PurgeService and PurgeMetric delete at most limit rollups of the resolution of the service
+	// or the metric with buckets starting before the time and report their number.
+	PurgeService(time.Duration, int, time.Time, int) (int, error)
+	PurgeMetric(time.Duration, int, time.Time, int) (int, error)
+}
+
+// PartitionRepository manages the time partitions of events and of their metric values, which are shared
+// by every tenant. Events of a time without a partition are kept in a default partition.
+type PartitionRepository interface {
+	// List returns the partitions ordered by time.
+	List() ([]*entity.Partition, error)
+
+	// Create adds the partition and moves the events of its time out of the default partition.
+	Create(*entity.Partition) error
+
+	// Drop removes the partition with its events and their values.
+	Drop(*entity.Partition) error
+
+	// PurgeDefault deletes at most limit of the oldest events of the default partition stamped before
+	// the time with their values and returns their number.
+	PurgeDefault(time.Time, int) (int, error)
+}
+
+// AlertRepository keeps the alert rules with the state of their last evaluation and the history
+// of its changes. All lists the rules of every tenant for the alert evaluator.
+type AlertRepository interface {
+	ForTenant(int) AlertRepository
+	Create(*entity.AlertRule) error
+
+	// Update replaces the rule and resets its state.
+	Update(*entity.AlertRule) error
+	FindByID(int) (*entity.AlertRule, error)
+	List() ([]*entity.AlertRule, error)
+	All() ([]*entity.AlertRule, error)
+	Delete(int) error
+
+	// FindState returns the state of the rule, ok if it has not been evaluated yet.
+	FindState(int) (*entity.AlertState, error)
+
+	// SaveState stores the state of the rule and appends the transition to its history unless it is nil.
+	SaveState(*entity.AlertState, *entity.AlertTransition) error
+
+	// ListActive returns the pending and firing states of the rules.
+	ListActive() ([]*entity.AlertState, error)
+
+	// History returns at most limit latest transitions of the rule, newest first.
+	History(int, int) ([]*entity.AlertTransition, error)
 }
@@ -0,0 +1,121 @@
+package sqlrepository
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+)
+
+// aggregateFunctionExpression renders the SQL aggregate for function f over the value expression v.
+// Functions are expected to be validated against the metric type beforehand.
+func aggregateFunctionExpression(f, v string) string {
+	switch f {
+	case "count":
+		return "count(*)"
+	case "count_distinct":
+		return fmt.Sprintf("count(DISTINCT %s)", v)
+	case "true_ratio":
+		return fmt.Sprintf("avg(CASE WHEN %s THEN 1.0 ELSE 0.0 END)", v)
+	case "first":
+		return fmt.Sprintf("(array_agg(%s ORDER BY e.time_stamp))[1]", v)
+	case "last":
+		return fmt.Sprintf("(array_agg(%s ORDER BY e.time_stamp DESC))[1]", v)
+	case "p50", "p95", "p99":
+		return fmt.Sprintf("percentile_cont(%g) WITHIN GROUP (ORDER BY %s)", entity.Percentiles[f], v)
+	default:
+		return fmt.Sprintf("%s(%s)", f, v)
+	}
+}
+
+// aggregateValue converts the textual result of an aggregate function to the value returned to clients.
+func aggregateValue(metricType, f string, v sql.NullString) (interface{}, error) {
+	if !v.Valid {
+		return nil, nil
+	}
+
+	switch f {
+	case "count", "count_distinct":
+		return strconv.Atoi(v.String)
+	case "true_ratio":
+		return strconv.ParseFloat(v.String, 64)
+	}
+
+	switch metricType {
+	case "INT":
+		if f == "avg" || entity.Percentiles[f] > 0 {
+			return strconv.ParseFloat(v.String, 64)
+		}
+		return strconv.ParseInt(v.String, 10, 64)
+	case "FLOAT":
+		return strconv.ParseFloat(v.String, 64)
+	case "DURATION":
+		seconds, err := strconv.ParseFloat(v.String, 64)
+		if err != nil {
+			return nil, err
+		}
+		return time.Duration(seconds * float64(time.Second)).String(), nil
+	case "TIMESTAMP_WITH_TIMEZONE":
+		t, err := time.Parse(time.RFC3339Nano, v.String)
+		if err != nil {
+			return nil, err
+		}
+		return &entity.CustomTime{Time: t}, nil
+	case "BOOL":
+		return strconv.ParseBool(v.String)
+	default:
+		return v.String, nil
+	}
+}
+
+// scanAggregatedMetrics reads the buckets of an aggregation that selects the bucket, the group columns of sel
+// and the functions of a, no buckets are reported as repository.ErrRecordNotFound.
+func scanAggregatedMetrics(rows *sql.Rows, metricType string, a *entity.Aggregation, sel *entity.LabelSelector) ([]*entity.AggregatedMetric, error) {
+	buckets := make([]*entity.AggregatedMetric, 0)
+	groupDest, labels := scanLabelGroup(sel)
+
+	for rows.Next() {
+		var t time.Time
+		raw := make([]sql.NullString, len(a.Functions))
+
+		dest := make([]interface{}, 0, len(groupDest)+len(raw)+1)
+		dest = append(dest, &t)
+		dest = append(dest, groupDest...)
+		for i := range raw {
+			dest = append(dest, &raw[i])
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		b := &entity.AggregatedMetric{
+			TimeStamp: entity.CustomTime{Time: t.UTC()},
+			Values:    make(map[string]interface{}, len(a.Functions)),
+			Labels:    labels(),
+		}
+
+		for i, f := range a.Functions {
+			value, err := aggregateValue(metricType, f, raw[i])
+			if err != nil {
+				return nil, err
+			}
+			b.Values[f] = value
+		}
+
+		buckets = append(buckets, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(buckets) > 0 {
+		return buckets, nil
+	} else {
+		return nil, repository.ErrRecordNotFound
+	}
+}
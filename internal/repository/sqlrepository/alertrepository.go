@@ -0,0 +1,298 @@
+package sqlrepository
+
+import (
+	"database/sql"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+)
+
+const alertRuleColumns = "rule_id, tenant_id, rule_name, service_id, metric_id, function, time_window, operator, threshold, for_duration, updated_at"
+
+type AlertRepository struct {
+	db       *sql.DB
+	tenantID int
+}
+
+func NewAlertRepository(db *sql.DB) *AlertRepository {
+	return &AlertRepository{
+		db:       db,
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *AlertRepository) ForTenant(tenantID int) repository.AlertRepository {
+	return &AlertRepository{
+		db:       r.db,
+		tenantID: tenantID,
+	}
+}
+
+func (r *AlertRepository) Create(a *entity.AlertRule) error {
+	return translateError(r.db.QueryRow(
+		`INSERT INTO alert_rules (tenant_id, rule_name, service_id, metric_id, function, time_window, operator, threshold, for_duration)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING rule_id, tenant_id, updated_at`,
+		r.tenantID,
+		a.Name,
+		a.ServiceID,
+		a.MetricID,
+		a.Function,
+		a.Window,
+		a.Operator,
+		a.Threshold,
+		a.For,
+	).Scan(&a.RuleID, &a.TenantID, &a.UpdatedAt.Time))
+}
+
+func (r *AlertRepository) Update(a *entity.AlertRule) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		`UPDATE alert_rules SET rule_name = $3, service_id = $4, metric_id = $5, function = $6, time_window = $7,
+		operator = $8, threshold = $9, for_duration = $10, updated_at = now()
+		WHERE rule_id = $1 AND tenant_id = $2 RETURNING tenant_id, updated_at`,
+		a.RuleID,
+		r.tenantID,
+		a.Name,
+		a.ServiceID,
+		a.MetricID,
+		a.Function,
+		a.Window,
+		a.Operator,
+		a.Threshold,
+		a.For,
+	).Scan(&a.TenantID, &a.UpdatedAt.Time)
+	if err == sql.ErrNoRows {
+		return repository.ErrRecordNotFound
+	}
+	if err != nil {
+		return translateError(err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM alert_states WHERE rule_id = $1", a.RuleID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *AlertRepository) FindByID(ruleID int) (*entity.AlertRule, error) {
+	a, err := scanAlertRule(r.db.QueryRow(
+		"SELECT "+alertRuleColumns+" FROM alert_rules WHERE rule_id = $1 AND tenant_id = $2",
+		ruleID,
+		r.tenantID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrRecordNotFound
+	}
+	return a, err
+}
+
+func (r *AlertRepository) List() ([]*entity.AlertRule, error) {
+	return r.list("WHERE tenant_id = $1", r.tenantID)
+}
+
+// All lists the rules of every tenant.
+func (r *AlertRepository) All() ([]*entity.AlertRule, error) {
+	return r.list("")
+}
+
+func (r *AlertRepository) list(where string, args ...interface{}) ([]*entity.AlertRule, error) {
+	rows, err := r.db.Query(
+		"SELECT "+alertRuleColumns+" FROM alert_rules "+where+" ORDER BY rule_id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make([]*entity.AlertRule, 0)
+	for rows.Next() {
+		a, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, a)
+	}
+
+	return rules, rows.Err()
+}
+
+func (r *AlertRepository) Delete(ruleID int) error {
+	return execOne(r.db, "DELETE FROM alert_rules WHERE rule_id = $1 AND tenant_id = $2", ruleID, r.tenantID)
+}
+
+func (r *AlertRepository) FindState(ruleID int) (*entity.AlertState, error) {
+	var exists bool
+	if err := r.db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM alert_rules WHERE rule_id = $1 AND tenant_id = $2)",
+		ruleID,
+		r.tenantID,
+	).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, repository.ErrRecordNotFound
+	}
+
+	s, err := scanAlertState(r.db.QueryRow(
+		"SELECT rule_id, state, value, active_at, changed_at, evaluated_at FROM alert_states WHERE rule_id = $1",
+		ruleID,
+	))
+	if err == sql.ErrNoRows {
+		return &entity.AlertState{RuleID: ruleID, State: entity.AlertOK}, nil
+	}
+	return s, err
+}
+
+func (r *AlertRepository) SaveState(s *entity.AlertState, t *entity.AlertTransition) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var activeAt sql.NullTime
+	if s.ActiveAt != nil {
+		activeAt = sql.NullTime{Time: s.ActiveAt.Time, Valid: true}
+	}
+
+	// the rule may have been deleted since it was evaluated
+	res, err := tx.Exec(
+		`INSERT INTO alert_states (rule_id, state, value, active_at, changed_at, evaluated_at)
+		SELECT rule_id, $3, $4, $5, $6, $7 FROM alert_rules WHERE rule_id = $1 AND tenant_id = $2
+		ON CONFLICT (rule_id) DO UPDATE SET state = EXCLUDED.state, value = EXCLUDED.value, active_at = EXCLUDED.active_at,
+		changed_at = EXCLUDED.changed_at, evaluated_at = EXCLUDED.evaluated_at`,
+		s.RuleID,
+		r.tenantID,
+		s.State,
+		s.Value,
+		activeAt,
+		s.ChangedAt.Time,
+		s.EvaluatedAt.Time,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrRecordNotFound
+	}
+
+	if t != nil {
+		if _, err := tx.Exec(
+			"INSERT INTO alert_history (rule_id, state_from, state_to, value, time_stamp) VALUES ($1, $2, $3, $4, $5)",
+			t.RuleID,
+			t.From,
+			t.To,
+			t.Value,
+			t.TimeStamp.Time,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *AlertRepository) ListActive() ([]*entity.AlertState, error) {
+	rows, err := r.db.Query(
+		`SELECT s.rule_id, s.state, s.value, s.active_at, s.changed_at, s.evaluated_at
+		FROM alert_states s JOIN alert_rules a ON a.rule_id = s.rule_id
+		WHERE a.tenant_id = $1 AND s.state IN ($2, $3) ORDER BY s.active_at, s.rule_id`,
+		r.tenantID,
+		entity.AlertPending,
+		entity.AlertFiring,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make([]*entity.AlertState, 0)
+	for rows.Next() {
+		s, err := scanAlertState(rows)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, s)
+	}
+
+	return states, rows.Err()
+}
+
+func (r *AlertRepository) History(ruleID, limit int) ([]*entity.AlertTransition, error) {
+	rows, err := r.db.Query(
+		`SELECT h.rule_id, h.state_from, h.state_to, h.value, h.time_stamp
+		FROM alert_history h JOIN alert_rules a ON a.rule_id = h.rule_id
+		WHERE h.rule_id = $1 AND a.tenant_id = $2 ORDER BY h.time_stamp DESC, h.transition_id DESC LIMIT $3`,
+		ruleID,
+		r.tenantID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := make([]*entity.AlertTransition, 0)
+	for rows.Next() {
+		t := &entity.AlertTransition{}
+		if err := rows.Scan(&t.RuleID, &t.From, &t.To, &t.Value, &t.TimeStamp.Time); err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, t)
+	}
+
+	return transitions, rows.Err()
+}
+
+func scanAlertRule(row interface{ Scan(...interface{}) error }) (*entity.AlertRule, error) {
+	a := &entity.AlertRule{}
+	if err := row.Scan(
+		&a.RuleID,
+		&a.TenantID,
+		&a.Name,
+		&a.ServiceID,
+		&a.MetricID,
+		&a.Function,
+		&a.Window,
+		&a.Operator,
+		&a.Threshold,
+		&a.For,
+		&a.UpdatedAt.Time,
+	); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func scanAlertState(row interface{ Scan(...interface{}) error }) (*entity.AlertState, error) {
+	s := &entity.AlertState{}
+	var activeAt sql.NullTime
+
+	if err := row.Scan(
+		&s.RuleID,
+		&s.State,
+		&s.Value,
+		&activeAt,
+		&s.ChangedAt.Time,
+		&s.EvaluatedAt.Time,
+	); err != nil {
+		return nil, err
+	}
+
+	if activeAt.Valid {
+		s.ActiveAt = &entity.CustomTime{Time: activeAt.Time}
+	}
+	return s, nil
+}
@@ -0,0 +1,106 @@
+package sqlrepository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/sqlrepository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertRepository_Update(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("alert_rules", "services", "metrics")
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	sqlrepository.NewServiceRepository(db).Create(s)
+	sqlrepository.NewMetricRepository(db).Create(m)
+
+	ar := sqlrepository.NewAlertRepository(db)
+	other := ar.ForTenant(entity.DefaultTenantID + 1)
+
+	a := entity.TestAlertRule(t)
+	a.ServiceID = s.ServiceID
+	a.MetricID = m.MetricID
+	assert.NoError(t, ar.Create(a))
+	assert.NotZero(t, a.RuleID)
+
+	now := time.Now()
+	st, err := ar.FindState(a.RuleID)
+	assert.NoError(t, err)
+	assert.Equal(t, entity.AlertOK, st.State)
+	assert.NoError(t, ar.SaveState(st, st.Next(a, "350ms", true, now)))
+
+	a.Threshold = "500ms"
+	assert.EqualError(t, other.Update(a), repository.ErrRecordNotFound.Error())
+	assert.NoError(t, ar.Update(a))
+
+	found, err := ar.FindByID(a.RuleID)
+	assert.NoError(t, err)
+	assert.Equal(t, "500ms", found.Threshold)
+	assert.Equal(t, "10m", found.For)
+
+	// the state of an updated rule is reset
+	st, err = ar.FindState(a.RuleID)
+	assert.NoError(t, err)
+	assert.Equal(t, entity.AlertOK, st.State)
+
+	_, err = other.FindState(a.RuleID)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	rules, err := ar.All()
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+
+	a.MetricID++
+	assert.ErrorIs(t, ar.Update(a), repository.ErrRecordNotFound)
+}
+
+func TestAlertRepository_SaveState(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("alert_rules", "services", "metrics")
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	sr := sqlrepository.NewServiceRepository(db)
+	sr.Create(s)
+	sqlrepository.NewMetricRepository(db).Create(m)
+
+	ar := sqlrepository.NewAlertRepository(db)
+
+	a := entity.TestAlertRule(t)
+	a.ServiceID = s.ServiceID
+	a.MetricID = m.MetricID
+	ar.Create(a)
+
+	now := time.Now()
+	st, _ := ar.FindState(a.RuleID)
+	assert.NoError(t, ar.SaveState(st, st.Next(a, "350ms", true, now)))
+	assert.NoError(t, ar.SaveState(st, st.Next(a, "400ms", true, now.Add(time.Minute))))
+	assert.NoError(t, ar.SaveState(st, st.Next(a, "400ms", true, now.Add(10*time.Minute))))
+
+	active, err := ar.ListActive()
+	assert.NoError(t, err)
+	if assert.Len(t, active, 1) {
+		assert.Equal(t, entity.AlertFiring, active[0].State)
+		assert.NotNil(t, active[0].ActiveAt)
+	}
+
+	history, err := ar.History(a.RuleID, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, entity.AlertFiring, history[0].To)
+		assert.Equal(t, entity.AlertPending, history[1].To)
+	}
+
+	// the rules of a deleted service are deleted with their state and history
+	assert.NoError(t, sr.Delete(s.ServiceID))
+	assert.EqualError(t, ar.SaveState(st, nil), repository.ErrRecordNotFound.Error())
+
+	active, err = ar.ListActive()
+	assert.NoError(t, err)
+	assert.Empty(t, active)
+}
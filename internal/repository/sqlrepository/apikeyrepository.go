@@ -0,0 +1,114 @@
+package sqlrepository
+
+import (
+	"database/sql"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/lib/pq"
+)
+
+type APIKeyRepository struct {
+	db       *sql.DB
+	tenantID int
+}
+
+func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
+	return &APIKeyRepository{
+		db:       db,
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *APIKeyRepository) ForTenant(tenantID int) repository.APIKeyRepository {
+	return &APIKeyRepository{
+		db:       r.db,
+		tenantID: tenantID,
+	}
+}
+
+func (r *APIKeyRepository) Create(k *entity.APIKey) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+
+	return r.db.QueryRow(
+		"INSERT INTO api_keys (tenant_id, name, prefix, key_hash, scopes, service_ids) VALUES ($1, $2, $3, $4, $5, $6) RETURNING key_id, tenant_id, created_at",
+		r.tenantID,
+		k.Name,
+		k.Prefix,
+		k.Hash,
+		pq.Array(k.Scopes),
+		pq.Array(serviceIDsArg(k.ServiceIDs)),
+	).Scan(&k.KeyID, &k.TenantID, &k.CreatedAt.Time)
+}
+
+// FindByHash looks the key up in every tenant, the key tells the tenant of the request.
+func (r *APIKeyRepository) FindByHash(hash string) (*entity.APIKey, error) {
+	k, err := scanAPIKey(r.db.QueryRow(
+		"SELECT key_id, tenant_id, name, prefix, key_hash, scopes, service_ids, created_at FROM api_keys WHERE key_hash = $1",
+		hash,
+	))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrRecordNotFound
+	}
+	return k, err
+}
+
+func (r *APIKeyRepository) List() ([]*entity.APIKey, error) {
+	rows, err := r.db.Query(
+		"SELECT key_id, tenant_id, name, prefix, key_hash, scopes, service_ids, created_at FROM api_keys WHERE tenant_id = $1 ORDER BY key_id",
+		r.tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*entity.APIKey, 0)
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+func (r *APIKeyRepository) Delete(keyID int) error {
+	return execOne(r.db, "DELETE FROM api_keys WHERE key_id = $1 AND tenant_id = $2", keyID, r.tenantID)
+}
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*entity.APIKey, error) {
+	k := &entity.APIKey{}
+	var serviceIDs pq.Int64Array
+
+	if err := row.Scan(
+		&k.KeyID,
+		&k.TenantID,
+		&k.Name,
+		&k.Prefix,
+		&k.Hash,
+		pq.Array(&k.Scopes),
+		&serviceIDs,
+		&k.CreatedAt.Time,
+	); err != nil {
+		return nil, err
+	}
+
+	k.ServiceIDs = make([]int, len(serviceIDs))
+	for i, id := range serviceIDs {
+		k.ServiceIDs[i] = int(id)
+	}
+	return k, nil
+}
+
+func serviceIDsArg(ids []int) []int64 {
+	arg := make([]int64, len(ids))
+	for i, id := range ids {
+		arg[i] = int64(id)
+	}
+	return arg
+}
@@ -0,0 +1,61 @@
+package sqlrepository_test
+
+import (
+	"testing"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/sqlrepository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyRepository_Create(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("api_keys")
+
+	k := entity.TestAPIKey(t)
+	k.Generate()
+	kr := sqlrepository.NewAPIKeyRepository(db)
+
+	assert.NoError(t, kr.Create(k))
+	assert.NotZero(t, k.KeyID)
+}
+
+func TestAPIKeyRepository_FindByHash(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("api_keys")
+
+	k1 := entity.TestAPIKey(t)
+	k1.ServiceIDs = []int{1, 2}
+	key, _ := k1.Generate()
+	kr := sqlrepository.NewAPIKeyRepository(db)
+
+	kr.Create(k1)
+
+	_, err := kr.FindByHash(entity.HashAPIKey(key + "x"))
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	k2, err := kr.FindByHash(entity.HashAPIKey(key))
+	assert.NoError(t, err)
+	assert.Equal(t, k1.KeyID, k2.KeyID)
+	assert.Equal(t, k1.Scopes, k2.Scopes)
+	assert.Equal(t, k1.ServiceIDs, k2.ServiceIDs)
+}
+
+func TestAPIKeyRepository_Delete(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("api_keys")
+
+	k := entity.TestAPIKey(t)
+	k.Generate()
+	kr := sqlrepository.NewAPIKeyRepository(db)
+
+	kr.Create(k)
+
+	assert.NoError(t, kr.Delete(k.KeyID))
+	assert.EqualError(t, kr.Delete(k.KeyID), repository.ErrRecordNotFound.Error())
+
+	keys, err := kr.List()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
@@ -0,0 +1,35 @@
+package sqlrepository
+
+import (
+	"database/sql"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+)
+
+// archivedAt converts a nullable archived_at column.
+func archivedAt(t sql.NullTime) *entity.CustomTime {
+	if !t.Valid {
+		return nil
+	}
+	return &entity.CustomTime{Time: t.Time}
+}
+
+// execOne executes a statement addressing a single row by id within a tenant
+// and reports repository.ErrRecordNotFound if there is no such row.
+func execOne(db *sql.DB, query string, id, tenantID int) error {
+	res, err := db.Exec(query, id, tenantID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repository.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package sqlrepository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/lib/pq"
+)
+
+const (
+	foreignKeyViolation = "23503"
+)
+
+// translateError maps foreign key violations, e.g. an unknown service_id or metric_id, to repository.ErrRecordNotFound.
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return fmt.Errorf("%w: %s", repository.ErrRecordNotFound, pqErr.Detail)
+	}
+	return err
+}
@@ -2,61 +2,367 @@ package sqlrepository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
-	"strconv"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/AnatoliyBr/dwh-service/internal/entity"
 	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/lib/pq"
 )
 
-const (
-	defaultLayout = time.RFC3339
-)
+// batchRows limits the rows of one multi-row INSERT to stay below 65535 bind parameters.
+const batchRows = 1000
 
+// EventRepository stores events in the tenant of their services, the service of an event of another tenant
+// is reported as not found by the foreign key of events and the metrics of other tenants are not accepted.
 type EventRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	tenantID int
 }
 
 func NewEventRepository(db *sql.DB) *EventRepository {
 	return &EventRepository{
-		db: db,
+		db:       db,
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *EventRepository) ForTenant(tenantID int) repository.EventRepository {
+	return &EventRepository{
+		db:       r.db,
+		tenantID: tenantID,
 	}
 }
 
 func (r *EventRepository) Create(e *entity.Event) error {
-	return r.db.QueryRow(
-		"INSERT INTO events (time_stamp, service_id) VALUES ($1, $2) RETURNING event_id",
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var eventID int
+	if err := tx.QueryRow(
+		"INSERT INTO events (tenant_id, time_stamp, service_id, labels) VALUES ($1, $2, $3, $4) RETURNING event_id",
+		r.tenantID,
 		e.TimeStamp.Time,
 		e.ServiceID,
-	).Scan(&e.EventID)
+		labelsArg(e.Labels),
+	).Scan(&eventID); err != nil {
+		return err
+	}
+
+	if err := addUsage(tx, entity.CountUsage([]*entity.BatchItem{{Event: e}})); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	e.EventID = eventID
+	return nil
 }
 
 func (r *EventRepository) AddMetricsToEvent(eventID int, metrics []*entity.AddMetric) error {
-	stmt, err := r.db.Prepare(
-		"INSERT INTO events_with_metrics (event_id, metric_id, metric_value) VALUES ($1, $2, $3)")
+	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	for _, m := range metrics {
-		_, err := stmt.Exec(eventID, m.MetricID, m.MetricValue)
-		if err != nil {
+	var serviceID int
+	var timeStamp time.Time
+	if err := tx.QueryRow(
+		"SELECT service_id, time_stamp FROM events WHERE event_id = $1 AND tenant_id = $2",
+		eventID,
+		r.tenantID,
+	).Scan(&serviceID, &timeStamp); err != nil {
+		if err == sql.ErrNoRows {
+			return repository.ErrRecordNotFound
+		}
+		return err
+	}
+
+	if err := r.addMetrics(tx, eventID, timeStamp, metrics); err != nil {
+		return err
+	}
+
+	if err := addUsage(tx, map[int]*entity.Usage{serviceID: {ServiceID: serviceID, MetricValues: len(metrics)}}); err != nil {
+		return err
+	}
+
+	if len(metrics) > 0 {
+		if err := markLateValues(tx, map[int][]time.Time{serviceID: {timeStamp}}); err != nil {
 			return err
 		}
 	}
+
+	return tx.Commit()
+}
+
+func (r *EventRepository) CreateWithMetrics(e *entity.Event, metrics []*entity.AddMetric) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var eventID int
+	if err := tx.QueryRow(
+		"INSERT INTO events (tenant_id, time_stamp, service_id, labels) VALUES ($1, $2, $3, $4) RETURNING event_id",
+		r.tenantID,
+		e.TimeStamp.Time,
+		e.ServiceID,
+		labelsArg(e.Labels),
+	).Scan(&eventID); err != nil {
+		return translateError(err)
+	}
+
+	if err := r.addMetrics(tx, eventID, e.TimeStamp.Time, metrics); err != nil {
+		return err
+	}
+
+	if err := addUsage(tx, entity.CountUsage([]*entity.BatchItem{{Event: e, Metrics: metrics}})); err != nil {
+		return err
+	}
+
+	if len(metrics) > 0 {
+		if err := markLateValues(tx, map[int][]time.Time{e.ServiceID: {e.TimeStamp.Time}}); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	e.EventID = eventID
+	return nil
+}
+
+// CreateBatch stores all items in one transaction using multi-row inserts.
+// Event ids are allocated from the sequence up front, so metrics can be inserted without waiting for events.
+func (r *EventRepository) CreateBatch(items []*entity.BatchItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	eventIDs, err := nextEventIDs(tx, len(items))
+	if err != nil {
+		return err
+	}
+
+	metricIDs := make([]int, 0)
+	for _, item := range items {
+		for _, m := range item.Metrics {
+			metricIDs = append(metricIDs, m.MetricID)
+		}
+	}
+
+	known, err := r.tenantMetrics(tx, metricIDs)
+	if err != nil {
+		return err
+	}
+
+	events := make([][]interface{}, len(items))
+	values := make([][]interface{}, 0, len(items))
+
+	for i, item := range items {
+		events[i] = []interface{}{eventIDs[i], r.tenantID, item.Event.TimeStamp.Time, item.Event.ServiceID, labelsArg(item.Event.Labels)}
+
+		for j, m := range item.Metrics {
+			if !known[m.MetricID] {
+				return fmt.Errorf("items[%d]: %w", i, &entity.MetricError{Index: j, MetricID: m.MetricID, Err: repository.ErrRecordNotFound})
+			}
+
+			args, err := metricValueArgs(m.MetricValue)
+			if err != nil {
+				return fmt.Errorf("items[%d]: %w", i, &entity.MetricError{Index: j, MetricID: m.MetricID, Err: err})
+			}
+			values = append(values, append([]interface{}{eventIDs[i], m.MetricID, item.Event.TimeStamp.Time}, args...))
+		}
+	}
+
+	if err := insertRows(tx, "INSERT INTO events (event_id, tenant_id, time_stamp, service_id, labels) VALUES ", events); err != nil {
+		return translateError(err)
+	}
+
+	if err := insertRows(tx, "INSERT INTO events_with_metrics (event_id, metric_id, time_stamp, value_int, value_float, value_duration, value_timestamp, value_bool, value_string) VALUES ", values); err != nil {
+		return translateError(err)
+	}
+
+	if err := addUsage(tx, entity.CountUsage(items)); err != nil {
+		return err
+	}
+
+	stamps := make(map[int][]time.Time)
+	for _, item := range items {
+		if len(item.Metrics) > 0 {
+			stamps[item.Event.ServiceID] = append(stamps[item.Event.ServiceID], item.Event.TimeStamp.Time)
+		}
+	}
+
+	if err := markLateValues(tx, stamps); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for i, item := range items {
+		item.Event.EventID = eventIDs[i]
+	}
 	return nil
 }
 
-func (r *EventRepository) GetMetricValuesForTimePeriod(serviceID int, p [2]*entity.CustomTime, m *entity.Metric) (interface{}, error) {
+// labelsArg encodes event labels for the JSONB labels column.
+func labelsArg(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+
+	b, _ := json.Marshal(labels)
+	return string(b)
+}
+
+func nextEventIDs(tx *sql.Tx, n int) ([]int, error) {
+	rows, err := tx.Query("SELECT nextval(pg_get_serial_sequence('events', 'event_id')) FROM generate_series(1, $1)", n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0, n)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// insertRows executes query, which must end with VALUES, for rows in chunks of batchRows rows.
+func insertRows(tx *sql.Tx, query string, rows [][]interface{}) error {
+	for start := 0; start < len(rows); start += batchRows {
+		end := start + batchRows
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0)
+
+		for _, row := range rows[start:end] {
+			placeholders := make([]string, len(row))
+			for i := range row {
+				placeholders[i] = fmt.Sprintf("$%d", len(args)+i+1)
+			}
+			values = append(values, "("+strings.Join(placeholders, ", ")+")")
+			args = append(args, row...)
+		}
+
+		if _, err := tx.Exec(query+strings.Join(values, ", "), args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tenantMetrics returns which of the metrics belong to the tenant of the repository.
+func (r *EventRepository) tenantMetrics(tx *sql.Tx, metricIDs []int) (map[int]bool, error) {
+	rows, err := tx.Query("SELECT metric_id FROM metrics WHERE tenant_id = $1 AND metric_id = ANY($2)", r.tenantID, pq.Array(metricIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := make(map[int]bool, len(metricIDs))
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		known[id] = true
+	}
+
+	return known, rows.Err()
+}
+
+// addMetrics stores metric values of the event within tx, the failed entry is reported as *entity.MetricError.
+// The values repeat the time stamp of the event, which partitions them along with it.
+func (r *EventRepository) addMetrics(tx *sql.Tx, eventID int, timeStamp time.Time, metrics []*entity.AddMetric) error {
+	metricIDs := make([]int, len(metrics))
+	for i, m := range metrics {
+		metricIDs[i] = m.MetricID
+	}
+
+	known, err := r.tenantMetrics(tx, metricIDs)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(
+		"INSERT INTO events_with_metrics (event_id, metric_id, time_stamp, value_int, value_float, value_duration, value_timestamp, value_bool, value_string) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, m := range metrics {
+		if !known[m.MetricID] {
+			return &entity.MetricError{Index: i, MetricID: m.MetricID, Err: repository.ErrRecordNotFound}
+		}
+
+		args, err := metricValueArgs(m.MetricValue)
+		if err != nil {
+			return &entity.MetricError{Index: i, MetricID: m.MetricID, Err: err}
+		}
+
+		_, err = stmt.Exec(append([]interface{}{eventID, m.MetricID, timeStamp}, args...)...)
+		if err != nil {
+			return &entity.MetricError{Index: i, MetricID: m.MetricID, Err: translateError(err)}
+		}
+	}
+	return nil
+}
+
+// GetMetricValuesForTimePeriod returns the values of the events selected by sel ordered by time,
+// values grouped by labels are ordered by their group first. The period is repeated for the values,
+// so that the partitions of both tables outside of it are pruned.
+func (r *EventRepository) GetMetricValuesForTimePeriod(serviceID int, p [2]*entity.CustomTime, m *entity.Metric, sel *entity.LabelSelector) (interface{}, error) {
+	v, ok := metricValueColumns[m.MetricType]
+	if !ok {
+		return nil, errors.New("unknown metric type")
+	}
+
 	values := make([]*entity.GetMetric, 0)
 
+	conditions, args := labelConditions(sel, []interface{}{serviceID, p[0].Time, p[1].Time, m.MetricID, r.tenantID})
+	groups := labelGroupColumns(sel)
+
 	rows, err := r.db.Query(
-		`SELECT e.time_stamp, ewm.metric_value FROM events e, events_with_metrics ewm WHERE (ewm.event_id IN (SELECT event_id FROM events WHERE service_id = $1 AND (time_stamp >= $2 AND time_stamp <= $3))) AND ewm.metric_id = $4 AND ewm.event_id = e.event_id`,
-		serviceID,
-		p[0].Time,
-		p[1].Time,
-		m.MetricID,
+		fmt.Sprintf(
+			`SELECT e.time_stamp, %s FROM events e JOIN events_with_metrics ewm ON ewm.event_id = e.event_id AND ewm.time_stamp = e.time_stamp WHERE e.tenant_id = $5 AND e.service_id = $1 AND (e.time_stamp >= $2 AND e.time_stamp <= $3) AND (ewm.time_stamp >= $2 AND ewm.time_stamp <= $3) AND ewm.metric_id = $4%s ORDER BY %se.time_stamp`,
+			strings.Join(append([]string{v}, groups...), ", "),
+			andConditions(conditions),
+			orderColumns(groups),
+		),
+		args...,
 	)
 
 	if err != nil {
@@ -64,82 +370,15 @@ func (r *EventRepository) GetMetricValuesForTimePeriod(serviceID int, p [2]*enti
 	}
 	defer rows.Close()
 
+	dest, labels := scanLabelGroup(sel)
 	for rows.Next() {
-		var t time.Time
-		var v string
-
-		err := rows.Scan(&t, &v)
+		value, err := scanMetricValue(rows, m.MetricType, dest...)
 		if err != nil {
 			return nil, err
 		}
+		value.Labels = labels()
 
-		switch m.MetricType {
-		case "INT":
-			i, err := strconv.Atoi(v)
-			if err != nil {
-				return nil, err
-			}
-			values = append(values, &entity.GetMetric{
-				TimeStamp: entity.CustomTime{
-					Time: t,
-				},
-				Value: i,
-			})
-		case "FLOAT":
-			f, err := strconv.ParseFloat(v, 32)
-			if err != nil {
-				return nil, err
-			}
-			values = append(values, &entity.GetMetric{
-				TimeStamp: entity.CustomTime{
-					Time: t,
-				},
-				Value: f,
-			})
-		case "DURATION":
-			d, err := time.ParseDuration(v)
-			if err != nil {
-				return nil, err
-			}
-			values = append(values, &entity.GetMetric{
-				TimeStamp: entity.CustomTime{
-					Time: t,
-				},
-				Value: d.String(),
-			})
-		case "TIMESTAMP_WITH_TIMEZONE":
-			tmstmp, err := time.Parse(defaultLayout, v)
-			if err != nil {
-				return nil, err
-			}
-			values = append(values, &entity.GetMetric{
-				TimeStamp: entity.CustomTime{
-					Time: t,
-				},
-				Value: &entity.CustomTime{Time: tmstmp},
-			})
-		case "BOOL":
-			b, err := strconv.ParseBool(v)
-			if err != nil {
-				return nil, err
-			}
-			values = append(values, &entity.GetMetric{
-				TimeStamp: entity.CustomTime{
-					Time: t,
-				},
-				Value: b,
-			})
-		case "STRING":
-			values = append(values, &entity.GetMetric{
-				TimeStamp: entity.CustomTime{
-					Time: t,
-				},
-				Value: v,
-			})
-		default:
-			return nil, errors.New("unknown metric type")
-		}
-
+		values = append(values, value)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -152,3 +391,178 @@ func (r *EventRepository) GetMetricValuesForTimePeriod(serviceID int, p [2]*enti
 		return nil, repository.ErrRecordNotFound
 	}
 }
+
+// AggregateMetricValuesForTimePeriod aggregates the values of the events selected by sel by buckets
+// and, if sel groups them, by the values of the labels.
+func (r *EventRepository) AggregateMetricValuesForTimePeriod(serviceID int, p [2]*entity.CustomTime, m *entity.Metric, a *entity.Aggregation, sel *entity.LabelSelector) ([]*entity.AggregatedMetric, error) {
+	v, ok := metricValueColumns[m.MetricType]
+	if !ok {
+		return nil, errors.New("unknown metric type")
+	}
+
+	groups := labelGroupColumns(sel)
+
+	columns := make([]string, 0, len(groups)+len(a.Functions))
+	columns = append(columns, groups...)
+	for _, f := range a.Functions {
+		columns = append(columns, aggregateFunctionExpression(f, v))
+	}
+
+	// the group columns follow the bucket
+	groupBy := "bucket"
+	for i := range groups {
+		groupBy += fmt.Sprintf(", %d", i+2)
+	}
+
+	conditions, args := labelConditions(sel, []interface{}{serviceID, p[0].Time, p[1].Time, m.MetricID, a.Bucket.Seconds(), r.tenantID})
+
+	rows, err := r.db.Query(
+		fmt.Sprintf(
+			`SELECT to_timestamp(floor(extract(epoch FROM e.time_stamp) / $5) * $5) AS bucket, %s FROM events e JOIN events_with_metrics ewm ON ewm.event_id = e.event_id AND ewm.time_stamp = e.time_stamp WHERE e.tenant_id = $6 AND e.service_id = $1 AND (e.time_stamp >= $2 AND e.time_stamp < $3) AND (ewm.time_stamp >= $2 AND ewm.time_stamp < $3) AND ewm.metric_id = $4%s GROUP BY %s ORDER BY %sbucket`,
+			strings.Join(columns, ", "),
+			andConditions(conditions),
+			groupBy,
+			orderColumns(groups),
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAggregatedMetrics(rows, m.MetricType, a, sel)
+}
+
+func (r *EventRepository) ServiceCascade(serviceID int) (*entity.Cascade, error) {
+	c := &entity.Cascade{}
+	if err := r.db.QueryRow(
+		`SELECT count(DISTINCT e.event_id), count(ewm.event_id)
+		FROM events e LEFT JOIN events_with_metrics ewm ON ewm.event_id = e.event_id AND ewm.time_stamp = e.time_stamp
+		WHERE e.service_id = $1 AND e.tenant_id = $2`,
+		serviceID,
+		r.tenantID,
+	).Scan(
+		&c.Events,
+		&c.Values,
+	); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *EventRepository) MetricCascade(metricID int) (*entity.Cascade, error) {
+	c := &entity.Cascade{}
+	if err := r.db.QueryRow(
+		"SELECT count(*) FROM events_with_metrics ewm JOIN events e ON e.event_id = ewm.event_id AND e.time_stamp = ewm.time_stamp WHERE ewm.metric_id = $1 AND e.tenant_id = $2",
+		metricID,
+		r.tenantID,
+	).Scan(&c.Values); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// PurgeService deletes the oldest events of the service in one statement, their values are deleted
+// by the cascade and counted beforehand.
+func (r *EventRepository) PurgeService(serviceID int, before time.Time, limit int) (*entity.Cascade, error) {
+	c := &entity.Cascade{}
+	if err := r.db.QueryRow(
+		`WITH expired AS (
+			SELECT e.event_id, (SELECT count(*) FROM events_with_metrics ewm WHERE ewm.event_id = e.event_id AND ewm.time_stamp = e.time_stamp) AS values_count
+			FROM events e
+			WHERE e.service_id = $1 AND e.tenant_id = $2 AND e.time_stamp < $3
+			ORDER BY e.time_stamp
+			LIMIT $4
+		), purged AS (
+			DELETE FROM events WHERE time_stamp < $3 AND event_id IN (SELECT event_id FROM expired) RETURNING event_id
+		)
+		SELECT count(*), coalesce(sum(values_count), 0) FROM expired WHERE event_id IN (SELECT event_id FROM purged)`,
+		serviceID,
+		r.tenantID,
+		before,
+		limit,
+	).Scan(
+		&c.Events,
+		&c.Values,
+	); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// PurgeMetric deletes the oldest values of the metric, the events are kept for the values of other metrics.
+func (r *EventRepository) PurgeMetric(metricID int, before time.Time, limit int) (*entity.Cascade, error) {
+	res, err := r.db.Exec(
+		`DELETE FROM events_with_metrics WHERE metric_id = $1 AND time_stamp < $3 AND event_id IN (
+			SELECT e.event_id
+			FROM events_with_metrics ewm JOIN events e ON e.event_id = ewm.event_id AND e.time_stamp = ewm.time_stamp
+			WHERE ewm.metric_id = $1 AND e.tenant_id = $2 AND e.time_stamp < $3
+			ORDER BY e.time_stamp
+			LIMIT $4
+		)`,
+		metricID,
+		r.tenantID,
+		before,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	return &entity.Cascade{Values: int(n)}, nil
+}
+
+// LatestMetricValues returns the most recent value of every metric of every service
+// restricted to serviceIDs and metricIDs unless they are empty.
+func (r *EventRepository) LatestMetricValues(serviceIDs, metricIDs []int) ([]*entity.LatestValue, error) {
+	conditions := []string{"e.tenant_id = $1"}
+	args := []interface{}{r.tenantID}
+
+	if len(serviceIDs) > 0 {
+		args = append(args, pq.Array(serviceIDs))
+		conditions = append(conditions, fmt.Sprintf("e.service_id = ANY($%d)", len(args)))
+	}
+
+	if len(metricIDs) > 0 {
+		args = append(args, pq.Array(metricIDs))
+		conditions = append(conditions, fmt.Sprintf("ewm.metric_id = ANY($%d)", len(args)))
+	}
+
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	rows, err := r.db.Query(
+		fmt.Sprintf(
+			`SELECT DISTINCT ON (e.service_id, ewm.metric_id) e.service_id, ewm.metric_id, e.time_stamp, %s
+			FROM events e JOIN events_with_metrics ewm ON ewm.event_id = e.event_id AND ewm.time_stamp = e.time_stamp%s
+			ORDER BY e.service_id, ewm.metric_id, e.time_stamp DESC, e.event_id DESC`,
+			typedValueColumns,
+			where,
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make([]*entity.LatestValue, 0)
+	for rows.Next() {
+		lv := &entity.LatestValue{}
+		v := &typedValue{}
+		if err := rows.Scan(append([]interface{}{&lv.ServiceID, &lv.MetricID, &lv.TimeStamp.Time}, v.dest()...)...); err != nil {
+			return nil, err
+		}
+
+		if lv.Value, err = v.value(); err != nil {
+			return nil, err
+		}
+		values = append(values, lv)
+	}
+
+	return values, rows.Err()
+}
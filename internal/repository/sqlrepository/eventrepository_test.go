@@ -10,10 +10,6 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-const (
-	defaultLayout = time.RFC3339
-)
-
 func TestEventRepository_Create(t *testing.T) {
 	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
 	defer teardown("services, events")
@@ -32,34 +28,77 @@ func TestEventRepository_Create(t *testing.T) {
 	assert.NoError(t, er.Create(e))
 }
 
+func TestEventRepository_Create_SameTimeStamp(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services, events")
+
+	s1 := entity.TestService(t)
+	s2 := entity.TestService(t)
+	s2.Slug = "NOTE_BOOK_2"
+	e1 := entity.TestEvent(t)
+	e2 := entity.TestEvent(t)
+	e2.TimeStamp = e1.TimeStamp
+
+	sr := sqlrepository.NewServiceRepository(db)
+	er := sqlrepository.NewEventRepository(db)
+
+	sr.Create(s1)
+	sr.Create(s2)
+
+	e1.ServiceID = s1.ServiceID
+	e2.ServiceID = s2.ServiceID
+	assert.NoError(t, er.Create(e1))
+	assert.NoError(t, er.Create(e2))
+}
+
 func TestEventRepository_AddMetricsToEvent(t *testing.T) {
 	testCases := []struct {
 		name        string
+		metricType  string
 		metricValue interface{}
+		isValid     bool
 	}{
 		{
 			name:        "int",
-			metricValue: 10,
+			metricType:  "INT",
+			metricValue: int64(10),
+			isValid:     true,
 		},
 		{
 			name:        "float",
+			metricType:  "FLOAT",
 			metricValue: 56.7,
+			isValid:     true,
 		},
 		{
 			name:        "duration",
-			metricValue: time.Duration(10 * time.Second).String(),
+			metricType:  "DURATION",
+			metricValue: time.Duration(10 * time.Second),
+			isValid:     true,
 		},
 		{
 			name:        "timestamp with timezone",
-			metricValue: entity.CustomTime{Time: time.Now()}.Time.Format(defaultLayout),
+			metricType:  "TIMESTAMP_WITH_TIMEZONE",
+			metricValue: time.Now(),
+			isValid:     true,
 		},
 		{
 			name:        "bool",
+			metricType:  "BOOL",
 			metricValue: true,
+			isValid:     true,
 		},
 		{
 			name:        "string",
+			metricType:  "STRING",
 			metricValue: "starting api server",
+			isValid:     true,
+		},
+		{
+			name:        "unparsed value",
+			metricType:  "FLOAT",
+			metricValue: float32(56.7),
+			isValid:     false,
 		},
 	}
 
@@ -70,6 +109,7 @@ func TestEventRepository_AddMetricsToEvent(t *testing.T) {
 
 			s := entity.TestService(t)
 			m := entity.TestMetric(t)
+			m.MetricType = tc.metricType
 			e := entity.TestEvent(t)
 
 			sr := sqlrepository.NewServiceRepository(db)
@@ -87,7 +127,11 @@ func TestEventRepository_AddMetricsToEvent(t *testing.T) {
 					MetricValue: tc.metricValue,
 				}})
 
-			assert.NoError(t, err)
+			if tc.isValid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, entity.ErrInvalidMetricValue)
+			}
 		})
 	}
 }
@@ -106,7 +150,7 @@ func TestEventRepository_GetMetricValuesForTimePeriod(t *testing.T) {
 				m.MetricType = "INT"
 				return m
 			},
-			metricValue: 10,
+			metricValue: int64(10),
 			p: [2]*entity.CustomTime{
 				{Time: time.Now().AddDate(0, 0, -1)},
 				{Time: time.Now().AddDate(0, 0, +1)},
@@ -132,7 +176,7 @@ func TestEventRepository_GetMetricValuesForTimePeriod(t *testing.T) {
 				m.MetricType = "DURATION"
 				return m
 			},
-			metricValue: time.Duration(10 * time.Second).String(),
+			metricValue: time.Duration(10 * time.Second),
 			p: [2]*entity.CustomTime{
 				{Time: time.Now().AddDate(0, 0, -1)},
 				{Time: time.Now().AddDate(0, 0, +1)},
@@ -145,7 +189,7 @@ func TestEventRepository_GetMetricValuesForTimePeriod(t *testing.T) {
 				m.MetricType = "TIMESTAMP_WITH_TIMEZONE"
 				return m
 			},
-			metricValue: entity.CustomTime{Time: time.Now()}.Time.Format(defaultLayout),
+			metricValue: time.Now(),
 			p: [2]*entity.CustomTime{
 				{Time: time.Now().AddDate(0, 0, -1)},
 				{Time: time.Now().AddDate(0, 0, +1)},
@@ -196,7 +240,7 @@ func TestEventRepository_GetMetricValuesForTimePeriod(t *testing.T) {
 			mr.Create(m)
 			er.Create(e)
 
-			_, err := er.GetMetricValuesForTimePeriod(s.ServiceID, tc.p, m)
+			_, err := er.GetMetricValuesForTimePeriod(s.ServiceID, tc.p, m, nil)
 			assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
 
 			er.AddMetricsToEvent(e.EventID, []*entity.AddMetric{
@@ -205,8 +249,411 @@ func TestEventRepository_GetMetricValuesForTimePeriod(t *testing.T) {
 					MetricValue: tc.metricValue,
 				}})
 
-			_, err = er.GetMetricValuesForTimePeriod(s.ServiceID, tc.p, m)
+			_, err = er.GetMetricValuesForTimePeriod(s.ServiceID, tc.p, m, nil)
 			assert.NoError(t, err)
 		})
 	}
 }
+
+func TestEventRepository_AggregateMetricValuesForTimePeriod(t *testing.T) {
+	testCases := []struct {
+		name        string
+		metricType  string
+		metricValue interface{}
+		functions   []string
+	}{
+		{
+			name:        "int",
+			metricType:  "INT",
+			metricValue: int64(10),
+			functions:   []string{"count", "sum", "min", "max", "avg", "p50", "p95", "p99", "first", "last"},
+		},
+		{
+			name:        "float",
+			metricType:  "FLOAT",
+			metricValue: 56.7,
+			functions:   []string{"count", "sum", "avg", "p99"},
+		},
+		{
+			name:        "duration",
+			metricType:  "DURATION",
+			metricValue: time.Duration(10 * time.Second),
+			functions:   []string{"sum", "avg", "p95"},
+		},
+		{
+			name:        "timestamp with timezone",
+			metricType:  "TIMESTAMP_WITH_TIMEZONE",
+			metricValue: time.Now(),
+			functions:   []string{"min", "max", "first", "last"},
+		},
+		{
+			name:        "bool",
+			metricType:  "BOOL",
+			metricValue: true,
+			functions:   []string{"count", "true_ratio"},
+		},
+		{
+			name:        "string",
+			metricType:  "STRING",
+			metricValue: "starting api server",
+			functions:   []string{"count_distinct", "first"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+			defer teardown("services, metrics, events, events_with_metrics")
+
+			s := entity.TestService(t)
+			e := entity.TestEvent(t)
+			m := entity.TestMetric(t)
+			m.MetricType = tc.metricType
+			a := entity.TestAggregation(t)
+			a.Functions = tc.functions
+			p := [2]*entity.CustomTime{
+				{Time: time.Now().AddDate(0, 0, -1)},
+				{Time: time.Now().AddDate(0, 0, +1)},
+			}
+
+			sr := sqlrepository.NewServiceRepository(db)
+			mr := sqlrepository.NewMetricRepository(db)
+			er := sqlrepository.NewEventRepository(db)
+
+			sr.Create(s)
+			e.ServiceID = s.ServiceID
+			mr.Create(m)
+			er.Create(e)
+
+			_, err := er.AggregateMetricValuesForTimePeriod(s.ServiceID, p, m, a, nil)
+			assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+			er.AddMetricsToEvent(e.EventID, []*entity.AddMetric{
+				{
+					MetricID:    m.MetricID,
+					MetricValue: tc.metricValue,
+				}})
+
+			report, err := er.AggregateMetricValuesForTimePeriod(s.ServiceID, p, m, a, nil)
+			assert.NoError(t, err)
+			assert.Len(t, report, 1)
+		})
+	}
+}
+
+func TestEventRepository_CreateWithMetrics(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services, metrics, events, events_with_metrics")
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	e := entity.TestEvent(t)
+
+	sr := sqlrepository.NewServiceRepository(db)
+	mr := sqlrepository.NewMetricRepository(db)
+	er := sqlrepository.NewEventRepository(db)
+
+	sr.Create(s)
+	mr.Create(m)
+	e.ServiceID = s.ServiceID
+
+	metrics := []*entity.AddMetric{
+		{
+			MetricID:    m.MetricID,
+			MetricValue: time.Duration(10 * time.Second),
+		},
+		{
+			MetricID:    m.MetricID + 1,
+			MetricValue: time.Duration(15 * time.Second),
+		},
+	}
+
+	err := er.CreateWithMetrics(e, metrics)
+	assert.ErrorIs(t, err, repository.ErrRecordNotFound)
+
+	var metricErr *entity.MetricError
+	if assert.ErrorAs(t, err, &metricErr) {
+		assert.Equal(t, 1, metricErr.Index)
+	}
+
+	var events int
+	db.QueryRow("SELECT count(*) FROM events").Scan(&events)
+	assert.Zero(t, events)
+
+	assert.NoError(t, er.CreateWithMetrics(e, metrics[:1]))
+	assert.NotZero(t, e.EventID)
+}
+
+func TestEventRepository_CreateBatch(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services, metrics, events, events_with_metrics")
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+
+	sr := sqlrepository.NewServiceRepository(db)
+	mr := sqlrepository.NewMetricRepository(db)
+	er := sqlrepository.NewEventRepository(db)
+
+	sr.Create(s)
+	mr.Create(m)
+
+	items := make([]*entity.BatchItem, 3)
+	for i := range items {
+		e := entity.TestEvent(t)
+		e.ServiceID = s.ServiceID
+		items[i] = &entity.BatchItem{
+			Event: e,
+			Metrics: []*entity.AddMetric{
+				{MetricID: m.MetricID, MetricValue: time.Duration(i+1) * time.Second},
+			},
+		}
+	}
+
+	items[2].Metrics[0].MetricID = m.MetricID + 1
+	assert.ErrorIs(t, er.CreateBatch(items), repository.ErrRecordNotFound)
+
+	var events int
+	db.QueryRow("SELECT count(*) FROM events").Scan(&events)
+	assert.Zero(t, events)
+
+	assert.NoError(t, er.CreateBatch(items[:2]))
+	assert.NotZero(t, items[0].Event.EventID)
+	assert.NotZero(t, items[1].Event.EventID)
+
+	p := [2]*entity.CustomTime{
+		{Time: time.Now().AddDate(0, 0, -1)},
+		{Time: time.Now().AddDate(0, 0, +1)},
+	}
+
+	values, err := er.GetMetricValuesForTimePeriod(s.ServiceID, p, m, nil)
+	assert.NoError(t, err)
+	assert.Len(t, values, 2)
+}
+
+func TestEventRepository_Cascade(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services, metrics, events, events_with_metrics")
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+
+	sr := sqlrepository.NewServiceRepository(db)
+	mr := sqlrepository.NewMetricRepository(db)
+	er := sqlrepository.NewEventRepository(db)
+
+	sr.Create(s)
+	mr.Create(m)
+
+	for i := 0; i < 2; i++ {
+		e := entity.TestEvent(t)
+		e.ServiceID = s.ServiceID
+		e.TimeStamp = entity.CustomTime{Time: e.TimeStamp.Add(time.Duration(i) * time.Second)}
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: time.Second}}))
+	}
+	assert.NoError(t, er.Create(&entity.Event{ServiceID: s.ServiceID, TimeStamp: entity.CustomTime{Time: time.Now()}}))
+
+	c, err := er.ServiceCascade(s.ServiceID)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 3, Values: 2}, c)
+
+	c, err = er.MetricCascade(m.MetricID)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Values: 2}, c)
+
+	m.MetricType = "INT"
+	assert.ErrorIs(t, mr.Update(m), entity.ErrMetricTypeLocked)
+
+	assert.NoError(t, mr.Delete(m.MetricID))
+	c, err = er.ServiceCascade(s.ServiceID)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 3}, c)
+
+	assert.NoError(t, sr.Delete(s.ServiceID))
+	c, err = er.ServiceCascade(s.ServiceID)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{}, c)
+}
+
+func TestEventRepository_Purge(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services, metrics, events, events_with_metrics")
+
+	s := entity.TestService(t)
+	m1 := entity.TestMetric(t)
+	m1.MetricType = "INT"
+	m2 := entity.TestMetric(t)
+	m2.Slug = "READING_TIME_NOTE_2"
+	m2.MetricType = "BOOL"
+
+	sr := sqlrepository.NewServiceRepository(db)
+	mr := sqlrepository.NewMetricRepository(db)
+	er := sqlrepository.NewEventRepository(db)
+
+	sr.Create(s)
+	mr.Create(m1)
+	mr.Create(m2)
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		e := entity.TestEvent(t)
+		e.ServiceID = s.ServiceID
+		e.TimeStamp.Time = now.Add(-time.Duration(5-i) * time.Hour)
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{
+			{MetricID: m1.MetricID, MetricValue: int64(i)},
+			{MetricID: m2.MetricID, MetricValue: true},
+		}))
+	}
+
+	c, err := er.ForTenant(entity.DefaultTenantID+1).PurgeService(s.ServiceID, now, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{}, c)
+
+	c, err = er.PurgeMetric(m2.MetricID, now.Add(-90*time.Minute), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Values: 3}, c)
+
+	c, err = er.PurgeService(s.ServiceID, now.Add(-150*time.Minute), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 2, Values: 2}, c)
+
+	c, err = er.PurgeService(s.ServiceID, now.Add(-150*time.Minute), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 1, Values: 1}, c)
+
+	c, err = er.ServiceCascade(s.ServiceID)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 2, Values: 4}, c)
+}
+
+func TestEventRepository_LatestMetricValues(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services, metrics, events, events_with_metrics")
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+
+	sr := sqlrepository.NewServiceRepository(db)
+	mr := sqlrepository.NewMetricRepository(db)
+	er := sqlrepository.NewEventRepository(db)
+
+	sr.Create(s)
+	mr.Create(m)
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		e := &entity.Event{ServiceID: s.ServiceID, TimeStamp: entity.CustomTime{Time: now.Add(time.Duration(i) * time.Second)}}
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: time.Duration(i) * time.Second}}))
+	}
+
+	values, err := er.LatestMetricValues(nil, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, values, 1) {
+		assert.Equal(t, s.ServiceID, values[0].ServiceID)
+		assert.Equal(t, m.MetricID, values[0].MetricID)
+		assert.Equal(t, 2*time.Second, values[0].Value)
+	}
+
+	values, err = er.LatestMetricValues([]int{s.ServiceID}, []int{m.MetricID + 1})
+	assert.NoError(t, err)
+	assert.Len(t, values, 0)
+}
+
+func TestEventRepository_Labels(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services, metrics, events, events_with_metrics")
+
+	sr := sqlrepository.NewServiceRepository(db)
+	mr := sqlrepository.NewMetricRepository(db)
+	er := sqlrepository.NewEventRepository(db)
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	m.MetricType = "INT"
+
+	sr.Create(s)
+	mr.Create(m)
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Hour).UTC()
+	for i, labels := range []map[string]string{
+		{"host": "a", "region": "eu"},
+		{"host": "b", "region": "eu"},
+		{"host": "c", "region": "us"},
+		nil,
+	} {
+		e := entity.TestEvent(t)
+		e.ServiceID = s.ServiceID
+		e.TimeStamp.Time = start.Add(time.Duration(i+1) * time.Second)
+		e.Labels = labels
+
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: (i + 1) * 10}}))
+	}
+
+	p := [2]*entity.CustomTime{
+		{Time: start},
+		{Time: start.Add(time.Hour)},
+	}
+
+	match := func(matchers ...string) []*entity.LabelMatcher {
+		res := make([]*entity.LabelMatcher, len(matchers))
+		for i, s := range matchers {
+			m, err := entity.ParseLabelMatcher(s)
+			assert.NoError(t, err)
+			res[i] = m
+		}
+		return res
+	}
+
+	valuesOf := func(sel *entity.LabelSelector) []interface{} {
+		report, err := er.GetMetricValuesForTimePeriod(s.ServiceID, p, m, sel)
+		if err != nil {
+			return nil
+		}
+
+		values := make([]interface{}, 0)
+		for _, v := range report.([]*entity.GetMetric) {
+			values = append(values, v.Value)
+		}
+		return values
+	}
+
+	assert.Equal(t, []interface{}{10, 20}, valuesOf(&entity.LabelSelector{Matchers: match(`region="eu"`)}))
+	assert.Equal(t, []interface{}{20}, valuesOf(&entity.LabelSelector{Matchers: match(`region=~"e.*"`, `host!="a"`)}))
+	assert.Equal(t, []interface{}{40}, valuesOf(&entity.LabelSelector{Matchers: match(`region=""`)}))
+	assert.Equal(t, []interface{}{10, 30}, valuesOf(&entity.LabelSelector{Matchers: match(`host=~"a|c"`)}))
+	assert.Equal(t, []interface{}{20, 30, 40}, valuesOf(&entity.LabelSelector{Matchers: match(`host!~"a"`)}))
+	assert.Nil(t, valuesOf(&entity.LabelSelector{Matchers: match(`region="asia"`)}))
+
+	report, err := er.GetMetricValuesForTimePeriod(s.ServiceID, p, m, &entity.LabelSelector{GroupBy: []string{"region"}})
+	assert.NoError(t, err)
+	values := report.([]*entity.GetMetric)
+	assert.Len(t, values, 4)
+	assert.Equal(t, map[string]string{"region": ""}, values[0].Labels)
+	assert.Equal(t, 40, values[0].Value)
+	assert.Equal(t, map[string]string{"region": "eu"}, values[1].Labels)
+	assert.Equal(t, 10, values[1].Value)
+	assert.Equal(t, map[string]string{"region": "us"}, values[3].Labels)
+
+	a := &entity.Aggregation{Bucket: time.Hour, Functions: []string{"sum"}}
+
+	buckets, err := er.AggregateMetricValuesForTimePeriod(s.ServiceID, p, m, a, &entity.LabelSelector{
+		Matchers: match(`host!="b"`),
+		GroupBy:  []string{"region"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, buckets, 3)
+	for i, expected := range []struct {
+		region string
+		sum    int64
+	}{{"", 40}, {"eu", 10}, {"us", 30}} {
+		assert.Equal(t, start, buckets[i].TimeStamp.Time)
+		assert.Equal(t, map[string]string{"region": expected.region}, buckets[i].Labels)
+		assert.Equal(t, expected.sum, buckets[i].Values["sum"])
+	}
+
+	buckets, err = er.AggregateMetricValuesForTimePeriod(s.ServiceID, p, m, a, &entity.LabelSelector{Matchers: match(`region="eu"`)})
+	assert.NoError(t, err)
+	assert.Len(t, buckets, 1)
+	assert.Nil(t, buckets[0].Labels)
+	assert.Equal(t, int64(30), buckets[0].Values["sum"])
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
 )
 
 func TestDB(t *testing.T, databaseURL string) (*sql.DB, func(...string)) {
@@ -19,9 +21,23 @@ func TestDB(t *testing.T, databaseURL string) (*sql.DB, func(...string)) {
 		t.Fatal(err)
 	}
 
+	// the default tenant is kept, the tables of the tenants are expected to be listed before tenants
 	return db, func(tables ...string) {
-		if len(tables) > 0 {
-			if _, err := db.Exec(fmt.Sprintf("TRUNCATE %s CASCADE", strings.Join(tables, ", "))); err != nil {
+		truncate := make([]string, 0, len(tables))
+		for _, table := range tables {
+			if table != "tenants" {
+				truncate = append(truncate, table)
+			}
+		}
+
+		if len(truncate) > 0 {
+			if _, err := db.Exec(fmt.Sprintf("TRUNCATE %s CASCADE", strings.Join(truncate, ", "))); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if len(truncate) < len(tables) {
+			if _, err := db.Exec("DELETE FROM tenants WHERE tenant_id <> $1", entity.DefaultTenantID); err != nil {
 				t.Fatal(err)
 			}
 		}
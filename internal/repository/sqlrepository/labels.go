@@ -0,0 +1,97 @@
+package sqlrepository
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/lib/pq"
+)
+
+// labelMatchOperators maps label matcher types to the SQL operators on the label value.
+var labelMatchOperators = map[string]string{
+	entity.MatchEqual:     "=",
+	entity.MatchNotEqual:  "<>",
+	entity.MatchRegexp:    "~",
+	entity.MatchNotRegexp: "!~",
+}
+
+// labelConditions renders the matchers of sel as conditions on e.labels, their arguments are appended to args.
+// Equality to a non-empty value is a containment test, so it is served by the GIN index of the labels.
+func labelConditions(sel *entity.LabelSelector, args []interface{}) ([]string, []interface{}) {
+	if sel == nil {
+		return nil, args
+	}
+
+	conditions := make([]string, 0, len(sel.Matchers))
+	for _, m := range sel.Matchers {
+		if m.Type == entity.MatchEqual && m.Value != "" {
+			b, _ := json.Marshal(map[string]string{m.Name: m.Value})
+			args = append(args, string(b))
+			conditions = append(conditions, fmt.Sprintf("e.labels @> $%d::jsonb", len(args)))
+			continue
+		}
+
+		value := m.Value
+		if m.Type == entity.MatchRegexp || m.Type == entity.MatchNotRegexp {
+			value = "^(?:" + value + ")$"
+		}
+
+		args = append(args, m.Name, value)
+		conditions = append(conditions, fmt.Sprintf("coalesce(e.labels->>$%d::text, '') %s $%d::text", len(args)-1, labelMatchOperators[m.Type], len(args)))
+	}
+
+	return conditions, args
+}
+
+// labelGroupColumns renders the values of the labels the results are grouped by, a missing label is empty.
+func labelGroupColumns(sel *entity.LabelSelector) []string {
+	if sel == nil {
+		return nil
+	}
+
+	columns := make([]string, len(sel.GroupBy))
+	for i, name := range sel.GroupBy {
+		columns[i] = fmt.Sprintf("coalesce(e.labels->>%s, '')", pq.QuoteLiteral(name))
+	}
+	return columns
+}
+
+// scanLabelGroup returns destinations for the group columns and the function that collects them into labels.
+func scanLabelGroup(sel *entity.LabelSelector) ([]interface{}, func() map[string]string) {
+	columns := labelGroupColumns(sel)
+	values := make([]string, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	return dest, func() map[string]string {
+		if len(values) == 0 {
+			return nil
+		}
+
+		labels := make(map[string]string, len(values))
+		for i, name := range sel.GroupBy {
+			labels[name] = values[i]
+		}
+		return labels
+	}
+}
+
+// andConditions joins conditions that follow others in a WHERE clause.
+func andConditions(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " AND " + strings.Join(conditions, " AND ")
+}
+
+// orderColumns renders the columns as the leading part of an ORDER BY clause.
+func orderColumns(columns []string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+	return strings.Join(columns, ", ") + ", "
+}
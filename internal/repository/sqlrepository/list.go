@@ -0,0 +1,72 @@
+package sqlrepository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+// listClauses builds the WHERE, ORDER BY and LIMIT clauses of a keyset paginated list of a tenant
+// over a table with the idColumn primary key and tenant_id, slug, details and archived columns.
+func listClauses(idColumn string, tenantID int, o *entity.ListOptions) (string, []interface{}, error) {
+	after, err := o.After()
+	if err != nil {
+		return "", nil, err
+	}
+
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions = append(conditions, fmt.Sprintf("tenant_id = %s", arg(tenantID)))
+
+	if !o.IncludeArchived {
+		conditions = append(conditions, "NOT archived")
+	}
+
+	if o.SlugPrefix != "" {
+		conditions = append(conditions, fmt.Sprintf("starts_with(slug, %s)", arg(o.SlugPrefix)))
+	}
+
+	if o.MetricType != "" {
+		conditions = append(conditions, fmt.Sprintf("metric_type = %s", arg(o.MetricType)))
+	}
+
+	if o.Search != "" {
+		conditions = append(conditions, fmt.Sprintf("details ILIKE %s", arg("%"+escapeLike(o.Search)+"%")))
+	}
+
+	op, dir := ">", "ASC"
+	if o.Order == "desc" {
+		op, dir = "<", "DESC"
+	}
+
+	orderBy := fmt.Sprintf("%s %s", idColumn, dir)
+	if o.SortBy == "slug" {
+		orderBy = fmt.Sprintf("slug %s, %s", dir, orderBy)
+	}
+
+	if after != nil {
+		if o.SortBy == "slug" {
+			conditions = append(conditions, fmt.Sprintf("(slug, %s) %s (%s, %s)", idColumn, op, arg(after.Slug), arg(after.ID)))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("%s %s %s", idColumn, op, arg(after.ID)))
+		}
+	}
+
+	clauses := " WHERE " + strings.Join(conditions, " AND ")
+	clauses += fmt.Sprintf(" ORDER BY %s LIMIT %s", orderBy, arg(o.Limit))
+
+	return clauses, args, nil
+}
+
+var likeReplacer = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike escapes the wildcards of LIKE patterns.
+func escapeLike(s string) string {
+	return likeReplacer.Replace(s)
+}
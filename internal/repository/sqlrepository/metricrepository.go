@@ -8,12 +8,21 @@ import (
 )
 
 type MetricRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	tenantID int
 }
 
 func NewMetricRepository(db *sql.DB) *MetricRepository {
 	return &MetricRepository{
-		db: db,
+		db:       db,
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *MetricRepository) ForTenant(tenantID int) repository.MetricRepository {
+	return &MetricRepository{
+		db:       r.db,
+		tenantID: tenantID,
 	}
 }
 
@@ -23,7 +32,8 @@ func (r *MetricRepository) Create(m *entity.Metric) error {
 	}
 
 	return r.db.QueryRow(
-		"INSERT INTO metrics (slug, metric_type, details) VALUES ($1, $2, $3) RETURNING metric_id",
+		"INSERT INTO metrics (tenant_id, slug, metric_type, details) VALUES ($1, $2, $3, $4) RETURNING metric_id",
+		r.tenantID,
 		m.Slug,
 		m.MetricType,
 		m.Details,
@@ -31,20 +41,118 @@ func (r *MetricRepository) Create(m *entity.Metric) error {
 }
 
 func (r *MetricRepository) FindByID(metricID int) (*entity.Metric, error) {
+	return r.find("metric_id = $2", metricID)
+}
+
+// FindBySlug normalizes the slug the same way Create does before looking the metric up.
+func (r *MetricRepository) FindBySlug(slug string) (*entity.Metric, error) {
+	return r.find("slug = $2", entity.NormalizeSlug(slug))
+}
+
+func (r *MetricRepository) find(condition string, arg interface{}) (*entity.Metric, error) {
 	m := &entity.Metric{}
+	var t sql.NullTime
 	if err := r.db.QueryRow(
-		"SELECT metric_id, slug, metric_type, details FROM metrics WHERE metric_id = $1",
-		metricID,
+		"SELECT metric_id, slug, metric_type, details, archived, archived_at FROM metrics WHERE tenant_id = $1 AND "+condition,
+		r.tenantID,
+		arg,
 	).Scan(
 		&m.MetricID,
 		&m.Slug,
 		&m.MetricType,
 		&m.Details,
+		&m.Archived,
+		&t,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, repository.ErrRecordNotFound
 		}
 		return nil, err
 	}
+	m.ArchivedAt = archivedAt(t)
 	return m, nil
 }
+
+func (r *MetricRepository) List(o *entity.ListOptions) ([]*entity.Metric, error) {
+	clauses, args, err := listClauses("metric_id", r.tenantID, o)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query("SELECT metric_id, slug, metric_type, details, archived, archived_at FROM metrics"+clauses, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := make([]*entity.Metric, 0)
+	for rows.Next() {
+		m := &entity.Metric{}
+		var t sql.NullTime
+		if err := rows.Scan(
+			&m.MetricID,
+			&m.Slug,
+			&m.MetricType,
+			&m.Details,
+			&m.Archived,
+			&t,
+		); err != nil {
+			return nil, err
+		}
+		m.ArchivedAt = archivedAt(t)
+		metrics = append(metrics, m)
+	}
+
+	return metrics, rows.Err()
+}
+
+// Update replaces the slug, type and details of the metric, the archive state is kept.
+// The type of a metric with stored values is never changed: such an update fails with entity.ErrMetricTypeLocked.
+func (r *MetricRepository) Update(m *entity.Metric) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	var t sql.NullTime
+	err := r.db.QueryRow(
+		`UPDATE metrics SET slug = $3, metric_type = $4, details = $5
+		WHERE metric_id = $1 AND tenant_id = $2
+			AND (metric_type = $4 OR NOT EXISTS (SELECT 1 FROM events_with_metrics WHERE metric_id = $1))
+		RETURNING archived, archived_at`,
+		m.MetricID,
+		r.tenantID,
+		m.Slug,
+		m.MetricType,
+		m.Details,
+	).Scan(
+		&m.Archived,
+		&t,
+	)
+	if err == sql.ErrNoRows {
+		if _, err := r.FindByID(m.MetricID); err != nil {
+			return err
+		}
+		return entity.ErrMetricTypeLocked
+	}
+	if err != nil {
+		return err
+	}
+
+	m.ArchivedAt = archivedAt(t)
+	return nil
+}
+
+// Archive marks the metric as archived, archiving it again keeps the original time.
+func (r *MetricRepository) Archive(metricID int) error {
+	return execOne(
+		r.db,
+		"UPDATE metrics SET archived = true, archived_at = COALESCE(archived_at, now()) WHERE metric_id = $1 AND tenant_id = $2",
+		metricID,
+		r.tenantID,
+	)
+}
+
+// Delete removes the metric, its values are removed by cascade.
+func (r *MetricRepository) Delete(metricID int) error {
+	return execOne(r.db, "DELETE FROM metrics WHERE metric_id = $1 AND tenant_id = $2", metricID, r.tenantID)
+}
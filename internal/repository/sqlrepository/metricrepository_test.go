@@ -1,6 +1,7 @@
 package sqlrepository_test
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/AnatoliyBr/dwh-service/internal/entity"
@@ -35,3 +36,60 @@ func TestMetricRepository_FindByID(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, s2)
 }
+
+func TestMetricRepository_List(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("metrics")
+
+	mr := sqlrepository.NewMetricRepository(db)
+
+	for i, metricType := range []string{"DURATION", "INT", "DURATION"} {
+		m := entity.TestMetric(t)
+		m.Slug = fmt.Sprintf("READING_TIME_NOTE_%d", i+1)
+		m.MetricType = metricType
+		mr.Create(m)
+	}
+
+	o := &entity.ListOptions{MetricType: "DURATION"}
+	assert.NoError(t, o.Validate())
+
+	page, err := mr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 2)
+	assert.Less(t, page[0].MetricID, page[1].MetricID)
+}
+
+func TestMetricRepository_Update(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("metrics")
+
+	mr := sqlrepository.NewMetricRepository(db)
+
+	m := entity.TestMetric(t)
+	assert.Equal(t, repository.ErrRecordNotFound, mr.Update(m))
+
+	mr.Create(m)
+	assert.NoError(t, mr.Archive(m.MetricID))
+
+	updated := &entity.Metric{MetricID: m.MetricID, Slug: m.Slug, MetricType: "INT", Details: "Seconds"}
+	assert.NoError(t, mr.Update(updated))
+	assert.True(t, updated.Archived)
+	assert.NotNil(t, updated.ArchivedAt)
+}
+
+func TestMetricRepository_FindBySlug(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("metrics")
+
+	m1 := entity.TestMetric(t)
+	mr := sqlrepository.NewMetricRepository(db)
+
+	mr.Create(m1)
+
+	_, err := mr.FindBySlug("READING_TIME_NOTE_2")
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	m2, err := mr.FindBySlug("reading_time_note_1")
+	assert.NoError(t, err)
+	assert.Equal(t, m1.MetricID, m2.MetricID)
+}
@@ -0,0 +1,126 @@
+package sqlrepository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+// metricValueColumns maps metric types to the expression that reads the typed value column.
+// Durations are read as seconds.
+var metricValueColumns = map[string]string{
+	"INT":                     "ewm.value_int",
+	"FLOAT":                   "ewm.value_float",
+	"DURATION":                "extract(epoch FROM ewm.value_duration)::double precision",
+	"TIMESTAMP_WITH_TIMEZONE": "ewm.value_timestamp",
+	"BOOL":                    "ewm.value_bool",
+	"STRING":                  "ewm.value_string",
+}
+
+// typedValueColumns reads all typed value columns, exactly one of them is not null.
+const typedValueColumns = "ewm.value_int, ewm.value_float, extract(epoch FROM ewm.value_duration)::double precision, " +
+	"ewm.value_timestamp, ewm.value_bool, ewm.value_string"
+
+// typedValue is the destination of typedValueColumns.
+type typedValue struct {
+	i sql.NullInt64
+	f sql.NullFloat64
+	d sql.NullFloat64
+	t sql.NullTime
+	b sql.NullBool
+	s sql.NullString
+}
+
+func (v *typedValue) dest() []interface{} {
+	return []interface{}{&v.i, &v.f, &v.d, &v.t, &v.b, &v.s}
+}
+
+// value returns the value in the types of entity.Metric.ParseValue.
+func (v *typedValue) value() (interface{}, error) {
+	switch {
+	case v.i.Valid:
+		return v.i.Int64, nil
+	case v.f.Valid:
+		return v.f.Float64, nil
+	case v.d.Valid:
+		return time.Duration(v.d.Float64 * float64(time.Second)), nil
+	case v.t.Valid:
+		return v.t.Time, nil
+	case v.b.Valid:
+		return v.b.Bool, nil
+	case v.s.Valid:
+		return v.s.String, nil
+	default:
+		return nil, errors.New("metric value is null")
+	}
+}
+
+// metricValueArgs spreads a value parsed by entity.Metric.ParseValue over
+// value_int, value_float, value_duration, value_timestamp, value_bool and value_string.
+func metricValueArgs(v interface{}) ([]interface{}, error) {
+	args := make([]interface{}, 6)
+
+	switch v := v.(type) {
+	case int64:
+		args[0] = v
+	case int:
+		args[0] = int64(v)
+	case float64:
+		args[1] = v
+	case time.Duration:
+		args[2] = fmt.Sprintf("%d microseconds", v.Microseconds())
+	case time.Time:
+		args[3] = v
+	case bool:
+		args[4] = v
+	case string:
+		args[5] = v
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %T", entity.ErrInvalidMetricValue, v)
+	}
+
+	return args, nil
+}
+
+// scanMetricValue reads a row of (time_stamp, value, extra...) where value is selected with metricValueColumns.
+func scanMetricValue(rows *sql.Rows, metricType string, extra ...interface{}) (*entity.GetMetric, error) {
+	var (
+		t       time.Time
+		i       int64
+		f       float64
+		tmstmp  time.Time
+		b       bool
+		s       string
+		dest    interface{}
+		convert func() interface{}
+	)
+
+	switch metricType {
+	case "INT":
+		dest, convert = &i, func() interface{} { return int(i) }
+	case "FLOAT":
+		dest, convert = &f, func() interface{} { return f }
+	case "DURATION":
+		dest, convert = &f, func() interface{} { return time.Duration(f * float64(time.Second)).String() }
+	case "TIMESTAMP_WITH_TIMEZONE":
+		dest, convert = &tmstmp, func() interface{} { return &entity.CustomTime{Time: tmstmp} }
+	case "BOOL":
+		dest, convert = &b, func() interface{} { return b }
+	case "STRING":
+		dest, convert = &s, func() interface{} { return s }
+	default:
+		return nil, errors.New("unknown metric type")
+	}
+
+	if err := rows.Scan(append([]interface{}{&t, dest}, extra...)...); err != nil {
+		return nil, err
+	}
+
+	return &entity.GetMetric{
+		TimeStamp: entity.CustomTime{Time: t},
+		Value:     convert(),
+	}, nil
+}
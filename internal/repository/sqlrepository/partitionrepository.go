@@ -0,0 +1,154 @@
+package sqlrepository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/lib/pq"
+)
+
+// partitionedTables are partitioned alike, the values of an event are in the partition of the same time.
+var partitionedTables = []string{"events", "events_with_metrics"}
+
+// PartitionRepository keeps the partitions of the tables in event_partitions.
+type PartitionRepository struct {
+	db *sql.DB
+}
+
+func NewPartitionRepository(db *sql.DB) *PartitionRepository {
+	return &PartitionRepository{
+		db: db,
+	}
+}
+
+func (r *PartitionRepository) List() ([]*entity.Partition, error) {
+	rows, err := r.db.Query("SELECT partition_from, partition_to FROM event_partitions ORDER BY partition_from")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partitions := make([]*entity.Partition, 0)
+	for rows.Next() {
+		p := &entity.Partition{}
+		if err := rows.Scan(&p.From, &p.To); err != nil {
+			return nil, err
+		}
+		p.From, p.To = p.From.UTC(), p.To.UTC()
+		partitions = append(partitions, p)
+	}
+
+	return partitions, rows.Err()
+}
+
+// Create copies the events of the time of the partition and their values aside and deletes them from
+// the default partitions, which would not let the partitions be created otherwise, then stores them again.
+func (r *PartitionRepository) Create(p *entity.Partition) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range partitionedTables {
+		if _, err := tx.Exec(fmt.Sprintf("CREATE TEMP TABLE %s ON COMMIT DROP AS TABLE %s WITH NO DATA", movedTable(table), table)); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(
+			fmt.Sprintf("INSERT INTO %s SELECT * FROM %s WHERE time_stamp >= $1 AND time_stamp < $2", movedTable(table), table+"_default"),
+			p.From,
+			p.To,
+		); err != nil {
+			return err
+		}
+	}
+
+	// the values are deleted by the cascade
+	if _, err := tx.Exec("DELETE FROM events_default WHERE time_stamp >= $1 AND time_stamp < $2", p.From, p.To); err != nil {
+		return err
+	}
+
+	for _, table := range partitionedTables {
+		if _, err := tx.Exec(fmt.Sprintf(
+			"CREATE TABLE %s PARTITION OF %s FOR VALUES FROM (%s) TO (%s)",
+			pq.QuoteIdentifier(partitionName(table, p)),
+			table,
+			timeLiteral(p.From),
+			timeLiteral(p.To),
+		)); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", table, movedTable(table))); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO event_partitions (partition_from, partition_to) VALUES ($1, $2)", p.From, p.To); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Drop detaches the partition of events before dropping it, the partition of the values that refer to it goes first.
+func (r *PartitionRepository) Drop(p *entity.Partition) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", pq.QuoteIdentifier(partitionName("events_with_metrics", p)))); err != nil {
+		return err
+	}
+
+	events := pq.QuoteIdentifier(partitionName("events", p))
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE events DETACH PARTITION %s", events)); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("DROP TABLE %s", events)); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM event_partitions WHERE partition_from = $1", p.From); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeDefault deletes the oldest events of the default partition, their values are deleted by the cascade.
+func (r *PartitionRepository) PurgeDefault(before time.Time, limit int) (int, error) {
+	res, err := r.db.Exec(
+		`DELETE FROM events_default WHERE time_stamp < $1 AND event_id IN (
+			SELECT event_id FROM events_default WHERE time_stamp < $1 ORDER BY time_stamp LIMIT $2
+		)`,
+		before,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// partitionName names the partition of the table after the day it starts, e.g. events_p20231001.
+func partitionName(table string, p *entity.Partition) string {
+	return table + "_p" + p.From.UTC().Format("20060102")
+}
+
+// movedTable names the temporary table the rows of the default partition of the table are moved through.
+func movedTable(table string) string {
+	return "moved_" + table
+}
+
+func timeLiteral(t time.Time) string {
+	return pq.QuoteLiteral(t.UTC().Format(time.RFC3339Nano))
+}
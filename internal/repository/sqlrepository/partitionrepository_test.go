@@ -0,0 +1,71 @@
+package sqlrepository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/sqlrepository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionRepository(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services, metrics, events, events_with_metrics")
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	m.MetricType = "INT"
+
+	sqlrepository.NewServiceRepository(db).Create(s)
+	sqlrepository.NewMetricRepository(db).Create(m)
+	er := sqlrepository.NewEventRepository(db)
+	pr := sqlrepository.NewPartitionRepository(db)
+
+	// far from the partitions created by the migrations, so the events are in the default partition first
+	ts := time.Date(2100, 1, 15, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		e := entity.TestEvent(t)
+		e.ServiceID = s.ServiceID
+		e.TimeStamp.Time = ts.AddDate(0, i, 0)
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: int64(i)}}))
+	}
+
+	p := entity.PartitionAt(ts, entity.PartitionMonth)
+	assert.NoError(t, pr.Create(p))
+	assert.Error(t, pr.Create(entity.PartitionAt(ts, entity.PartitionDay)))
+
+	partitions, err := pr.List()
+	assert.NoError(t, err)
+	assert.Equal(t, p, partitions[len(partitions)-1])
+
+	values, err := er.GetMetricValuesForTimePeriod(s.ServiceID, [2]*entity.CustomTime{{Time: p.From}, {Time: p.To}}, m, nil)
+	assert.NoError(t, err)
+	assert.Len(t, values, 1)
+
+	// the event of February is left in the default partition until it is purged before the end of a later partition
+	next := entity.PartitionAt(p.To.AddDate(0, 1, 0), entity.PartitionMonth)
+	assert.NoError(t, pr.Create(next))
+	assert.NoError(t, pr.Drop(p))
+
+	n, err := pr.PurgeDefault(p.To, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	c, err := er.ServiceCascade(s.ServiceID)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 1, Values: 1}, c)
+
+	n, err = pr.PurgeDefault(next.To, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoError(t, pr.Drop(next))
+
+	c, err = er.ServiceCascade(s.ServiceID)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 0, Values: 0}, c)
+
+	partitions, err = pr.List()
+	assert.NoError(t, err)
+	assert.NotContains(t, partitions, p)
+}
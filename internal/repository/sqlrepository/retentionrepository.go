@@ -0,0 +1,154 @@
+package sqlrepository
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+)
+
+type RetentionRepository struct {
+	db       *sql.DB
+	tenantID int
+}
+
+func NewRetentionRepository(db *sql.DB) *RetentionRepository {
+	return &RetentionRepository{
+		db:       db,
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *RetentionRepository) ForTenant(tenantID int) repository.RetentionRepository {
+	return &RetentionRepository{
+		db:       r.db,
+		tenantID: tenantID,
+	}
+}
+
+// Save inserts the policy or replaces the policy of its service or metric,
+// a policy of another tenant is never replaced.
+func (r *RetentionRepository) Save(p *entity.RetentionPolicy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	target := "service_id"
+	if p.MetricID != 0 {
+		target = "metric_id"
+	}
+
+	keepRollups := []byte("{}")
+	if len(p.KeepRollups) > 0 {
+		b, err := json.Marshal(p.KeepRollups)
+		if err != nil {
+			return err
+		}
+		keepRollups = b
+	}
+
+	err := r.db.QueryRow(
+		`INSERT INTO retention_policies (tenant_id, service_id, metric_id, keep_raw, keep_rollups) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (`+target+`) DO UPDATE SET keep_raw = EXCLUDED.keep_raw, keep_rollups = EXCLUDED.keep_rollups, updated_at = now()
+		WHERE retention_policies.tenant_id = EXCLUDED.tenant_id
+		RETURNING policy_id, tenant_id, updated_at`,
+		r.tenantID,
+		nullID(p.ServiceID),
+		nullID(p.MetricID),
+		p.KeepRaw,
+		string(keepRollups),
+	).Scan(&p.PolicyID, &p.TenantID, &p.UpdatedAt.Time)
+	if err == sql.ErrNoRows {
+		return repository.ErrRecordNotFound
+	}
+	return translateError(err)
+}
+
+func (r *RetentionRepository) FindByService(serviceID int) (*entity.RetentionPolicy, error) {
+	return r.find("service_id = $1 AND tenant_id = $2", serviceID, r.tenantID)
+}
+
+func (r *RetentionRepository) FindByMetric(metricID int) (*entity.RetentionPolicy, error) {
+	return r.find("metric_id = $1 AND tenant_id = $2", metricID, r.tenantID)
+}
+
+func (r *RetentionRepository) find(condition string, args ...interface{}) (*entity.RetentionPolicy, error) {
+	p, err := scanRetentionPolicy(r.db.QueryRow(
+		"SELECT policy_id, tenant_id, service_id, metric_id, keep_raw, keep_rollups, updated_at FROM retention_policies WHERE "+condition,
+		args...,
+	))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrRecordNotFound
+	}
+	return p, err
+}
+
+func (r *RetentionRepository) List() ([]*entity.RetentionPolicy, error) {
+	return r.list("WHERE tenant_id = $1", r.tenantID)
+}
+
+// All lists the policies of every tenant.
+func (r *RetentionRepository) All() ([]*entity.RetentionPolicy, error) {
+	return r.list("")
+}
+
+func (r *RetentionRepository) list(where string, args ...interface{}) ([]*entity.RetentionPolicy, error) {
+	rows, err := r.db.Query(
+		"SELECT policy_id, tenant_id, service_id, metric_id, keep_raw, keep_rollups, updated_at FROM retention_policies "+where+" ORDER BY policy_id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := make([]*entity.RetentionPolicy, 0)
+	for rows.Next() {
+		p, err := scanRetentionPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+
+	return policies, rows.Err()
+}
+
+func (r *RetentionRepository) Delete(policyID int) error {
+	return execOne(r.db, "DELETE FROM retention_policies WHERE policy_id = $1 AND tenant_id = $2", policyID, r.tenantID)
+}
+
+func scanRetentionPolicy(row interface{ Scan(...interface{}) error }) (*entity.RetentionPolicy, error) {
+	p := &entity.RetentionPolicy{}
+	var serviceID, metricID sql.NullInt64
+	var keepRollups []byte
+
+	if err := row.Scan(
+		&p.PolicyID,
+		&p.TenantID,
+		&serviceID,
+		&metricID,
+		&p.KeepRaw,
+		&keepRollups,
+		&p.UpdatedAt.Time,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(keepRollups, &p.KeepRollups); err != nil {
+		return nil, err
+	}
+	if len(p.KeepRollups) == 0 {
+		p.KeepRollups = nil
+	}
+
+	p.ServiceID = int(serviceID.Int64)
+	p.MetricID = int(metricID.Int64)
+	return p, nil
+}
+
+// nullID stores a zero id as NULL.
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
@@ -0,0 +1,76 @@
+package sqlrepository_test
+
+import (
+	"testing"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/sqlrepository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionRepository_Save(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("retention_policies", "services", "metrics")
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	sqlrepository.NewServiceRepository(db).Create(s)
+	sqlrepository.NewMetricRepository(db).Create(m)
+
+	rr := sqlrepository.NewRetentionRepository(db)
+
+	p1 := &entity.RetentionPolicy{ServiceID: s.ServiceID, KeepRaw: "30d"}
+	assert.NoError(t, rr.Save(p1))
+	assert.NotZero(t, p1.PolicyID)
+
+	p2 := &entity.RetentionPolicy{ServiceID: s.ServiceID, KeepRaw: "7d"}
+	assert.NoError(t, rr.Save(p2))
+	assert.Equal(t, p1.PolicyID, p2.PolicyID)
+
+	p3 := &entity.RetentionPolicy{MetricID: m.MetricID, KeepRaw: "1d"}
+	assert.NoError(t, rr.Save(p3))
+
+	found, err := rr.FindByService(s.ServiceID)
+	assert.NoError(t, err)
+	assert.Equal(t, "7d", found.KeepRaw)
+	assert.Zero(t, found.MetricID)
+
+	found, err = rr.FindByMetric(m.MetricID)
+	assert.NoError(t, err)
+	assert.Equal(t, p3.PolicyID, found.PolicyID)
+
+	assert.EqualError(t, rr.ForTenant(entity.DefaultTenantID+1).Save(p2), repository.ErrRecordNotFound.Error())
+
+	err = rr.Save(&entity.RetentionPolicy{ServiceID: s.ServiceID + 1, KeepRaw: "1d"})
+	assert.ErrorIs(t, err, repository.ErrRecordNotFound)
+}
+
+func TestRetentionRepository_Delete(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("retention_policies", "services")
+
+	s := entity.TestService(t)
+	sr := sqlrepository.NewServiceRepository(db)
+	sr.Create(s)
+
+	rr := sqlrepository.NewRetentionRepository(db)
+
+	p := &entity.RetentionPolicy{ServiceID: s.ServiceID, KeepRaw: "30d"}
+	rr.Save(p)
+
+	policies, err := rr.All()
+	assert.NoError(t, err)
+	assert.Len(t, policies, 1)
+
+	assert.EqualError(t, rr.ForTenant(entity.DefaultTenantID+1).Delete(p.PolicyID), repository.ErrRecordNotFound.Error())
+	assert.NoError(t, rr.Delete(p.PolicyID))
+
+	// the policy of a deleted service is deleted with it
+	rr.Save(p)
+	assert.NoError(t, sr.Delete(s.ServiceID))
+
+	policies, err = rr.List()
+	assert.NoError(t, err)
+	assert.Empty(t, policies)
+}
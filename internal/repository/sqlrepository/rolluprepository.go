@@ -0,0 +1,379 @@
+package sqlrepository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/lib/pq"
+)
+
+// rollupTables maps rollup resolutions to their tables.
+var rollupTables = map[time.Duration]string{
+	time.Minute:    "metric_rollups_1m",
+	time.Hour:      "metric_rollups_1h",
+	24 * time.Hour: "metric_rollups_1d",
+}
+
+// rollupValueColumn reads the value of a metric with rollups as a number, durations in seconds.
+const rollupValueColumn = "coalesce(ewm.value_int::double precision, ewm.value_float, extract(epoch FROM ewm.value_duration)::double precision)"
+
+// rollupColumns are the columns of every rollup table written by Rollup.
+const rollupColumns = "tenant_id, service_id, metric_id, bucket, count, sum, min, max, last, last_time_stamp"
+
+// the buckets of [from, to) are rolled up as a whole, so a rollup written again replaces the previous one
+const rollupConflict = `ON CONFLICT (service_id, metric_id, bucket) DO UPDATE SET count = EXCLUDED.count, sum = EXCLUDED.sum,
+	min = EXCLUDED.min, max = EXCLUDED.max, last = EXCLUDED.last, last_time_stamp = EXCLUDED.last_time_stamp`
+
+var errUnknownRollupResolution = errors.New("unknown rollup resolution")
+
+type RollupRepository struct {
+	db       *sql.DB
+	tenantID int
+}
+
+func NewRollupRepository(db *sql.DB) *RollupRepository {
+	return &RollupRepository{
+		db:       db,
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *RollupRepository) ForTenant(tenantID int) repository.RollupRepository {
+	return &RollupRepository{
+		db:       r.db,
+		tenantID: tenantID,
+	}
+}
+
+func (r *RollupRepository) Watermark(res time.Duration) (time.Time, error) {
+	var t sql.NullTime
+	if err := r.db.QueryRow(
+		"SELECT coalesce((SELECT watermark FROM rollup_watermarks WHERE resolution = $1), (SELECT min(time_stamp) FROM events))",
+		entity.FormatBucket(res),
+	).Scan(&t); err != nil {
+		return time.Time{}, err
+	}
+	return t.Time, nil
+}
+
+// Rollup writes the rollups and the watermark in one transaction.
+func (r *RollupRepository) Rollup(res time.Duration, from, to time.Time) (int, error) {
+	table, ok := rollupTables[res]
+	if !ok {
+		return 0, errUnknownRollupResolution
+	}
+
+	var query string
+	if finer, ok := entity.FinerRollupResolution(res); ok {
+		query = fmt.Sprintf(
+			`INSERT INTO %s (%s)
+			SELECT r.tenant_id, r.service_id, r.metric_id, to_timestamp(floor(extract(epoch FROM r.bucket) / $3) * $3),
+				sum(r.count), sum(r.sum), min(r.min), max(r.max), (array_agg(r.last ORDER BY r.last_time_stamp DESC))[1], max(r.last_time_stamp)
+			FROM %s r
+			WHERE r.bucket >= $1 AND r.bucket < $2
+			GROUP BY 1, 2, 3, 4
+			%s`,
+			table,
+			rollupColumns,
+			rollupTables[finer],
+			rollupConflict,
+		)
+	} else {
+		query = fmt.Sprintf(
+			`INSERT INTO %s (%s)
+			SELECT e.tenant_id, e.service_id, ewm.metric_id, to_timestamp(floor(extract(epoch FROM e.time_stamp) / $3) * $3),
+				count(*), sum(v.value), min(v.value), max(v.value), (array_agg(v.value ORDER BY e.time_stamp DESC))[1], max(e.time_stamp)
+			FROM events e JOIN events_with_metrics ewm ON ewm.event_id = e.event_id AND ewm.time_stamp = e.time_stamp, LATERAL (SELECT %s AS value) v
+			WHERE e.time_stamp >= $1 AND e.time_stamp < $2 AND ewm.time_stamp >= $1 AND ewm.time_stamp < $2 AND v.value IS NOT NULL
+			GROUP BY 1, 2, 3, 4
+			%s`,
+			table,
+			rollupColumns,
+			rollupValueColumn,
+			rollupConflict,
+		)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// values written meanwhile are either rolled up or checked against the new watermark, see markLateValues
+	if _, err := tx.Exec("SELECT watermark FROM rollup_watermarks WHERE resolution = $1 FOR UPDATE", entity.FormatBucket(res)); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(query, from, to, res.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO rollup_watermarks (resolution, watermark) VALUES ($1, $2)
+		ON CONFLICT (resolution) DO UPDATE SET watermark = EXCLUDED.watermark`,
+		entity.FormatBucket(res),
+		to,
+	); err != nil {
+		return 0, err
+	}
+
+	return int(n), tx.Commit()
+}
+
+// lateBuckets selects the distinct buckets of the resolution of $3 seconds the late minutes belong to,
+// given as the ids of their services in $1 and their epochs in $2.
+const lateBuckets = `(SELECT DISTINCT l.service_id, to_timestamp(floor(l.bucket / $3) * $3) AS bucket
+	FROM unnest($1::bigint[], $2::bigint[]) AS l(service_id, bucket)) l`
+
+// RollupLate takes the late minutes and rolls every resolution of them up again in one transaction,
+// the late minutes taken by a concurrent call are skipped.
+func (r *RollupRepository) RollupLate(limit int) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`DELETE FROM rollup_late_values WHERE (service_id, bucket) IN (
+			SELECT service_id, bucket FROM rollup_late_values ORDER BY bucket LIMIT $1 FOR UPDATE SKIP LOCKED
+		) RETURNING service_id, extract(epoch FROM bucket)::bigint`,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	serviceIDs := make([]int64, 0)
+	buckets := make([]int64, 0)
+	for rows.Next() {
+		var serviceID, bucket int64
+		if err := rows.Scan(&serviceID, &bucket); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		serviceIDs = append(serviceIDs, serviceID)
+		buckets = append(buckets, bucket)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(serviceIDs) == 0 {
+		return 0, nil
+	}
+
+	for _, res := range entity.RollupResolutions {
+		var watermark time.Time
+		err := tx.QueryRow("SELECT watermark FROM rollup_watermarks WHERE resolution = $1", entity.FormatBucket(res)).Scan(&watermark)
+		if err == sql.ErrNoRows {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := tx.Exec(rollupLateQuery(res), pq.Array(serviceIDs), pq.Array(buckets), res.Seconds(), watermark); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(serviceIDs), tx.Commit()
+}
+
+// rollupLateQuery rolls up again the buckets of the resolution selected by lateBuckets like Rollup does.
+func rollupLateQuery(res time.Duration) string {
+	if finer, ok := entity.FinerRollupResolution(res); ok {
+		return fmt.Sprintf(
+			`INSERT INTO %s (%s)
+			SELECT r.tenant_id, r.service_id, r.metric_id, l.bucket,
+				sum(r.count), sum(r.sum), min(r.min), max(r.max), (array_agg(r.last ORDER BY r.last_time_stamp DESC))[1], max(r.last_time_stamp)
+			FROM %s JOIN %s r ON r.service_id = l.service_id AND r.bucket >= l.bucket AND r.bucket < l.bucket + make_interval(secs => $3)
+			WHERE l.bucket < $4
+			GROUP BY 1, 2, 3, 4
+			%s`,
+			rollupTables[res],
+			rollupColumns,
+			lateBuckets,
+			rollupTables[finer],
+			rollupConflict,
+		)
+	}
+
+	return fmt.Sprintf(
+		`INSERT INTO %s (%s)
+		SELECT e.tenant_id, e.service_id, ewm.metric_id, l.bucket,
+			count(*), sum(v.value), min(v.value), max(v.value), (array_agg(v.value ORDER BY e.time_stamp DESC))[1], max(e.time_stamp)
+		FROM %s
+			JOIN events e ON e.service_id = l.service_id AND e.time_stamp >= l.bucket AND e.time_stamp < l.bucket + make_interval(secs => $3)
+			JOIN events_with_metrics ewm ON ewm.event_id = e.event_id AND ewm.time_stamp = e.time_stamp
+				AND ewm.time_stamp >= l.bucket AND ewm.time_stamp < l.bucket + make_interval(secs => $3),
+			LATERAL (SELECT %s AS value) v
+		WHERE l.bucket < $4 AND v.value IS NOT NULL
+		GROUP BY 1, 2, 3, 4
+		%s`,
+		rollupTables[res],
+		rollupColumns,
+		lateBuckets,
+		rollupValueColumn,
+		rollupConflict,
+	)
+}
+
+func (r *RollupRepository) Late(serviceID int, p [2]*entity.CustomTime) (bool, error) {
+	var late bool
+	err := r.db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM rollup_late_values WHERE service_id = $1 AND bucket > $2 AND bucket < $3)",
+		serviceID,
+		p[0].Add(-time.Minute),
+		p[1].Time,
+	).Scan(&late)
+	return late, err
+}
+
+// markLateValues records the minutes of the values of the services stamped behind the watermark
+// of the finest rollups for RollupLate. The watermark is locked until tx ends, so a concurrent rollup
+// either sees the values or moves the watermark before they are checked against it.
+func markLateValues(tx *sql.Tx, stamps map[int][]time.Time) error {
+	if len(stamps) == 0 {
+		return nil
+	}
+
+	res := entity.RollupResolutions[0]
+
+	var watermark time.Time
+	err := tx.QueryRow("SELECT watermark FROM rollup_watermarks WHERE resolution = $1 FOR SHARE", entity.FormatBucket(res)).Scan(&watermark)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	a := &entity.Aggregation{Bucket: res}
+	serviceIDs := make([]int64, 0)
+	buckets := make([]int64, 0)
+	for serviceID, ts := range stamps {
+		for _, t := range ts {
+			if t.Before(watermark) {
+				serviceIDs = append(serviceIDs, int64(serviceID))
+				buckets = append(buckets, a.BucketStart(t).Unix())
+			}
+		}
+	}
+
+	if len(serviceIDs) == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO rollup_late_values (service_id, bucket)
+		SELECT DISTINCT l.service_id, to_timestamp(l.bucket) FROM unnest($1::bigint[], $2::bigint[]) AS l(service_id, bucket)
+		ON CONFLICT DO NOTHING`,
+		pq.Array(serviceIDs),
+		pq.Array(buckets),
+	)
+	return err
+}
+
+func (r *RollupRepository) Aggregate(serviceID int, p [2]*entity.CustomTime, m *entity.Metric, a *entity.Aggregation, res time.Duration) ([]*entity.AggregatedMetric, error) {
+	table, ok := rollupTables[res]
+	if !ok {
+		return nil, errUnknownRollupResolution
+	}
+
+	columns := make([]string, len(a.Functions))
+	for i, f := range a.Functions {
+		columns[i] = rollupFunctionExpression(f, m.MetricType)
+	}
+
+	rows, err := r.db.Query(
+		fmt.Sprintf(
+			`SELECT to_timestamp(floor(extract(epoch FROM r.bucket) / $5) * $5) AS bucket, %s FROM %s r WHERE r.tenant_id = $6 AND r.service_id = $1 AND (r.bucket >= $2 AND r.bucket < $3) AND r.metric_id = $4 GROUP BY bucket ORDER BY bucket`,
+			strings.Join(columns, ", "),
+			table,
+		),
+		serviceID,
+		p[0].Time,
+		p[1].Time,
+		m.MetricID,
+		a.Bucket.Seconds(),
+		r.tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAggregatedMetrics(rows, m.MetricType, a, nil)
+}
+
+func (r *RollupRepository) PurgeService(res time.Duration, serviceID int, before time.Time, limit int) (int, error) {
+	return r.purge(res, "service_id", serviceID, before, limit)
+}
+
+func (r *RollupRepository) PurgeMetric(res time.Duration, metricID int, before time.Time, limit int) (int, error) {
+	return r.purge(res, "metric_id", metricID, before, limit)
+}
+
+// purge deletes the oldest rollups of the resolution whose column equals id.
+func (r *RollupRepository) purge(res time.Duration, column string, id int, before time.Time, limit int) (int, error) {
+	table, ok := rollupTables[res]
+	if !ok {
+		return 0, errUnknownRollupResolution
+	}
+
+	result, err := r.db.Exec(
+		fmt.Sprintf(
+			`DELETE FROM %[1]s WHERE (service_id, metric_id, bucket) IN (
+				SELECT service_id, metric_id, bucket FROM %[1]s WHERE %[2]s = $1 AND tenant_id = $2 AND bucket < $3 ORDER BY bucket LIMIT $4
+			)`,
+			table,
+			column,
+		),
+		id,
+		r.tenantID,
+		before,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// rollupFunctionExpression renders the aggregate for function f over the rollups r,
+// the results of INT metrics other than avg and count are rounded back to integers.
+func rollupFunctionExpression(f, metricType string) string {
+	var x string
+	switch f {
+	case "count":
+		return "sum(r.count)"
+	case "avg":
+		return "sum(r.sum) / sum(r.count)"
+	case "last":
+		x = "(array_agg(r.last ORDER BY r.last_time_stamp DESC))[1]"
+	default:
+		x = fmt.Sprintf("%s(r.%s)", f, f)
+	}
+
+	if metricType == "INT" {
+		return fmt.Sprintf("round(%s)::bigint", x)
+	}
+	return x
+}
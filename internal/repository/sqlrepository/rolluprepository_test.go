@@ -0,0 +1,156 @@
+package sqlrepository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/sqlrepository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollupRepository_Rollup(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services, metrics, events, events_with_metrics, metric_rollups_1m, metric_rollups_1h, metric_rollups_1d, rollup_watermarks")
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	m.MetricType = "INT"
+
+	sqlrepository.NewServiceRepository(db).Create(s)
+	sqlrepository.NewMetricRepository(db).Create(m)
+	er := sqlrepository.NewEventRepository(db)
+	ur := sqlrepository.NewRollupRepository(db)
+
+	watermark, err := ur.Watermark(time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, watermark.IsZero())
+
+	day := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i, minutes := range []int{0, 0, 1, 61, 62} {
+		e := entity.TestEvent(t)
+		e.ServiceID = s.ServiceID
+		e.TimeStamp.Time = day.Add(time.Duration(minutes)*time.Minute + time.Duration(i)*time.Second)
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: int64((i + 1) * 10)}}))
+	}
+
+	watermark, err = ur.Watermark(time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, day.Equal(watermark))
+
+	n, err := ur.Rollup(time.Minute, day, day.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	n, err = ur.Rollup(time.Hour, day, day.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	watermark, err = ur.Watermark(time.Hour)
+	assert.NoError(t, err)
+	assert.True(t, day.Add(2*time.Hour).Equal(watermark))
+
+	p := [2]*entity.CustomTime{{Time: day}, {Time: day.Add(2 * time.Hour)}}
+	a := &entity.Aggregation{Bucket: time.Hour, Functions: []string{"count", "sum", "max", "last"}}
+	for _, res := range []time.Duration{time.Minute, time.Hour} {
+		buckets, err := ur.Aggregate(s.ServiceID, p, m, a, res)
+		assert.NoError(t, err)
+		assert.Len(t, buckets, 2)
+		assert.Equal(t, map[string]interface{}{"count": 3, "sum": int64(60), "max": int64(30), "last": int64(30)}, buckets[0].Values)
+		assert.Equal(t, map[string]interface{}{"count": 2, "sum": int64(90), "max": int64(50), "last": int64(50)}, buckets[1].Values)
+	}
+
+	_, err = ur.ForTenant(entity.DefaultTenantID+1).Aggregate(s.ServiceID, p, m, a, time.Hour)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+}
+
+func TestRollupRepository_RollupLate(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services, metrics, events, events_with_metrics, metric_rollups_1m, metric_rollups_1h, rollup_watermarks, rollup_late_values")
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	m.MetricType = "INT"
+
+	sqlrepository.NewServiceRepository(db).Create(s)
+	sqlrepository.NewMetricRepository(db).Create(m)
+	er := sqlrepository.NewEventRepository(db)
+	ur := sqlrepository.NewRollupRepository(db)
+
+	day := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	create := func(ts time.Time, v int64) {
+		e := entity.TestEvent(t)
+		e.ServiceID = s.ServiceID
+		e.TimeStamp.Time = ts
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: v}}))
+	}
+
+	create(day.Add(10*time.Minute), 10)
+	for _, res := range []time.Duration{time.Minute, time.Hour} {
+		_, err := ur.Rollup(res, day, day.Add(2*time.Hour))
+		assert.NoError(t, err)
+	}
+
+	p := [2]*entity.CustomTime{{Time: day}, {Time: day.Add(time.Hour)}}
+	create(day.Add(10*time.Minute+30*time.Second), 20)
+	create(day.Add(90*time.Minute), 30)
+
+	late, err := ur.Late(s.ServiceID, p)
+	assert.NoError(t, err)
+	assert.True(t, late)
+
+	n, err := ur.RollupLate(10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	late, err = ur.Late(s.ServiceID, p)
+	assert.NoError(t, err)
+	assert.False(t, late)
+
+	a := &entity.Aggregation{Bucket: time.Hour, Functions: []string{"count", "sum"}}
+	for _, res := range []time.Duration{time.Minute, time.Hour} {
+		buckets, err := ur.Aggregate(s.ServiceID, [2]*entity.CustomTime{{Time: day}, {Time: day.Add(2 * time.Hour)}}, m, a, res)
+		assert.NoError(t, err)
+		assert.Len(t, buckets, 2)
+		assert.Equal(t, map[string]interface{}{"count": 2, "sum": int64(30)}, buckets[0].Values)
+		assert.Equal(t, map[string]interface{}{"count": 1, "sum": int64(30)}, buckets[1].Values)
+	}
+}
+
+func TestRollupRepository_Purge(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services, metrics, events, events_with_metrics, metric_rollups_1m, rollup_watermarks")
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	m.MetricType = "FLOAT"
+
+	sqlrepository.NewServiceRepository(db).Create(s)
+	sqlrepository.NewMetricRepository(db).Create(m)
+	er := sqlrepository.NewEventRepository(db)
+	ur := sqlrepository.NewRollupRepository(db)
+
+	day := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		e := entity.TestEvent(t)
+		e.ServiceID = s.ServiceID
+		e.TimeStamp.Time = day.Add(time.Duration(i) * time.Minute)
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: 1.5}}))
+	}
+
+	_, err := ur.Rollup(time.Minute, day, day.Add(time.Hour))
+	assert.NoError(t, err)
+
+	n, err := ur.ForTenant(entity.DefaultTenantID+1).PurgeService(time.Minute, s.ServiceID, day.Add(time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	n, err = ur.PurgeMetric(time.Minute, m.MetricID, day.Add(2*time.Minute), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = ur.PurgeService(time.Minute, s.ServiceID, day.Add(time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
@@ -8,12 +8,21 @@ import (
 )
 
 type ServiceRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	tenantID int
 }
 
 func NewServiceRepository(db *sql.DB) *ServiceRepository {
 	return &ServiceRepository{
-		db: db,
+		db:       db,
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *ServiceRepository) ForTenant(tenantID int) repository.ServiceRepository {
+	return &ServiceRepository{
+		db:       r.db,
+		tenantID: tenantID,
 	}
 }
 
@@ -23,26 +32,114 @@ func (r *ServiceRepository) Create(s *entity.Service) error {
 	}
 
 	return r.db.QueryRow(
-		"INSERT INTO services (slug, details) VALUES ($1, $2) RETURNING service_id",
+		"INSERT INTO services (tenant_id, slug, details) VALUES ($1, $2, $3) RETURNING service_id",
+		r.tenantID,
 		s.Slug,
 		s.Details,
 	).Scan(&s.ServiceID)
 }
 
 func (r *ServiceRepository) FindByID(serviceID int) (*entity.Service, error) {
+	return r.find("service_id = $2", serviceID)
+}
+
+// FindBySlug normalizes the slug the same way Create does before looking the service up.
+func (r *ServiceRepository) FindBySlug(slug string) (*entity.Service, error) {
+	return r.find("slug = $2", entity.NormalizeSlug(slug))
+}
+
+func (r *ServiceRepository) find(condition string, arg interface{}) (*entity.Service, error) {
 	s := &entity.Service{}
+	var t sql.NullTime
 	if err := r.db.QueryRow(
-		"SELECT service_id, slug, details FROM services WHERE service_id = $1",
-		serviceID,
+		"SELECT service_id, slug, details, archived, archived_at FROM services WHERE tenant_id = $1 AND "+condition,
+		r.tenantID,
+		arg,
 	).Scan(
 		&s.ServiceID,
 		&s.Slug,
 		&s.Details,
+		&s.Archived,
+		&t,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, repository.ErrRecordNotFound
 		}
 		return nil, err
 	}
+	s.ArchivedAt = archivedAt(t)
 	return s, nil
 }
+
+func (r *ServiceRepository) List(o *entity.ListOptions) ([]*entity.Service, error) {
+	clauses, args, err := listClauses("service_id", r.tenantID, o)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query("SELECT service_id, slug, details, archived, archived_at FROM services"+clauses, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	services := make([]*entity.Service, 0)
+	for rows.Next() {
+		s := &entity.Service{}
+		var t sql.NullTime
+		if err := rows.Scan(
+			&s.ServiceID,
+			&s.Slug,
+			&s.Details,
+			&s.Archived,
+			&t,
+		); err != nil {
+			return nil, err
+		}
+		s.ArchivedAt = archivedAt(t)
+		services = append(services, s)
+	}
+
+	return services, rows.Err()
+}
+
+// Update replaces the slug and details of the service, the archive state is kept.
+func (r *ServiceRepository) Update(s *entity.Service) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	var t sql.NullTime
+	if err := r.db.QueryRow(
+		"UPDATE services SET slug = $3, details = $4 WHERE service_id = $1 AND tenant_id = $2 RETURNING archived, archived_at",
+		s.ServiceID,
+		r.tenantID,
+		s.Slug,
+		s.Details,
+	).Scan(
+		&s.Archived,
+		&t,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return repository.ErrRecordNotFound
+		}
+		return err
+	}
+	s.ArchivedAt = archivedAt(t)
+	return nil
+}
+
+// Archive marks the service as archived, archiving it again keeps the original time.
+func (r *ServiceRepository) Archive(serviceID int) error {
+	return execOne(
+		r.db,
+		"UPDATE services SET archived = true, archived_at = COALESCE(archived_at, now()) WHERE service_id = $1 AND tenant_id = $2",
+		serviceID,
+		r.tenantID,
+	)
+}
+
+// Delete removes the service, its events and their metric values are removed by cascade.
+func (r *ServiceRepository) Delete(serviceID int) error {
+	return execOne(r.db, "DELETE FROM services WHERE service_id = $1 AND tenant_id = $2", serviceID, r.tenantID)
+}
@@ -35,3 +35,109 @@ func TestServiceRepository_FindByID(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, s2)
 }
+
+func TestServiceRepository_List(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services")
+
+	sr := sqlrepository.NewServiceRepository(db)
+
+	for _, slug := range []string{"NOTE_BOOK", "TODO_APP", "NOTE_PAD"} {
+		s := entity.TestService(t)
+		s.Slug = slug
+		sr.Create(s)
+	}
+
+	o := &entity.ListOptions{Limit: 2, SortBy: "slug"}
+	assert.NoError(t, o.Validate())
+
+	page, err := sr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 2)
+	assert.Equal(t, "NOTE_BOOK", page[0].Slug)
+	assert.Equal(t, "NOTE_PAD", page[1].Slug)
+
+	o.Cursor = o.NextCursor(page[1].ServiceID, page[1].Slug)
+	page, err = sr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Equal(t, "TODO_APP", page[0].Slug)
+
+	o = &entity.ListOptions{Order: "desc", SlugPrefix: "note", Search: "WORD"}
+	assert.NoError(t, o.Validate())
+
+	page, err = sr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 2)
+	assert.Equal(t, "NOTE_PAD", page[0].Slug)
+}
+
+func TestServiceRepository_Update(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services")
+
+	sr := sqlrepository.NewServiceRepository(db)
+
+	s := entity.TestService(t)
+	assert.Equal(t, repository.ErrRecordNotFound, sr.Update(s))
+
+	sr.Create(s)
+
+	updated := &entity.Service{ServiceID: s.ServiceID, Slug: "note pad", Details: "Notes"}
+	assert.NoError(t, sr.Update(updated))
+
+	found, err := sr.FindByID(s.ServiceID)
+	assert.NoError(t, err)
+	assert.Equal(t, "NOTE_PAD", found.Slug)
+	assert.Equal(t, "Notes", found.Details)
+}
+
+func TestServiceRepository_Archive(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services")
+
+	sr := sqlrepository.NewServiceRepository(db)
+
+	s := entity.TestService(t)
+	sr.Create(s)
+
+	assert.NoError(t, sr.Archive(s.ServiceID))
+	assert.Equal(t, repository.ErrRecordNotFound, sr.Archive(s.ServiceID+1))
+
+	found, err := sr.FindByID(s.ServiceID)
+	assert.NoError(t, err)
+	assert.True(t, found.Archived)
+	assert.NotNil(t, found.ArchivedAt)
+
+	o := &entity.ListOptions{}
+	assert.NoError(t, o.Validate())
+
+	page, err := sr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 0)
+
+	o.IncludeArchived = true
+	page, err = sr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+
+	assert.NoError(t, sr.Delete(s.ServiceID))
+	assert.Equal(t, repository.ErrRecordNotFound, sr.Delete(s.ServiceID))
+}
+
+func TestServiceRepository_FindBySlug(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services")
+
+	s1 := entity.TestService(t)
+	sr := sqlrepository.NewServiceRepository(db)
+
+	sr.Create(s1)
+
+	_, err := sr.FindBySlug("TODO_APP")
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	s2, err := sr.FindBySlug(" note book ")
+	assert.NoError(t, err)
+	assert.Equal(t, s1.ServiceID, s2.ServiceID)
+}
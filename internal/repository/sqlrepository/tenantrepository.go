@@ -0,0 +1,80 @@
+package sqlrepository
+
+import (
+	"database/sql"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+)
+
+type TenantRepository struct {
+	db *sql.DB
+}
+
+func NewTenantRepository(db *sql.DB) *TenantRepository {
+	return &TenantRepository{
+		db: db,
+	}
+}
+
+func (r *TenantRepository) Create(t *entity.Tenant) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	return r.db.QueryRow(
+		"INSERT INTO tenants (slug, details) VALUES ($1, $2) RETURNING tenant_id",
+		t.Slug,
+		t.Details,
+	).Scan(&t.TenantID)
+}
+
+func (r *TenantRepository) FindByID(tenantID int) (*entity.Tenant, error) {
+	return r.find("tenant_id = $1", tenantID)
+}
+
+// FindBySlug normalizes the slug the same way Create does before looking the tenant up.
+func (r *TenantRepository) FindBySlug(slug string) (*entity.Tenant, error) {
+	return r.find("slug = $1", entity.NormalizeSlug(slug))
+}
+
+func (r *TenantRepository) find(condition string, arg interface{}) (*entity.Tenant, error) {
+	t := &entity.Tenant{}
+	if err := r.db.QueryRow(
+		"SELECT tenant_id, slug, details FROM tenants WHERE "+condition,
+		arg,
+	).Scan(
+		&t.TenantID,
+		&t.Slug,
+		&t.Details,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *TenantRepository) List() ([]*entity.Tenant, error) {
+	rows, err := r.db.Query("SELECT tenant_id, slug, details FROM tenants ORDER BY tenant_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := make([]*entity.Tenant, 0)
+	for rows.Next() {
+		t := &entity.Tenant{}
+		if err := rows.Scan(
+			&t.TenantID,
+			&t.Slug,
+			&t.Details,
+		); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+
+	return tenants, rows.Err()
+}
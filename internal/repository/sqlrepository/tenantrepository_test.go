@@ -0,0 +1,86 @@
+package sqlrepository_test
+
+import (
+	"testing"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/sqlrepository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantRepository_Create(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("tenants")
+
+	tenant := entity.TestTenant(t)
+	tr := sqlrepository.NewTenantRepository(db)
+
+	assert.NoError(t, tr.Create(tenant))
+	assert.NotEqual(t, entity.DefaultTenantID, tenant.TenantID)
+
+	assert.Error(t, tr.Create(entity.TestTenant(t)))
+}
+
+func TestTenantRepository_FindBySlug(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("tenants")
+
+	tr := sqlrepository.NewTenantRepository(db)
+
+	_, err := tr.FindBySlug("team_a")
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	tenant := entity.TestTenant(t)
+	tr.Create(tenant)
+
+	got, err := tr.FindBySlug("team_a")
+	assert.NoError(t, err)
+	assert.Equal(t, tenant.TenantID, got.TenantID)
+
+	tenants, err := tr.List()
+	assert.NoError(t, err)
+	assert.Len(t, tenants, 2)
+}
+
+func TestTenantRepository_Isolation(t *testing.T) {
+	db, teardown := sqlrepository.TestDB(t, testDatabaseURL)
+	defer teardown("services", "metrics", "events", "events_with_metrics", "tenants")
+
+	tenant := entity.TestTenant(t)
+	sqlrepository.NewTenantRepository(db).Create(tenant)
+
+	sr := sqlrepository.NewServiceRepository(db)
+	mr := sqlrepository.NewMetricRepository(db)
+	er := sqlrepository.NewEventRepository(db)
+
+	s1 := entity.TestService(t)
+	assert.NoError(t, sr.Create(s1))
+	m1 := entity.TestMetric(t)
+	assert.NoError(t, mr.Create(m1))
+
+	// the same slugs are free in another tenant
+	s2 := entity.TestService(t)
+	assert.NoError(t, sr.ForTenant(tenant.TenantID).Create(s2))
+	m2 := entity.TestMetric(t)
+	assert.NoError(t, mr.ForTenant(tenant.TenantID).Create(m2))
+
+	_, err := sr.ForTenant(tenant.TenantID).FindByID(s1.ServiceID)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	_, err = mr.ForTenant(tenant.TenantID).FindBySlug(m1.Slug)
+	assert.NoError(t, err)
+
+	// an event cannot refer to a service or a metric of another tenant
+	e := entity.TestEvent(t)
+	e.ServiceID = s1.ServiceID
+	assert.Error(t, er.ForTenant(tenant.TenantID).Create(e))
+
+	e = entity.TestEvent(t)
+	e.ServiceID = s2.ServiceID
+	assert.NoError(t, er.ForTenant(tenant.TenantID).Create(e))
+
+	metrics := []*entity.AddMetric{{MetricID: m1.MetricID, MetricValue: 1}}
+	assert.ErrorIs(t, er.ForTenant(tenant.TenantID).AddMetricsToEvent(e.EventID, metrics), repository.ErrRecordNotFound)
+	assert.ErrorIs(t, er.AddMetricsToEvent(e.EventID, metrics), repository.ErrRecordNotFound)
+}
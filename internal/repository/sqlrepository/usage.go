@@ -0,0 +1,70 @@
+package sqlrepository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/lib/pq"
+)
+
+// dateLayout formats the days of service_usage.
+const dateLayout = "2006-01-02"
+
+// addUsage adds the events and the metric values written within tx to the usage of their services today.
+func addUsage(tx *sql.Tx, usage map[int]*entity.Usage) error {
+	day := entity.UsageDay(time.Now()).Format(dateLayout)
+
+	for _, u := range usage {
+		if _, err := tx.Exec(
+			`INSERT INTO service_usage (service_id, day, events, metric_values) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (service_id, day) DO UPDATE SET
+				events = service_usage.events + EXCLUDED.events,
+				metric_values = service_usage.metric_values + EXCLUDED.metric_values`,
+			u.ServiceID,
+			day,
+			u.Events,
+			u.MetricValues,
+		); err != nil {
+			return translateError(err)
+		}
+	}
+
+	return nil
+}
+
+// Usage returns the usage of the services of the tenant on the day, of all of them if serviceIDs is empty.
+// Services without writes on the day are left out.
+func (r *EventRepository) Usage(day time.Time, serviceIDs []int) ([]*entity.Usage, error) {
+	query := `SELECT u.service_id, u.events, u.metric_values
+		FROM service_usage u JOIN services s ON s.service_id = u.service_id
+		WHERE s.tenant_id = $1 AND u.day = $2`
+	args := []interface{}{r.tenantID, entity.UsageDay(day).Format(dateLayout)}
+
+	if len(serviceIDs) > 0 {
+		args = append(args, pq.Array(serviceIDs))
+		query += fmt.Sprintf(" AND u.service_id = ANY($%d)", len(args))
+	}
+
+	rows, err := r.db.Query(query+" ORDER BY u.service_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make([]*entity.Usage, 0)
+	for rows.Next() {
+		u := &entity.Usage{}
+		if err := rows.Scan(
+			&u.ServiceID,
+			&u.Events,
+			&u.MetricValues,
+		); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+
+	return usage, rows.Err()
+}
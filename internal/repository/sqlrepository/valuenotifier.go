@@ -0,0 +1,221 @@
+package sqlrepository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/lib/pq"
+)
+
+// valuesChannel is the channel of LISTEN/NOTIFY the values are sent to.
+const valuesChannel = "dwh_values"
+
+// maxNotifyPayload keeps notifications below the 8000 bytes limit of Postgres.
+const maxNotifyPayload = 7900
+
+// ValueNotifier relays the values of stored events between the replicas of the app with LISTEN/NOTIFY.
+type ValueNotifier struct {
+	db          *sql.DB
+	databaseURL string
+	listener    *pq.Listener
+}
+
+func NewValueNotifier(db *sql.DB, databaseURL string) *ValueNotifier {
+	return &ValueNotifier{
+		db:          db,
+		databaseURL: databaseURL,
+	}
+}
+
+// notifiedValue is a value in a notification, the kind of the value tells how v is decoded.
+type notifiedValue struct {
+	EventID   int             `json:"e"`
+	TimeStamp int64           `json:"t"`
+	ServiceID int             `json:"s"`
+	MetricID  int             `json:"m"`
+	Kind      string          `json:"k"`
+	Value     json.RawMessage `json:"v"`
+}
+
+// Notify sends values in as many notifications as they take, the notifications are sent in one transaction,
+// so either all of them are delivered or none.
+func (n *ValueNotifier) Notify(values []*entity.LiveValue) error {
+	payloads, err := encodeValues(values)
+	if err != nil {
+		return err
+	}
+
+	tx, err := n.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range payloads {
+		if _, err := tx.Exec("SELECT pg_notify($1, $2)", valuesChannel, p); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Listen passes the values of every notification to fn in a goroutine of its own until the notifier is closed.
+// Notifications sent while the connection is lost are not delivered.
+func (n *ValueNotifier) Listen(fn func([]*entity.LiveValue)) error {
+	l := pq.NewListener(n.databaseURL, 10*time.Second, time.Minute, nil)
+	if err := l.Listen(valuesChannel); err != nil {
+		l.Close()
+		return err
+	}
+	n.listener = l
+
+	go func() {
+		for notification := range l.Notify {
+			// nil is sent after the connection is reestablished
+			if notification == nil {
+				continue
+			}
+
+			values, err := decodeValues(notification.Extra)
+			if err != nil {
+				continue
+			}
+			fn(values)
+		}
+	}()
+
+	return nil
+}
+
+func (n *ValueNotifier) Close() error {
+	if n.listener == nil {
+		return nil
+	}
+	return n.listener.Close()
+}
+
+// encodeValues packs values into JSON arrays of up to maxNotifyPayload bytes.
+func encodeValues(values []*entity.LiveValue) ([]string, error) {
+	payloads := make([]string, 0, 1)
+	batch := make([]byte, 0, maxNotifyPayload)
+
+	for _, v := range values {
+		nv := &notifiedValue{
+			EventID:   v.EventID,
+			TimeStamp: v.TimeStamp.UnixNano(),
+			ServiceID: v.ServiceID,
+			MetricID:  v.MetricID,
+		}
+
+		var raw interface{}
+		switch value := v.Value.(type) {
+		case int64, int:
+			nv.Kind, raw = "i", value
+		case float64:
+			nv.Kind, raw = "f", value
+		case time.Duration:
+			nv.Kind, raw = "d", int64(value)
+		case time.Time:
+			nv.Kind, raw = "t", value.Format(time.RFC3339Nano)
+		case bool:
+			nv.Kind, raw = "b", value
+		case string:
+			nv.Kind, raw = "s", value
+		default:
+			return nil, fmt.Errorf("%w: unsupported type %T", entity.ErrInvalidMetricValue, value)
+		}
+
+		var err error
+		if nv.Value, err = json.Marshal(raw); err != nil {
+			return nil, err
+		}
+
+		b, err := json.Marshal(nv)
+		if err != nil {
+			return nil, err
+		}
+
+		// an array of one value or a comma and the closing bracket take 2 bytes
+		if len(b)+2 > maxNotifyPayload {
+			return nil, fmt.Errorf("value of metric_id %d is too large to be notified", v.MetricID)
+		}
+
+		if len(batch) > 0 && len(batch)+len(b)+2 > maxNotifyPayload {
+			payloads = append(payloads, string(append(batch, ']')))
+			batch = batch[:0]
+		}
+
+		if len(batch) == 0 {
+			batch = append(batch, '[')
+		} else {
+			batch = append(batch, ',')
+		}
+		batch = append(batch, b...)
+	}
+
+	if len(batch) > 0 {
+		payloads = append(payloads, string(append(batch, ']')))
+	}
+
+	return payloads, nil
+}
+
+// decodeValues reads the values of a notification in the types of entity.Metric.ParseValue.
+func decodeValues(payload string) ([]*entity.LiveValue, error) {
+	var nvs []*notifiedValue
+	if err := json.Unmarshal([]byte(payload), &nvs); err != nil {
+		return nil, err
+	}
+
+	values := make([]*entity.LiveValue, len(nvs))
+	for i, nv := range nvs {
+		v := &entity.LiveValue{
+			EventID:   nv.EventID,
+			TimeStamp: entity.CustomTime{Time: time.Unix(0, nv.TimeStamp).UTC()},
+			ServiceID: nv.ServiceID,
+			MetricID:  nv.MetricID,
+		}
+
+		var err error
+		switch nv.Kind {
+		case "i":
+			var i int64
+			err = json.Unmarshal(nv.Value, &i)
+			v.Value = i
+		case "f":
+			var f float64
+			err = json.Unmarshal(nv.Value, &f)
+			v.Value = f
+		case "d":
+			var d int64
+			err = json.Unmarshal(nv.Value, &d)
+			v.Value = time.Duration(d)
+		case "t":
+			var s string
+			if err = json.Unmarshal(nv.Value, &s); err == nil {
+				v.Value, err = time.Parse(time.RFC3339Nano, s)
+			}
+		case "b":
+			var b bool
+			err = json.Unmarshal(nv.Value, &b)
+			v.Value = b
+		case "s":
+			var s string
+			err = json.Unmarshal(nv.Value, &s)
+			v.Value = s
+		default:
+			err = fmt.Errorf("unknown kind %q", nv.Kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = v
+	}
+
+	return values, nil
+}
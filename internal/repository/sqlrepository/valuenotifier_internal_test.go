@@ -0,0 +1,54 @@
+package sqlrepository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeValues(t *testing.T) {
+	ts := entity.CustomTime{Time: time.Date(2023, 10, 20, 12, 0, 0, 0, time.UTC)}
+
+	values := []*entity.LiveValue{
+		{EventID: 1, TimeStamp: ts, ServiceID: 1, MetricID: 1, Value: int64(5)},
+		{EventID: 1, TimeStamp: ts, ServiceID: 1, MetricID: 2, Value: 1.5},
+		{EventID: 1, TimeStamp: ts, ServiceID: 1, MetricID: 3, Value: 15 * time.Second},
+		{EventID: 1, TimeStamp: ts, ServiceID: 1, MetricID: 4, Value: ts.Time},
+		{EventID: 1, TimeStamp: ts, ServiceID: 1, MetricID: 5, Value: true},
+		{EventID: 1, TimeStamp: ts, ServiceID: 1, MetricID: 6, Value: "ok"},
+	}
+
+	payloads, err := encodeValues(values)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+
+	decoded, err := decodeValues(payloads[0])
+	assert.NoError(t, err)
+	assert.Equal(t, values, decoded)
+
+	// values are split between notifications
+	long := make([]*entity.LiveValue, 10)
+	for i := range long {
+		long[i] = &entity.LiveValue{EventID: i, TimeStamp: ts, ServiceID: 1, MetricID: 6, Value: strings.Repeat("a", 1000)}
+	}
+
+	payloads, err = encodeValues(long)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 2)
+
+	n := 0
+	for _, p := range payloads {
+		assert.LessOrEqual(t, len(p), maxNotifyPayload)
+
+		decoded, err := decodeValues(p)
+		assert.NoError(t, err)
+		n += len(decoded)
+	}
+	assert.Equal(t, len(long), n)
+
+	_, err = encodeValues([]*entity.LiveValue{{Value: strings.Repeat("a", maxNotifyPayload)}})
+	assert.Error(t, err)
+}
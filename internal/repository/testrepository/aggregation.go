@@ -0,0 +1,139 @@
+package testrepository
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+type sample struct {
+	timeStamp time.Time
+	value     interface{}
+	labels    map[string]string
+}
+
+// aggregate applies function f to the samples of one bucket ordered by time.
+func aggregate(metricType, f string, samples []sample) (interface{}, error) {
+	switch f {
+	case "count":
+		return len(samples), nil
+	case "count_distinct":
+		distinct := make(map[string]struct{})
+		for _, s := range samples {
+			distinct[fmt.Sprint(s.value)] = struct{}{}
+		}
+		return len(distinct), nil
+	case "true_ratio":
+		var n int
+		for _, s := range samples {
+			if b, ok := s.value.(bool); ok && b {
+				n++
+			}
+		}
+		return float64(n) / float64(len(samples)), nil
+	case "first":
+		return aggregateResult(metricType, f, samples[0].value)
+	case "last":
+		return aggregateResult(metricType, f, samples[len(samples)-1].value)
+	}
+
+	xs := make([]float64, len(samples))
+	for i, s := range samples {
+		x, err := toFloat(s.value)
+		if err != nil {
+			return nil, err
+		}
+		xs[i] = x
+	}
+	sort.Float64s(xs)
+
+	var x float64
+	switch f {
+	case "sum", "avg":
+		for _, v := range xs {
+			x += v
+		}
+		if f == "avg" {
+			x /= float64(len(xs))
+		}
+	case "min":
+		x = xs[0]
+	case "max":
+		x = xs[len(xs)-1]
+	default:
+		p, ok := entity.Percentiles[f]
+		if !ok {
+			return nil, errors.New("unknown aggregate function")
+		}
+		x = percentile(xs, p)
+	}
+
+	return aggregateResult(metricType, f, x)
+}
+
+// percentile interpolates linearly between the closest ranks like percentile_cont does.
+func percentile(sorted []float64, p float64) float64 {
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// toFloat converts a stored value to a number, durations are counted in seconds
+// and timestamps in seconds since the unix epoch.
+func toFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case time.Duration:
+		return v.Seconds(), nil
+	case time.Time:
+		return float64(v.UnixNano()) / float64(time.Second), nil
+	case string:
+		if d, err := time.ParseDuration(v); err == nil {
+			return d.Seconds(), nil
+		}
+		if t, err := time.Parse(defaultLayout, v); err == nil {
+			return float64(t.UnixNano()) / float64(time.Second), nil
+		}
+		return strconv.ParseFloat(v, 64)
+	default:
+		return 0, errors.New("unknown metric type")
+	}
+}
+
+// aggregateResult converts an aggregated value to the representation used by sqlrepository.
+func aggregateResult(metricType, f string, v interface{}) (interface{}, error) {
+	switch metricType {
+	case "BOOL", "STRING":
+		return v, nil
+	}
+
+	x, err := toFloat(v)
+	if err != nil {
+		return nil, err
+	}
+
+	switch metricType {
+	case "INT":
+		if f == "avg" || entity.Percentiles[f] > 0 {
+			return x, nil
+		}
+		return int64(x), nil
+	case "DURATION":
+		return time.Duration(x * float64(time.Second)).String(), nil
+	case "TIMESTAMP_WITH_TIMEZONE":
+		return &entity.CustomTime{Time: time.Unix(0, int64(x*float64(time.Second))).UTC()}, nil
+	default:
+		return x, nil
+	}
+}
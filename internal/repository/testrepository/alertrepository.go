@@ -0,0 +1,219 @@
+package testrepository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+)
+
+// AlertRepository is safe for concurrent use, the rules are evaluated by the alert evaluator.
+// The rules of every tenant are kept in one table shared by its tenant scopes.
+type AlertRepository struct {
+	*alertTable
+	tenantID int
+}
+
+type alertTable struct {
+	mu      sync.Mutex
+	rules   map[int]*entity.AlertRule
+	states  map[int]*entity.AlertState
+	history []*entity.AlertTransition
+	lastID  int
+}
+
+func NewAlertRepository() *AlertRepository {
+	return &AlertRepository{
+		alertTable: &alertTable{
+			rules:  make(map[int]*entity.AlertRule),
+			states: make(map[int]*entity.AlertState),
+		},
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *AlertRepository) ForTenant(tenantID int) repository.AlertRepository {
+	return &AlertRepository{
+		alertTable: r.alertTable,
+		tenantID:   tenantID,
+	}
+}
+
+func (r *AlertRepository) Create(a *entity.AlertRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	a.RuleID = r.lastID
+	a.TenantID = r.tenantID
+	a.UpdatedAt = entity.CustomTime{Time: time.Now()}
+
+	c := *a
+	r.rules[a.RuleID] = &c
+
+	return nil
+}
+
+func (r *AlertRepository) Update(a *entity.AlertRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.rule(a.RuleID); !ok {
+		return repository.ErrRecordNotFound
+	}
+
+	a.TenantID = r.tenantID
+	a.UpdatedAt = entity.CustomTime{Time: time.Now()}
+
+	c := *a
+	r.rules[a.RuleID] = &c
+	delete(r.states, a.RuleID)
+
+	return nil
+}
+
+func (r *AlertRepository) FindByID(ruleID int) (*entity.AlertRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.rule(ruleID)
+	if !ok {
+		return nil, repository.ErrRecordNotFound
+	}
+
+	c := *a
+	return &c, nil
+}
+
+func (r *AlertRepository) List() ([]*entity.AlertRule, error) {
+	return r.list(true)
+}
+
+func (r *AlertRepository) All() ([]*entity.AlertRule, error) {
+	return r.list(false)
+}
+
+func (r *AlertRepository) list(inTenant bool) ([]*entity.AlertRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rules := make([]*entity.AlertRule, 0, len(r.rules))
+	for _, a := range r.rules {
+		if !inTenant || a.TenantID == r.tenantID {
+			c := *a
+			rules = append(rules, &c)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].RuleID < rules[j].RuleID })
+
+	return rules, nil
+}
+
+func (r *AlertRepository) Delete(ruleID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.rule(ruleID); !ok {
+		return repository.ErrRecordNotFound
+	}
+
+	delete(r.rules, ruleID)
+	delete(r.states, ruleID)
+
+	history := r.history[:0]
+	for _, t := range r.history {
+		if t.RuleID != ruleID {
+			history = append(history, t)
+		}
+	}
+	r.history = history
+
+	return nil
+}
+
+func (r *AlertRepository) FindState(ruleID int) (*entity.AlertState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.rule(ruleID); !ok {
+		return nil, repository.ErrRecordNotFound
+	}
+
+	s, ok := r.states[ruleID]
+	if !ok {
+		return &entity.AlertState{RuleID: ruleID, State: entity.AlertOK}, nil
+	}
+
+	c := *s
+	return &c, nil
+}
+
+func (r *AlertRepository) SaveState(s *entity.AlertState, t *entity.AlertTransition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.rule(s.RuleID); !ok {
+		return repository.ErrRecordNotFound
+	}
+
+	c := *s
+	r.states[s.RuleID] = &c
+
+	if t != nil {
+		ct := *t
+		r.history = append(r.history, &ct)
+	}
+
+	return nil
+}
+
+func (r *AlertRepository) ListActive() ([]*entity.AlertState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	states := make([]*entity.AlertState, 0)
+	for ruleID, s := range r.states {
+		if _, ok := r.rule(ruleID); ok && s.Active() {
+			c := *s
+			states = append(states, &c)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if !states[i].ActiveAt.Equal(states[j].ActiveAt.Time) {
+			return states[i].ActiveAt.Before(states[j].ActiveAt.Time)
+		}
+		return states[i].RuleID < states[j].RuleID
+	})
+
+	return states, nil
+}
+
+func (r *AlertRepository) History(ruleID, limit int) ([]*entity.AlertTransition, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	transitions := make([]*entity.AlertTransition, 0)
+	if _, ok := r.rule(ruleID); !ok {
+		return transitions, nil
+	}
+
+	for i := len(r.history) - 1; i >= 0 && len(transitions) < limit; i-- {
+		if t := r.history[i]; t.RuleID == ruleID {
+			c := *t
+			transitions = append(transitions, &c)
+		}
+	}
+
+	return transitions, nil
+}
+
+// rule returns the rule of the tenant, the caller holds the lock.
+func (r *AlertRepository) rule(ruleID int) (*entity.AlertRule, bool) {
+	a, ok := r.rules[ruleID]
+	if !ok || a.TenantID != r.tenantID {
+		return nil, false
+	}
+	return a, true
+}
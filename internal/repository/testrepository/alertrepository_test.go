@@ -0,0 +1,88 @@
+package testrepository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/testrepository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertRepository_Update(t *testing.T) {
+	ar := testrepository.NewAlertRepository()
+	other := ar.ForTenant(entity.DefaultTenantID + 1)
+
+	a := entity.TestAlertRule(t)
+	assert.NoError(t, ar.Create(a))
+	assert.NotZero(t, a.RuleID)
+
+	now := time.Now()
+	s, err := ar.FindState(a.RuleID)
+	assert.NoError(t, err)
+	assert.Equal(t, entity.AlertOK, s.State)
+	assert.NoError(t, ar.SaveState(s, s.Next(a, "350ms", true, now)))
+
+	a.Threshold = "500ms"
+	assert.EqualError(t, other.Update(a), repository.ErrRecordNotFound.Error())
+	assert.NoError(t, ar.Update(a))
+
+	found, err := ar.FindByID(a.RuleID)
+	assert.NoError(t, err)
+	assert.Equal(t, "500ms", found.Threshold)
+
+	// the state of an updated rule is reset
+	s, err = ar.FindState(a.RuleID)
+	assert.NoError(t, err)
+	assert.Equal(t, entity.AlertOK, s.State)
+
+	_, err = other.FindByID(a.RuleID)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	rules, err := other.List()
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+
+	rules, err = other.All()
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+}
+
+func TestAlertRepository_SaveState(t *testing.T) {
+	ar := testrepository.NewAlertRepository()
+
+	a := entity.TestAlertRule(t)
+	ar.Create(a)
+
+	now := time.Now()
+	s, _ := ar.FindState(a.RuleID)
+	assert.NoError(t, ar.SaveState(s, s.Next(a, "350ms", true, now)))
+	assert.NoError(t, ar.SaveState(s, s.Next(a, "400ms", true, now.Add(time.Minute))))
+	assert.NoError(t, ar.SaveState(s, s.Next(a, "400ms", true, now.Add(10*time.Minute))))
+
+	active, err := ar.ListActive()
+	assert.NoError(t, err)
+	if assert.Len(t, active, 1) {
+		assert.Equal(t, entity.AlertFiring, active[0].State)
+		assert.Equal(t, "400ms", active[0].Value)
+	}
+
+	history, err := ar.History(a.RuleID, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, entity.AlertFiring, history[0].To)
+		assert.Equal(t, entity.AlertPending, history[1].To)
+	}
+
+	history, err = ar.History(a.RuleID, 1)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	assert.NoError(t, ar.Delete(a.RuleID))
+	assert.EqualError(t, ar.SaveState(s, nil), repository.ErrRecordNotFound.Error())
+
+	active, err = ar.ListActive()
+	assert.NoError(t, err)
+	assert.Empty(t, active)
+}
@@ -0,0 +1,94 @@
+package testrepository
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+)
+
+// APIKeyRepository is safe for concurrent use, keys are looked up by every request.
+// The keys of every tenant are kept in one table shared by its tenant scopes.
+type APIKeyRepository struct {
+	*apiKeyTable
+	tenantID int
+}
+
+type apiKeyTable struct {
+	mu     sync.Mutex
+	keys   map[int]*entity.APIKey
+	lastID int
+}
+
+func NewAPIKeyRepository() *APIKeyRepository {
+	return &APIKeyRepository{
+		apiKeyTable: &apiKeyTable{
+			keys: make(map[int]*entity.APIKey),
+		},
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *APIKeyRepository) ForTenant(tenantID int) repository.APIKeyRepository {
+	return &APIKeyRepository{
+		apiKeyTable: r.apiKeyTable,
+		tenantID:    tenantID,
+	}
+}
+
+func (r *APIKeyRepository) Create(k *entity.APIKey) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	k.KeyID = r.lastID
+	k.TenantID = r.tenantID
+	r.keys[k.KeyID] = k
+
+	return nil
+}
+
+func (r *APIKeyRepository) FindByHash(hash string) (*entity.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+	return nil, repository.ErrRecordNotFound
+}
+
+func (r *APIKeyRepository) List() ([]*entity.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]*entity.APIKey, 0, len(r.keys))
+	for _, k := range r.keys {
+		if k.TenantID == r.tenantID {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyID < keys[j].KeyID })
+
+	return keys, nil
+}
+
+func (r *APIKeyRepository) Delete(keyID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if k, ok := r.keys[keyID]; !ok || k.TenantID != r.tenantID {
+		return repository.ErrRecordNotFound
+	}
+
+	delete(r.keys, keyID)
+
+	return nil
+}
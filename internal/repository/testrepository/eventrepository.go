@@ -2,55 +2,145 @@ package testrepository
 
 import (
 	"errors"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/AnatoliyBr/dwh-service/internal/entity"
 	"github.com/AnatoliyBr/dwh-service/internal/repository"
 )
 
+const (
+	defaultLayout = time.RFC3339
+)
+
 type Pair struct {
 	eventID  int
 	metricID int
 }
 
+// EventRepository keeps the events of every tenant in one table shared by its tenant scopes,
+// an event belongs to the tenant of the scope it is created in.
 type EventRepository struct {
+	*eventTable
+	tenantID int
+}
+
+type eventTable struct {
 	events            map[int]*entity.Event
 	eventsWithMetrics map[Pair]interface{}
+	tenants           map[int]int
+	usage             map[usageKey]*entity.Usage
+	lastID            int
+
+	// late holds the minutes of the values written behind rolledUpTo, the watermark of the finest rollups
+	late       map[lateKey]bool
+	rolledUpTo time.Time
+}
+
+type usageKey struct {
+	serviceID int
+	day       time.Time
+}
+
+type lateKey struct {
+	serviceID int
+	bucket    time.Time
 }
 
 func NewEventRepository() *EventRepository {
 	return &EventRepository{
-		events:            make(map[int]*entity.Event),
-		eventsWithMetrics: make(map[Pair]interface{}),
+		eventTable: &eventTable{
+			events:            make(map[int]*entity.Event),
+			eventsWithMetrics: make(map[Pair]interface{}),
+			tenants:           make(map[int]int),
+			usage:             make(map[usageKey]*entity.Usage),
+			late:              make(map[lateKey]bool),
+		},
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *EventRepository) ForTenant(tenantID int) repository.EventRepository {
+	return &EventRepository{
+		eventTable: r.eventTable,
+		tenantID:   tenantID,
 	}
 }
 
 func (r *EventRepository) Create(e *entity.Event) error {
-	e.EventID = len(r.events) + 1
+	r.lastID++
+	e.EventID = r.lastID
 	r.events[e.EventID] = e
+	r.tenants[e.EventID] = r.tenantID
+	r.addUsage(e.ServiceID, 1, 0)
 
 	return nil
 }
 
+func (r *EventRepository) addUsage(serviceID, events, values int) {
+	k := usageKey{serviceID: serviceID, day: entity.UsageDay(time.Now())}
+	u, ok := r.usage[k]
+	if !ok {
+		u = &entity.Usage{ServiceID: serviceID}
+		r.usage[k] = u
+	}
+
+	u.Events += events
+	u.MetricValues += values
+}
+
+// Usage reports the usage of the services the events of the tenant are written to.
+func (r *EventRepository) Usage(day time.Time, serviceIDs []int) ([]*entity.Usage, error) {
+	inTenant := make(map[int]bool)
+	for eventID, e := range r.events {
+		if r.inTenant(eventID) {
+			inTenant[e.ServiceID] = true
+		}
+	}
+
+	usage := make([]*entity.Usage, 0)
+	for k, u := range r.usage {
+		if k.day.Equal(entity.UsageDay(day)) && inTenant[k.serviceID] && (len(serviceIDs) == 0 || containsID(serviceIDs, k.serviceID)) {
+			c := *u
+			usage = append(usage, &c)
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].ServiceID < usage[j].ServiceID })
+
+	return usage, nil
+}
+
+// inTenant reports whether the event belongs to the tenant of the repository.
+func (r *EventRepository) inTenant(eventID int) bool {
+	_, ok := r.events[eventID]
+	return ok && r.tenants[eventID] == r.tenantID
+}
+
 func (r *EventRepository) AddMetricsToEvent(eventID int, metrics []*entity.AddMetric) error {
-	if _, ok := r.events[eventID]; !ok {
+	if !r.inTenant(eventID) {
 		return repository.ErrRecordNotFound
 	}
 
 	for _, m := range metrics {
 		r.eventsWithMetrics[Pair{eventID: eventID, metricID: m.MetricID}] = m.MetricValue
 	}
+	r.addUsage(r.events[eventID].ServiceID, 0, len(metrics))
+
+	if e := r.events[eventID]; len(metrics) > 0 && e.TimeStamp.Before(r.rolledUpTo) {
+		r.late[lateKey{serviceID: e.ServiceID, bucket: e.TimeStamp.UTC().Truncate(time.Minute)}] = true
+	}
 
 	return nil
 }
 
-func (r *EventRepository) GetMetricValuesForTimePeriod(serviceID int, p [2]*entity.CustomTime, m *entity.Metric) (interface{}, error) {
+func (r *EventRepository) GetMetricValuesForTimePeriod(serviceID int, p [2]*entity.CustomTime, m *entity.Metric, sel *entity.LabelSelector) (interface{}, error) {
 	values := make([]*entity.GetMetric, 0)
 
 	suitableEvents := make([]*entity.Event, 0)
 
 	for _, e := range r.events {
-		if e.ServiceID == serviceID && p[0].Before(e.TimeStamp.Time) && p[1].After(e.TimeStamp.Time) {
+		if r.inTenant(e.EventID) && e.ServiceID == serviceID && p[0].Before(e.TimeStamp.Time) && p[1].After(e.TimeStamp.Time) && sel.Matches(e.Labels) {
 			suitableEvents = append(suitableEvents, e)
 		}
 	}
@@ -64,6 +154,11 @@ func (r *EventRepository) GetMetricValuesForTimePeriod(serviceID int, p [2]*enti
 				TimeStamp: se.TimeStamp,
 				Value:     v.(int),
 			})
+		case int64:
+			values = append(values, &entity.GetMetric{
+				TimeStamp: se.TimeStamp,
+				Value:     int(v.(int64)),
+			})
 		case float64:
 			values = append(values, &entity.GetMetric{
 				TimeStamp: se.TimeStamp,
@@ -94,11 +189,253 @@ func (r *EventRepository) GetMetricValuesForTimePeriod(serviceID int, p [2]*enti
 		default:
 			return nil, errors.New("unknown metric type")
 		}
+
+		values[len(values)-1].Labels = sel.Group(se.Labels)
 	}
 
+	sort.SliceStable(values, func(i, j int) bool {
+		if gi, gj := groupKey(sel, values[i].Labels), groupKey(sel, values[j].Labels); gi != gj {
+			return gi < gj
+		}
+		return values[i].TimeStamp.Before(values[j].TimeStamp.Time)
+	})
+
 	if len(values) > 0 {
 		return values, nil
 	} else {
 		return nil, repository.ErrRecordNotFound
 	}
 }
+
+func (r *EventRepository) AggregateMetricValuesForTimePeriod(serviceID int, p [2]*entity.CustomTime, m *entity.Metric, a *entity.Aggregation, sel *entity.LabelSelector) ([]*entity.AggregatedMetric, error) {
+	samples := make([]sample, 0)
+
+	for _, e := range r.events {
+		if r.inTenant(e.EventID) && e.ServiceID == serviceID && !e.TimeStamp.Before(p[0].Time) && e.TimeStamp.Before(p[1].Time) && sel.Matches(e.Labels) {
+			if v, ok := r.eventsWithMetrics[Pair{eventID: e.EventID, metricID: m.MetricID}]; ok {
+				samples = append(samples, sample{timeStamp: e.TimeStamp.Time, value: v, labels: sel.Group(e.Labels)})
+			}
+		}
+	}
+
+	if len(samples) == 0 {
+		return nil, repository.ErrRecordNotFound
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		if gi, gj := groupKey(sel, samples[i].labels), groupKey(sel, samples[j].labels); gi != gj {
+			return gi < gj
+		}
+		return samples[i].timeStamp.Before(samples[j].timeStamp)
+	})
+
+	buckets := make([]*entity.AggregatedMetric, 0)
+	for start := 0; start < len(samples); {
+		t := a.BucketStart(samples[start].timeStamp)
+		group := groupKey(sel, samples[start].labels)
+
+		end := start
+		for end < len(samples) && a.BucketStart(samples[end].timeStamp).Equal(t) && groupKey(sel, samples[end].labels) == group {
+			end++
+		}
+
+		b := &entity.AggregatedMetric{
+			TimeStamp: entity.CustomTime{Time: t},
+			Values:    make(map[string]interface{}, len(a.Functions)),
+			Labels:    samples[start].labels,
+		}
+
+		for _, f := range a.Functions {
+			v, err := aggregate(m.MetricType, f, samples[start:end])
+			if err != nil {
+				return nil, err
+			}
+			b.Values[f] = v
+		}
+
+		buckets = append(buckets, b)
+		start = end
+	}
+
+	return buckets, nil
+}
+
+func (r *EventRepository) CreateWithMetrics(e *entity.Event, metrics []*entity.AddMetric) error {
+	if err := r.Create(e); err != nil {
+		return err
+	}
+
+	return r.AddMetricsToEvent(e.EventID, metrics)
+}
+
+func (r *EventRepository) CreateBatch(items []*entity.BatchItem) error {
+	for _, item := range items {
+		if err := r.CreateWithMetrics(item.Event, item.Metrics); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *EventRepository) ServiceCascade(serviceID int) (*entity.Cascade, error) {
+	c := &entity.Cascade{}
+	for _, e := range r.events {
+		if r.inTenant(e.EventID) && e.ServiceID == serviceID {
+			c.Events++
+		}
+	}
+
+	for p := range r.eventsWithMetrics {
+		if e, ok := r.events[p.eventID]; ok && r.inTenant(p.eventID) && e.ServiceID == serviceID {
+			c.Values++
+		}
+	}
+
+	return c, nil
+}
+
+func (r *EventRepository) MetricCascade(metricID int) (*entity.Cascade, error) {
+	c := &entity.Cascade{}
+	for p := range r.eventsWithMetrics {
+		if p.metricID == metricID && r.inTenant(p.eventID) {
+			c.Values++
+		}
+	}
+
+	return c, nil
+}
+
+func (r *EventRepository) PurgeService(serviceID int, before time.Time, limit int) (*entity.Cascade, error) {
+	expired := r.expired(func(e *entity.Event) bool { return e.ServiceID == serviceID }, before, limit)
+
+	purged := make(map[int]bool, len(expired))
+	for _, eventID := range expired {
+		purged[eventID] = true
+		delete(r.events, eventID)
+		delete(r.tenants, eventID)
+	}
+
+	c := &entity.Cascade{Events: len(expired)}
+	for p := range r.eventsWithMetrics {
+		if purged[p.eventID] {
+			delete(r.eventsWithMetrics, p)
+			c.Values++
+		}
+	}
+
+	return c, nil
+}
+
+func (r *EventRepository) PurgeMetric(metricID int, before time.Time, limit int) (*entity.Cascade, error) {
+	expired := r.expired(func(e *entity.Event) bool {
+		_, ok := r.eventsWithMetrics[Pair{eventID: e.EventID, metricID: metricID}]
+		return ok
+	}, before, limit)
+
+	for _, eventID := range expired {
+		delete(r.eventsWithMetrics, Pair{eventID: eventID, metricID: metricID})
+	}
+
+	return &entity.Cascade{Values: len(expired)}, nil
+}
+
+// expired returns the ids of at most limit of the oldest events of the tenant that match and are stored before the time.
+func (r *EventRepository) expired(match func(*entity.Event) bool, before time.Time, limit int) []int {
+	events := make([]*entity.Event, 0)
+	for eventID, e := range r.events {
+		if r.inTenant(eventID) && e.TimeStamp.Before(before) && match(e) {
+			events = append(events, e)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].TimeStamp.Equal(events[j].TimeStamp.Time) {
+			return events[i].TimeStamp.Before(events[j].TimeStamp.Time)
+		}
+		return events[i].EventID < events[j].EventID
+	})
+
+	if len(events) > limit {
+		events = events[:limit]
+	}
+
+	ids := make([]int, len(events))
+	for i, e := range events {
+		ids[i] = e.EventID
+	}
+	return ids
+}
+
+func (r *EventRepository) LatestMetricValues(serviceIDs, metricIDs []int) ([]*entity.LatestValue, error) {
+	type key struct {
+		serviceID int
+		metricID  int
+	}
+
+	latest := make(map[key]*entity.LatestValue)
+	latestEvents := make(map[key]int)
+
+	for p, v := range r.eventsWithMetrics {
+		e := r.events[p.eventID]
+		if !r.inTenant(p.eventID) || !containsID(serviceIDs, e.ServiceID) || !containsID(metricIDs, p.metricID) {
+			continue
+		}
+
+		k := key{serviceID: e.ServiceID, metricID: p.metricID}
+		if lv, ok := latest[k]; ok {
+			if lv.TimeStamp.After(e.TimeStamp.Time) || (lv.TimeStamp.Equal(e.TimeStamp.Time) && latestEvents[k] > e.EventID) {
+				continue
+			}
+		}
+
+		latest[k] = &entity.LatestValue{
+			ServiceID: e.ServiceID,
+			MetricID:  p.metricID,
+			TimeStamp: e.TimeStamp,
+			Value:     v,
+		}
+		latestEvents[k] = e.EventID
+	}
+
+	values := make([]*entity.LatestValue, 0, len(latest))
+	for _, lv := range latest {
+		values = append(values, lv)
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].ServiceID != values[j].ServiceID {
+			return values[i].ServiceID < values[j].ServiceID
+		}
+		return values[i].MetricID < values[j].MetricID
+	})
+
+	return values, nil
+}
+
+// groupKey orders the values of the labels the results are grouped by like sqlrepository does.
+func groupKey(sel *entity.LabelSelector, labels map[string]string) string {
+	if sel == nil {
+		return ""
+	}
+
+	values := make([]string, len(sel.GroupBy))
+	for i, name := range sel.GroupBy {
+		values[i] = labels[name]
+	}
+	return strings.Join(values, "\x00")
+}
+
+// containsID reports whether id is in ids, an empty ids contains every id.
+func containsID(ids []int, id int) bool {
+	if len(ids) == 0 {
+		return true
+	}
+
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -179,7 +179,7 @@ func TestEventRepository_GetMetricValuesForTimePeriod(t *testing.T) {
 			er := testrepository.NewEventRepository()
 			er.Create(e)
 
-			_, err := er.GetMetricValuesForTimePeriod(e.ServiceID, tc.p, m)
+			_, err := er.GetMetricValuesForTimePeriod(e.ServiceID, tc.p, m, nil)
 			assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
 
 			er.AddMetricsToEvent(e.EventID, []*entity.AddMetric{
@@ -188,8 +188,341 @@ func TestEventRepository_GetMetricValuesForTimePeriod(t *testing.T) {
 					MetricValue: tc.metricValue,
 				}})
 
-			_, err = er.GetMetricValuesForTimePeriod(e.ServiceID, tc.p, m)
+			_, err = er.GetMetricValuesForTimePeriod(e.ServiceID, tc.p, m, nil)
 			assert.NoError(t, err)
 		})
 	}
 }
+
+func TestEventRepository_AggregateMetricValuesForTimePeriod(t *testing.T) {
+	testCases := []struct {
+		name         string
+		metricType   string
+		metricValues []interface{}
+		functions    []string
+		expected     map[string]interface{}
+	}{
+		{
+			name:         "int",
+			metricType:   "INT",
+			metricValues: []interface{}{10, 20, 30},
+			functions:    []string{"count", "sum", "min", "max", "avg", "p50", "first", "last"},
+			expected: map[string]interface{}{
+				"count": 3,
+				"sum":   int64(60),
+				"min":   int64(10),
+				"max":   int64(30),
+				"avg":   20.0,
+				"p50":   20.0,
+				"first": int64(10),
+				"last":  int64(30),
+			},
+		},
+		{
+			name:         "duration",
+			metricType:   "DURATION",
+			metricValues: []interface{}{"10s", "20s"},
+			functions:    []string{"sum", "avg"},
+			expected: map[string]interface{}{
+				"sum": "30s",
+				"avg": "15s",
+			},
+		},
+		{
+			name:         "bool",
+			metricType:   "BOOL",
+			metricValues: []interface{}{true, false, true, true},
+			functions:    []string{"count", "true_ratio"},
+			expected: map[string]interface{}{
+				"count":      4,
+				"true_ratio": 0.75,
+			},
+		},
+		{
+			name:         "string",
+			metricType:   "STRING",
+			metricValues: []interface{}{"ok", "fail", "ok"},
+			functions:    []string{"count_distinct", "last"},
+			expected: map[string]interface{}{
+				"count_distinct": 2,
+				"last":           "ok",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := entity.TestService(t)
+			m := entity.TestMetric(t)
+			m.MetricType = tc.metricType
+
+			mr := testrepository.NewMetricRepository()
+			mr.Create(m)
+
+			sr := testrepository.NewServiceRepository()
+			sr.Create(s)
+
+			er := testrepository.NewEventRepository()
+
+			a := entity.TestAggregation(t)
+			a.Functions = tc.functions
+
+			start := a.BucketStart(time.Now().Add(-time.Hour))
+			p := [2]*entity.CustomTime{
+				{Time: start.Add(-time.Minute)},
+				{Time: start.Add(time.Hour)},
+			}
+
+			_, err := er.AggregateMetricValuesForTimePeriod(s.ServiceID, p, m, a, nil)
+			assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+			for i, v := range tc.metricValues {
+				e := entity.TestEvent(t)
+				e.ServiceID = s.ServiceID
+				e.TimeStamp.Time = start.Add(time.Duration(i+1) * time.Second)
+				er.Create(e)
+
+				er.AddMetricsToEvent(e.EventID, []*entity.AddMetric{
+					{
+						MetricID:    m.MetricID,
+						MetricValue: v,
+					}})
+			}
+
+			report, err := er.AggregateMetricValuesForTimePeriod(s.ServiceID, p, m, a, nil)
+			assert.NoError(t, err)
+			assert.Len(t, report, 1)
+			assert.Equal(t, start, report[0].TimeStamp.Time)
+			assert.Equal(t, tc.expected, report[0].Values)
+		})
+	}
+}
+
+func TestEventRepository_CreateWithMetrics(t *testing.T) {
+	m := entity.TestMetric(t)
+	e := entity.TestEvent(t)
+	er := testrepository.NewEventRepository()
+
+	assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{
+		{
+			MetricID:    m.MetricID,
+			MetricValue: time.Duration(10 * time.Second),
+		}}))
+	assert.NotZero(t, e.EventID)
+}
+
+func TestEventRepository_CreateBatch(t *testing.T) {
+	m := entity.TestMetric(t)
+	er := testrepository.NewEventRepository()
+
+	items := []*entity.BatchItem{
+		{
+			Event: entity.TestEvent(t),
+			Metrics: []*entity.AddMetric{
+				{MetricID: m.MetricID, MetricValue: time.Duration(10 * time.Second)},
+			},
+		},
+		{
+			Event: entity.TestEvent(t),
+			Metrics: []*entity.AddMetric{
+				{MetricID: m.MetricID, MetricValue: time.Duration(15 * time.Second)},
+			},
+		},
+	}
+
+	assert.NoError(t, er.CreateBatch(items))
+	assert.NotZero(t, items[0].Event.EventID)
+	assert.NotEqual(t, items[0].Event.EventID, items[1].Event.EventID)
+}
+
+func TestEventRepository_Cascade(t *testing.T) {
+	er := testrepository.NewEventRepository()
+
+	for i := 0; i < 2; i++ {
+		e := entity.TestEvent(t)
+		e.ServiceID = 1
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{
+			{MetricID: 1, MetricValue: int64(i)},
+			{MetricID: 2, MetricValue: true},
+		}))
+	}
+
+	c, err := er.ServiceCascade(1)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 2, Values: 4}, c)
+
+	c, err = er.MetricCascade(1)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Values: 2}, c)
+
+	c, err = er.ServiceCascade(2)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{}, c)
+}
+
+func TestEventRepository_Purge(t *testing.T) {
+	er := testrepository.NewEventRepository()
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		e := entity.TestEvent(t)
+		e.ServiceID = 1
+		e.TimeStamp.Time = now.Add(-time.Duration(5-i) * time.Hour)
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{
+			{MetricID: 1, MetricValue: int64(i)},
+			{MetricID: 2, MetricValue: true},
+		}))
+	}
+
+	other := er.ForTenant(entity.DefaultTenantID + 1)
+	c, err := other.PurgeService(1, now, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{}, c)
+
+	c, err = er.PurgeMetric(2, now.Add(-90*time.Minute), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Values: 2}, c)
+
+	c, err = er.PurgeMetric(2, now.Add(-90*time.Minute), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Values: 2}, c)
+
+	c, err = er.PurgeService(1, now.Add(-150*time.Minute), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 2, Values: 2}, c)
+
+	c, err = er.PurgeService(1, now.Add(-150*time.Minute), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 1, Values: 1}, c)
+
+	c, err = er.ServiceCascade(1)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 2, Values: 3}, c)
+
+	// ids of purged events are not reused
+	e := entity.TestEvent(t)
+	e.ServiceID = 1
+	assert.NoError(t, er.Create(e))
+	assert.Equal(t, 6, e.EventID)
+}
+
+func TestEventRepository_LatestMetricValues(t *testing.T) {
+	er := testrepository.NewEventRepository()
+
+	now := time.Now()
+	for i, serviceID := range []int{1, 1, 2} {
+		e := &entity.Event{ServiceID: serviceID, TimeStamp: entity.CustomTime{Time: now.Add(time.Duration(i) * time.Second)}}
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{
+			{MetricID: 1, MetricValue: int64(i)},
+			{MetricID: 2, MetricValue: true},
+		}))
+	}
+
+	values, err := er.LatestMetricValues(nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, values, 4)
+	assert.Equal(t, int64(1), values[0].Value)
+
+	values, err = er.LatestMetricValues([]int{2}, []int{1})
+	assert.NoError(t, err)
+	if assert.Len(t, values, 1) {
+		assert.Equal(t, 2, values[0].ServiceID)
+		assert.Equal(t, int64(2), values[0].Value)
+	}
+}
+
+func TestEventRepository_Labels(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+	mr := testrepository.NewMetricRepository()
+	er := testrepository.NewEventRepository()
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	m.MetricType = "INT"
+
+	sr.Create(s)
+	mr.Create(m)
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Hour).UTC()
+	for i, labels := range []map[string]string{
+		{"host": "a", "region": "eu"},
+		{"host": "b", "region": "eu"},
+		{"host": "c", "region": "us"},
+		nil,
+	} {
+		e := entity.TestEvent(t)
+		e.ServiceID = s.ServiceID
+		e.TimeStamp.Time = start.Add(time.Duration(i+1) * time.Second)
+		e.Labels = labels
+
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: (i + 1) * 10}}))
+	}
+
+	p := [2]*entity.CustomTime{
+		{Time: start},
+		{Time: start.Add(time.Hour)},
+	}
+
+	match := func(matchers ...string) []*entity.LabelMatcher {
+		res := make([]*entity.LabelMatcher, len(matchers))
+		for i, s := range matchers {
+			m, err := entity.ParseLabelMatcher(s)
+			assert.NoError(t, err)
+			res[i] = m
+		}
+		return res
+	}
+
+	valuesOf := func(sel *entity.LabelSelector) []interface{} {
+		report, err := er.GetMetricValuesForTimePeriod(s.ServiceID, p, m, sel)
+		if err != nil {
+			return nil
+		}
+
+		values := make([]interface{}, 0)
+		for _, v := range report.([]*entity.GetMetric) {
+			values = append(values, v.Value)
+		}
+		return values
+	}
+
+	assert.Equal(t, []interface{}{10, 20}, valuesOf(&entity.LabelSelector{Matchers: match(`region="eu"`)}))
+	assert.Equal(t, []interface{}{20}, valuesOf(&entity.LabelSelector{Matchers: match(`region=~"e.*"`, `host!="a"`)}))
+	assert.Equal(t, []interface{}{40}, valuesOf(&entity.LabelSelector{Matchers: match(`region=""`)}))
+	assert.Equal(t, []interface{}{10, 30}, valuesOf(&entity.LabelSelector{Matchers: match(`host=~"a|c"`)}))
+	assert.Equal(t, []interface{}{20, 30, 40}, valuesOf(&entity.LabelSelector{Matchers: match(`host!~"a"`)}))
+	assert.Nil(t, valuesOf(&entity.LabelSelector{Matchers: match(`region="asia"`)}))
+
+	report, err := er.GetMetricValuesForTimePeriod(s.ServiceID, p, m, &entity.LabelSelector{GroupBy: []string{"region"}})
+	assert.NoError(t, err)
+	values := report.([]*entity.GetMetric)
+	assert.Len(t, values, 4)
+	assert.Equal(t, map[string]string{"region": ""}, values[0].Labels)
+	assert.Equal(t, 40, values[0].Value)
+	assert.Equal(t, map[string]string{"region": "eu"}, values[1].Labels)
+	assert.Equal(t, 10, values[1].Value)
+	assert.Equal(t, map[string]string{"region": "us"}, values[3].Labels)
+
+	a := &entity.Aggregation{Bucket: time.Hour, Functions: []string{"sum"}}
+
+	buckets, err := er.AggregateMetricValuesForTimePeriod(s.ServiceID, p, m, a, &entity.LabelSelector{
+		Matchers: match(`host!="b"`),
+		GroupBy:  []string{"region"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, buckets, 3)
+	for i, expected := range []struct {
+		region string
+		sum    int64
+	}{{"", 40}, {"eu", 10}, {"us", 30}} {
+		assert.Equal(t, start, buckets[i].TimeStamp.Time)
+		assert.Equal(t, map[string]string{"region": expected.region}, buckets[i].Labels)
+		assert.Equal(t, expected.sum, buckets[i].Values["sum"])
+	}
+
+	buckets, err = er.AggregateMetricValuesForTimePeriod(s.ServiceID, p, m, a, &entity.LabelSelector{Matchers: match(`region="eu"`)})
+	assert.NoError(t, err)
+	assert.Len(t, buckets, 1)
+	assert.Nil(t, buckets[0].Labels)
+	assert.Equal(t, int64(30), buckets[0].Values["sum"])
+}
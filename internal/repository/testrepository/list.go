@@ -0,0 +1,78 @@
+package testrepository
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+type listItem struct {
+	id         int
+	slug       string
+	metricType string
+	details    string
+	archived   bool
+}
+
+// listPage applies the filters, order and cursor of o to items and returns the ids of the page.
+func listPage(items []listItem, o *entity.ListOptions) ([]int, error) {
+	after, err := o.After()
+	if err != nil {
+		return nil, err
+	}
+
+	less := func(a, b listItem) bool {
+		if o.SortBy == "slug" && a.slug != b.slug {
+			return a.slug < b.slug
+		}
+		return a.id < b.id
+	}
+
+	desc := o.Order == "desc"
+
+	page := make([]listItem, 0)
+	for _, it := range items {
+		if it.archived && !o.IncludeArchived {
+			continue
+		}
+
+		if o.SlugPrefix != "" && !strings.HasPrefix(it.slug, o.SlugPrefix) {
+			continue
+		}
+
+		if o.MetricType != "" && it.metricType != o.MetricType {
+			continue
+		}
+
+		if o.Search != "" && !strings.Contains(strings.ToLower(it.details), strings.ToLower(o.Search)) {
+			continue
+		}
+
+		if after != nil {
+			last := listItem{id: after.ID, slug: after.Slug}
+			if (!desc && !less(last, it)) || (desc && !less(it, last)) {
+				continue
+			}
+		}
+
+		page = append(page, it)
+	}
+
+	sort.Slice(page, func(i, j int) bool {
+		if desc {
+			return less(page[j], page[i])
+		}
+		return less(page[i], page[j])
+	})
+
+	if len(page) > o.Limit {
+		page = page[:o.Limit]
+	}
+
+	ids := make([]int, len(page))
+	for i, it := range page {
+		ids[i] = it.id
+	}
+	return ids, nil
+}
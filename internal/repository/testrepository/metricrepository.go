@@ -1,17 +1,38 @@
 package testrepository
 
 import (
+	"time"
+
 	"github.com/AnatoliyBr/dwh-service/internal/entity"
 	"github.com/AnatoliyBr/dwh-service/internal/repository"
 )
 
+// MetricRepository keeps the metrics of every tenant in one table shared by its tenant scopes.
 type MetricRepository struct {
+	*metricTable
+	tenantID int
+}
+
+type metricTable struct {
 	metrics map[int]*entity.Metric
+	tenants map[int]int
+	lastID  int
 }
 
 func NewMetricRepository() *MetricRepository {
 	return &MetricRepository{
-		metrics: make(map[int]*entity.Metric),
+		metricTable: &metricTable{
+			metrics: make(map[int]*entity.Metric),
+			tenants: make(map[int]int),
+		},
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *MetricRepository) ForTenant(tenantID int) repository.MetricRepository {
+	return &MetricRepository{
+		metricTable: r.metricTable,
+		tenantID:    tenantID,
 	}
 }
 
@@ -20,16 +41,92 @@ func (r *MetricRepository) Create(m *entity.Metric) error {
 		return err
 	}
 
-	m.MetricID = len(r.metrics) + 1
+	r.lastID++
+	m.MetricID = r.lastID
 	r.metrics[m.MetricID] = m
+	r.tenants[m.MetricID] = r.tenantID
 
 	return nil
 }
 
 func (r *MetricRepository) FindByID(metricID int) (*entity.Metric, error) {
-	s, ok := r.metrics[metricID]
-	if !ok {
+	m, ok := r.metrics[metricID]
+	if !ok || r.tenants[metricID] != r.tenantID {
 		return nil, repository.ErrRecordNotFound
 	}
-	return s, nil
+	return m, nil
+}
+
+func (r *MetricRepository) FindBySlug(slug string) (*entity.Metric, error) {
+	slug = entity.NormalizeSlug(slug)
+	for _, m := range r.metrics {
+		if m.Slug == slug && r.tenants[m.MetricID] == r.tenantID {
+			return m, nil
+		}
+	}
+	return nil, repository.ErrRecordNotFound
+}
+
+func (r *MetricRepository) List(o *entity.ListOptions) ([]*entity.Metric, error) {
+	items := make([]listItem, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		if r.tenants[m.MetricID] == r.tenantID {
+			items = append(items, listItem{id: m.MetricID, slug: m.Slug, metricType: m.MetricType, details: m.Details, archived: m.Archived})
+		}
+	}
+
+	ids, err := listPage(items, o)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]*entity.Metric, len(ids))
+	for i, id := range ids {
+		metrics[i] = r.metrics[id]
+	}
+	return metrics, nil
+}
+
+// Update replaces the metric. Stored values are kept by EventRepository,
+// so the check that the type of a metric with values is not changed is left to the caller.
+func (r *MetricRepository) Update(m *entity.Metric) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	old, err := r.FindByID(m.MetricID)
+	if err != nil {
+		return err
+	}
+
+	m.Archived = old.Archived
+	m.ArchivedAt = old.ArchivedAt
+	r.metrics[m.MetricID] = m
+
+	return nil
+}
+
+func (r *MetricRepository) Archive(metricID int) error {
+	m, err := r.FindByID(metricID)
+	if err != nil {
+		return err
+	}
+
+	if !m.Archived {
+		m.Archived = true
+		m.ArchivedAt = &entity.CustomTime{Time: time.Now()}
+	}
+
+	return nil
+}
+
+func (r *MetricRepository) Delete(metricID int) error {
+	if _, err := r.FindByID(metricID); err != nil {
+		return err
+	}
+
+	delete(r.metrics, metricID)
+	delete(r.tenants, metricID)
+
+	return nil
 }
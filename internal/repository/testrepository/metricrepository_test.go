@@ -1,6 +1,7 @@
 package testrepository_test
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/AnatoliyBr/dwh-service/internal/entity"
@@ -29,3 +30,81 @@ func TestMetricRepository_FindByID(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, s2)
 }
+
+func TestMetricRepository_List(t *testing.T) {
+	mr := testrepository.NewMetricRepository()
+
+	for i, metricType := range []string{"DURATION", "INT", "DURATION"} {
+		m := entity.TestMetric(t)
+		m.Slug = fmt.Sprintf("READING_TIME_NOTE_%d", i+1)
+		m.MetricType = metricType
+		mr.Create(m)
+	}
+
+	o := &entity.ListOptions{MetricType: "DURATION", Order: "desc"}
+	assert.NoError(t, o.Validate())
+
+	page, err := mr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 2)
+	assert.Equal(t, 3, page[0].MetricID)
+	assert.Equal(t, 1, page[1].MetricID)
+
+	o = &entity.ListOptions{Limit: 1, SortBy: "slug"}
+	assert.NoError(t, o.Validate())
+
+	page, err = mr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Equal(t, 1, page[0].MetricID)
+
+	o.Cursor = o.NextCursor(page[0].MetricID, page[0].Slug)
+	page, err = mr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Equal(t, 2, page[0].MetricID)
+}
+
+func TestMetricRepository_Update(t *testing.T) {
+	mr := testrepository.NewMetricRepository()
+
+	m := entity.TestMetric(t)
+	assert.Equal(t, repository.ErrRecordNotFound, mr.Update(m))
+
+	mr.Create(m)
+
+	updated := &entity.Metric{MetricID: m.MetricID, Slug: m.Slug, MetricType: "INT", Details: "Seconds"}
+	assert.NoError(t, mr.Update(updated))
+
+	found, err := mr.FindByID(m.MetricID)
+	assert.NoError(t, err)
+	assert.Equal(t, "INT", found.MetricType)
+}
+
+func TestMetricRepository_ArchiveAndDelete(t *testing.T) {
+	mr := testrepository.NewMetricRepository()
+
+	m := entity.TestMetric(t)
+	mr.Create(m)
+
+	assert.NoError(t, mr.Archive(m.MetricID))
+	assert.True(t, m.Archived)
+
+	assert.NoError(t, mr.Delete(m.MetricID))
+	assert.Equal(t, repository.ErrRecordNotFound, mr.Archive(m.MetricID))
+	assert.Equal(t, repository.ErrRecordNotFound, mr.Delete(m.MetricID))
+}
+
+func TestMetricRepository_FindBySlug(t *testing.T) {
+	mr := testrepository.NewMetricRepository()
+
+	m1 := entity.TestMetric(t)
+	mr.Create(m1)
+
+	_, err := mr.FindBySlug("READING_TIME_NOTE_2")
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	m2, err := mr.FindBySlug("reading_time_note_1")
+	assert.NoError(t, err)
+	assert.Equal(t, m1.MetricID, m2.MetricID)
+}
@@ -0,0 +1,113 @@
+package testrepository
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+var errPartitionOverlaps = errors.New("partition overlaps an existing one")
+
+// PartitionRepository partitions the events of an EventRepository, an event outside of every partition
+// is in the default one.
+type PartitionRepository struct {
+	partitions []*entity.Partition
+	events     *eventTable
+}
+
+func NewPartitionRepository(er *EventRepository) *PartitionRepository {
+	return &PartitionRepository{
+		partitions: make([]*entity.Partition, 0),
+		events:     er.eventTable,
+	}
+}
+
+func (r *PartitionRepository) List() ([]*entity.Partition, error) {
+	partitions := make([]*entity.Partition, len(r.partitions))
+	for i, p := range r.partitions {
+		c := *p
+		partitions[i] = &c
+	}
+	return partitions, nil
+}
+
+func (r *PartitionRepository) Create(p *entity.Partition) error {
+	for _, o := range r.partitions {
+		if p.From.Before(o.To) && o.From.Before(p.To) {
+			return errPartitionOverlaps
+		}
+	}
+
+	c := *p
+	r.partitions = append(r.partitions, &c)
+	sort.Slice(r.partitions, func(i, j int) bool { return r.partitions[i].From.Before(r.partitions[j].From) })
+
+	return nil
+}
+
+func (r *PartitionRepository) Drop(p *entity.Partition) error {
+	for i, o := range r.partitions {
+		if o.From.Equal(p.From) {
+			r.partitions = append(r.partitions[:i], r.partitions[i+1:]...)
+			break
+		}
+	}
+
+	dropped := make(map[int]bool)
+	for eventID, e := range r.events.events {
+		if p.Contains(e.TimeStamp.Time) {
+			dropped[eventID] = true
+		}
+	}
+	r.delete(dropped)
+
+	return nil
+}
+
+func (r *PartitionRepository) PurgeDefault(before time.Time, limit int) (int, error) {
+	expired := make([]*entity.Event, 0)
+	for _, e := range r.events.events {
+		if e.TimeStamp.Before(before) && r.partitionOf(e) == nil {
+			expired = append(expired, e)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].TimeStamp.Before(expired[j].TimeStamp.Time) })
+
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+
+	purged := make(map[int]bool, len(expired))
+	for _, e := range expired {
+		purged[e.EventID] = true
+	}
+	r.delete(purged)
+
+	return len(purged), nil
+}
+
+// delete removes the events with their values.
+func (r *PartitionRepository) delete(eventIDs map[int]bool) {
+	for eventID := range eventIDs {
+		delete(r.events.events, eventID)
+		delete(r.events.tenants, eventID)
+	}
+
+	for pair := range r.events.eventsWithMetrics {
+		if eventIDs[pair.eventID] {
+			delete(r.events.eventsWithMetrics, pair)
+		}
+	}
+}
+
+// partitionOf returns the partition of the event, nil for the default one.
+func (r *PartitionRepository) partitionOf(e *entity.Event) *entity.Partition {
+	for _, p := range r.partitions {
+		if p.Contains(e.TimeStamp.Time) {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package testrepository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/testrepository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionRepository(t *testing.T) {
+	er := testrepository.NewEventRepository()
+	pr := testrepository.NewPartitionRepository(er)
+
+	day := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	october := entity.PartitionAt(day, entity.PartitionMonth)
+	november := entity.PartitionAt(october.To, entity.PartitionMonth)
+
+	assert.NoError(t, pr.Create(november))
+	assert.NoError(t, pr.Create(october))
+	assert.Error(t, pr.Create(entity.PartitionAt(day.AddDate(0, 0, 10), entity.PartitionDay)))
+
+	partitions, err := pr.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []*entity.Partition{october, november}, partitions)
+
+	// the first event is in the default partition, the last one in November
+	for _, ts := range []time.Time{day.AddDate(0, -1, 0), day, day.AddDate(0, 0, 30), day.AddDate(0, 1, 0)} {
+		e := &entity.Event{ServiceID: 1, TimeStamp: entity.CustomTime{Time: ts}}
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: 1, MetricValue: int64(1)}}))
+	}
+
+	// the event of the default partition is left to PurgeDefault
+	assert.NoError(t, pr.Drop(october))
+
+	c, err := er.ServiceCascade(1)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 2, Values: 2}, c)
+
+	n, err := pr.PurgeDefault(october.To, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = pr.PurgeDefault(october.To, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	c, err = er.ServiceCascade(1)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 1, Values: 1}, c)
+
+	partitions, err = pr.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []*entity.Partition{november}, partitions)
+}
@@ -0,0 +1,127 @@
+package testrepository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+)
+
+// RetentionRepository is safe for concurrent use, the policies are read by the purge worker.
+// The policies of every tenant are kept in one table shared by its tenant scopes.
+type RetentionRepository struct {
+	*retentionTable
+	tenantID int
+}
+
+type retentionTable struct {
+	mu       sync.Mutex
+	policies map[int]*entity.RetentionPolicy
+	lastID   int
+}
+
+func NewRetentionRepository() *RetentionRepository {
+	return &RetentionRepository{
+		retentionTable: &retentionTable{
+			policies: make(map[int]*entity.RetentionPolicy),
+		},
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *RetentionRepository) ForTenant(tenantID int) repository.RetentionRepository {
+	return &RetentionRepository{
+		retentionTable: r.retentionTable,
+		tenantID:       tenantID,
+	}
+}
+
+func (r *RetentionRepository) Save(p *entity.RetentionPolicy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, saved := range r.policies {
+		if (p.ServiceID != 0 && saved.ServiceID == p.ServiceID) || (p.MetricID != 0 && saved.MetricID == p.MetricID) {
+			if saved.TenantID != r.tenantID {
+				return repository.ErrRecordNotFound
+			}
+			p.PolicyID = saved.PolicyID
+		}
+	}
+
+	if p.PolicyID == 0 {
+		r.lastID++
+		p.PolicyID = r.lastID
+	}
+	p.TenantID = r.tenantID
+	p.UpdatedAt = entity.CustomTime{Time: time.Now()}
+
+	c := *p
+	r.policies[p.PolicyID] = &c
+
+	return nil
+}
+
+func (r *RetentionRepository) FindByService(serviceID int) (*entity.RetentionPolicy, error) {
+	return r.find(func(p *entity.RetentionPolicy) bool { return p.ServiceID == serviceID })
+}
+
+func (r *RetentionRepository) FindByMetric(metricID int) (*entity.RetentionPolicy, error) {
+	return r.find(func(p *entity.RetentionPolicy) bool { return p.MetricID == metricID })
+}
+
+func (r *RetentionRepository) find(match func(*entity.RetentionPolicy) bool) (*entity.RetentionPolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.policies {
+		if p.TenantID == r.tenantID && match(p) {
+			c := *p
+			return &c, nil
+		}
+	}
+	return nil, repository.ErrRecordNotFound
+}
+
+func (r *RetentionRepository) List() ([]*entity.RetentionPolicy, error) {
+	return r.list(true)
+}
+
+func (r *RetentionRepository) All() ([]*entity.RetentionPolicy, error) {
+	return r.list(false)
+}
+
+func (r *RetentionRepository) list(inTenant bool) ([]*entity.RetentionPolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	policies := make([]*entity.RetentionPolicy, 0, len(r.policies))
+	for _, p := range r.policies {
+		if !inTenant || p.TenantID == r.tenantID {
+			c := *p
+			policies = append(policies, &c)
+		}
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].PolicyID < policies[j].PolicyID })
+
+	return policies, nil
+}
+
+func (r *RetentionRepository) Delete(policyID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, ok := r.policies[policyID]; !ok || p.TenantID != r.tenantID {
+		return repository.ErrRecordNotFound
+	}
+
+	delete(r.policies, policyID)
+
+	return nil
+}
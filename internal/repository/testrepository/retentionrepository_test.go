@@ -0,0 +1,64 @@
+package testrepository_test
+
+import (
+	"testing"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/testrepository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionRepository_Save(t *testing.T) {
+	rr := testrepository.NewRetentionRepository()
+
+	p1 := entity.TestRetentionPolicy(t)
+	assert.NoError(t, rr.Save(p1))
+	assert.NotZero(t, p1.PolicyID)
+
+	p2 := entity.TestRetentionPolicy(t)
+	p2.KeepRaw = "7d"
+	assert.NoError(t, rr.Save(p2))
+	assert.Equal(t, p1.PolicyID, p2.PolicyID)
+
+	found, err := rr.FindByService(p1.ServiceID)
+	assert.NoError(t, err)
+	assert.Equal(t, "7d", found.KeepRaw)
+
+	_, err = rr.FindByMetric(p1.ServiceID)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	assert.Error(t, rr.Save(&entity.RetentionPolicy{KeepRaw: "7d"}))
+}
+
+func TestRetentionRepository_ForTenant(t *testing.T) {
+	rr := testrepository.NewRetentionRepository()
+	other := rr.ForTenant(entity.DefaultTenantID + 1)
+
+	p1 := entity.TestRetentionPolicy(t)
+	assert.NoError(t, rr.Save(p1))
+
+	p2 := &entity.RetentionPolicy{MetricID: 1, KeepRaw: "1d"}
+	assert.NoError(t, other.Save(p2))
+
+	assert.EqualError(t, other.Save(entity.TestRetentionPolicy(t)), repository.ErrRecordNotFound.Error())
+
+	_, err := other.FindByService(p1.ServiceID)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	policies, err := rr.List()
+	assert.NoError(t, err)
+	assert.Len(t, policies, 1)
+
+	policies, err = rr.All()
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+	assert.Equal(t, entity.DefaultTenantID+1, policies[1].TenantID)
+
+	assert.EqualError(t, rr.Delete(p2.PolicyID), repository.ErrRecordNotFound.Error())
+	assert.NoError(t, other.Delete(p2.PolicyID))
+
+	policies, err = other.List()
+	assert.NoError(t, err)
+	assert.Empty(t, policies)
+}
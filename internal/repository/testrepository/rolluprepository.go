@@ -0,0 +1,279 @@
+package testrepository
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+)
+
+// RollupRepository rolls up the events of an EventRepository, the rollups of every tenant are kept
+// in one table shared by its tenant scopes.
+type RollupRepository struct {
+	*rollupTable
+	events   *eventTable
+	tenantID int
+}
+
+type rollupTable struct {
+	rollups    map[time.Duration]map[rollupKey]*rollup
+	watermarks map[time.Duration]time.Time
+}
+
+type rollupKey struct {
+	serviceID int
+	metricID  int
+	bucket    time.Time
+}
+
+type rollup struct {
+	tenantID      int
+	count         int
+	sum           float64
+	min           float64
+	max           float64
+	last          float64
+	lastTimeStamp time.Time
+}
+
+// merge adds the values of o to the rollup.
+func (ru *rollup) merge(o *rollup) {
+	if ru.count == 0 || o.min < ru.min {
+		ru.min = o.min
+	}
+	if ru.count == 0 || o.max > ru.max {
+		ru.max = o.max
+	}
+	if ru.count == 0 || !o.lastTimeStamp.Before(ru.lastTimeStamp) {
+		ru.last = o.last
+		ru.lastTimeStamp = o.lastTimeStamp
+	}
+
+	ru.tenantID = o.tenantID
+	ru.count += o.count
+	ru.sum += o.sum
+}
+
+func NewRollupRepository(er *EventRepository) *RollupRepository {
+	rollups := make(map[time.Duration]map[rollupKey]*rollup, len(entity.RollupResolutions))
+	for _, res := range entity.RollupResolutions {
+		rollups[res] = make(map[rollupKey]*rollup)
+	}
+
+	return &RollupRepository{
+		rollupTable: &rollupTable{
+			rollups:    rollups,
+			watermarks: make(map[time.Duration]time.Time),
+		},
+		events:   er.eventTable,
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *RollupRepository) ForTenant(tenantID int) repository.RollupRepository {
+	return &RollupRepository{
+		rollupTable: r.rollupTable,
+		events:      r.events,
+		tenantID:    tenantID,
+	}
+}
+
+func (r *RollupRepository) Watermark(res time.Duration) (time.Time, error) {
+	if t, ok := r.watermarks[res]; ok {
+		return t, nil
+	}
+
+	var earliest time.Time
+	for _, e := range r.events.events {
+		if earliest.IsZero() || e.TimeStamp.Before(earliest) {
+			earliest = e.TimeStamp.Time
+		}
+	}
+	return earliest, nil
+}
+
+func (r *RollupRepository) Rollup(res time.Duration, from, to time.Time) (int, error) {
+	if !entity.IsRollupResolution(res) {
+		return 0, errors.New("unknown rollup resolution")
+	}
+
+	n := r.rollup(res, func(_ int, t time.Time) bool { return !t.Before(from) && t.Before(to) })
+	r.watermarks[res] = to
+	if _, ok := entity.FinerRollupResolution(res); !ok {
+		r.events.rolledUpTo = to
+	}
+
+	return n, nil
+}
+
+func (r *RollupRepository) RollupLate(limit int) (int, error) {
+	keys := make([]lateKey, 0, len(r.events.late))
+	for k := range r.events.late {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].bucket.Before(keys[j].bucket) })
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	for _, k := range keys {
+		delete(r.events.late, k)
+	}
+
+	for _, res := range entity.RollupResolutions {
+		watermark, ok := r.watermarks[res]
+		if !ok {
+			break
+		}
+
+		a := &entity.Aggregation{Bucket: res}
+		buckets := make(map[lateKey]bool, len(keys))
+		for _, k := range keys {
+			buckets[lateKey{serviceID: k.serviceID, bucket: a.BucketStart(k.bucket)}] = true
+		}
+
+		r.rollup(res, func(serviceID int, t time.Time) bool {
+			b := a.BucketStart(t)
+			return b.Before(watermark) && buckets[lateKey{serviceID: serviceID, bucket: b}]
+		})
+	}
+
+	return len(keys), nil
+}
+
+func (r *RollupRepository) Late(serviceID int, p [2]*entity.CustomTime) (bool, error) {
+	for k := range r.events.late {
+		if k.serviceID == serviceID && k.bucket.After(p[0].Add(-time.Minute)) && k.bucket.Before(p[1].Time) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// rollup replaces the rollups of res with the values of the finer resolution, or the raw values for the finest,
+// matched by their service and time stamp, and returns the number of rollups.
+func (r *RollupRepository) rollup(res time.Duration, match func(serviceID int, t time.Time) bool) int {
+	a := &entity.Aggregation{Bucket: res}
+	rollups := make(map[rollupKey]*rollup)
+	add := func(k rollupKey, ru *rollup) {
+		k.bucket = a.BucketStart(k.bucket)
+		if _, ok := rollups[k]; !ok {
+			rollups[k] = &rollup{}
+		}
+		rollups[k].merge(ru)
+	}
+
+	if finer, ok := entity.FinerRollupResolution(res); ok {
+		for k, ru := range r.rollups[finer] {
+			if match(k.serviceID, k.bucket) {
+				add(k, ru)
+			}
+		}
+	} else {
+		for p, v := range r.events.eventsWithMetrics {
+			e := r.events.events[p.eventID]
+			x, ok := rollupValue(v)
+			if !ok || !match(e.ServiceID, e.TimeStamp.Time) {
+				continue
+			}
+
+			add(
+				rollupKey{serviceID: e.ServiceID, metricID: p.metricID, bucket: e.TimeStamp.Time},
+				&rollup{tenantID: r.events.tenants[p.eventID], count: 1, sum: x, min: x, max: x, last: x, lastTimeStamp: e.TimeStamp.Time},
+			)
+		}
+	}
+
+	for k, ru := range rollups {
+		r.rollups[res][k] = ru
+	}
+
+	return len(rollups)
+}
+
+func (r *RollupRepository) Aggregate(serviceID int, p [2]*entity.CustomTime, m *entity.Metric, a *entity.Aggregation, res time.Duration) ([]*entity.AggregatedMetric, error) {
+	grouped := make(map[time.Time]*rollup)
+	for k, ru := range r.rollups[res] {
+		if ru.tenantID != r.tenantID || k.serviceID != serviceID || k.metricID != m.MetricID || k.bucket.Before(p[0].Time) || !k.bucket.Before(p[1].Time) {
+			continue
+		}
+
+		t := a.BucketStart(k.bucket)
+		if _, ok := grouped[t]; !ok {
+			grouped[t] = &rollup{}
+		}
+		grouped[t].merge(ru)
+	}
+
+	if len(grouped) == 0 {
+		return nil, repository.ErrRecordNotFound
+	}
+
+	buckets := make([]*entity.AggregatedMetric, 0, len(grouped))
+	for t, ru := range grouped {
+		b := &entity.AggregatedMetric{
+			TimeStamp: entity.CustomTime{Time: t},
+			Values:    make(map[string]interface{}, len(a.Functions)),
+		}
+
+		for _, f := range a.Functions {
+			if f == "count" {
+				b.Values[f] = ru.count
+				continue
+			}
+
+			x := map[string]float64{"sum": ru.sum, "min": ru.min, "max": ru.max, "avg": ru.sum / float64(ru.count), "last": ru.last}[f]
+			v, err := aggregateResult(m.MetricType, f, x)
+			if err != nil {
+				return nil, err
+			}
+			b.Values[f] = v
+		}
+
+		buckets = append(buckets, b)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].TimeStamp.Before(buckets[j].TimeStamp.Time) })
+
+	return buckets, nil
+}
+
+func (r *RollupRepository) PurgeService(res time.Duration, serviceID int, before time.Time, limit int) (int, error) {
+	return r.purge(res, func(k rollupKey) bool { return k.serviceID == serviceID }, before, limit)
+}
+
+func (r *RollupRepository) PurgeMetric(res time.Duration, metricID int, before time.Time, limit int) (int, error) {
+	return r.purge(res, func(k rollupKey) bool { return k.metricID == metricID }, before, limit)
+}
+
+func (r *RollupRepository) purge(res time.Duration, match func(rollupKey) bool, before time.Time, limit int) (int, error) {
+	keys := make([]rollupKey, 0)
+	for k, ru := range r.rollups[res] {
+		if ru.tenantID == r.tenantID && k.bucket.Before(before) && match(k) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].bucket.Before(keys[j].bucket) })
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	for _, k := range keys {
+		delete(r.rollups[res], k)
+	}
+
+	return len(keys), nil
+}
+
+// rollupValue converts the value of a metric with rollups to a number like sqlrepository does.
+func rollupValue(v interface{}) (float64, bool) {
+	switch v.(type) {
+	case int, int64, float64, time.Duration:
+		x, err := toFloat(v)
+		return x, err == nil
+	default:
+		return 0, false
+	}
+}
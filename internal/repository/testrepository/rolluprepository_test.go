@@ -0,0 +1,170 @@
+package testrepository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/testrepository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollupRepository_Rollup(t *testing.T) {
+	er := testrepository.NewEventRepository()
+	ur := testrepository.NewRollupRepository(er)
+
+	m := entity.TestMetric(t)
+	m.MetricID = 1
+	m.MetricType = "INT"
+
+	watermark, err := ur.Watermark(time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, watermark.IsZero())
+
+	day := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i, minutes := range []int{0, 0, 1, 61, 62} {
+		e := entity.TestEvent(t)
+		e.ServiceID = 1
+		e.TimeStamp.Time = day.Add(time.Duration(minutes)*time.Minute + time.Duration(i)*time.Second)
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{
+			{MetricID: m.MetricID, MetricValue: int64((i + 1) * 10)},
+			{MetricID: 2, MetricValue: "text"},
+		}))
+	}
+
+	watermark, err = ur.Watermark(time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, day, watermark)
+
+	n, err := ur.Rollup(time.Minute, day, day.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	n, err = ur.Rollup(time.Hour, day, day.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	watermark, err = ur.Watermark(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, day.Add(2*time.Hour), watermark)
+
+	p := [2]*entity.CustomTime{{Time: day}, {Time: day.Add(2 * time.Hour)}}
+	a := &entity.Aggregation{Bucket: time.Hour, Functions: []string{"count", "sum", "min", "max", "avg", "last"}}
+	expected := []*entity.AggregatedMetric{
+		{
+			TimeStamp: entity.CustomTime{Time: day},
+			Values:    map[string]interface{}{"count": 3, "sum": int64(60), "min": int64(10), "max": int64(30), "avg": 20.0, "last": int64(30)},
+		},
+		{
+			TimeStamp: entity.CustomTime{Time: day.Add(time.Hour)},
+			Values:    map[string]interface{}{"count": 2, "sum": int64(90), "min": int64(40), "max": int64(50), "avg": 45.0, "last": int64(50)},
+		},
+	}
+
+	for _, res := range []time.Duration{time.Minute, time.Hour} {
+		buckets, err := ur.Aggregate(1, p, m, a, res)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, buckets)
+	}
+
+	_, err = ur.ForTenant(entity.DefaultTenantID+1).Aggregate(1, p, m, a, time.Hour)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+}
+
+func TestRollupRepository_RollupLate(t *testing.T) {
+	er := testrepository.NewEventRepository()
+	ur := testrepository.NewRollupRepository(er)
+
+	m := &entity.Metric{MetricID: 1, MetricType: "INT"}
+	day := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	create := func(ts time.Time, v int64) {
+		e := &entity.Event{ServiceID: 1, TimeStamp: entity.CustomTime{Time: ts}}
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: v}}))
+	}
+
+	create(day.Add(10*time.Minute), 10)
+	for _, res := range []time.Duration{time.Minute, time.Hour} {
+		_, err := ur.Rollup(res, day, day.Add(2*time.Hour))
+		assert.NoError(t, err)
+	}
+
+	p := [2]*entity.CustomTime{{Time: day}, {Time: day.Add(time.Hour)}}
+	late, err := ur.Late(1, p)
+	assert.NoError(t, err)
+	assert.False(t, late)
+
+	create(day.Add(10*time.Minute+30*time.Second), 20)
+	create(day.Add(90*time.Minute), 30)
+	create(day.Add(3*time.Hour), 40)
+
+	late, err = ur.Late(1, p)
+	assert.NoError(t, err)
+	assert.True(t, late)
+
+	late, err = ur.Late(2, p)
+	assert.NoError(t, err)
+	assert.False(t, late)
+
+	n, err := ur.RollupLate(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	late, err = ur.Late(1, p)
+	assert.NoError(t, err)
+	assert.False(t, late)
+
+	n, err = ur.RollupLate(10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	a := &entity.Aggregation{Bucket: time.Hour, Functions: []string{"count", "sum"}}
+	expected := []*entity.AggregatedMetric{
+		{TimeStamp: entity.CustomTime{Time: day}, Values: map[string]interface{}{"count": 2, "sum": int64(30)}},
+		{TimeStamp: entity.CustomTime{Time: day.Add(time.Hour)}, Values: map[string]interface{}{"count": 1, "sum": int64(30)}},
+	}
+	for _, res := range []time.Duration{time.Minute, time.Hour} {
+		buckets, err := ur.Aggregate(1, [2]*entity.CustomTime{{Time: day}, {Time: day.Add(4 * time.Hour)}}, m, a, res)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, buckets)
+	}
+
+	n, err = ur.RollupLate(10)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestRollupRepository_Purge(t *testing.T) {
+	er := testrepository.NewEventRepository()
+	ur := testrepository.NewRollupRepository(er)
+
+	day := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		e := entity.TestEvent(t)
+		e.ServiceID = 1
+		e.TimeStamp.Time = day.Add(time.Duration(i) * time.Minute)
+		assert.NoError(t, er.CreateWithMetrics(e, []*entity.AddMetric{
+			{MetricID: 1, MetricValue: 1.5},
+			{MetricID: 2, MetricValue: time.Second},
+		}))
+	}
+
+	_, err := ur.Rollup(time.Minute, day, day.Add(time.Hour))
+	assert.NoError(t, err)
+
+	n, err := ur.ForTenant(entity.DefaultTenantID+1).PurgeService(time.Minute, 1, day.Add(time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	n, err = ur.PurgeMetric(time.Minute, 2, day.Add(time.Hour), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	n, err = ur.PurgeService(time.Minute, 1, day.Add(2*time.Minute), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	n, err = ur.PurgeService(time.Minute, 1, day.Add(time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
@@ -1,17 +1,38 @@
 package testrepository
 
 import (
+	"time"
+
 	"github.com/AnatoliyBr/dwh-service/internal/entity"
 	"github.com/AnatoliyBr/dwh-service/internal/repository"
 )
 
+// ServiceRepository keeps the services of every tenant in one table shared by its tenant scopes.
 type ServiceRepository struct {
+	*serviceTable
+	tenantID int
+}
+
+type serviceTable struct {
 	services map[int]*entity.Service
+	tenants  map[int]int
+	lastID   int
 }
 
 func NewServiceRepository() *ServiceRepository {
 	return &ServiceRepository{
-		services: make(map[int]*entity.Service),
+		serviceTable: &serviceTable{
+			services: make(map[int]*entity.Service),
+			tenants:  make(map[int]int),
+		},
+		tenantID: entity.DefaultTenantID,
+	}
+}
+
+func (r *ServiceRepository) ForTenant(tenantID int) repository.ServiceRepository {
+	return &ServiceRepository{
+		serviceTable: r.serviceTable,
+		tenantID:     tenantID,
 	}
 }
 
@@ -20,16 +41,90 @@ func (r *ServiceRepository) Create(s *entity.Service) error {
 		return err
 	}
 
-	s.ServiceID = len(r.services) + 1
+	r.lastID++
+	s.ServiceID = r.lastID
 	r.services[s.ServiceID] = s
+	r.tenants[s.ServiceID] = r.tenantID
 
 	return nil
 }
 
 func (r *ServiceRepository) FindByID(serviceID int) (*entity.Service, error) {
 	s, ok := r.services[serviceID]
-	if !ok {
+	if !ok || r.tenants[serviceID] != r.tenantID {
 		return nil, repository.ErrRecordNotFound
 	}
 	return s, nil
 }
+
+func (r *ServiceRepository) FindBySlug(slug string) (*entity.Service, error) {
+	slug = entity.NormalizeSlug(slug)
+	for _, s := range r.services {
+		if s.Slug == slug && r.tenants[s.ServiceID] == r.tenantID {
+			return s, nil
+		}
+	}
+	return nil, repository.ErrRecordNotFound
+}
+
+func (r *ServiceRepository) List(o *entity.ListOptions) ([]*entity.Service, error) {
+	items := make([]listItem, 0, len(r.services))
+	for _, s := range r.services {
+		if r.tenants[s.ServiceID] == r.tenantID {
+			items = append(items, listItem{id: s.ServiceID, slug: s.Slug, details: s.Details, archived: s.Archived})
+		}
+	}
+
+	ids, err := listPage(items, o)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]*entity.Service, len(ids))
+	for i, id := range ids {
+		services[i] = r.services[id]
+	}
+	return services, nil
+}
+
+func (r *ServiceRepository) Update(s *entity.Service) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	old, err := r.FindByID(s.ServiceID)
+	if err != nil {
+		return err
+	}
+
+	s.Archived = old.Archived
+	s.ArchivedAt = old.ArchivedAt
+	r.services[s.ServiceID] = s
+
+	return nil
+}
+
+func (r *ServiceRepository) Archive(serviceID int) error {
+	s, err := r.FindByID(serviceID)
+	if err != nil {
+		return err
+	}
+
+	if !s.Archived {
+		s.Archived = true
+		s.ArchivedAt = &entity.CustomTime{Time: time.Now()}
+	}
+
+	return nil
+}
+
+func (r *ServiceRepository) Delete(serviceID int) error {
+	if _, err := r.FindByID(serviceID); err != nil {
+		return err
+	}
+
+	delete(r.services, serviceID)
+	delete(r.tenants, serviceID)
+
+	return nil
+}
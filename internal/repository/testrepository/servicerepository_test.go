@@ -29,3 +29,120 @@ func TestServiceRepository_FindByID(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, s2)
 }
+
+func TestServiceRepository_List(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+
+	for _, slug := range []string{"NOTE_BOOK", "TODO_APP", "NOTE_PAD"} {
+		s := entity.TestService(t)
+		s.Slug = slug
+		sr.Create(s)
+	}
+
+	o := &entity.ListOptions{Limit: 2}
+	assert.NoError(t, o.Validate())
+
+	page, err := sr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 2)
+	assert.Equal(t, 1, page[0].ServiceID)
+
+	o.Cursor = o.NextCursor(page[1].ServiceID, page[1].Slug)
+	page, err = sr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Equal(t, 3, page[0].ServiceID)
+
+	o = &entity.ListOptions{SortBy: "slug", Order: "desc", SlugPrefix: "note"}
+	assert.NoError(t, o.Validate())
+
+	page, err = sr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 2)
+	assert.Equal(t, "NOTE_PAD", page[0].Slug)
+	assert.Equal(t, "NOTE_BOOK", page[1].Slug)
+
+	o = &entity.ListOptions{Search: "word processing"}
+	assert.NoError(t, o.Validate())
+
+	page, err = sr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 3)
+}
+
+func TestServiceRepository_Update(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+
+	s := entity.TestService(t)
+	assert.Equal(t, repository.ErrRecordNotFound, sr.Update(s))
+
+	sr.Create(s)
+	sr.Archive(s.ServiceID)
+
+	updated := &entity.Service{ServiceID: s.ServiceID, Slug: "note pad", Details: "Notes"}
+	assert.NoError(t, sr.Update(updated))
+	assert.Equal(t, "NOTE_PAD", updated.Slug)
+	assert.True(t, updated.Archived)
+
+	updated.Details = ""
+	assert.Error(t, sr.Update(updated))
+}
+
+func TestServiceRepository_Archive(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+	assert.Equal(t, repository.ErrRecordNotFound, sr.Archive(1))
+
+	s := entity.TestService(t)
+	sr.Create(s)
+
+	assert.NoError(t, sr.Archive(s.ServiceID))
+	assert.True(t, s.Archived)
+	assert.NotNil(t, s.ArchivedAt)
+
+	archivedAt := s.ArchivedAt
+	assert.NoError(t, sr.Archive(s.ServiceID))
+	assert.Equal(t, archivedAt, s.ArchivedAt)
+
+	o := &entity.ListOptions{}
+	assert.NoError(t, o.Validate())
+
+	page, err := sr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 0)
+
+	o.IncludeArchived = true
+	page, err = sr.List(o)
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+}
+
+func TestServiceRepository_Delete(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+
+	s1 := entity.TestService(t)
+	sr.Create(s1)
+
+	assert.NoError(t, sr.Delete(s1.ServiceID))
+	assert.Equal(t, repository.ErrRecordNotFound, sr.Delete(s1.ServiceID))
+
+	_, err := sr.FindByID(s1.ServiceID)
+	assert.Equal(t, repository.ErrRecordNotFound, err)
+
+	s2 := entity.TestService(t)
+	sr.Create(s2)
+	assert.NotEqual(t, s1.ServiceID, s2.ServiceID)
+}
+
+func TestServiceRepository_FindBySlug(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+
+	s1 := entity.TestService(t)
+	sr.Create(s1)
+
+	_, err := sr.FindBySlug("TODO_APP")
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	s2, err := sr.FindBySlug(" note book ")
+	assert.NoError(t, err)
+	assert.Equal(t, s1.ServiceID, s2.ServiceID)
+}
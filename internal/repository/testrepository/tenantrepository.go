@@ -0,0 +1,63 @@
+package testrepository
+
+import (
+	"sort"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+)
+
+// TenantRepository starts with the default tenant like the database does.
+type TenantRepository struct {
+	tenants map[int]*entity.Tenant
+	lastID  int
+}
+
+func NewTenantRepository() *TenantRepository {
+	return &TenantRepository{
+		tenants: map[int]*entity.Tenant{
+			entity.DefaultTenantID: {TenantID: entity.DefaultTenantID, Slug: "DEFAULT", Details: "Default tenant"},
+		},
+		lastID: entity.DefaultTenantID,
+	}
+}
+
+func (r *TenantRepository) Create(t *entity.Tenant) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	r.lastID++
+	t.TenantID = r.lastID
+	r.tenants[t.TenantID] = t
+
+	return nil
+}
+
+func (r *TenantRepository) FindByID(tenantID int) (*entity.Tenant, error) {
+	t, ok := r.tenants[tenantID]
+	if !ok {
+		return nil, repository.ErrRecordNotFound
+	}
+	return t, nil
+}
+
+func (r *TenantRepository) FindBySlug(slug string) (*entity.Tenant, error) {
+	slug = entity.NormalizeSlug(slug)
+	for _, t := range r.tenants {
+		if t.Slug == slug {
+			return t, nil
+		}
+	}
+	return nil, repository.ErrRecordNotFound
+}
+
+func (r *TenantRepository) List() ([]*entity.Tenant, error) {
+	tenants := make([]*entity.Tenant, 0, len(r.tenants))
+	for _, t := range r.tenants {
+		tenants = append(tenants, t)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].TenantID < tenants[j].TenantID })
+
+	return tenants, nil
+}
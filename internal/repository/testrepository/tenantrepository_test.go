@@ -0,0 +1,50 @@
+package testrepository_test
+
+import (
+	"testing"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+	"github.com/AnatoliyBr/dwh-service/internal/repository"
+	"github.com/AnatoliyBr/dwh-service/internal/repository/testrepository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantRepository_Create(t *testing.T) {
+	tr := testrepository.NewTenantRepository()
+
+	tenant := entity.TestTenant(t)
+	assert.NoError(t, tr.Create(tenant))
+	assert.NotEqual(t, entity.DefaultTenantID, tenant.TenantID)
+
+	got, err := tr.FindBySlug("team_a")
+	assert.NoError(t, err)
+	assert.Equal(t, tenant.TenantID, got.TenantID)
+
+	tenants, err := tr.List()
+	assert.NoError(t, err)
+	assert.Len(t, tenants, 2)
+	assert.Equal(t, entity.DefaultTenantID, tenants[0].TenantID)
+}
+
+func TestServiceRepository_ForTenant(t *testing.T) {
+	sr := testrepository.NewServiceRepository()
+	other := sr.ForTenant(entity.DefaultTenantID + 1)
+
+	s1 := entity.TestService(t)
+	assert.NoError(t, sr.Create(s1))
+
+	s2 := entity.TestService(t)
+	assert.NoError(t, other.Create(s2))
+
+	_, err := other.FindByID(s1.ServiceID)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	found, err := other.FindBySlug(s1.Slug)
+	assert.NoError(t, err)
+	assert.Equal(t, s2.ServiceID, found.ServiceID)
+
+	page, err := sr.List(&entity.ListOptions{Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Equal(t, s1.ServiceID, page[0].ServiceID)
+}
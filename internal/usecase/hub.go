@@ -0,0 +1,108 @@
+package usecase
+
+import (
+	"sync"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+// Hub fans the values of stored events out to the subscribers of their series.
+// Publishing never blocks: a subscriber whose buffer is full is dropped.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription receives the values of a set of series until it is closed or dropped.
+type Subscription struct {
+	hub     *Hub
+	series  map[entity.Series]struct{}
+	values  chan *entity.LiveValue
+	dropped bool
+	closed  bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe subscribes to the values of series, up to buffer values are kept for a subscriber that lags behind.
+func (h *Hub) Subscribe(series []entity.Series, buffer int) *Subscription {
+	sub := &Subscription{
+		hub:    h,
+		series: make(map[entity.Series]struct{}, len(series)),
+		values: make(chan *entity.LiveValue, buffer),
+	}
+	for _, s := range series {
+		sub.series[s] = struct{}{}
+	}
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub
+}
+
+// Publish delivers values to the subscribers of their series.
+func (h *Hub) Publish(values []*entity.LiveValue) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		for _, v := range values {
+			if _, ok := sub.series[v.Series()]; !ok {
+				continue
+			}
+
+			select {
+			case sub.values <- v:
+			default:
+				sub.dropped = true
+				h.remove(sub)
+			}
+
+			if sub.closed {
+				break
+			}
+		}
+	}
+}
+
+// Subscribers returns the number of active subscriptions.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// remove closes the channel of sub, h.mu must be held.
+func (h *Hub) remove(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(h.subs, sub)
+	close(sub.values)
+}
+
+// Values returns the channel of the values, it is closed once the subscription is closed or dropped.
+func (s *Subscription) Values() <-chan *entity.LiveValue {
+	return s.values
+}
+
+// Dropped reports whether the subscription was dropped because the subscriber did not keep up.
+func (s *Subscription) Dropped() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.dropped
+}
+
+// Close unsubscribes, it is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
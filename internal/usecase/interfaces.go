@@ -1,15 +1,78 @@
 package usecase
 
-import "github.com/AnatoliyBr/dwh-service/internal/entity"
+import (
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
 
 type UseCase interface {
+	ForTenant(int) UseCase
+	TenantID() int
+	TenantCreate(*entity.Tenant) error
+	TenantFindByID(int) (*entity.Tenant, error)
+	TenantFindBySlug(string) (*entity.Tenant, error)
+	TenantList() ([]*entity.Tenant, error)
+
 	ServiceCreate(*entity.Service) error
 	ServiceFindByID(int) (*entity.Service, error)
+	ServiceFindBySlug(string) (*entity.Service, error)
+	ServiceList(*entity.ListOptions) ([]*entity.Service, error)
+	ServiceUpdate(*entity.Service) error
+	ServiceArchive(int) (*entity.Service, error)
+	ServiceDelete(int, bool) (*entity.Cascade, error)
 
 	MetricCreate(*entity.Metric) error
+	MetricRegister(*entity.Metric) (bool, error)
 	MetricFindByID(int) (*entity.Metric, error)
+	MetricFindBySlug(string) (*entity.Metric, error)
+	MetricList(*entity.ListOptions) ([]*entity.Metric, error)
+	MetricUpdate(*entity.Metric) error
+	MetricArchive(int) (*entity.Metric, error)
+	MetricDelete(int, bool) (*entity.Cascade, error)
 
 	EventCreate(*entity.Event) error
 	AddMetricsToEvent(int, []*entity.AddMetric) error
-	GetMetricValuesForTimePeriod(int, [2]*entity.CustomTime, *entity.Metric) (interface{}, error)
+	EventCreateWithMetrics(*entity.Event, []*entity.AddMetric) error
+	EventBatchCreate([]*entity.BatchItem, bool) []error
+	GetMetricValuesForTimePeriod(int, [2]*entity.CustomTime, *entity.Metric, *entity.LabelSelector) (interface{}, error)
+	AggregateMetricValuesForTimePeriod(int, [2]*entity.CustomTime, *entity.Metric, *entity.Aggregation, *entity.LabelSelector) ([]*entity.AggregatedMetric, error)
+	LatestMetricValues([]string, []string) ([]*entity.LatestValue, error)
+	Subscribe([]entity.Series, int) *Subscription
+	Quotas() Quotas
+	Usage(time.Time) ([]*entity.Usage, error)
+
+	APIKeyCreate(*entity.APIKey) (string, error)
+	APIKeyAuthenticate(string) (*entity.APIKey, error)
+	APIKeyList() ([]*entity.APIKey, error)
+	APIKeyDelete(int) error
+	EventAuthorizer(*entity.APIKey) func(*entity.Event) error
+
+	RetentionPolicySave(*entity.RetentionPolicy) error
+	RetentionPolicyFindByService(int) (*entity.RetentionPolicy, error)
+	RetentionPolicyFindByMetric(int) (*entity.RetentionPolicy, error)
+	RetentionPolicyList() ([]*entity.RetentionPolicy, error)
+	RetentionPolicyDelete(int) error
+	RetentionPolicyListAll() ([]*entity.RetentionPolicy, error)
+	RetentionPurge(*entity.RetentionPolicy, time.Time, int) (*entity.Cascade, error)
+	RetentionPurgeRollups(*entity.RetentionPolicy, time.Duration, time.Time, int) (int, error)
+
+	RollupWatermark(time.Duration) (time.Time, error)
+	Rollup(time.Duration, time.Time, time.Time) (int, error)
+	RollupLate(int) (int, error)
+
+	PartitionList() ([]*entity.Partition, error)
+	PartitionCreate(*entity.Partition) error
+	PartitionDrop(*entity.Partition) error
+	PartitionPurgeDefault(*entity.Partition, int) (int, error)
+
+	AlertRuleCreate(*entity.AlertRule) error
+	AlertRuleUpdate(*entity.AlertRule) error
+	AlertRuleFindByID(int) (*entity.AlertRule, error)
+	AlertRuleList() ([]*entity.AlertRule, error)
+	AlertRuleDelete(int) error
+	AlertRuleListAll() ([]*entity.AlertRule, error)
+	AlertEvaluate(*entity.AlertRule, time.Time) (*entity.AlertTransition, error)
+	AlertList() ([]*entity.AlertState, error)
+	AlertHistory(int, int) ([]*entity.AlertTransition, error)
 }
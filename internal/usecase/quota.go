@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AnatoliyBr/dwh-service/internal/entity"
+)
+
+// Quotas limit the events and the metric values written to a service a day, zero disables a limit.
+type Quotas struct {
+	EventsPerDay       int `toml:"events_per_day" json:"events_per_day"`
+	MetricValuesPerDay int `toml:"metric_values_per_day" json:"metric_values_per_day"`
+}
+
+func (q Quotas) check(u *entity.Usage, events, values int) error {
+	if q.EventsPerDay > 0 && u.Events+events > q.EventsPerDay {
+		return fmt.Errorf("%w: %d of %d events written today", entity.ErrQuotaExceeded, u.Events, q.EventsPerDay)
+	}
+
+	if q.MetricValuesPerDay > 0 && u.MetricValues+values > q.MetricValuesPerDay {
+		return fmt.Errorf("%w: %d of %d metric values written today", entity.ErrQuotaExceeded, u.MetricValues, q.MetricValuesPerDay)
+	}
+
+	return nil
+}
+
+// SetQuotas limits the daily usage of every service, the use cases of the tenants
+// scoped with ForTenant afterwards share the quotas.
+func (uc *AppUseCase) SetQuotas(q Quotas) {
+	uc.quotas = q
+}
+
+func (uc *AppUseCase) Quotas() Quotas {
+	return uc.quotas
+}
+
+// Usage reports the usage of the services of the tenant on the day.
+func (uc *AppUseCase) Usage(day time.Time) ([]*entity.Usage, error) {
+	return uc.eventRepository.Usage(day, nil)
+}
+
+// checkQuotas admits the items in order while the daily quotas of their services allow
+// and rejects the rest with ErrQuotaExceeded, so that a batch fills up what is left of a quota.
+// The usage is read before the items are written, concurrent writes may overshoot a quota slightly.
+func (uc *AppUseCase) checkQuotas(items []*entity.BatchItem) ([]error, error) {
+	errs := make([]error, len(items))
+	if uc.quotas.EventsPerDay == 0 && uc.quotas.MetricValuesPerDay == 0 {
+		return errs, nil
+	}
+
+	serviceIDs := make([]int, 0)
+	for id := range entity.CountUsage(items) {
+		serviceIDs = append(serviceIDs, id)
+	}
+
+	usage, err := uc.eventRepository.Usage(time.Now(), serviceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[int]*entity.Usage, len(serviceIDs))
+	for _, u := range usage {
+		used[u.ServiceID] = u
+	}
+
+	for i, item := range items {
+		u, ok := used[item.Event.ServiceID]
+		if !ok {
+			u = &entity.Usage{ServiceID: item.Event.ServiceID}
+			used[item.Event.ServiceID] = u
+		}
+
+		if err := uc.quotas.check(u, 1, len(item.Metrics)); err != nil {
+			errs[i] = fmt.Errorf("service_id %d: %w", item.Event.ServiceID, err)
+			continue
+		}
+
+		u.Events++
+		u.MetricValues += len(item.Metrics)
+	}
+
+	return errs, nil
+}
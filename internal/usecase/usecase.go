@@ -1,22 +1,93 @@
 package usecase
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/AnatoliyBr/dwh-service/internal/entity"
 	"github.com/AnatoliyBr/dwh-service/internal/repository"
 )
 
+// AppUseCase works within one tenant, the default one unless it is scoped to another with ForTenant.
 type AppUseCase struct {
-	serviceRepository repository.ServiceRepository
-	metricRepository  repository.MetricRepository
-	eventRepository   repository.EventRepository
+	serviceRepository   repository.ServiceRepository
+	metricRepository    repository.MetricRepository
+	eventRepository     repository.EventRepository
+	apiKeyRepository    repository.APIKeyRepository
+	tenantRepository    repository.TenantRepository
+	retentionRepository repository.RetentionRepository
+	rollupRepository    repository.RollupRepository
+	partitionRepository repository.PartitionRepository
+	alertRepository     repository.AlertRepository
+	tenantID            int
+	quotas              Quotas
+
+	hub      *Hub
+	notifier repository.ValueNotifier
 }
 
-func NewAppUseCase(sr repository.ServiceRepository, mr repository.MetricRepository, er repository.EventRepository) *AppUseCase {
+func NewAppUseCase(sr repository.ServiceRepository, mr repository.MetricRepository, er repository.EventRepository, kr repository.APIKeyRepository, tr repository.TenantRepository, rr repository.RetentionRepository, ur repository.RollupRepository, pr repository.PartitionRepository, ar repository.AlertRepository) *AppUseCase {
 	return &AppUseCase{
-		serviceRepository: sr,
-		metricRepository:  mr,
-		eventRepository:   er,
+		serviceRepository:   sr,
+		metricRepository:    mr,
+		eventRepository:     er,
+		apiKeyRepository:    kr,
+		tenantRepository:    tr,
+		retentionRepository: rr,
+		rollupRepository:    ur,
+		partitionRepository: pr,
+		alertRepository:     ar,
+		tenantID:            entity.DefaultTenantID,
+		hub:                 NewHub(),
+	}
+}
+
+// ForTenant returns the use cases of the tenant, they share the live subscribers of uc:
+// series are identified by the ids of services and metrics, which are unique across tenants.
+func (uc *AppUseCase) ForTenant(tenantID int) UseCase {
+	t := *uc
+	t.serviceRepository = uc.serviceRepository.ForTenant(tenantID)
+	t.metricRepository = uc.metricRepository.ForTenant(tenantID)
+	t.eventRepository = uc.eventRepository.ForTenant(tenantID)
+	t.apiKeyRepository = uc.apiKeyRepository.ForTenant(tenantID)
+	t.retentionRepository = uc.retentionRepository.ForTenant(tenantID)
+	t.rollupRepository = uc.rollupRepository.ForTenant(tenantID)
+	t.alertRepository = uc.alertRepository.ForTenant(tenantID)
+	t.tenantID = tenantID
+	return &t
+}
+
+func (uc *AppUseCase) TenantID() int {
+	return uc.tenantID
+}
+
+func (uc *AppUseCase) TenantCreate(t *entity.Tenant) error {
+	return uc.tenantRepository.Create(t)
+}
+
+func (uc *AppUseCase) TenantFindByID(tenantID int) (*entity.Tenant, error) {
+	return uc.tenantRepository.FindByID(tenantID)
+}
+
+func (uc *AppUseCase) TenantFindBySlug(slug string) (*entity.Tenant, error) {
+	return uc.tenantRepository.FindBySlug(slug)
+}
+
+func (uc *AppUseCase) TenantList() ([]*entity.Tenant, error) {
+	return uc.tenantRepository.List()
+}
+
+// RelayValues sends the values of stored events through n instead of publishing them directly
+// and publishes the values n receives, so that the subscribers of every replica of the app
+// get the values stored by any of them.
+func (uc *AppUseCase) RelayValues(n repository.ValueNotifier) error {
+	if err := n.Listen(uc.hub.Publish); err != nil {
+		return err
 	}
+
+	uc.notifier = n
+	return nil
 }
 
 func (uc *AppUseCase) ServiceCreate(s *entity.Service) error {
@@ -27,22 +98,803 @@ func (uc *AppUseCase) ServiceFindByID(serviceID int) (*entity.Service, error) {
 	return uc.serviceRepository.FindByID(serviceID)
 }
 
+func (uc *AppUseCase) ServiceFindBySlug(slug string) (*entity.Service, error) {
+	return uc.serviceRepository.FindBySlug(slug)
+}
+
+func (uc *AppUseCase) ServiceList(o *entity.ListOptions) ([]*entity.Service, error) {
+	return uc.serviceRepository.List(o)
+}
+
+func (uc *AppUseCase) ServiceUpdate(s *entity.Service) error {
+	return uc.serviceRepository.Update(s)
+}
+
+// ServiceArchive retires the service: it is hidden from lists and accepts no new events,
+// while its events stay available.
+func (uc *AppUseCase) ServiceArchive(serviceID int) (*entity.Service, error) {
+	if err := uc.serviceRepository.Archive(serviceID); err != nil {
+		return nil, err
+	}
+	return uc.serviceRepository.FindByID(serviceID)
+}
+
+// ServiceDelete removes the service together with its events and their metric values
+// and reports how many of them are removed. With dryRun set nothing is removed.
+func (uc *AppUseCase) ServiceDelete(serviceID int, dryRun bool) (*entity.Cascade, error) {
+	if _, err := uc.serviceRepository.FindByID(serviceID); err != nil {
+		return nil, err
+	}
+
+	c, err := uc.eventRepository.ServiceCascade(serviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return c, nil
+	}
+	return c, uc.serviceRepository.Delete(serviceID)
+}
+
 func (uc *AppUseCase) MetricCreate(m *entity.Metric) error {
 	return uc.metricRepository.Create(m)
 }
 
+// MetricRegister creates the metric unless a metric with its slug already exists, in which case m is
+// replaced by the existing one, and reports whether the metric was created.
+func (uc *AppUseCase) MetricRegister(m *entity.Metric) (bool, error) {
+	existing, err := uc.metricRepository.FindBySlug(m.Slug)
+	if err == nil {
+		*m = *existing
+		return false, nil
+	} else if !errors.Is(err, repository.ErrRecordNotFound) {
+		return false, err
+	}
+
+	if err := m.Validate(); err != nil {
+		return false, err
+	}
+
+	if err := uc.metricRepository.Create(m); err != nil {
+		// another client may have registered the metric in the meantime
+		existing, findErr := uc.metricRepository.FindBySlug(m.Slug)
+		if findErr != nil {
+			return false, err
+		}
+
+		*m = *existing
+		return false, nil
+	}
+
+	return true, nil
+}
+
 func (uc *AppUseCase) MetricFindByID(metricID int) (*entity.Metric, error) {
 	return uc.metricRepository.FindByID(metricID)
 }
 
+func (uc *AppUseCase) MetricFindBySlug(slug string) (*entity.Metric, error) {
+	return uc.metricRepository.FindBySlug(slug)
+}
+
+func (uc *AppUseCase) MetricList(o *entity.ListOptions) ([]*entity.Metric, error) {
+	return uc.metricRepository.List(o)
+}
+
+// MetricUpdate refuses to change the type of a metric that already has stored values,
+// they would no longer match it.
+func (uc *AppUseCase) MetricUpdate(m *entity.Metric) error {
+	old, err := uc.metricRepository.FindByID(m.MetricID)
+	if err != nil {
+		return err
+	}
+
+	if old.MetricType != m.MetricType {
+		c, err := uc.eventRepository.MetricCascade(m.MetricID)
+		if err != nil {
+			return err
+		}
+
+		if c.Values > 0 {
+			return entity.ErrMetricTypeLocked
+		}
+	}
+
+	return uc.metricRepository.Update(m)
+}
+
+// MetricArchive retires the metric: it is hidden from lists and accepts no new values,
+// while its values stay available.
+func (uc *AppUseCase) MetricArchive(metricID int) (*entity.Metric, error) {
+	if err := uc.metricRepository.Archive(metricID); err != nil {
+		return nil, err
+	}
+	return uc.metricRepository.FindByID(metricID)
+}
+
+// MetricDelete removes the metric together with its values and reports how many values are removed.
+// With dryRun set nothing is removed.
+func (uc *AppUseCase) MetricDelete(metricID int, dryRun bool) (*entity.Cascade, error) {
+	if _, err := uc.metricRepository.FindByID(metricID); err != nil {
+		return nil, err
+	}
+
+	c, err := uc.eventRepository.MetricCascade(metricID)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return c, nil
+	}
+	return c, uc.metricRepository.Delete(metricID)
+}
+
 func (uc *AppUseCase) EventCreate(e *entity.Event) error {
+	if err := e.ValidateLabels(); err != nil {
+		return err
+	}
+
 	return uc.eventRepository.Create(e)
 }
 
 func (uc *AppUseCase) AddMetricsToEvent(eventID int, metrics []*entity.AddMetric) error {
-	return uc.eventRepository.AddMetricsToEvent(eventID, metrics)
+	values, err := uc.parseMetricValues(metrics, nil)
+	if err != nil {
+		return err
+	}
+
+	return uc.eventRepository.AddMetricsToEvent(eventID, values)
 }
 
-func (uc *AppUseCase) GetMetricValuesForTimePeriod(serviceID int, p [2]*entity.CustomTime, m *entity.Metric) (interface{}, error) {
-	return uc.eventRepository.GetMetricValuesForTimePeriod(serviceID, p, m)
+// EventCreateWithMetrics stores the event together with its metric values in one transaction:
+// either everything is written or nothing is.
+func (uc *AppUseCase) EventCreateWithMetrics(e *entity.Event, metrics []*entity.AddMetric) error {
+	if err := e.ValidateLabels(); err != nil {
+		return err
+	}
+
+	if err := uc.resolveService(e, nil); err != nil {
+		return err
+	}
+
+	values, err := uc.parseMetricValues(metrics, nil)
+	if err != nil {
+		return err
+	}
+
+	quotaErrs, err := uc.checkQuotas([]*entity.BatchItem{{Event: e, Metrics: values}})
+	if err != nil {
+		return err
+	}
+	if quotaErrs[0] != nil {
+		return quotaErrs[0]
+	}
+
+	if err := uc.eventRepository.CreateWithMetrics(e, values); err != nil {
+		return err
+	}
+
+	uc.publish([]*entity.BatchItem{{Event: e, Metrics: values}})
+	return nil
+}
+
+// EventBatchCreate stores a batch of events and returns the reason of rejection for every item,
+// nil for accepted ones. With atomic set either all items are written or none of them.
+func (uc *AppUseCase) EventBatchCreate(items []*entity.BatchItem, atomic bool) []error {
+	errs := make([]error, len(items))
+	valid := make([]*entity.BatchItem, 0, len(items))
+	indexes := make([]int, 0, len(items))
+
+	services := make(map[serviceKey]*serviceRef)
+	metrics := make(map[metricKey]*entity.Metric)
+
+	for i, item := range items {
+		if err := item.Event.ValidateLabels(); err != nil {
+			errs[i] = err
+			continue
+		}
+
+		if err := uc.resolveService(item.Event, services); err != nil {
+			errs[i] = err
+			continue
+		}
+
+		values, err := uc.parseMetricValues(item.Metrics, metrics)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		valid = append(valid, &entity.BatchItem{Event: item.Event, Metrics: values})
+		indexes = append(indexes, i)
+	}
+
+	quotaErrs, err := uc.checkQuotas(valid)
+	if err != nil {
+		for _, i := range indexes {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	admitted := make([]*entity.BatchItem, 0, len(valid))
+	admittedIndexes := make([]int, 0, len(indexes))
+	for k, item := range valid {
+		if quotaErrs[k] != nil {
+			errs[indexes[k]] = quotaErrs[k]
+			continue
+		}
+
+		admitted = append(admitted, item)
+		admittedIndexes = append(admittedIndexes, indexes[k])
+	}
+	valid, indexes = admitted, admittedIndexes
+
+	if atomic && len(valid) < len(items) {
+		for _, i := range indexes {
+			errs[i] = entity.ErrBatchRejected
+		}
+		return errs
+	}
+
+	if err := uc.eventRepository.CreateBatch(valid); err != nil {
+		if atomic {
+			for _, i := range indexes {
+				errs[i] = err
+			}
+			return errs
+		}
+
+		// find out which items cannot be stored by writing them one by one
+		stored := make([]*entity.BatchItem, 0, len(valid))
+		for k, item := range valid {
+			errs[indexes[k]] = uc.eventRepository.CreateWithMetrics(item.Event, item.Metrics)
+			if errs[indexes[k]] == nil {
+				stored = append(stored, item)
+			}
+		}
+
+		uc.publish(stored)
+		return errs
+	}
+
+	uc.publish(valid)
+	return errs
+}
+
+// Subscribe subscribes to the values of series stored from now on,
+// up to buffer values are kept for a subscriber that lags behind before it is dropped.
+func (uc *AppUseCase) Subscribe(series []entity.Series, buffer int) *Subscription {
+	return uc.hub.Subscribe(series, buffer)
+}
+
+// publish delivers the values of stored events to live subscribers.
+// The values are already stored, so a failure of the notifier only keeps them from other replicas.
+func (uc *AppUseCase) publish(items []*entity.BatchItem) {
+	values := make([]*entity.LiveValue, 0)
+	for _, item := range items {
+		for _, m := range item.Metrics {
+			values = append(values, &entity.LiveValue{
+				EventID:   item.Event.EventID,
+				TimeStamp: item.Event.TimeStamp,
+				ServiceID: item.Event.ServiceID,
+				MetricID:  m.MetricID,
+				Value:     m.MetricValue,
+			})
+		}
+	}
+
+	if len(values) == 0 {
+		return
+	}
+
+	if uc.notifier == nil || uc.notifier.Notify(values) != nil {
+		uc.hub.Publish(values)
+	}
+}
+
+// GetMetricValuesForTimePeriod returns the values of the events selected by sel, a nil sel selects every event.
+func (uc *AppUseCase) GetMetricValuesForTimePeriod(serviceID int, p [2]*entity.CustomTime, m *entity.Metric, sel *entity.LabelSelector) (interface{}, error) {
+	return uc.eventRepository.GetMetricValuesForTimePeriod(serviceID, p, m, sel)
+}
+
+// AggregateMetricValuesForTimePeriod aggregates the values of the events selected by sel,
+// a nil sel selects every event. Aggregations of every event are read from the coarsest rollup
+// that serves them if the rollups are complete up to the end of the period.
+func (uc *AppUseCase) AggregateMetricValuesForTimePeriod(serviceID int, p [2]*entity.CustomTime, m *entity.Metric, a *entity.Aggregation, sel *entity.LabelSelector) ([]*entity.AggregatedMetric, error) {
+	if res, ok := a.RollupResolution(m.MetricType, p); ok && (sel == nil || (len(sel.Matchers) == 0 && len(sel.GroupBy) == 0)) {
+		watermark, err := uc.rollupRepository.Watermark(res)
+		if err != nil {
+			return nil, err
+		}
+
+		late, err := uc.rollupRepository.Late(serviceID, p)
+		if err != nil {
+			return nil, err
+		}
+
+		// values written behind the watermark are read raw until they are rolled up again
+		if !p[1].After(watermark) && !late {
+			return uc.rollupRepository.Aggregate(serviceID, p, m, a, res)
+		}
+	}
+
+	return uc.eventRepository.AggregateMetricValuesForTimePeriod(serviceID, p, m, a, sel)
+}
+
+// LatestMetricValues returns the most recent value of every metric of every service
+// restricted to the services and metrics with the given slugs unless they are empty.
+// Unknown slugs select nothing, archived services and metrics are left out.
+func (uc *AppUseCase) LatestMetricValues(serviceSlugs, metricSlugs []string) ([]*entity.LatestValue, error) {
+	serviceIDs, err := idsBySlug(serviceSlugs, func(slug string) (int, error) {
+		s, err := uc.serviceRepository.FindBySlug(slug)
+		if err != nil {
+			return 0, err
+		}
+		return s.ServiceID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metricIDs, err := idsBySlug(metricSlugs, func(slug string) (int, error) {
+		m, err := uc.metricRepository.FindBySlug(slug)
+		if err != nil {
+			return 0, err
+		}
+		return m.MetricID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]*entity.LatestValue, 0)
+	if (len(serviceSlugs) > 0 && len(serviceIDs) == 0) || (len(metricSlugs) > 0 && len(metricIDs) == 0) {
+		return values, nil
+	}
+
+	latest, err := uc.eventRepository.LatestMetricValues(serviceIDs, metricIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[int]*entity.Service)
+	metrics := make(map[int]*entity.Metric)
+
+	for _, lv := range latest {
+		s, ok := services[lv.ServiceID]
+		if !ok {
+			s, err = uc.serviceRepository.FindByID(lv.ServiceID)
+			if err != nil && !errors.Is(err, repository.ErrRecordNotFound) {
+				return nil, err
+			}
+			services[lv.ServiceID] = s
+		}
+
+		m, ok := metrics[lv.MetricID]
+		if !ok {
+			m, err = uc.metricRepository.FindByID(lv.MetricID)
+			if err != nil && !errors.Is(err, repository.ErrRecordNotFound) {
+				return nil, err
+			}
+			metrics[lv.MetricID] = m
+		}
+
+		if s == nil || m == nil || s.Archived || m.Archived {
+			continue
+		}
+
+		lv.ServiceSlug = s.Slug
+		lv.MetricSlug = m.Slug
+		lv.MetricType = m.MetricType
+		values = append(values, lv)
+	}
+
+	return values, nil
+}
+
+// APIKeyCreate generates the key, stores its hash and returns the key, which is not available afterwards.
+func (uc *AppUseCase) APIKeyCreate(k *entity.APIKey) (string, error) {
+	if err := k.Validate(); err != nil {
+		return "", err
+	}
+
+	key, err := k.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	if err := uc.apiKeyRepository.Create(k); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// APIKeyAuthenticate looks the key up by its hash, an unknown key is reported as repository.ErrRecordNotFound.
+func (uc *AppUseCase) APIKeyAuthenticate(key string) (*entity.APIKey, error) {
+	return uc.apiKeyRepository.FindByHash(entity.HashAPIKey(key))
+}
+
+func (uc *AppUseCase) APIKeyList() ([]*entity.APIKey, error) {
+	return uc.apiKeyRepository.List()
+}
+
+func (uc *AppUseCase) APIKeyDelete(keyID int) error {
+	return uc.apiKeyRepository.Delete(keyID)
+}
+
+// RetentionPolicySave creates or replaces the policy of a service or a metric of the tenant.
+func (uc *AppUseCase) RetentionPolicySave(p *entity.RetentionPolicy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	if p.ServiceID != 0 {
+		if _, err := uc.serviceRepository.FindByID(p.ServiceID); err != nil {
+			return err
+		}
+	} else if _, err := uc.metricRepository.FindByID(p.MetricID); err != nil {
+		return err
+	}
+
+	return uc.retentionRepository.Save(p)
+}
+
+func (uc *AppUseCase) RetentionPolicyFindByService(serviceID int) (*entity.RetentionPolicy, error) {
+	return uc.retentionRepository.FindByService(serviceID)
+}
+
+func (uc *AppUseCase) RetentionPolicyFindByMetric(metricID int) (*entity.RetentionPolicy, error) {
+	return uc.retentionRepository.FindByMetric(metricID)
+}
+
+func (uc *AppUseCase) RetentionPolicyList() ([]*entity.RetentionPolicy, error) {
+	return uc.retentionRepository.List()
+}
+
+func (uc *AppUseCase) RetentionPolicyDelete(policyID int) error {
+	return uc.retentionRepository.Delete(policyID)
+}
+
+// RetentionPolicyListAll lists the policies of every tenant for the purge worker.
+func (uc *AppUseCase) RetentionPolicyListAll() ([]*entity.RetentionPolicy, error) {
+	return uc.retentionRepository.All()
+}
+
+// RetentionPurge deletes at most limit of the oldest raw values the policy expires at now,
+// in the tenant of the policy whatever the tenant of uc is.
+func (uc *AppUseCase) RetentionPurge(p *entity.RetentionPolicy, now time.Time, limit int) (*entity.Cascade, error) {
+	if p.KeepRaw == "" {
+		return &entity.Cascade{}, nil
+	}
+
+	er := uc.eventRepository.ForTenant(p.TenantID)
+	if p.ServiceID != 0 {
+		return er.PurgeService(p.ServiceID, p.Expired(now), limit)
+	}
+	return er.PurgeMetric(p.MetricID, p.Expired(now), limit)
+}
+
+// RetentionPurgeRollups deletes at most limit of the oldest rollups of the resolution the policy expires at now
+// like RetentionPurge does and reports their number.
+func (uc *AppUseCase) RetentionPurgeRollups(p *entity.RetentionPolicy, res time.Duration, now time.Time, limit int) (int, error) {
+	keep := p.RollupRetention(res)
+	if keep == 0 {
+		return 0, nil
+	}
+
+	ur := uc.rollupRepository.ForTenant(p.TenantID)
+	if p.ServiceID != 0 {
+		return ur.PurgeService(res, p.ServiceID, now.Add(-keep), limit)
+	}
+	return ur.PurgeMetric(res, p.MetricID, now.Add(-keep), limit)
+}
+
+// RollupWatermark returns the time the rollups of the resolution are complete before.
+func (uc *AppUseCase) RollupWatermark(res time.Duration) (time.Time, error) {
+	return uc.rollupRepository.Watermark(res)
+}
+
+// Rollup aggregates the values of every tenant stored in [from, to) into the rollups of the resolution.
+func (uc *AppUseCase) Rollup(res time.Duration, from, to time.Time) (int, error) {
+	return uc.rollupRepository.Rollup(res, from, to)
+}
+
+// RollupLate rolls up again at most limit of the minutes with values written behind the watermark
+// and returns their number.
+func (uc *AppUseCase) RollupLate(limit int) (int, error) {
+	return uc.rollupRepository.RollupLate(limit)
+}
+
+// PartitionList returns the time partitions of the events of every tenant.
+func (uc *AppUseCase) PartitionList() ([]*entity.Partition, error) {
+	return uc.partitionRepository.List()
+}
+
+func (uc *AppUseCase) PartitionCreate(p *entity.Partition) error {
+	return uc.partitionRepository.Create(p)
+}
+
+// PartitionDrop deletes the events of every tenant in the partition along with it.
+func (uc *AppUseCase) PartitionDrop(p *entity.Partition) error {
+	return uc.partitionRepository.Drop(p)
+}
+
+// PartitionPurgeDefault deletes at most limit of the oldest events of every tenant left in the default partition
+// before the end of the partition and returns their number.
+func (uc *AppUseCase) PartitionPurgeDefault(p *entity.Partition, limit int) (int, error) {
+	return uc.partitionRepository.PurgeDefault(p.To, limit)
+}
+
+func (uc *AppUseCase) AlertRuleCreate(a *entity.AlertRule) error {
+	if err := uc.validateAlertRule(a); err != nil {
+		return err
+	}
+	return uc.alertRepository.Create(a)
+}
+
+// AlertRuleUpdate replaces the rule, which is evaluated afresh from the ok state.
+func (uc *AppUseCase) AlertRuleUpdate(a *entity.AlertRule) error {
+	if _, err := uc.alertRepository.FindByID(a.RuleID); err != nil {
+		return err
+	}
+
+	if err := uc.validateAlertRule(a); err != nil {
+		return err
+	}
+	return uc.alertRepository.Update(a)
+}
+
+// validateAlertRule checks the rule against the type of its metric, the service and the metric belong to the tenant.
+func (uc *AppUseCase) validateAlertRule(a *entity.AlertRule) error {
+	if _, err := uc.serviceRepository.FindByID(a.ServiceID); err != nil {
+		return err
+	}
+
+	m, err := uc.metricRepository.FindByID(a.MetricID)
+	if err != nil {
+		return err
+	}
+	return a.Validate(m.MetricType)
+}
+
+func (uc *AppUseCase) AlertRuleFindByID(ruleID int) (*entity.AlertRule, error) {
+	return uc.alertRepository.FindByID(ruleID)
+}
+
+func (uc *AppUseCase) AlertRuleList() ([]*entity.AlertRule, error) {
+	return uc.alertRepository.List()
+}
+
+func (uc *AppUseCase) AlertRuleDelete(ruleID int) error {
+	return uc.alertRepository.Delete(ruleID)
+}
+
+// AlertRuleListAll lists the rules of every tenant for the alert evaluator.
+func (uc *AppUseCase) AlertRuleListAll() ([]*entity.AlertRule, error) {
+	return uc.alertRepository.All()
+}
+
+// AlertEvaluate aggregates the values of the window of the rule ending at now in one bucket, tests the result and
+// stores the new state, in the tenant of the rule whatever the tenant of uc is. It returns the transition, nil if the state is kept.
+func (uc *AppUseCase) AlertEvaluate(a *entity.AlertRule, now time.Time) (*entity.AlertTransition, error) {
+	ar := uc.alertRepository.ForTenant(a.TenantID)
+
+	m, err := uc.metricRepository.ForTenant(a.TenantID).FindByID(a.MetricID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := [2]*entity.CustomTime{{Time: now.Add(-a.WindowDuration())}, {Time: now}}
+	buckets, err := uc.ForTenant(a.TenantID).AggregateMetricValuesForTimePeriod(a.ServiceID, p, m, a.Aggregation(), nil)
+	if err != nil && !errors.Is(err, repository.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var v interface{}
+	if len(buckets) > 0 {
+		v = buckets[0].Values[a.Function]
+	}
+
+	value, holds, err := a.Evaluate(m.MetricType, v)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := ar.FindState(a.RuleID)
+	if err != nil {
+		return nil, err
+	}
+
+	t := s.Next(a, value, holds, now)
+	if err := ar.SaveState(s, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// AlertList returns the pending and firing alerts of the tenant.
+func (uc *AppUseCase) AlertList() ([]*entity.AlertState, error) {
+	return uc.alertRepository.ListActive()
+}
+
+// AlertHistory returns at most limit latest state changes of the rule, newest first.
+func (uc *AppUseCase) AlertHistory(ruleID, limit int) ([]*entity.AlertTransition, error) {
+	if _, err := uc.alertRepository.FindByID(ruleID); err != nil {
+		return nil, err
+	}
+	return uc.alertRepository.History(ruleID, limit)
+}
+
+// EventAuthorizer returns the check that k may add events to the service of an event, nil k grants nothing.
+// Services referred to by slug are looked up once, unknown ones are left to the event methods to report,
+// and a failed lookup rejects the event.
+func (uc *AppUseCase) EventAuthorizer(k *entity.APIKey) func(*entity.Event) error {
+	if k != nil && (k.Allows(entity.ScopeAdmin) || (k.Allows(entity.ScopeWrite) && len(k.ServiceIDs) == 0)) {
+		return func(*entity.Event) error { return nil }
+	}
+
+	ids := make(map[string]int)
+
+	return func(e *entity.Event) error {
+		if k == nil {
+			return entity.ErrForbidden
+		}
+
+		serviceID := e.ServiceID
+		if serviceID == 0 && e.ServiceSlug != "" {
+			slug := entity.NormalizeSlug(e.ServiceSlug)
+
+			id, ok := ids[slug]
+			if !ok {
+				s, err := uc.serviceRepository.FindBySlug(slug)
+				if errors.Is(err, repository.ErrRecordNotFound) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				id = s.ServiceID
+				ids[slug] = id
+			}
+			serviceID = id
+		}
+
+		if !k.CanWrite(serviceID) {
+			return fmt.Errorf("service_id %d: %w", serviceID, entity.ErrForbidden)
+		}
+		return nil
+	}
+}
+
+// idsBySlug looks up the ids of slugs with find skipping unknown ones.
+func idsBySlug(slugs []string, find func(string) (int, error)) ([]int, error) {
+	ids := make([]int, 0, len(slugs))
+	for _, slug := range slugs {
+		id, err := find(slug)
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+type serviceKey struct {
+	id   int
+	slug string
+}
+
+type serviceRef struct {
+	id  int
+	err error
+}
+
+type metricKey struct {
+	id   int
+	slug string
+}
+
+// resolveService makes sure that events can be added to the service of e: it exists and is not archived.
+// A service referred to by slug is looked up and its id is set to e.ServiceID.
+// Lookups are kept in cache if it is not nil.
+func (uc *AppUseCase) resolveService(e *entity.Event, cache map[serviceKey]*serviceRef) error {
+	key := serviceKey{id: e.ServiceID}
+	if e.ServiceID == 0 && e.ServiceSlug != "" {
+		key.slug = entity.NormalizeSlug(e.ServiceSlug)
+	}
+
+	ref, ok := cache[key]
+	if !ok {
+		ref = &serviceRef{}
+
+		var (
+			s   *entity.Service
+			err error
+		)
+		if key.slug != "" {
+			s, err = uc.serviceRepository.FindBySlug(key.slug)
+		} else {
+			s, err = uc.serviceRepository.FindByID(key.id)
+		}
+
+		switch {
+		case err != nil:
+			ref.err = err
+		case s.Archived:
+			ref.err = entity.ErrArchived
+		default:
+			ref.id = s.ServiceID
+		}
+
+		if ref.err != nil {
+			if key.slug != "" {
+				ref.err = fmt.Errorf("service_slug %s: %w", key.slug, ref.err)
+			} else {
+				ref.err = fmt.Errorf("service_id %d: %w", key.id, ref.err)
+			}
+		}
+
+		if cache != nil {
+			cache[key] = ref
+		}
+	}
+
+	if ref.err != nil {
+		return ref.err
+	}
+
+	e.ServiceID = ref.id
+	return nil
+}
+
+// parseMetricValues checks every value against the type of its metric before anything is written
+// and returns copies of the metrics referred to by id and holding the parsed values.
+// Metrics found are kept in cache if it is not nil.
+func (uc *AppUseCase) parseMetricValues(metrics []*entity.AddMetric, cache map[metricKey]*entity.Metric) ([]*entity.AddMetric, error) {
+	values := make([]*entity.AddMetric, len(metrics))
+
+	for i, am := range metrics {
+		key := metricKey{id: am.MetricID}
+		if am.MetricID == 0 && am.MetricSlug != "" {
+			key.slug = entity.NormalizeSlug(am.MetricSlug)
+		}
+
+		m, ok := cache[key]
+		if !ok {
+			var err error
+			if key.slug != "" {
+				m, err = uc.metricRepository.FindBySlug(key.slug)
+			} else {
+				m, err = uc.metricRepository.FindByID(key.id)
+			}
+			if err != nil {
+				return nil, &entity.MetricError{Index: i, MetricID: key.id, MetricSlug: key.slug, Err: err}
+			}
+
+			if cache != nil {
+				cache[key] = m
+			}
+		}
+
+		if m.Archived {
+			return nil, &entity.MetricError{Index: i, MetricID: m.MetricID, Err: entity.ErrArchived}
+		}
+
+		v, err := m.ParseValue(am.MetricValue)
+		if err != nil {
+			return nil, &entity.MetricError{Index: i, MetricID: m.MetricID, Err: err}
+		}
+
+		values[i] = &entity.AddMetric{
+			MetricID:    m.MetricID,
+			MetricValue: v,
+		}
+	}
+
+	return values, nil
 }
@@ -1,6 +1,7 @@
 package usecase_test
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -15,23 +16,67 @@ const (
 	defaultLayout = time.RFC3339
 )
 
+// testRepositories are the repositories of the use case of newTestUseCaseWithRepositories
+// for the tests that store records directly.
+type testRepositories struct {
+	services *testrepository.ServiceRepository
+	metrics  *testrepository.MetricRepository
+	events   *testrepository.EventRepository
+	tenants  *testrepository.TenantRepository
+}
+
+// newTestUseCase returns a use case of empty in-memory repositories.
+func newTestUseCase(t *testing.T) *usecase.AppUseCase {
+	t.Helper()
+
+	uc, _ := newTestUseCaseWithRepositories(t)
+	return uc
+}
+
+// brokenServiceRepository fails to find services by slug as if the database were down.
+type brokenServiceRepository struct {
+	*testrepository.ServiceRepository
+}
+
+func (r *brokenServiceRepository) FindBySlug(string) (*entity.Service, error) {
+	return nil, errBrokenRepository
+}
+
+var errBrokenRepository = errors.New("connection refused")
+
+func newTestUseCaseWithRepositories(t *testing.T) (*usecase.AppUseCase, *testRepositories) {
+	t.Helper()
+
+	repos := &testRepositories{
+		services: testrepository.NewServiceRepository(),
+		metrics:  testrepository.NewMetricRepository(),
+		events:   testrepository.NewEventRepository(),
+		tenants:  testrepository.NewTenantRepository(),
+	}
+
+	uc := usecase.NewAppUseCase(
+		repos.services,
+		repos.metrics,
+		repos.events,
+		testrepository.NewAPIKeyRepository(),
+		repos.tenants,
+		testrepository.NewRetentionRepository(),
+		testrepository.NewRollupRepository(repos.events),
+		testrepository.NewPartitionRepository(repos.events),
+		testrepository.NewAlertRepository(),
+	)
+	return uc, repos
+}
+
 func TestAppUseCase_ServiceCreate(t *testing.T) {
 	s := entity.TestService(t)
-	sr := testrepository.NewServiceRepository()
-	mr := testrepository.NewMetricRepository()
-	er := testrepository.NewEventRepository()
-
-	uc := usecase.NewAppUseCase(sr, mr, er)
+	uc := newTestUseCase(t)
 	assert.NoError(t, uc.ServiceCreate(s))
 }
 
 func TestAppUseCase_ServiceFindByID(t *testing.T) {
 	s1 := entity.TestService(t)
-	sr := testrepository.NewServiceRepository()
-	mr := testrepository.NewMetricRepository()
-	er := testrepository.NewEventRepository()
-
-	uc := usecase.NewAppUseCase(sr, mr, er)
+	uc := newTestUseCase(t)
 	uc.ServiceCreate(s1)
 
 	_, err := uc.ServiceFindByID(s1.ServiceID + 1)
@@ -42,23 +87,96 @@ func TestAppUseCase_ServiceFindByID(t *testing.T) {
 	assert.NotNil(t, s2)
 }
 
+func TestAppUseCase_ServiceList(t *testing.T) {
+	uc := newTestUseCase(t)
+
+	uc.ServiceCreate(entity.TestService(t))
+
+	o := &entity.ListOptions{}
+	assert.NoError(t, o.Validate())
+
+	services, err := uc.ServiceList(o)
+	assert.NoError(t, err)
+	assert.Len(t, services, 1)
+}
+
+func TestAppUseCase_ServiceDelete(t *testing.T) {
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	uc := newTestUseCase(t)
+
+	_, err := uc.ServiceDelete(1, false)
+	assert.ErrorIs(t, err, repository.ErrRecordNotFound)
+
+	uc.ServiceCreate(s)
+	uc.MetricCreate(m)
+
+	e := entity.TestEvent(t)
+	e.ServiceID = s.ServiceID
+	uc.EventCreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: "10s"}})
+
+	c, err := uc.ServiceDelete(s.ServiceID, true)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 1, Values: 1}, c)
+
+	_, err = uc.ServiceFindByID(s.ServiceID)
+	assert.NoError(t, err)
+
+	c, err = uc.ServiceDelete(s.ServiceID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 1, Values: 1}, c)
+
+	_, err = uc.ServiceFindByID(s.ServiceID)
+	assert.ErrorIs(t, err, repository.ErrRecordNotFound)
+}
+
+func TestAppUseCase_ServiceArchive(t *testing.T) {
+	s := entity.TestService(t)
+	uc := newTestUseCase(t)
+
+	uc.ServiceCreate(s)
+
+	archived, err := uc.ServiceArchive(s.ServiceID)
+	assert.NoError(t, err)
+	assert.True(t, archived.Archived)
+
+	e := entity.TestEvent(t)
+	e.ServiceID = s.ServiceID
+	assert.ErrorIs(t, uc.EventCreateWithMetrics(e, nil), entity.ErrArchived)
+}
+
 func TestAppUseCase_MetricCreate(t *testing.T) {
 	m := entity.TestMetric(t)
-	sr := testrepository.NewServiceRepository()
-	mr := testrepository.NewMetricRepository()
-	er := testrepository.NewEventRepository()
-	uc := usecase.NewAppUseCase(sr, mr, er)
+	uc := newTestUseCase(t)
 
 	assert.NoError(t, uc.MetricCreate(m))
 }
 
+func TestAppUseCase_MetricRegister(t *testing.T) {
+	uc := newTestUseCase(t)
+
+	m := entity.TestMetric(t)
+	created, err := uc.MetricRegister(m)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	again := entity.TestMetric(t)
+	again.Slug = "reading time note 1"
+	again.MetricType = "FLOAT"
+	created, err = uc.MetricRegister(again)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, m, again)
+
+	invalid := entity.TestMetric(t)
+	invalid.Slug = "READING-TIME"
+	_, err = uc.MetricRegister(invalid)
+	assert.Error(t, err)
+}
+
 func TestAppUseCase_MetricFindByID(t *testing.T) {
 	m1 := entity.TestMetric(t)
-	sr := testrepository.NewServiceRepository()
-	mr := testrepository.NewMetricRepository()
-	er := testrepository.NewEventRepository()
-
-	uc := usecase.NewAppUseCase(sr, mr, er)
+	uc := newTestUseCase(t)
 	uc.MetricCreate(m1)
 
 	_, err := uc.MetricFindByID(m1.MetricID + 1)
@@ -69,12 +187,75 @@ func TestAppUseCase_MetricFindByID(t *testing.T) {
 	assert.NotNil(t, s2)
 }
 
+func TestAppUseCase_MetricList(t *testing.T) {
+	uc := newTestUseCase(t)
+
+	uc.MetricCreate(entity.TestMetric(t))
+
+	o := &entity.ListOptions{MetricType: "INT"}
+	assert.NoError(t, o.Validate())
+
+	metrics, err := uc.MetricList(o)
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 0)
+}
+
+func TestAppUseCase_MetricUpdate(t *testing.T) {
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	uc := newTestUseCase(t)
+
+	uc.ServiceCreate(s)
+	uc.MetricCreate(m)
+
+	update := func(metricType string) error {
+		return uc.MetricUpdate(&entity.Metric{
+			MetricID:   m.MetricID,
+			Slug:       m.Slug,
+			MetricType: metricType,
+			Details:    m.Details,
+		})
+	}
+
+	assert.ErrorIs(t, uc.MetricUpdate(&entity.Metric{MetricID: m.MetricID + 1}), repository.ErrRecordNotFound)
+	assert.NoError(t, update("INT"))
+	assert.NoError(t, update("DURATION"))
+
+	e := entity.TestEvent(t)
+	e.ServiceID = s.ServiceID
+	assert.NoError(t, uc.EventCreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: "10s"}}))
+
+	assert.ErrorIs(t, update("INT"), entity.ErrMetricTypeLocked)
+	assert.NoError(t, update("DURATION"))
+}
+
+func TestAppUseCase_MetricArchive(t *testing.T) {
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	uc := newTestUseCase(t)
+
+	uc.ServiceCreate(s)
+	uc.MetricCreate(m)
+
+	_, err := uc.MetricArchive(m.MetricID)
+	assert.NoError(t, err)
+
+	e := entity.TestEvent(t)
+	e.ServiceID = s.ServiceID
+	err = uc.EventCreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: "10s"}})
+	assert.ErrorIs(t, err, entity.ErrArchived)
+
+	c, err := uc.MetricDelete(m.MetricID, false)
+	assert.NoError(t, err)
+	assert.Zero(t, c.Values)
+
+	_, err = uc.MetricFindByID(m.MetricID)
+	assert.ErrorIs(t, err, repository.ErrRecordNotFound)
+}
+
 func TestAppUseCase_EventCreate(t *testing.T) {
 	e := entity.TestEvent(t)
-	sr := testrepository.NewServiceRepository()
-	mr := testrepository.NewMetricRepository()
-	er := testrepository.NewEventRepository()
-	uc := usecase.NewAppUseCase(sr, mr, er)
+	uc := newTestUseCase(t)
 
 	assert.NoError(t, uc.EventCreate(e))
 }
@@ -82,63 +263,111 @@ func TestAppUseCase_EventCreate(t *testing.T) {
 func TestAppUseCase_AddMetricsToEvent(t *testing.T) {
 	testCases := []struct {
 		name        string
+		metricType  string
 		metricValue interface{}
+		isValid     bool
 	}{
 		{
 			name:        "int",
+			metricType:  "INT",
 			metricValue: 10,
+			isValid:     true,
 		},
 		{
 			name:        "float",
+			metricType:  "FLOAT",
 			metricValue: 56.7,
+			isValid:     true,
 		},
 		{
 			name:        "duration",
+			metricType:  "DURATION",
 			metricValue: time.Duration(10 * time.Second).String(),
+			isValid:     true,
 		},
 		{
 			name:        "timestamp with timezone",
+			metricType:  "TIMESTAMP_WITH_TIMEZONE",
 			metricValue: entity.CustomTime{Time: time.Now()}.Time.Format(defaultLayout),
+			isValid:     true,
 		},
 		{
 			name:        "bool",
+			metricType:  "BOOL",
 			metricValue: true,
+			isValid:     true,
 		},
 		{
 			name:        "string",
+			metricType:  "STRING",
 			metricValue: "starting api server",
+			isValid:     true,
+		},
+		{
+			name:        "string as int",
+			metricType:  "INT",
+			metricValue: "10",
+			isValid:     false,
+		},
+		{
+			name:        "invalid duration",
+			metricType:  "DURATION",
+			metricValue: "ten seconds",
+			isValid:     false,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			m := entity.TestMetric(t)
+			m.MetricType = tc.metricType
 			e := entity.TestEvent(t)
 
-			sr := testrepository.NewServiceRepository()
-			mr := testrepository.NewMetricRepository()
-			er := testrepository.NewEventRepository()
-			uc := usecase.NewAppUseCase(sr, mr, er)
-
-			err := uc.AddMetricsToEvent(e.EventID, []*entity.AddMetric{
-				{
-					MetricID:    m.MetricID,
-					MetricValue: tc.metricValue,
-				}})
-			assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+			uc := newTestUseCase(t)
 
+			uc.MetricCreate(m)
 			uc.EventCreate(e)
-			err = uc.AddMetricsToEvent(e.EventID, []*entity.AddMetric{
+
+			err := uc.AddMetricsToEvent(e.EventID, []*entity.AddMetric{
 				{
 					MetricID:    m.MetricID,
 					MetricValue: tc.metricValue,
 				}})
 
-			assert.NoError(t, err)
+			if tc.isValid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, entity.ErrInvalidMetricValue)
+			}
 		})
 	}
 }
 
+func TestAppUseCase_AddMetricsToEvent_NotFound(t *testing.T) {
+	m := entity.TestMetric(t)
+	e := entity.TestEvent(t)
+
+	uc := newTestUseCase(t)
+
+	metrics := []*entity.AddMetric{
+		{
+			MetricID:    m.MetricID,
+			MetricValue: time.Duration(10 * time.Second).String(),
+		}}
+
+	err := uc.AddMetricsToEvent(e.EventID, metrics)
+	assert.ErrorIs(t, err, repository.ErrRecordNotFound)
+
+	uc.MetricCreate(m)
+	metrics[0].MetricID = m.MetricID
+
+	err = uc.AddMetricsToEvent(e.EventID, metrics)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	uc.EventCreate(e)
+	assert.NoError(t, uc.AddMetricsToEvent(e.EventID, metrics))
+}
+
 func TestAppUseCase_GetMetricValuesForTimePeriod(t *testing.T) {
 	testCases := []struct {
 		name        string
@@ -232,17 +461,14 @@ func TestAppUseCase_GetMetricValuesForTimePeriod(t *testing.T) {
 			e := entity.TestEvent(t)
 			m := tc.m()
 
-			sr := testrepository.NewServiceRepository()
-			mr := testrepository.NewMetricRepository()
-			er := testrepository.NewEventRepository()
-			uc := usecase.NewAppUseCase(sr, mr, er)
+			uc := newTestUseCase(t)
 
 			uc.MetricCreate(m)
 			uc.ServiceCreate(s)
 			e.ServiceID = s.ServiceID
 			uc.EventCreate(e)
 
-			_, err := uc.GetMetricValuesForTimePeriod(e.ServiceID, tc.p, m)
+			_, err := uc.GetMetricValuesForTimePeriod(e.ServiceID, tc.p, m, nil)
 			assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
 
 			uc.AddMetricsToEvent(e.EventID, []*entity.AddMetric{
@@ -251,8 +477,688 @@ func TestAppUseCase_GetMetricValuesForTimePeriod(t *testing.T) {
 					MetricValue: tc.metricValue,
 				}})
 
-			_, err = uc.GetMetricValuesForTimePeriod(e.ServiceID, tc.p, m)
+			_, err = uc.GetMetricValuesForTimePeriod(e.ServiceID, tc.p, m, nil)
 			assert.NoError(t, err)
 		})
 	}
 }
+
+func TestAppUseCase_AggregateMetricValuesForTimePeriod(t *testing.T) {
+	s := entity.TestService(t)
+	e := entity.TestEvent(t)
+	m := entity.TestMetric(t)
+	a := entity.TestAggregation(t)
+	p := [2]*entity.CustomTime{
+		{Time: time.Now().AddDate(0, 0, -1)},
+		{Time: time.Now().AddDate(0, 0, +1)},
+	}
+
+	uc := newTestUseCase(t)
+
+	uc.MetricCreate(m)
+	uc.ServiceCreate(s)
+	e.ServiceID = s.ServiceID
+	uc.EventCreate(e)
+
+	_, err := uc.AggregateMetricValuesForTimePeriod(e.ServiceID, p, m, a, nil)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	uc.AddMetricsToEvent(e.EventID, []*entity.AddMetric{
+		{
+			MetricID:    m.MetricID,
+			MetricValue: time.Duration(10 * time.Second),
+		}})
+
+	report, err := uc.AggregateMetricValuesForTimePeriod(e.ServiceID, p, m, a, nil)
+	assert.NoError(t, err)
+	assert.Len(t, report, 1)
+}
+
+func TestAppUseCase_EventCreateWithMetrics(t *testing.T) {
+	s := entity.TestService(t)
+	m1 := entity.TestMetric(t)
+	m2 := entity.TestMetric(t)
+	m2.Slug = "READING_TIME_NOTE_2"
+	m2.MetricType = "INT"
+	p := [2]*entity.CustomTime{
+		{Time: time.Now().AddDate(0, 0, -1)},
+		{Time: time.Now().AddDate(0, 0, +1)},
+	}
+
+	uc := newTestUseCase(t)
+
+	uc.MetricCreate(m1)
+	uc.MetricCreate(m2)
+
+	metrics := []*entity.AddMetric{
+		{
+			MetricID:    m1.MetricID,
+			MetricValue: time.Duration(10 * time.Second).String(),
+		},
+		{
+			MetricID:    m2.MetricID,
+			MetricValue: "25",
+		},
+	}
+
+	e := entity.TestEvent(t)
+	e.ServiceID = s.ServiceID + 1
+	assert.ErrorIs(t, uc.EventCreateWithMetrics(e, metrics), repository.ErrRecordNotFound)
+
+	uc.ServiceCreate(s)
+	e.ServiceID = s.ServiceID
+
+	err := uc.EventCreateWithMetrics(e, metrics)
+	assert.ErrorIs(t, err, entity.ErrInvalidMetricValue)
+
+	var metricErr *entity.MetricError
+	if assert.ErrorAs(t, err, &metricErr) {
+		assert.Equal(t, 1, metricErr.Index)
+		assert.Equal(t, m2.MetricID, metricErr.MetricID)
+	}
+
+	_, err = uc.GetMetricValuesForTimePeriod(s.ServiceID, p, m1, nil)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	metrics[1].MetricValue = 25
+	assert.NoError(t, uc.EventCreateWithMetrics(e, metrics))
+	assert.NotZero(t, e.EventID)
+
+	_, err = uc.GetMetricValuesForTimePeriod(s.ServiceID, p, m1, nil)
+	assert.NoError(t, err)
+}
+
+func TestAppUseCase_EventCreateWithMetrics_Slugs(t *testing.T) {
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+
+	uc := newTestUseCase(t)
+
+	uc.ServiceCreate(s)
+	uc.MetricCreate(m)
+
+	e := entity.TestEvent(t)
+	e.ServiceSlug = "todo app"
+	err := uc.EventCreateWithMetrics(e, nil)
+	assert.ErrorIs(t, err, repository.ErrRecordNotFound)
+	assert.Contains(t, err.Error(), "service_slug TODO_APP")
+
+	e.ServiceSlug = "note book"
+	err = uc.EventCreateWithMetrics(e, []*entity.AddMetric{{MetricSlug: "reading time", MetricValue: "10s"}})
+	assert.ErrorIs(t, err, repository.ErrRecordNotFound)
+
+	var metricErr *entity.MetricError
+	if assert.ErrorAs(t, err, &metricErr) {
+		assert.Equal(t, "READING_TIME", metricErr.MetricSlug)
+	}
+
+	err = uc.EventCreateWithMetrics(e, []*entity.AddMetric{{MetricSlug: "reading time note 1", MetricValue: "10s"}})
+	assert.NoError(t, err)
+	assert.Equal(t, s.ServiceID, e.ServiceID)
+
+	c, err := uc.MetricDelete(m.MetricID, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, c.Values)
+}
+
+func TestAppUseCase_EventBatchCreate(t *testing.T) {
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+
+	uc := newTestUseCase(t)
+
+	uc.ServiceCreate(s)
+	uc.MetricCreate(m)
+
+	items := func() []*entity.BatchItem {
+		valid := entity.TestEvent(t)
+		valid.ServiceID = s.ServiceID
+
+		unexistedService := entity.TestEvent(t)
+		unexistedService.ServiceID = s.ServiceID + 1
+
+		invalidValue := entity.TestEvent(t)
+		invalidValue.ServiceID = s.ServiceID
+
+		return []*entity.BatchItem{
+			{
+				Event: valid,
+				Metrics: []*entity.AddMetric{
+					{MetricID: m.MetricID, MetricValue: time.Duration(10 * time.Second).String()},
+				},
+			},
+			{
+				Event: unexistedService,
+				Metrics: []*entity.AddMetric{
+					{MetricID: m.MetricID, MetricValue: time.Duration(10 * time.Second).String()},
+				},
+			},
+			{
+				Event: invalidValue,
+				Metrics: []*entity.AddMetric{
+					{MetricID: m.MetricID, MetricValue: 10},
+				},
+			},
+		}
+	}
+
+	t.Run("partial", func(t *testing.T) {
+		batch := items()
+		errs := uc.EventBatchCreate(batch, false)
+
+		assert.NoError(t, errs[0])
+		assert.NotZero(t, batch[0].Event.EventID)
+		assert.ErrorIs(t, errs[1], repository.ErrRecordNotFound)
+		assert.ErrorIs(t, errs[2], entity.ErrInvalidMetricValue)
+	})
+
+	t.Run("atomic", func(t *testing.T) {
+		batch := items()
+		errs := uc.EventBatchCreate(batch, true)
+
+		assert.ErrorIs(t, errs[0], entity.ErrBatchRejected)
+		assert.Zero(t, batch[0].Event.EventID)
+		assert.ErrorIs(t, errs[1], repository.ErrRecordNotFound)
+		assert.ErrorIs(t, errs[2], entity.ErrInvalidMetricValue)
+
+		errs = uc.EventBatchCreate(batch[:1], true)
+		assert.NoError(t, errs[0])
+		assert.NotZero(t, batch[0].Event.EventID)
+	})
+}
+
+func TestAppUseCase_LatestMetricValues(t *testing.T) {
+	s := entity.TestService(t)
+	m1 := entity.TestMetric(t)
+	m2 := entity.TestMetric(t)
+	m2.Slug = "READING_TIME_NOTE_2"
+
+	uc := newTestUseCase(t)
+
+	uc.ServiceCreate(s)
+	uc.MetricCreate(m1)
+	uc.MetricCreate(m2)
+
+	e := entity.TestEvent(t)
+	e.ServiceID = s.ServiceID
+	assert.NoError(t, uc.EventCreateWithMetrics(e, []*entity.AddMetric{
+		{MetricID: m1.MetricID, MetricValue: "10s"},
+		{MetricID: m2.MetricID, MetricValue: "15s"},
+	}))
+
+	values, err := uc.LatestMetricValues(nil, []string{"reading time note 1"})
+	assert.NoError(t, err)
+	if assert.Len(t, values, 1) {
+		assert.Equal(t, s.Slug, values[0].ServiceSlug)
+		assert.Equal(t, m1.Slug, values[0].MetricSlug)
+		assert.Equal(t, "DURATION", values[0].MetricType)
+		assert.Equal(t, 10*time.Second, values[0].Value)
+	}
+
+	values, err = uc.LatestMetricValues([]string{"TODO_APP"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, values, 0)
+
+	uc.MetricArchive(m2.MetricID)
+	values, err = uc.LatestMetricValues(nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, values, 1)
+}
+
+func TestAppUseCase_Subscribe(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	repos.services.Create(s)
+	repos.metrics.Create(m)
+
+	series := []entity.Series{{ServiceID: s.ServiceID, MetricID: m.MetricID}}
+	sub := uc.Subscribe(series, 1)
+	other := uc.Subscribe([]entity.Series{{ServiceID: s.ServiceID, MetricID: m.MetricID + 1}}, 1)
+	defer other.Close()
+
+	create := func(v string) {
+		e := entity.TestEvent(t)
+		e.ServiceID = s.ServiceID
+		assert.NoError(t, uc.EventCreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: v}}))
+	}
+
+	create("10s")
+	v := <-sub.Values()
+	assert.Equal(t, m.MetricID, v.MetricID)
+	assert.Equal(t, 10*time.Second, v.Value)
+	assert.Empty(t, other.Values())
+
+	// the subscriber lags behind by more than its buffer
+	create("20s")
+	create("30s")
+
+	_, ok := <-sub.Values()
+	assert.True(t, ok)
+	_, ok = <-sub.Values()
+	assert.False(t, ok)
+	assert.True(t, sub.Dropped())
+
+	sub.Close()
+	assert.False(t, other.Dropped())
+}
+
+func TestAppUseCase_APIKeyAuthenticate(t *testing.T) {
+	uc := newTestUseCase(t)
+
+	k := entity.TestAPIKey(t)
+	k.Scopes = nil
+	_, err := uc.APIKeyCreate(k)
+	assert.Error(t, err)
+
+	k = entity.TestAPIKey(t)
+	key, err := uc.APIKeyCreate(k)
+	assert.NoError(t, err)
+	assert.NotZero(t, k.KeyID)
+
+	got, err := uc.APIKeyAuthenticate(key)
+	assert.NoError(t, err)
+	assert.Equal(t, k.KeyID, got.KeyID)
+
+	_, err = uc.APIKeyAuthenticate(key + "x")
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	assert.NoError(t, uc.APIKeyDelete(k.KeyID))
+	_, err = uc.APIKeyAuthenticate(key)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+}
+
+func TestAppUseCase_EventAuthorizer(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+
+	allowed := entity.TestService(t)
+	other := entity.TestService(t)
+	other.Slug = "other"
+	repos.services.Create(allowed)
+	repos.services.Create(other)
+
+	k := entity.TestAPIKey(t)
+	k.ServiceIDs = []int{allowed.ServiceID}
+	authorize := uc.EventAuthorizer(k)
+
+	assert.NoError(t, authorize(&entity.Event{ServiceID: allowed.ServiceID}))
+	assert.NoError(t, authorize(&entity.Event{ServiceSlug: "note_book"}))
+	assert.ErrorIs(t, authorize(&entity.Event{ServiceID: other.ServiceID}), entity.ErrForbidden)
+	assert.ErrorIs(t, authorize(&entity.Event{ServiceSlug: "OTHER"}), entity.ErrForbidden)
+
+	k.Scopes = []string{entity.ScopeRead}
+	assert.ErrorIs(t, uc.EventAuthorizer(k)(&entity.Event{ServiceID: allowed.ServiceID}), entity.ErrForbidden)
+	assert.ErrorIs(t, uc.EventAuthorizer(nil)(&entity.Event{ServiceID: allowed.ServiceID}), entity.ErrForbidden)
+
+	t.Run("failed lookup", func(t *testing.T) {
+		broken := usecase.NewAppUseCase(
+			&brokenServiceRepository{repos.services},
+			repos.metrics,
+			repos.events,
+			testrepository.NewAPIKeyRepository(),
+			repos.tenants,
+			testrepository.NewRetentionRepository(),
+			testrepository.NewRollupRepository(repos.events),
+			testrepository.NewPartitionRepository(repos.events),
+			testrepository.NewAlertRepository(),
+		)
+
+		k := entity.TestAPIKey(t)
+		k.ServiceIDs = []int{allowed.ServiceID}
+		assert.ErrorIs(t, broken.EventAuthorizer(k)(&entity.Event{ServiceSlug: "OTHER"}), errBrokenRepository)
+	})
+}
+
+func TestAppUseCase_ForTenant(t *testing.T) {
+	uc := newTestUseCase(t)
+
+	tenant := entity.TestTenant(t)
+	assert.NoError(t, uc.TenantCreate(tenant))
+	other := uc.ForTenant(tenant.TenantID)
+	assert.Equal(t, entity.DefaultTenantID, uc.TenantID())
+	assert.Equal(t, tenant.TenantID, other.TenantID())
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	assert.NoError(t, uc.ServiceCreate(s))
+	assert.NoError(t, uc.MetricCreate(m))
+
+	_, err := other.ServiceFindByID(s.ServiceID)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+	_, err = other.MetricFindBySlug(m.Slug)
+	assert.EqualError(t, err, repository.ErrRecordNotFound.Error())
+
+	services, err := other.ServiceList(&entity.ListOptions{Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, services)
+
+	metrics := []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: "10s"}}
+	e := entity.TestEvent(t)
+	e.ServiceID = s.ServiceID
+	assert.ErrorIs(t, other.EventCreateWithMetrics(e, metrics), repository.ErrRecordNotFound)
+
+	// the same slugs are free in another tenant
+	assert.NoError(t, other.ServiceCreate(entity.TestService(t)))
+	assert.NoError(t, uc.EventCreateWithMetrics(e, metrics))
+
+	k := entity.TestAPIKey(t)
+	key, err := other.APIKeyCreate(k)
+	assert.NoError(t, err)
+	assert.Equal(t, tenant.TenantID, k.TenantID)
+
+	got, err := uc.APIKeyAuthenticate(key)
+	assert.NoError(t, err)
+	assert.Equal(t, tenant.TenantID, got.TenantID)
+
+	keys, err := uc.APIKeyList()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestAppUseCase_Quotas(t *testing.T) {
+	uc := newTestUseCase(t)
+	uc.SetQuotas(usecase.Quotas{EventsPerDay: 3, MetricValuesPerDay: 4})
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	uc.ServiceCreate(s)
+	uc.MetricCreate(m)
+
+	item := func(values int) *entity.BatchItem {
+		metrics := make([]*entity.AddMetric, values)
+		for i := range metrics {
+			metrics[i] = &entity.AddMetric{MetricID: m.MetricID, MetricValue: "10s"}
+		}
+		return &entity.BatchItem{Event: &entity.Event{TimeStamp: entity.CustomTime{Time: time.Now()}, ServiceID: s.ServiceID}, Metrics: metrics}
+	}
+
+	first := item(2)
+	assert.NoError(t, uc.EventCreateWithMetrics(first.Event, first.Metrics))
+
+	// the second item fills the quota of metric values, the third one is over it
+	errs := uc.EventBatchCreate([]*entity.BatchItem{item(1), item(1), item(1)}, false)
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.ErrorIs(t, errs[2], entity.ErrQuotaExceeded)
+
+	usage, err := uc.Usage(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []*entity.Usage{{ServiceID: s.ServiceID, Events: 3, MetricValues: 4}}, usage)
+
+	last := item(0)
+	assert.ErrorIs(t, uc.EventCreateWithMetrics(last.Event, last.Metrics), entity.ErrQuotaExceeded)
+
+	usage, err = uc.Usage(time.Now().AddDate(0, 0, -1))
+	assert.NoError(t, err)
+	assert.Empty(t, usage)
+}
+
+func TestAppUseCase_Retention(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	uc.ServiceCreate(s)
+	uc.MetricCreate(m)
+
+	other := uc.ForTenant(entity.DefaultTenantID + 1)
+	assert.ErrorIs(t, other.RetentionPolicySave(&entity.RetentionPolicy{ServiceID: s.ServiceID, KeepRaw: "1d"}), repository.ErrRecordNotFound)
+	assert.ErrorIs(t, uc.RetentionPolicySave(&entity.RetentionPolicy{MetricID: m.MetricID + 1, KeepRaw: "1d"}), repository.ErrRecordNotFound)
+	assert.Error(t, uc.RetentionPolicySave(&entity.RetentionPolicy{ServiceID: s.ServiceID, KeepRaw: "1m"}))
+
+	p := &entity.RetentionPolicy{ServiceID: s.ServiceID, KeepRaw: "1d"}
+	assert.NoError(t, uc.RetentionPolicySave(p))
+
+	now := time.Now()
+	for _, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, time.Hour} {
+		e := &entity.Event{ServiceID: s.ServiceID, TimeStamp: entity.CustomTime{Time: now.Add(-age)}}
+		assert.NoError(t, repos.events.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: time.Second}}))
+	}
+
+	// the worker purges the policies of every tenant from the default one
+	policies, err := other.RetentionPolicyListAll()
+	assert.NoError(t, err)
+	assert.Len(t, policies, 1)
+
+	c, err := other.RetentionPurge(policies[0], now, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 1, Values: 1}, c)
+
+	c, err = uc.RetentionPurge(policies[0], now, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 1, Values: 1}, c)
+
+	c, err = uc.ServiceDelete(s.ServiceID, true)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{Events: 1, Values: 1}, c)
+
+	assert.NoError(t, uc.RetentionPolicyDelete(p.PolicyID))
+	_, err = uc.RetentionPolicyFindByService(s.ServiceID)
+	assert.ErrorIs(t, err, repository.ErrRecordNotFound)
+}
+
+func TestAppUseCase_AggregateMetricValuesForTimePeriod_Rollups(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	m.MetricType = "INT"
+	uc.ServiceCreate(s)
+	uc.MetricCreate(m)
+
+	day := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		e := &entity.Event{ServiceID: s.ServiceID, TimeStamp: entity.CustomTime{Time: day.Add(time.Duration(i*30) * time.Minute)}}
+		assert.NoError(t, repos.events.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: int64(i)}}))
+	}
+
+	_, err := uc.Rollup(time.Minute, day, day.Add(2*time.Hour))
+	assert.NoError(t, err)
+	_, err = uc.Rollup(time.Hour, day, day.Add(2*time.Hour))
+	assert.NoError(t, err)
+
+	// the raw values are purged, so whatever is found comes from the rollups
+	_, err = repos.events.PurgeService(s.ServiceID, day.Add(2*time.Hour), 10)
+	assert.NoError(t, err)
+
+	p := [2]*entity.CustomTime{{Time: day}, {Time: day.Add(2 * time.Hour)}}
+	a := &entity.Aggregation{Bucket: time.Hour, Functions: []string{"count", "max"}}
+	buckets, err := uc.AggregateMetricValuesForTimePeriod(s.ServiceID, p, m, a, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []*entity.AggregatedMetric{
+		{TimeStamp: entity.CustomTime{Time: day}, Values: map[string]interface{}{"count": 2, "max": int64(1)}},
+		{TimeStamp: entity.CustomTime{Time: day.Add(time.Hour)}, Values: map[string]interface{}{"count": 2, "max": int64(3)}},
+	}, buckets)
+
+	testCases := []struct {
+		name string
+		p    [2]*entity.CustomTime
+		a    *entity.Aggregation
+		sel  *entity.LabelSelector
+	}{
+		{
+			name: "beyond watermark",
+			p:    [2]*entity.CustomTime{{Time: day}, {Time: day.Add(3 * time.Hour)}},
+			a:    a,
+		},
+		{
+			name: "unaligned period",
+			p:    [2]*entity.CustomTime{{Time: day.Add(30 * time.Second)}, {Time: day.Add(time.Hour)}},
+			a:    a,
+		},
+		{
+			name: "percentile",
+			p:    p,
+			a:    &entity.Aggregation{Bucket: time.Hour, Functions: []string{"p95"}},
+		},
+		{
+			name: "label selector",
+			p:    p,
+			a:    a,
+			sel:  &entity.LabelSelector{GroupBy: []string{"host"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := uc.AggregateMetricValuesForTimePeriod(s.ServiceID, tc.p, m, tc.a, tc.sel)
+			assert.ErrorIs(t, err, repository.ErrRecordNotFound)
+		})
+	}
+}
+
+func TestAppUseCase_AggregateMetricValuesForTimePeriod_PeriodEnd(t *testing.T) {
+	uc, repos := newTestUseCaseWithRepositories(t)
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	m.MetricType = "INT"
+	uc.ServiceCreate(s)
+	uc.MetricCreate(m)
+
+	day := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i, ts := range []time.Time{day, day.Add(30 * time.Minute), day.Add(time.Hour)} {
+		e := &entity.Event{ServiceID: s.ServiceID, TimeStamp: entity.CustomTime{Time: ts}}
+		assert.NoError(t, repos.events.CreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: int64(i)}}))
+	}
+
+	// the value at the end of the period is left out on both paths
+	p := [2]*entity.CustomTime{{Time: day}, {Time: day.Add(time.Hour)}}
+	a := &entity.Aggregation{Bucket: time.Hour, Functions: []string{"count", "max"}}
+	raw, err := uc.AggregateMetricValuesForTimePeriod(s.ServiceID, p, m, a, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []*entity.AggregatedMetric{
+		{TimeStamp: entity.CustomTime{Time: day}, Values: map[string]interface{}{"count": 2, "max": int64(1)}},
+	}, raw)
+
+	_, err = uc.Rollup(time.Minute, day, day.Add(2*time.Hour))
+	assert.NoError(t, err)
+	_, err = uc.Rollup(time.Hour, day, day.Add(2*time.Hour))
+	assert.NoError(t, err)
+	_, err = repos.events.PurgeService(s.ServiceID, day.Add(2*time.Hour), 10)
+	assert.NoError(t, err)
+
+	rollups, err := uc.AggregateMetricValuesForTimePeriod(s.ServiceID, p, m, a, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, rollups)
+}
+
+func TestAppUseCase_Partitions(t *testing.T) {
+	uc := newTestUseCase(t)
+
+	s := entity.TestService(t)
+	uc.ServiceCreate(s)
+	other := uc.ForTenant(entity.DefaultTenantID + 1)
+
+	day := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	p := entity.PartitionAt(day, entity.PartitionMonth)
+	assert.NoError(t, uc.PartitionCreate(p))
+
+	assert.NoError(t, uc.EventCreate(&entity.Event{ServiceID: s.ServiceID, TimeStamp: entity.CustomTime{Time: day}}))
+
+	// partitions are shared by the tenants
+	partitions, err := other.PartitionList()
+	assert.NoError(t, err)
+	assert.Equal(t, []*entity.Partition{p}, partitions)
+
+	assert.NoError(t, other.PartitionDrop(p))
+
+	c, err := uc.ServiceDelete(s.ServiceID, true)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Cascade{}, c)
+}
+
+func TestAppUseCase_AlertRuleCreate(t *testing.T) {
+	uc := newTestUseCase(t)
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	uc.ServiceCreate(s)
+	uc.MetricCreate(m)
+
+	a := entity.TestAlertRule(t)
+	a.ServiceID = s.ServiceID
+	a.MetricID = m.MetricID
+	assert.NoError(t, uc.AlertRuleCreate(a))
+
+	// the threshold of a DURATION metric is a duration
+	a.Threshold = "300"
+	assert.Error(t, uc.AlertRuleUpdate(a))
+
+	a.Threshold = "500ms"
+	assert.NoError(t, uc.AlertRuleUpdate(a))
+
+	other := uc.ForTenant(entity.DefaultTenantID + 1)
+	assert.ErrorIs(t, other.AlertRuleCreate(entity.TestAlertRule(t)), repository.ErrRecordNotFound)
+	assert.ErrorIs(t, other.AlertRuleUpdate(a), repository.ErrRecordNotFound)
+
+	rules, err := other.AlertRuleListAll()
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+}
+
+func TestAppUseCase_AlertEvaluate(t *testing.T) {
+	uc := newTestUseCase(t)
+
+	s := entity.TestService(t)
+	m := entity.TestMetric(t)
+	uc.ServiceCreate(s)
+	uc.MetricCreate(m)
+
+	a := entity.TestAlertRule(t)
+	a.ServiceID = s.ServiceID
+	a.MetricID = m.MetricID
+	uc.AlertRuleCreate(a)
+
+	now := time.Date(2023, 10, 31, 12, 0, 0, 0, time.UTC)
+	add := func(at time.Time, v string) {
+		e := &entity.Event{ServiceID: s.ServiceID, TimeStamp: entity.CustomTime{Time: at}}
+		assert.NoError(t, uc.EventCreateWithMetrics(e, []*entity.AddMetric{{MetricID: m.MetricID, MetricValue: v}}))
+	}
+
+	// an empty window does not hold
+	tr1, err := uc.AlertEvaluate(a, now)
+	assert.NoError(t, err)
+	assert.Nil(t, tr1)
+
+	add(now.Add(-2*time.Minute), "200ms")
+	add(now.Add(-time.Minute), "500ms")
+
+	tr1, err = uc.AlertEvaluate(a, now)
+	assert.NoError(t, err)
+	if assert.NotNil(t, tr1) {
+		assert.Equal(t, entity.AlertPending, tr1.To)
+		assert.Equal(t, "350ms", tr1.Value)
+	}
+
+	add(now.Add(9*time.Minute), "400ms")
+
+	tr1, err = uc.AlertEvaluate(a, now.Add(10*time.Minute))
+	assert.NoError(t, err)
+	if assert.NotNil(t, tr1) {
+		assert.Equal(t, entity.AlertFiring, tr1.To)
+	}
+
+	alerts, err := uc.AlertList()
+	assert.NoError(t, err)
+	assert.Len(t, alerts, 1)
+
+	alerts, err = uc.ForTenant(entity.DefaultTenantID + 1).AlertList()
+	assert.NoError(t, err)
+	assert.Empty(t, alerts)
+
+	// the window slides past the values
+	tr1, err = uc.AlertEvaluate(a, now.Add(20*time.Minute))
+	assert.NoError(t, err)
+	if assert.NotNil(t, tr1) {
+		assert.Equal(t, entity.AlertResolved, tr1.To)
+	}
+
+	history, err := uc.AlertHistory(a.RuleID, 10)
+	assert.NoError(t, err)
+	assert.Len(t, history, 3)
+
+	_, err = uc.ForTenant(entity.DefaultTenantID+1).AlertHistory(a.RuleID, 10)
+	assert.ErrorIs(t, err, repository.ErrRecordNotFound)
+}
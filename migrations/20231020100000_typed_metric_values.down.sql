@@ -0,0 +1,27 @@
+ALTER TABLE events_with_metrics
+    DROP CONSTRAINT events_with_metrics_one_value,
+    ADD COLUMN metric_value VARCHAR(255);
+
+UPDATE events_with_metrics SET metric_value = COALESCE(
+    value_int::text,
+    value_float::text,
+    extract(epoch FROM value_duration)::text || 's',
+    to_char(value_timestamp AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"'),
+    value_bool::text,
+    value_string
+);
+
+INSERT INTO events_with_metrics (event_id, metric_id, metric_value)
+SELECT event_id, metric_id, metric_value FROM events_with_metrics_rejected
+WHERE event_id IN (SELECT event_id FROM events) AND metric_id IN (SELECT metric_id FROM metrics);
+
+ALTER TABLE events_with_metrics
+    ALTER COLUMN metric_value SET NOT NULL,
+    DROP COLUMN value_int,
+    DROP COLUMN value_float,
+    DROP COLUMN value_duration,
+    DROP COLUMN value_timestamp,
+    DROP COLUMN value_bool,
+    DROP COLUMN value_string;
+
+DROP TABLE events_with_metrics_rejected;
@@ -0,0 +1,72 @@
+ALTER TABLE events_with_metrics
+    ADD COLUMN value_int BIGINT,
+    ADD COLUMN value_float DOUBLE PRECISION,
+    ADD COLUMN value_duration INTERVAL,
+    ADD COLUMN value_timestamp TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN value_bool BOOLEAN,
+    ADD COLUMN value_string TEXT;
+
+-- values that do not match the declared metric type are moved here instead of being kept as strings
+CREATE TABLE events_with_metrics_rejected (
+    event_id BIGINT NOT NULL,
+    metric_id BIGINT NOT NULL,
+    metric_type VARCHAR(255) NOT NULL,
+    metric_value VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL,
+    rejected_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (event_id, metric_id)
+);
+
+DO $$
+DECLARE
+    r RECORD;
+    rejected BIGINT := 0;
+BEGIN
+    FOR r IN
+        SELECT ewm.event_id, ewm.metric_id, ewm.metric_value, m.metric_type
+        FROM events_with_metrics ewm JOIN metrics m ON m.metric_id = ewm.metric_id
+    LOOP
+        BEGIN
+            CASE r.metric_type
+                WHEN 'INT' THEN
+                    UPDATE events_with_metrics SET value_int = r.metric_value::bigint
+                    WHERE event_id = r.event_id AND metric_id = r.metric_id;
+                WHEN 'FLOAT' THEN
+                    UPDATE events_with_metrics SET value_float = r.metric_value::double precision
+                    WHERE event_id = r.event_id AND metric_id = r.metric_id;
+                WHEN 'DURATION' THEN
+                    -- durations were stored in the time.Duration.String() format, e.g. 1h13m0.5s or 250µs
+                    UPDATE events_with_metrics SET value_duration = replace(r.metric_value, 'µs', 'us')::interval
+                    WHERE event_id = r.event_id AND metric_id = r.metric_id;
+                WHEN 'TIMESTAMP_WITH_TIMEZONE' THEN
+                    UPDATE events_with_metrics SET value_timestamp = r.metric_value::timestamptz
+                    WHERE event_id = r.event_id AND metric_id = r.metric_id;
+                WHEN 'BOOL' THEN
+                    UPDATE events_with_metrics SET value_bool = r.metric_value::boolean
+                    WHERE event_id = r.event_id AND metric_id = r.metric_id;
+                WHEN 'STRING' THEN
+                    UPDATE events_with_metrics SET value_string = r.metric_value
+                    WHERE event_id = r.event_id AND metric_id = r.metric_id;
+                ELSE
+                    RAISE EXCEPTION 'unknown metric type %', r.metric_type;
+            END CASE;
+        EXCEPTION WHEN others THEN
+            INSERT INTO events_with_metrics_rejected (event_id, metric_id, metric_type, metric_value, reason)
+            VALUES (r.event_id, r.metric_id, r.metric_type, r.metric_value, SQLERRM);
+
+            DELETE FROM events_with_metrics WHERE event_id = r.event_id AND metric_id = r.metric_id;
+
+            rejected := rejected + 1;
+        END;
+    END LOOP;
+
+    IF rejected > 0 THEN
+        RAISE WARNING '% metric values could not be converted, see events_with_metrics_rejected', rejected;
+    END IF;
+END $$;
+
+ALTER TABLE events_with_metrics
+    DROP COLUMN metric_value,
+    ADD CONSTRAINT events_with_metrics_one_value CHECK (
+        num_nonnulls(value_int, value_float, value_duration, value_timestamp, value_bool, value_string) = 1
+    );
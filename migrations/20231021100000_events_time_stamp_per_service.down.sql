@@ -0,0 +1,3 @@
+DROP INDEX events_service_id_time_stamp_idx;
+
+ALTER TABLE events ADD CONSTRAINT events_time_stamp_key UNIQUE (time_stamp);
@@ -0,0 +1,3 @@
+ALTER TABLE events DROP CONSTRAINT events_time_stamp_key;
+
+CREATE INDEX events_service_id_time_stamp_idx ON events (service_id, time_stamp);
@@ -0,0 +1,9 @@
+DROP INDEX events_with_metrics_metric_id_idx;
+
+ALTER TABLE metrics
+    DROP COLUMN archived_at,
+    DROP COLUMN archived;
+
+ALTER TABLE services
+    DROP COLUMN archived_at,
+    DROP COLUMN archived;
@@ -0,0 +1,10 @@
+ALTER TABLE services
+    ADD COLUMN archived BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE metrics
+    ADD COLUMN archived BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE;
+
+-- metric values are looked up by metric when a metric is deleted or its type is changed
+CREATE INDEX events_with_metrics_metric_id_idx ON events_with_metrics (metric_id);
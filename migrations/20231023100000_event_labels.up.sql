@@ -0,0 +1,3 @@
+-- labels of ingested series that are mapped neither to the service nor to the metric, e.g. Prometheus labels
+ALTER TABLE events
+    ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,19 @@
+-- fails if slugs of different tenants collide, they have to be renamed first
+ALTER TABLE api_keys DROP COLUMN tenant_id;
+
+ALTER TABLE events
+    DROP CONSTRAINT events_service_id_tenant_id_fkey,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE metrics
+    DROP CONSTRAINT metrics_tenant_id_slug_key,
+    DROP COLUMN tenant_id,
+    ADD CONSTRAINT metrics_slug_key UNIQUE (slug);
+
+ALTER TABLE services
+    DROP CONSTRAINT services_service_id_tenant_id_key,
+    DROP CONSTRAINT services_tenant_id_slug_key,
+    DROP COLUMN tenant_id,
+    ADD CONSTRAINT services_slug_key UNIQUE (slug);
+
+DROP TABLE tenants;
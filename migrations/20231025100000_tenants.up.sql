@@ -0,0 +1,37 @@
+CREATE TABLE tenants (
+    tenant_id BIGSERIAL PRIMARY KEY,
+    slug VARCHAR(255) NOT NULL UNIQUE,
+    details VARCHAR(255) NOT NULL
+);
+
+-- everything created before tenants belongs to the default tenant
+INSERT INTO tenants (tenant_id, slug, details) VALUES (1, 'DEFAULT', 'Default tenant');
+SELECT setval(pg_get_serial_sequence('tenants', 'tenant_id'), 1);
+
+ALTER TABLE services
+    ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 1 REFERENCES tenants ON DELETE CASCADE,
+    DROP CONSTRAINT services_slug_key,
+    ADD CONSTRAINT services_tenant_id_slug_key UNIQUE (tenant_id, slug),
+    -- referenced by events, so that an event is always in the tenant of its service
+    ADD CONSTRAINT services_service_id_tenant_id_key UNIQUE (service_id, tenant_id);
+
+ALTER TABLE services ALTER COLUMN tenant_id DROP DEFAULT;
+
+ALTER TABLE metrics
+    ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 1 REFERENCES tenants ON DELETE CASCADE,
+    DROP CONSTRAINT metrics_slug_key,
+    ADD CONSTRAINT metrics_tenant_id_slug_key UNIQUE (tenant_id, slug);
+
+ALTER TABLE metrics ALTER COLUMN tenant_id DROP DEFAULT;
+
+ALTER TABLE events
+    ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 1,
+    ADD CONSTRAINT events_service_id_tenant_id_fkey
+        FOREIGN KEY (service_id, tenant_id) REFERENCES services (service_id, tenant_id) ON DELETE CASCADE;
+
+ALTER TABLE events ALTER COLUMN tenant_id DROP DEFAULT;
+
+ALTER TABLE api_keys
+    ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 1 REFERENCES tenants ON DELETE CASCADE;
+
+ALTER TABLE api_keys ALTER COLUMN tenant_id DROP DEFAULT;
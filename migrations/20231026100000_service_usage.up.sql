@@ -0,0 +1,8 @@
+-- events and metric values written to a service a day (UTC), checked against the daily quotas
+CREATE TABLE service_usage (
+    service_id BIGINT REFERENCES services ON DELETE CASCADE NOT NULL,
+    day DATE NOT NULL,
+    events BIGINT NOT NULL DEFAULT 0,
+    metric_values BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (service_id, day)
+);
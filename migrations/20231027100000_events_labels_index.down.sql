@@ -0,0 +1 @@
+DROP INDEX events_labels_idx;
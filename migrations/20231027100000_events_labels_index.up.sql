@@ -0,0 +1,2 @@
+-- label matchers of value queries test the labels of events by containment
+CREATE INDEX events_labels_idx ON events USING GIN (labels jsonb_path_ops);
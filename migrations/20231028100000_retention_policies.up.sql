@@ -0,0 +1,10 @@
+-- a service or a metric has at most one policy, keep_raw is a duration such as 30d
+CREATE TABLE retention_policies (
+    policy_id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL REFERENCES tenants ON DELETE CASCADE,
+    service_id BIGINT UNIQUE REFERENCES services ON DELETE CASCADE,
+    metric_id BIGINT UNIQUE REFERENCES metrics ON DELETE CASCADE,
+    keep_raw VARCHAR(32) NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    CHECK ((service_id IS NULL) <> (metric_id IS NULL))
+);
@@ -0,0 +1,7 @@
+ALTER TABLE retention_policies DROP COLUMN IF EXISTS keep_rollups;
+
+DROP INDEX IF EXISTS events_time_stamp_idx;
+DROP TABLE IF EXISTS rollup_watermarks;
+DROP TABLE IF EXISTS metric_rollups_1d;
+DROP TABLE IF EXISTS metric_rollups_1h;
+DROP TABLE IF EXISTS metric_rollups_1m;
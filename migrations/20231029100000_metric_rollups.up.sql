@@ -0,0 +1,43 @@
+-- values of INT, FLOAT and DURATION metrics aggregated by 1 minute, 1 hour and 1 day, durations in seconds;
+-- last_time_stamp is the time stamp of the last value, so that rollups are rolled up further
+CREATE TABLE metric_rollups_1m (
+    tenant_id BIGINT NOT NULL REFERENCES tenants ON DELETE CASCADE,
+    service_id BIGINT NOT NULL REFERENCES services ON DELETE CASCADE,
+    metric_id BIGINT NOT NULL REFERENCES metrics ON DELETE CASCADE,
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    count BIGINT NOT NULL,
+    sum DOUBLE PRECISION NOT NULL,
+    min DOUBLE PRECISION NOT NULL,
+    max DOUBLE PRECISION NOT NULL,
+    last DOUBLE PRECISION NOT NULL,
+    last_time_stamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (service_id, metric_id, bucket)
+);
+
+CREATE TABLE metric_rollups_1h (LIKE metric_rollups_1m INCLUDING ALL);
+CREATE TABLE metric_rollups_1d (LIKE metric_rollups_1m INCLUDING ALL);
+
+ALTER TABLE metric_rollups_1h
+    ADD FOREIGN KEY (tenant_id) REFERENCES tenants ON DELETE CASCADE,
+    ADD FOREIGN KEY (service_id) REFERENCES services ON DELETE CASCADE,
+    ADD FOREIGN KEY (metric_id) REFERENCES metrics ON DELETE CASCADE;
+
+ALTER TABLE metric_rollups_1d
+    ADD FOREIGN KEY (tenant_id) REFERENCES tenants ON DELETE CASCADE,
+    ADD FOREIGN KEY (service_id) REFERENCES services ON DELETE CASCADE,
+    ADD FOREIGN KEY (metric_id) REFERENCES metrics ON DELETE CASCADE;
+
+CREATE INDEX metric_rollups_1m_bucket_idx ON metric_rollups_1m (bucket);
+CREATE INDEX metric_rollups_1h_bucket_idx ON metric_rollups_1h (bucket);
+CREATE INDEX metric_rollups_1d_bucket_idx ON metric_rollups_1d (bucket);
+
+-- the rollups of a resolution are complete before its watermark
+CREATE TABLE rollup_watermarks (
+    resolution VARCHAR(8) PRIMARY KEY,
+    watermark TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX events_time_stamp_idx ON events (time_stamp);
+
+ALTER TABLE retention_policies
+    ADD COLUMN keep_rollups JSONB NOT NULL DEFAULT '{}';
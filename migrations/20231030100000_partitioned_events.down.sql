@@ -0,0 +1,52 @@
+-- events are moved back to plain tables, every partition is dropped along with the partitioned tables
+CREATE TABLE events_unpartitioned (
+    event_id BIGINT PRIMARY KEY DEFAULT nextval('events_event_id_seq'),
+    time_stamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    service_id BIGINT NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    tenant_id BIGINT NOT NULL
+);
+
+INSERT INTO events_unpartitioned (event_id, time_stamp, service_id, labels, tenant_id)
+SELECT event_id, time_stamp, service_id, labels, tenant_id FROM events;
+
+CREATE TABLE events_with_metrics_unpartitioned (
+    event_id BIGINT REFERENCES events_unpartitioned ON DELETE CASCADE,
+    metric_id BIGINT REFERENCES metrics ON DELETE CASCADE,
+    value_int BIGINT,
+    value_float DOUBLE PRECISION,
+    value_duration INTERVAL,
+    value_timestamp TIMESTAMP WITH TIME ZONE,
+    value_bool BOOLEAN,
+    value_string TEXT,
+    PRIMARY KEY (event_id, metric_id),
+    CONSTRAINT events_with_metrics_one_value CHECK (
+        num_nonnulls(value_int, value_float, value_duration, value_timestamp, value_bool, value_string) = 1
+    )
+);
+
+INSERT INTO events_with_metrics_unpartitioned (event_id, metric_id, value_int, value_float, value_duration, value_timestamp, value_bool, value_string)
+SELECT event_id, metric_id, value_int, value_float, value_duration, value_timestamp, value_bool, value_string FROM events_with_metrics;
+
+ALTER SEQUENCE events_event_id_seq OWNED BY events_unpartitioned.event_id;
+
+DROP TABLE event_partitions;
+DROP TABLE events_with_metrics;
+DROP TABLE events;
+
+ALTER TABLE events_unpartitioned RENAME TO events;
+ALTER TABLE events_with_metrics_unpartitioned RENAME TO events_with_metrics;
+
+ALTER INDEX events_unpartitioned_pkey RENAME TO events_pkey;
+ALTER INDEX events_with_metrics_unpartitioned_pkey RENAME TO events_with_metrics_pkey;
+ALTER TABLE events_with_metrics RENAME CONSTRAINT events_with_metrics_unpartitioned_event_id_fkey TO events_with_metrics_event_id_fkey;
+ALTER TABLE events_with_metrics RENAME CONSTRAINT events_with_metrics_unpartitioned_metric_id_fkey TO events_with_metrics_metric_id_fkey;
+
+ALTER TABLE events
+    ADD CONSTRAINT events_service_id_tenant_id_fkey
+        FOREIGN KEY (service_id, tenant_id) REFERENCES services (service_id, tenant_id) ON DELETE CASCADE;
+
+CREATE INDEX events_service_id_time_stamp_idx ON events (service_id, time_stamp);
+CREATE INDEX events_labels_idx ON events USING GIN (labels jsonb_path_ops);
+CREATE INDEX events_time_stamp_idx ON events (time_stamp);
+CREATE INDEX events_with_metrics_metric_id_idx ON events_with_metrics (metric_id);
@@ -0,0 +1,98 @@
+-- events and their metric values are partitioned by time stamp, so that expired ones are dropped with their partitions;
+-- the keys of a partitioned table include the partition key, so the values repeat the time stamp of their event
+ALTER TABLE events RENAME TO events_unpartitioned;
+ALTER TABLE events_with_metrics RENAME TO events_with_metrics_unpartitioned;
+
+ALTER INDEX events_pkey RENAME TO events_unpartitioned_pkey;
+ALTER INDEX events_service_id_time_stamp_idx RENAME TO events_unpartitioned_service_id_time_stamp_idx;
+ALTER INDEX events_labels_idx RENAME TO events_unpartitioned_labels_idx;
+ALTER INDEX events_time_stamp_idx RENAME TO events_unpartitioned_time_stamp_idx;
+ALTER INDEX events_with_metrics_pkey RENAME TO events_with_metrics_unpartitioned_pkey;
+ALTER INDEX events_with_metrics_metric_id_idx RENAME TO events_with_metrics_unpartitioned_metric_id_idx;
+
+CREATE TABLE events (
+    event_id BIGINT NOT NULL DEFAULT nextval('events_event_id_seq'),
+    time_stamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    service_id BIGINT NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    tenant_id BIGINT NOT NULL,
+    PRIMARY KEY (event_id, time_stamp),
+    CONSTRAINT events_service_id_tenant_id_fkey
+        FOREIGN KEY (service_id, tenant_id) REFERENCES services (service_id, tenant_id) ON DELETE CASCADE
+) PARTITION BY RANGE (time_stamp);
+
+-- the sequence would be dropped with the old table otherwise
+ALTER SEQUENCE events_event_id_seq OWNED BY events.event_id;
+
+CREATE INDEX events_service_id_time_stamp_idx ON events (service_id, time_stamp);
+CREATE INDEX events_labels_idx ON events USING GIN (labels jsonb_path_ops);
+CREATE INDEX events_time_stamp_idx ON events (time_stamp);
+
+CREATE TABLE events_with_metrics (
+    event_id BIGINT NOT NULL,
+    metric_id BIGINT NOT NULL REFERENCES metrics ON DELETE CASCADE,
+    time_stamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    value_int BIGINT,
+    value_float DOUBLE PRECISION,
+    value_duration INTERVAL,
+    value_timestamp TIMESTAMP WITH TIME ZONE,
+    value_bool BOOLEAN,
+    value_string TEXT,
+    PRIMARY KEY (event_id, metric_id, time_stamp),
+    FOREIGN KEY (event_id, time_stamp) REFERENCES events (event_id, time_stamp) ON DELETE CASCADE,
+    CONSTRAINT events_with_metrics_one_value CHECK (
+        num_nonnulls(value_int, value_float, value_duration, value_timestamp, value_bool, value_string) = 1
+    )
+) PARTITION BY RANGE (time_stamp);
+
+CREATE INDEX events_with_metrics_metric_id_idx ON events_with_metrics (metric_id, time_stamp);
+
+-- the partitions of events and of events_with_metrics named after the start of their time, e.g. events_p20231001
+CREATE TABLE event_partitions (
+    partition_from TIMESTAMP WITH TIME ZONE PRIMARY KEY,
+    partition_to TIMESTAMP WITH TIME ZONE NOT NULL,
+    CHECK (partition_from < partition_to)
+);
+
+CREATE TABLE events_default PARTITION OF events DEFAULT;
+CREATE TABLE events_with_metrics_default PARTITION OF events_with_metrics DEFAULT;
+
+-- existing events get monthly partitions up to the next month, the app creates further ones
+DO $$
+DECLARE
+    partition_from TIMESTAMP WITH TIME ZONE;
+    partition_until TIMESTAMP WITH TIME ZONE;
+    suffix TEXT;
+BEGIN
+    -- months are added in UTC
+    PERFORM set_config('TimeZone', 'UTC', true);
+    partition_until := date_trunc('month', now()) + INTERVAL '1 month';
+
+    SELECT date_trunc('month', min(time_stamp)) INTO partition_from FROM events_unpartitioned;
+    IF partition_from IS NULL OR partition_from > partition_until THEN
+        partition_from := partition_until;
+    END IF;
+
+    WHILE partition_from <= partition_until LOOP
+        suffix := to_char(partition_from, 'YYYYMMDD');
+
+        EXECUTE format('CREATE TABLE %I PARTITION OF events FOR VALUES FROM (%L) TO (%L)',
+            'events_p' || suffix, partition_from, partition_from + INTERVAL '1 month');
+        EXECUTE format('CREATE TABLE %I PARTITION OF events_with_metrics FOR VALUES FROM (%L) TO (%L)',
+            'events_with_metrics_p' || suffix, partition_from, partition_from + INTERVAL '1 month');
+
+        INSERT INTO event_partitions VALUES (partition_from, partition_from + INTERVAL '1 month');
+
+        partition_from := partition_from + INTERVAL '1 month';
+    END LOOP;
+END $$;
+
+INSERT INTO events (event_id, time_stamp, service_id, labels, tenant_id)
+SELECT event_id, time_stamp, service_id, labels, tenant_id FROM events_unpartitioned;
+
+INSERT INTO events_with_metrics (event_id, metric_id, time_stamp, value_int, value_float, value_duration, value_timestamp, value_bool, value_string)
+SELECT ewm.event_id, ewm.metric_id, e.time_stamp, ewm.value_int, ewm.value_float, ewm.value_duration, ewm.value_timestamp, ewm.value_bool, ewm.value_string
+FROM events_with_metrics_unpartitioned ewm JOIN events_unpartitioned e ON e.event_id = ewm.event_id;
+
+DROP TABLE events_with_metrics_unpartitioned;
+DROP TABLE events_unpartitioned;
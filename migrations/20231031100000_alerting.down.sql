@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS alert_history;
+DROP TABLE IF EXISTS alert_states;
+DROP TABLE IF EXISTS alert_rules;
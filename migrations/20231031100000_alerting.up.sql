@@ -0,0 +1,37 @@
+-- time_window and for_duration are durations such as 5m, the threshold depends on the operator
+CREATE TABLE alert_rules (
+    rule_id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL REFERENCES tenants ON DELETE CASCADE,
+    rule_name VARCHAR(255) NOT NULL,
+    service_id BIGINT NOT NULL REFERENCES services ON DELETE CASCADE,
+    metric_id BIGINT NOT NULL REFERENCES metrics ON DELETE CASCADE,
+    function VARCHAR(32) NOT NULL,
+    time_window VARCHAR(32) NOT NULL,
+    operator VARCHAR(32) NOT NULL,
+    threshold TEXT NOT NULL DEFAULT '',
+    for_duration VARCHAR(32) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX alert_rules_tenant_id_idx ON alert_rules (tenant_id);
+
+-- the state of a rule after its last evaluation, a rule without one is ok
+CREATE TABLE alert_states (
+    rule_id BIGINT PRIMARY KEY REFERENCES alert_rules ON DELETE CASCADE,
+    state VARCHAR(16) NOT NULL,
+    value TEXT NOT NULL DEFAULT '',
+    active_at TIMESTAMP WITH TIME ZONE,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    evaluated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE alert_history (
+    transition_id BIGSERIAL PRIMARY KEY,
+    rule_id BIGINT NOT NULL REFERENCES alert_rules ON DELETE CASCADE,
+    state_from VARCHAR(16) NOT NULL,
+    state_to VARCHAR(16) NOT NULL,
+    value TEXT NOT NULL DEFAULT '',
+    time_stamp TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX alert_history_rule_id_time_stamp_idx ON alert_history (rule_id, time_stamp DESC);
@@ -0,0 +1,9 @@
+-- minutes of the values written behind the watermark of the finest rollups, they are rolled up again
+-- and queries read the raw values of their services until then
+CREATE TABLE rollup_late_values (
+    service_id BIGINT NOT NULL REFERENCES services ON DELETE CASCADE,
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (service_id, bucket)
+);
+
+CREATE INDEX rollup_late_values_bucket_idx ON rollup_late_values (bucket);